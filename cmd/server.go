@@ -6,18 +6,80 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"log/slog"
+	"net/netip"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/coocood/freecache"
 	"github.com/spf13/cobra"
 
 	"github.com/danvergara/jumble-proxy-server/pkg/config"
+	"github.com/danvergara/jumble-proxy-server/pkg/logging"
+	"github.com/danvergara/jumble-proxy-server/pkg/nostr"
+	"github.com/danvergara/jumble-proxy-server/pkg/oembed"
 	"github.com/danvergara/jumble-proxy-server/pkg/server"
 )
 
 var (
-	port string
+	port             string
+	listen           string
+	socketMode       string
+	logLevel         string
+	logFormat        string
+	logSampleRate    string
+	githubToken      string
+	shutdownDelay    string
+	shutdownTimeout  string
+	tlsCertFile      string
+	tlsKeyFile       string
+	tlsMinVersion    string
+	tlsCipherSuites  string
+	adminClientCA    string
+	adminAddr        string
+	adminToken       string
+	batchMaxURLs     string
+	batchConcurrency string
+	batchItemTimeout string
+	allowPrivate     string
+	imageMaxBytes    string
+	imageMaxPixels   string
+	rawPassthrough   string
+	headMaxBytes     string
+	feedMaxBytes     string
+	youtubeAPIKey    string
+	youtubeAPIBase   string
+	youtubeOEmbed    string
+	twitterSyndicate string
+	twitterOEmbed    string
+	blueskyAppView   string
+	npmRegistry      string
+	npmDownloads     string
+	pypiAPI          string
+	pypiStats        string
+	cratesIO         string
+	goProxy          string
+	depsDev          string
+	dockerHub        string
+	mediaWikiHosts   string
+	mediaWikiAPI     string
+	nostrRelays      string
+	nip05TTL         string
+	nip05NegativeTTL string
+	relayInfoTTL     string
+	lnurlTTL         string
+	nip98Auth        string
+	nip98Allowed     string
+	nip98Denied      string
+	nip98RateLimit   string
+	nip98AnonLimit   string
+	nip98TimeWindow  string
+	publicURL        string
+	trustedProxies   string
+	blossomVerifyMax string
+	ipfsGateway      string
+	oembedProviders  string
 )
 
 // serverCmd represents the server command
@@ -31,17 +93,229 @@ so that the client can show the URL preview from links' Open Graph data.`,
 			port = "8000"
 		}
 
-		jsonHandler := slog.NewJSONHandler(os.Stderr, nil)
+		logger, err := logging.New(os.Stderr, logLevel, logFormat)
+		if err != nil {
+			return err
+		}
+
+		sampleRate := 1.0
+		if logSampleRate != "" {
+			sampleRate, err = strconv.ParseFloat(logSampleRate, 64)
+			if err != nil {
+				return fmt.Errorf("invalid ACCESS_LOG_SAMPLE_RATE %q: %w", logSampleRate, err)
+			}
+		}
+
+		delay, err := parseDuration("SHUTDOWN_DELAY", shutdownDelay, 5*time.Second)
+		if err != nil {
+			return err
+		}
+
+		timeout, err := parseDuration("SHUTDOWN_TIMEOUT", shutdownTimeout, 10*time.Second)
+		if err != nil {
+			return err
+		}
+
+		maxBytes, err := parseInt("IMAGE_MAX_BYTES", imageMaxBytes, 10<<20)
+		if err != nil {
+			return err
+		}
+
+		maxPixels, err := parseInt("IMAGE_MAX_PIXELS", imageMaxPixels, 50_000_000)
+		if err != nil {
+			return err
+		}
+
+		headMax, err := parseInt("SITES_HEAD_MAX_BYTES", headMaxBytes, 1<<20)
+		if err != nil {
+			return err
+		}
+
+		feedMax, err := parseInt("FEED_MAX_BYTES", feedMaxBytes, 5<<20)
+		if err != nil {
+			return err
+		}
+
+		blossomMax, err := parseInt("BLOSSOM_VERIFY_MAX_BYTES", blossomVerifyMax, 5<<20)
+		if err != nil {
+			return err
+		}
+
+		batchMax, err := parseInt("BATCH_MAX_URLS", batchMaxURLs, 50)
+		if err != nil {
+			return err
+		}
+
+		batchWorkers, err := parseInt("BATCH_CONCURRENCY", batchConcurrency, 8)
+		if err != nil {
+			return err
+		}
+
+		batchTimeout, err := parseDuration("BATCH_ITEM_TIMEOUT", batchItemTimeout, 10*time.Second)
+		if err != nil {
+			return err
+		}
+
+		nip05CacheTTL, err := parseDuration("NIP05_CACHE_TTL", nip05TTL, time.Hour)
+		if err != nil {
+			return err
+		}
+
+		nip05NegativeCacheTTL, err := parseDuration("NIP05_NEGATIVE_CACHE_TTL", nip05NegativeTTL, 5*time.Minute)
+		if err != nil {
+			return err
+		}
+
+		relayInfoCacheTTL, err := parseDuration("RELAY_INFO_CACHE_TTL", relayInfoTTL, time.Hour)
+		if err != nil {
+			return err
+		}
+
+		lnurlCacheTTL, err := parseDuration("LNURL_CACHE_TTL", lnurlTTL, 10*time.Minute)
+		if err != nil {
+			return err
+		}
+
+		authRateLimit, err := parseInt("NIP98_RATE_LIMIT", nip98RateLimit, 0)
+		if err != nil {
+			return err
+		}
+
+		anonymousRateLimit, err := parseInt("NIP98_ANONYMOUS_RATE_LIMIT", nip98AnonLimit, 0)
+		if err != nil {
+			return err
+		}
+
+		authTimeWindow, err := parseDuration("NIP98_TIME_WINDOW", nip98TimeWindow, time.Minute)
+		if err != nil {
+			return err
+		}
+
+		// LISTEN takes precedence over PORT, which only supports TCP on every interface.
+		if listen == "" {
+			listen = ":" + port
+		}
+
+		listener, err := config.ParseListener(listen)
+		if err != nil {
+			return fmt.Errorf("invalid LISTEN: %w", err)
+		}
+
+		var adminListener config.Listener
+		if adminAddr != "" {
+			adminListener, err = config.ParseListener(adminAddr)
+			if err != nil {
+				return fmt.Errorf("invalid ADMIN_ADDR: %w", err)
+			}
+		}
+
+		if socketMode != "" {
+			mode, err := strconv.ParseUint(socketMode, 8, 32)
+			if err != nil {
+				return fmt.Errorf("invalid SOCKET_MODE %q: %w", socketMode, err)
+			}
+			listener.SocketMode = os.FileMode(mode)
+			adminListener.SocketMode = os.FileMode(mode)
+		}
+
+		var cipherSuites []string
+		if tlsCipherSuites != "" {
+			cipherSuites = strings.Split(tlsCipherSuites, ",")
+		}
+
+		proxies, err := parsePrefixes("TRUSTED_PROXIES", trustedProxies)
+		if err != nil {
+			return err
+		}
+
+		var relays []string
+		if nostrRelays != "" {
+			relays = strings.Split(nostrRelays, ",")
+		}
+
+		var wikiHosts []string
+		if mediaWikiHosts != "" {
+			wikiHosts = strings.Split(mediaWikiHosts, ",")
+		}
+
+		allowedPubKeys, err := parsePubKeys("NIP98_ALLOWED_PUBKEYS", nip98Allowed)
+		if err != nil {
+			return err
+		}
 
-		logger := slog.New(jsonHandler)
+		deniedPubKeys, err := parsePubKeys("NIP98_DENIED_PUBKEYS", nip98Denied)
+		if err != nil {
+			return err
+		}
+
+		embedProviders, err := readOEmbedProviders("OEMBED_PROVIDERS_FILE", oembedProviders)
+		if err != nil {
+			return err
+		}
 
 		cfg := config.Config{
-			Port:   port,
-			Logger: logger,
-			Cache:  freecache.NewCache(100 * 1024 * 1024),
+			Listen:                  listener,
+			Logger:                  logger,
+			Cache:                   freecache.NewCache(100 * 1024 * 1024),
+			PublicURL:               publicURL,
+			TrustedProxies:          proxies,
+			AdminListen:             adminListener,
+			AdminToken:              adminToken,
+			TLSCertFile:             tlsCertFile,
+			TLSKeyFile:              tlsKeyFile,
+			TLSMinVersion:           tlsMinVersion,
+			TLSCipherSuites:         cipherSuites,
+			AdminClientCAFile:       adminClientCA,
+			GitHubToken:             githubToken,
+			AccessLogSampleRate:     sampleRate,
+			AllowPrivateNetworks:    allowPrivate == "true",
+			RawPassthrough:          rawPassthrough == "true",
+			HeadMaxBytes:            int64(headMax),
+			FeedMaxBytes:            int64(feedMax),
+			OEmbedProviders:         embedProviders,
+			YouTubeAPIKey:           youtubeAPIKey,
+			YouTubeAPIBaseURL:       youtubeAPIBase,
+			YouTubeOEmbedURL:        youtubeOEmbed,
+			TwitterSyndicationURL:   twitterSyndicate,
+			TwitterOEmbedURL:        twitterOEmbed,
+			IPFSGatewayURL:          ipfsGateway,
+			BlueskyAppViewURL:       blueskyAppView,
+			NPMRegistryURL:          npmRegistry,
+			NPMDownloadsURL:         npmDownloads,
+			PyPIURL:                 pypiAPI,
+			PyPIStatsURL:            pypiStats,
+			CratesIOURL:             cratesIO,
+			GoProxyURL:              goProxy,
+			DepsDevURL:              depsDev,
+			DockerHubURL:            dockerHub,
+			MediaWikiHosts:          wikiHosts,
+			MediaWikiAPIURL:         mediaWikiAPI,
+			NostrRelays:             relays,
+			NIP05CacheTTL:           nip05CacheTTL,
+			NIP05NegativeCacheTTL:   nip05NegativeCacheTTL,
+			RelayInfoCacheTTL:       relayInfoCacheTTL,
+			LNURLCacheTTL:           lnurlCacheTTL,
+			BlossomVerifyMaxBytes:   int64(blossomMax),
+			NIP98Auth:               nip98Auth,
+			NIP98AllowedPubKeys:     allowedPubKeys,
+			NIP98DeniedPubKeys:      deniedPubKeys,
+			NIP98RateLimit:          authRateLimit,
+			NIP98AnonymousRateLimit: anonymousRateLimit,
+			NIP98TimeWindow:         authTimeWindow,
+			ImageMaxBytes:           int64(maxBytes),
+			ImageMaxPixels:          int64(maxPixels),
+			BatchMaxURLs:            batchMax,
+			BatchConcurrency:        batchWorkers,
+			BatchItemTimeout:        batchTimeout,
+			ShutdownDelay:           delay,
+			ShutdownTimeout:         timeout,
 		}
 
-		logger.Info(fmt.Sprintf("Server listening on port %s", port))
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		logger.Info(fmt.Sprintf("Server listening on %s", listener))
 
 		ctx := context.Background()
 		if err := server.Run(ctx, &cfg); err != nil {
@@ -57,4 +331,156 @@ func init() {
 	rootCmd.AddCommand(serverCmd)
 
 	port = os.Getenv("PORT")
+	listen = os.Getenv("LISTEN")
+	socketMode = os.Getenv("SOCKET_MODE")
+	logLevel = os.Getenv("LOG_LEVEL")
+	logFormat = os.Getenv("LOG_FORMAT")
+	logSampleRate = os.Getenv("ACCESS_LOG_SAMPLE_RATE")
+	githubToken = os.Getenv("JUMBLE_PROXY_GITHUB_TOKEN")
+	shutdownDelay = os.Getenv("SHUTDOWN_DELAY")
+	shutdownTimeout = os.Getenv("SHUTDOWN_TIMEOUT")
+	tlsCertFile = os.Getenv("TLS_CERT_FILE")
+	tlsKeyFile = os.Getenv("TLS_KEY_FILE")
+	tlsMinVersion = os.Getenv("TLS_MIN_VERSION")
+	tlsCipherSuites = os.Getenv("TLS_CIPHER_SUITES")
+	adminClientCA = os.Getenv("ADMIN_CLIENT_CA_FILE")
+	adminAddr = os.Getenv("ADMIN_ADDR")
+	adminToken = os.Getenv("ADMIN_TOKEN")
+	batchMaxURLs = os.Getenv("BATCH_MAX_URLS")
+	batchConcurrency = os.Getenv("BATCH_CONCURRENCY")
+	batchItemTimeout = os.Getenv("BATCH_ITEM_TIMEOUT")
+	allowPrivate = os.Getenv("OUTBOUND_ALLOW_PRIVATE_NETWORKS")
+	imageMaxBytes = os.Getenv("IMAGE_MAX_BYTES")
+	imageMaxPixels = os.Getenv("IMAGE_MAX_PIXELS")
+	rawPassthrough = os.Getenv("SITES_RAW_PASSTHROUGH")
+	headMaxBytes = os.Getenv("SITES_HEAD_MAX_BYTES")
+	feedMaxBytes = os.Getenv("FEED_MAX_BYTES")
+	youtubeAPIKey = os.Getenv("YOUTUBE_API_KEY")
+	youtubeAPIBase = os.Getenv("YOUTUBE_API_BASE_URL")
+	youtubeOEmbed = os.Getenv("YOUTUBE_OEMBED_URL")
+	twitterSyndicate = os.Getenv("TWITTER_SYNDICATION_URL")
+	twitterOEmbed = os.Getenv("TWITTER_OEMBED_URL")
+	blueskyAppView = os.Getenv("BLUESKY_APPVIEW_URL")
+	npmRegistry = os.Getenv("NPM_REGISTRY_URL")
+	npmDownloads = os.Getenv("NPM_DOWNLOADS_URL")
+	pypiAPI = os.Getenv("PYPI_URL")
+	pypiStats = os.Getenv("PYPISTATS_URL")
+	cratesIO = os.Getenv("CRATES_IO_URL")
+	goProxy = os.Getenv("GO_PROXY_URL")
+	depsDev = os.Getenv("DEPS_DEV_URL")
+	dockerHub = os.Getenv("DOCKER_HUB_URL")
+	mediaWikiHosts = os.Getenv("MEDIAWIKI_HOSTS")
+	mediaWikiAPI = os.Getenv("MEDIAWIKI_API_URL")
+	nostrRelays = os.Getenv("NOSTR_RELAYS")
+	nip05TTL = os.Getenv("NIP05_CACHE_TTL")
+	nip05NegativeTTL = os.Getenv("NIP05_NEGATIVE_CACHE_TTL")
+	relayInfoTTL = os.Getenv("RELAY_INFO_CACHE_TTL")
+	lnurlTTL = os.Getenv("LNURL_CACHE_TTL")
+	nip98Auth = os.Getenv("NIP98_AUTH")
+	nip98Allowed = os.Getenv("NIP98_ALLOWED_PUBKEYS")
+	nip98Denied = os.Getenv("NIP98_DENIED_PUBKEYS")
+	nip98RateLimit = os.Getenv("NIP98_RATE_LIMIT")
+	nip98AnonLimit = os.Getenv("NIP98_ANONYMOUS_RATE_LIMIT")
+	nip98TimeWindow = os.Getenv("NIP98_TIME_WINDOW")
+	publicURL = os.Getenv("PUBLIC_URL")
+	trustedProxies = os.Getenv("TRUSTED_PROXIES")
+	blossomVerifyMax = os.Getenv("BLOSSOM_VERIFY_MAX_BYTES")
+	ipfsGateway = os.Getenv("IPFS_GATEWAY_URL")
+	oembedProviders = os.Getenv("OEMBED_PROVIDERS_FILE")
+}
+
+// parseDuration parses the value of the name environment variable, returning def when it is empty.
+func parseDuration(name, value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, value, err)
+	}
+
+	return d, nil
+}
+
+// parsePrefixes parses the comma separated addresses and CIDR prefixes of the name environment variable.
+func parsePrefixes(name, value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+
+		if addr, err := netip.ParseAddr(s); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", name, s, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// parsePubKeys parses the comma separated hex or npub public keys of the name environment variable,
+// returning them in hex.
+func parsePubKeys(name, value string) ([]string, error) {
+	var pubkeys []string
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+
+		pubkey, err := nostr.ParsePubKey(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", name, s, err)
+		}
+		pubkeys = append(pubkeys, pubkey)
+	}
+
+	return pubkeys, nil
+}
+
+// readOEmbedProviders reads the oEmbed provider table at the path of the name environment variable,
+// returning nil, and so the built-in table, when it is empty.
+func readOEmbedProviders(name, path string) ([]config.OEmbedProvider, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	defer f.Close()
+
+	ps, err := oembed.ReadProviders(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %w", name, path, err)
+	}
+
+	providers := make([]config.OEmbedProvider, len(ps))
+	for i, p := range ps {
+		providers[i] = config.OEmbedProvider(p)
+	}
+
+	return providers, nil
+}
+
+// parseInt parses the value of the name environment variable, returning def when it is empty.
+func parseInt(name, value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, value, err)
+	}
+
+	return n, nil
 }
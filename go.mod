@@ -3,13 +3,20 @@ module github.com/danvergara/jumble-proxy-server
 go 1.24.2
 
 require (
+	github.com/btcsuite/btcd/btcec/v2 v2.3.4
 	github.com/coocood/freecache v1.2.4
 	github.com/google/go-github/v74 v74.0.0
 	github.com/spf13/cobra v1.9.1
+	golang.org/x/image v0.33.0
+	golang.org/x/net v0.47.0
+	golang.org/x/text v0.31.0
 )
 
 require (
+	github.com/btcsuite/btcd/chaincfg/chainhash v1.0.1 // indirect
 	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/decred/dcrd/crypto/blake256 v1.0.0 // indirect
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
 	github.com/google/go-querystring v1.1.0 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.6 // indirect
@@ -0,0 +1,133 @@
+// Package bech32 encodes and decodes the bech32 strings of BIP-173,
+// as used by Nostr NIP-19 entities and LNURLs, without their length limit.
+package bech32
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// MaxLength caps the length of the strings decoded. NIP-19 entities and LNURLs are not bound
+// by the 90 characters of BIP-173.
+const MaxLength = 5000
+
+func polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := range 5 {
+			if (top>>i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+
+	return chk
+}
+
+func expandPrefix(prefix string) []byte {
+	out := make([]byte, 0, len(prefix)*2+1)
+	for i := range len(prefix) {
+		out = append(out, prefix[i]>>5)
+	}
+	out = append(out, 0)
+	for i := range len(prefix) {
+		out = append(out, prefix[i]&31)
+	}
+	return out
+}
+
+// Decode returns the human readable part and the 8-bit data of the bech32 string s.
+// Upper case strings are accepted, mixed case ones are not. The prefix is returned in lower case.
+func Decode(s string) (string, []byte, error) {
+	if len(s) > MaxLength {
+		return "", nil, errors.New("bech32 string too long")
+	}
+
+	if lower := strings.ToLower(s); lower != s {
+		if strings.ToUpper(s) != s {
+			return "", nil, errors.New("mixed case bech32 string")
+		}
+		s = lower
+	}
+
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || sep+7 > len(s) {
+		return "", nil, errors.New("invalid bech32 separator position")
+	}
+
+	prefix := s[:sep]
+	values := make([]byte, 0, len(s)-sep-1)
+	for i := sep + 1; i < len(s); i++ {
+		v := strings.IndexByte(charset, s[i])
+		if v < 0 {
+			return "", nil, fmt.Errorf("invalid bech32 character %q", s[i])
+		}
+		values = append(values, byte(v))
+	}
+
+	if polymod(append(expandPrefix(prefix), values...)) != 1 {
+		return "", nil, errors.New("invalid bech32 checksum")
+	}
+
+	data, err := convertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return prefix, data, nil
+}
+
+// Encode returns the bech32 string of the 8-bit data with the human readable part prefix.
+func Encode(prefix string, data []byte) (string, error) {
+	values, err := convertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	checksum := polymod(append(append(expandPrefix(prefix), values...), 0, 0, 0, 0, 0, 0)) ^ 1
+	for i := range 6 {
+		values = append(values, byte(checksum>>(5*(5-i)))&31)
+	}
+
+	var b strings.Builder
+	b.WriteString(prefix)
+	b.WriteByte('1')
+	for _, v := range values {
+		b.WriteByte(charset[v])
+	}
+
+	return b.String(), nil
+}
+
+// convertBits regroups data from groups of from bits into groups of to bits.
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	var acc, bits uint
+	maxv := uint(1)<<to - 1
+	out := make([]byte, 0, len(data)*int(from)/int(to)+1)
+
+	for _, v := range data {
+		acc = acc<<from | uint(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil, errors.New("invalid bech32 padding")
+	}
+
+	return out, nil
+}
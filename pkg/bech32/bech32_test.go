@@ -0,0 +1,63 @@
+package bech32
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		prefix  string
+		data    []byte
+		wantErr bool
+	}{
+		{name: "empty data", s: "a12uel5l", prefix: "a", data: []byte{}},
+		{name: "upper case", s: "A12UEL5L", prefix: "a", data: []byte{}},
+		{
+			name:   "npub",
+			s:      "npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg",
+			prefix: "npub",
+			data: []byte{
+				0x7e, 0x7e, 0x9c, 0x42, 0xa9, 0x1b, 0xfe, 0xf1, 0x9f, 0xa9, 0x29, 0xe5, 0xfd, 0xa1, 0xb7, 0x2e,
+				0x0e, 0xbc, 0x1a, 0x4c, 0x11, 0x41, 0x67, 0x3e, 0x27, 0x94, 0x23, 0x4d, 0x86, 0xad, 0xdf, 0x4e,
+			},
+		},
+		{name: "mixed case", s: "A12uEL5L", wantErr: true},
+		{name: "invalid checksum", s: "a12uel5m", wantErr: true},
+		{name: "invalid character", s: "a1b2uel5l", wantErr: true},
+		{name: "no separator", s: "pzry9x0s0muk", wantErr: true},
+		{name: "too long", s: "a1" + strings.Repeat("q", MaxLength), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix, data, err := Decode(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if prefix != tt.prefix || !bytes.Equal(data, tt.data) {
+				t.Errorf("Decode() = %s, %x, expected %s, %x", prefix, data, tt.prefix, tt.data)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	data := []byte("https://example.com/.well-known/lnurlp/bob")
+
+	s, err := Encode("lnurl", data)
+	if err != nil {
+		t.Fatalf("Encode() unexpected error: %v", err)
+	}
+
+	prefix, decoded, err := Decode(strings.ToUpper(s))
+	if err != nil {
+		t.Fatalf("Decode() unexpected error: %v", err)
+	}
+	if prefix != "lnurl" || !bytes.Equal(decoded, data) {
+		t.Errorf("Decode(Encode()) = %s, %s, expected lnurl, %s", prefix, decoded, data)
+	}
+}
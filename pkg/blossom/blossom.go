@@ -0,0 +1,360 @@
+// Package blossom builds link previews of media blobs addressed by their SHA-256 hash,
+// as served by Blossom servers (BUD-01) and NIP-96 file storage servers.
+// The blobs themselves are never proxied: the preview only describes their type and size,
+// with a thumbnail served through the image proxy.
+package blossom
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+	"github.com/danvergara/jumble-proxy-server/pkg/outbound"
+)
+
+// DefaultVerifyMaxBytes is the size up to which blobs are downloaded to verify their hash.
+const DefaultVerifyMaxBytes = 5 << 20
+
+// ErrHashMismatch is returned when a Blossom server serves a blob that does not hash to its address.
+var ErrHashMismatch = errors.New("blob does not match its hash")
+
+// blobName matches the last path segment of a blob URL: the hex SHA-256 of the blob and an optional extension.
+var blobName = regexp.MustCompile(`^([0-9a-f]{64})(\.[A-Za-z0-9]{1,10})?$`)
+
+// Blob is a media blob addressed by its hash.
+type Blob struct {
+	URL string
+	// Hash is the hex SHA-256 the URL addresses the blob by.
+	Hash string
+	// Ext is the file extension of the URL, with its dot, if any.
+	Ext string
+	// Type is the media type of the blob, from the server or from the extension.
+	Type string
+	// Size is the size of the blob in bytes, -1 when it is unknown.
+	Size int64
+	// Verified reports whether the blob was downloaded and hashes to Hash.
+	Verified bool
+	// Poster is the URL of a preview image of a video, when the server advertises one.
+	Poster string
+}
+
+// Parse returns the hash and the extension of a blob URL.
+// Blossom URLs are /{sha256} or /{sha256}.{ext}; the deeper paths of NIP-96 servers must have an extension,
+// so that other hex identifiers, like transaction IDs, are not mistaken for blobs.
+func Parse(u *url.URL) (hash, ext string, err error) {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", "", errors.New("not an http or https URL")
+	}
+
+	dir, name := path.Split(u.Path)
+	m := blobName.FindStringSubmatch(strings.ToLower(name))
+	if m == nil {
+		return "", "", errors.New("not a blob URL")
+	}
+	if dir != "/" && m[2] == "" {
+		return "", "", errors.New("blob URLs of NIP-96 servers need an extension")
+	}
+
+	return m[1], m[2], nil
+}
+
+// isBlossom reports whether u is a Blossom URL, at the root of the server.
+// The NIP-96 servers address files by the hash of the upload, which may differ from the served file
+// when the server transforms it, so only Blossom blobs must match their hash.
+func isBlossom(u *url.URL) bool {
+	dir, _ := path.Split(u.Path)
+	return dir == "/"
+}
+
+// Options configures the client.
+type Options struct {
+	// HTTPClient fetches the blobs. Blob servers can be any host, so it defaults to an outbound client.
+	HTTPClient *http.Client
+	// VerifyMaxBytes defaults to DefaultVerifyMaxBytes. Larger blobs are not verified.
+	VerifyMaxBytes int64
+	// ImageProxyURL is the URL of the image proxy endpoint, like https://proxy.example/img/,
+	// to which the escaped URL of an image is appended to get its thumbnail.
+	// Images are used as is when it is empty.
+	ImageProxyURL string
+}
+
+// Client builds previews of blob URLs.
+type Client struct {
+	client         *http.Client
+	verifyMaxBytes int64
+	imageProxyURL  string
+}
+
+func New(opts Options) *Client {
+	c := &Client{
+		client:         opts.HTTPClient,
+		verifyMaxBytes: opts.VerifyMaxBytes,
+		imageProxyURL:  opts.ImageProxyURL,
+	}
+
+	if c.client == nil {
+		c.client = outbound.NewClient(outbound.Options{})
+	}
+	if c.verifyMaxBytes <= 0 {
+		c.verifyMaxBytes = DefaultVerifyMaxBytes
+	}
+
+	return c
+}
+
+// Match reports whether u addresses a blob by its hash.
+func (c *Client) Match(u *url.URL) bool {
+	_, _, err := Parse(u)
+	return err == nil
+}
+
+// Preview returns the head of the preview document of a blob.
+// URLs that turn out to serve HTML pages are left to the generic proxy.
+func (c *Client) Preview(ctx context.Context, u *url.URL) (opengraph.Head, error) {
+	blob, err := c.Stat(ctx, u)
+	if err != nil {
+		return opengraph.Head{}, err
+	}
+
+	return c.blobHead(u, blob), nil
+}
+
+// Stat returns the type and the size of a blob, from a HEAD request, and verifies its hash
+// when it is not larger than the configured limit. URLs serving HTML pages are reported
+// as errors.ErrUnsupported before anything is downloaded.
+func (c *Client) Stat(ctx context.Context, u *url.URL) (Blob, error) {
+	hash, ext, err := Parse(u)
+	if err != nil {
+		return Blob{}, err
+	}
+
+	blob := Blob{URL: u.String(), Hash: hash, Ext: ext, Size: -1}
+
+	resp, err := c.do(ctx, http.MethodHead, u)
+	if err != nil {
+		return Blob{}, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return Blob{}, fmt.Errorf("blob %s not found", hash)
+	case resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented:
+		// The server does not answer HEAD requests, the blob is described by the download below.
+	case resp.StatusCode != http.StatusOK:
+		return Blob{}, fmt.Errorf("%s returned status %d", u.Host, resp.StatusCode)
+	default:
+		blob.Type = resp.Header.Get("Content-Type")
+		blob.Size = resp.ContentLength
+		blob.Poster = posterLink(resp.Header, u)
+	}
+
+	if isHTML(blob.Type) {
+		return Blob{}, fmt.Errorf("%s serves an HTML page: %w", u, errors.ErrUnsupported)
+	}
+
+	if blob.Size <= c.verifyMaxBytes {
+		if err := c.verify(ctx, u, &blob); err != nil {
+			return Blob{}, err
+		}
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(blob.Type); mediaType == "" || mediaType == "application/octet-stream" {
+		if byExt := mime.TypeByExtension(ext); byExt != "" {
+			blob.Type = byExt
+		}
+	}
+
+	return blob, nil
+}
+
+// verify downloads the blob, unless it turns out to be larger than the limit, and checks its hash.
+// The download also fills the type and the size the HEAD request did not give.
+func (c *Client) verify(ctx context.Context, u *url.URL, blob *Blob) error {
+	resp, err := c.do(ctx, http.MethodGet, u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", u.Host, resp.StatusCode)
+	}
+
+	if blob.Type == "" {
+		blob.Type = resp.Header.Get("Content-Type")
+		if isHTML(blob.Type) {
+			return fmt.Errorf("%s serves an HTML page: %w", u, errors.ErrUnsupported)
+		}
+	}
+	if blob.Poster == "" {
+		blob.Poster = posterLink(resp.Header, u)
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(h, io.LimitReader(resp.Body, c.verifyMaxBytes+1))
+	if err != nil {
+		return err
+	}
+	if n > c.verifyMaxBytes {
+		// Too large to verify after all.
+		return nil
+	}
+	blob.Size = n
+
+	if hex.EncodeToString(h.Sum(nil)) == blob.Hash {
+		blob.Verified = true
+		return nil
+	}
+	if isBlossom(u) {
+		return fmt.Errorf("%w: %s", ErrHashMismatch, blob.Hash)
+	}
+
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method string, u *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Do(req)
+}
+
+// posterLink returns the absolute URL of the preview image a server advertises for a blob
+// with a Link header of relation preview, if any.
+func posterLink(header http.Header, base *url.URL) string {
+	for _, link := range header.Values("Link") {
+		for _, value := range strings.Split(link, ",") {
+			target, params, ok := strings.Cut(strings.TrimSpace(value), ";")
+			if !ok || !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+
+			for _, param := range strings.Split(params, ";") {
+				name, rel, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if !strings.EqualFold(name, "rel") || !strings.EqualFold(strings.Trim(rel, `"`), "preview") {
+					continue
+				}
+				if ref, err := base.Parse(target[1 : len(target)-1]); err == nil &&
+					(ref.Scheme == "http" || ref.Scheme == "https") {
+					return ref.String()
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// blobHead returns the preview of blob, served at u.
+func (c *Client) blobHead(u *url.URL, blob Blob) opengraph.Head {
+	mediaType, _, _ := mime.ParseMediaType(blob.Type)
+	kind := describe(mediaType)
+
+	title := strings.ToUpper(kind[:1]) + kind[1:] + " on " + u.Hostname()
+
+	head := opengraph.Head{Title: title, Charset: "utf-8"}
+	head.SetMeta("og:title", title)
+	head.SetMeta("og:site_name", u.Hostname())
+	head.SetMeta("og:url", blob.URL)
+	head.SetMeta("og:type", "website")
+
+	description := kind
+	if format := format(mediaType); format != "" {
+		description = format + " " + kind
+	}
+	if blob.Size >= 0 {
+		description += ", " + formatSize(blob.Size)
+	}
+	head.SetMeta("og:description", description)
+
+	switch strings.SplitN(mediaType, "/", 2)[0] {
+	case "image":
+		head.SetMeta("og:image", c.thumbnail(blob.URL))
+		head.SetMeta("twitter:card", "summary_large_image")
+	case "video":
+		head.SetMeta("og:type", "video.other")
+		head.SetMeta("og:video", blob.URL)
+		head.SetMeta("og:video:type", mediaType)
+		if blob.Poster != "" {
+			head.SetMeta("og:image", c.thumbnail(blob.Poster))
+		}
+		head.SetMeta("twitter:card", "player")
+	case "audio":
+		head.SetMeta("og:audio", blob.URL)
+		head.SetMeta("og:audio:type", mediaType)
+		head.SetMeta("twitter:card", "summary")
+	default:
+		head.SetMeta("twitter:card", "summary")
+	}
+
+	return head
+}
+
+// thumbnail returns the URL of the thumbnail of the image at imageURL, through the image proxy when it is set.
+func (c *Client) thumbnail(imageURL string) string {
+	if c.imageProxyURL == "" {
+		return imageURL
+	}
+	return c.imageProxyURL + url.PathEscape(imageURL) + "?w=600&h=600&fit=contain"
+}
+
+// describe returns what kind of file a blob of the media type is.
+func describe(mediaType string) string {
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		return "image"
+	case strings.HasPrefix(mediaType, "video/"):
+		return "video"
+	case strings.HasPrefix(mediaType, "audio/"):
+		return "audio file"
+	case mediaType == "application/pdf":
+		return "document"
+	default:
+		return "file"
+	}
+}
+
+// format returns the short name of the format of the media type, like JPEG for image/jpeg.
+func format(mediaType string) string {
+	_, subtype, ok := strings.Cut(mediaType, "/")
+	if !ok || subtype == "octet-stream" {
+		return ""
+	}
+	subtype, _, _ = strings.Cut(subtype, "+")
+	return strings.ToUpper(strings.TrimPrefix(subtype, "x-"))
+}
+
+// formatSize returns n bytes in a human readable form, like 1.2 MB.
+func formatSize(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+
+	value, exp := float64(n)/unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
+	}
+
+	return strconv.FormatFloat(value, 'f', 1, 64) + " " + []string{"kB", "MB", "GB", "TB"}[exp]
+}
+
+// isHTML reports whether contentType is the type of an HTML page.
+func isHTML(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "text/html"
+}
@@ -0,0 +1,240 @@
+package blossom
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+)
+
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestParse(t *testing.T) {
+	const hash = "b1674191a88ec5cdd733e4240a81803105dc412d6c6708d53ab94fc248f4f553"
+
+	tests := []struct {
+		url     string
+		ext     string
+		wantErr bool
+	}{
+		{url: "https://blossom.example/" + hash, ext: ""},
+		{url: "https://blossom.example/" + hash + ".jpg", ext: ".jpg"},
+		{url: "https://blossom.example/" + strings.ToUpper(hash) + ".PNG", ext: ".png"},
+		{url: "https://nostr.example/i/" + hash + ".webp", ext: ".webp"},
+		{url: "https://mempool.example/tx/" + hash, wantErr: true},
+		{url: "https://blossom.example/" + hash[:63], wantErr: true},
+		{url: "ftp://blossom.example/" + hash, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+			got, ext, err := Parse(u)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (got != hash || ext != tt.ext) {
+				t.Errorf("Parse() = %s, %s, expected %s, %s", got, ext, hash, tt.ext)
+			}
+		})
+	}
+}
+
+// blobServer serves the blobs of a fake Blossom and NIP-96 server, and counts the downloads.
+type blobServer struct {
+	*httptest.Server
+	image, video, other []byte
+	downloads           atomic.Int64
+}
+
+func newBlobServer(t *testing.T) *blobServer {
+	t.Helper()
+
+	s := &blobServer{
+		image: []byte("\x89PNG fake image"),
+		video: bytes.Repeat([]byte("frame"), 1000),
+		other: []byte("not the uploaded file"),
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			s.downloads.Add(1)
+		}
+
+		var body []byte
+		switch r.URL.Path {
+		case "/" + hashOf(s.image) + ".png", "/noheads/" + hashOf(s.image) + ".png":
+			if strings.HasPrefix(r.URL.Path, "/noheads/") && r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "image/png")
+			body = s.image
+		case "/" + hashOf(s.video) + ".mp4":
+			w.Header().Set("Content-Type", "video/mp4")
+			w.Header().Set("Link", `</posters/frame.jpg>; rel="preview"`)
+			body = s.video
+		case "/" + hashOf(s.image):
+			// A Blossom server serving the wrong content.
+			w.Header().Set("Content-Type", "application/octet-stream")
+			body = s.other
+		case "/media/" + hashOf(s.image) + ".png":
+			// A NIP-96 server serving a transformed file.
+			w.Header().Set("Content-Type", "image/png")
+			body = s.other
+		case "/" + hashOf(s.other) + ".html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			body = s.other
+		case "/" + hashOf(s.video):
+			// A page of a website whose path happens to look like a hash.
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			body = []byte("<html><head><title>Not a blob</title></head></html>")
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func TestClientPreview(t *testing.T) {
+	srv := newBlobServer(t)
+	c := New(Options{HTTPClient: srv.Client(), VerifyMaxBytes: 1000, ImageProxyURL: "https://proxy.example/img/"})
+
+	imageURL := srv.URL + "/" + hashOf(srv.image) + ".png"
+	videoURL := srv.URL + "/" + hashOf(srv.video) + ".mp4"
+
+	tests := []struct {
+		name      string
+		url       string
+		expected  opengraph.Metadata
+		downloads int64
+	}{
+		{
+			name: "image",
+			url:  imageURL,
+			expected: opengraph.Metadata{
+				URL:         imageURL,
+				Title:       "Image on 127.0.0.1",
+				Description: "PNG image, 15 B",
+				Image:       "https://proxy.example/img/" + url.PathEscape(imageURL) + "?w=600&h=600&fit=contain",
+				SiteName:    "127.0.0.1",
+				Type:        "website",
+			},
+			downloads: 1,
+		},
+		{
+			name: "video too large to verify",
+			url:  videoURL,
+			expected: opengraph.Metadata{
+				URL:         videoURL,
+				Title:       "Video on 127.0.0.1",
+				Description: "MP4 video, 5.0 kB",
+				Image:       "https://proxy.example/img/" + url.PathEscape(srv.URL+"/posters/frame.jpg") + "?w=600&h=600&fit=contain",
+				SiteName:    "127.0.0.1",
+				Type:        "video.other",
+			},
+			downloads: 0,
+		},
+		{
+			name: "NIP-96 transformed file",
+			url:  srv.URL + "/media/" + hashOf(srv.image) + ".png",
+			expected: opengraph.Metadata{
+				URL:         srv.URL + "/media/" + hashOf(srv.image) + ".png",
+				Title:       "Image on 127.0.0.1",
+				Description: "PNG image, 21 B",
+				Image:       "https://proxy.example/img/" + url.PathEscape(srv.URL+"/media/"+hashOf(srv.image)+".png") + "?w=600&h=600&fit=contain",
+				SiteName:    "127.0.0.1",
+				Type:        "website",
+			},
+			downloads: 1,
+		},
+		{
+			name: "server without HEAD support",
+			url:  srv.URL + "/noheads/" + hashOf(srv.image) + ".png",
+			expected: opengraph.Metadata{
+				URL:         srv.URL + "/noheads/" + hashOf(srv.image) + ".png",
+				Title:       "Image on 127.0.0.1",
+				Description: "PNG image, 15 B",
+				Image:       "https://proxy.example/img/" + url.PathEscape(srv.URL+"/noheads/"+hashOf(srv.image)+".png") + "?w=600&h=600&fit=contain",
+				SiteName:    "127.0.0.1",
+				Type:        "website",
+			},
+			downloads: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+			before := srv.downloads.Load()
+
+			head, err := c.Preview(context.Background(), u)
+			if err != nil {
+				t.Fatalf("Preview() unexpected error: %v", err)
+			}
+
+			if md := head.Metadata(); md != tt.expected {
+				t.Errorf("Preview() metadata = %+v, expected %+v", md, tt.expected)
+			}
+			if got := srv.downloads.Load() - before; got != tt.downloads {
+				t.Errorf("Preview() downloaded the blob %d times, expected %d", got, tt.downloads)
+			}
+		})
+	}
+}
+
+func TestClientStat(t *testing.T) {
+	srv := newBlobServer(t)
+	c := New(Options{HTTPClient: srv.Client()})
+
+	u, _ := url.Parse(srv.URL + "/" + hashOf(srv.image) + ".png")
+	blob, err := c.Stat(context.Background(), u)
+	if err != nil {
+		t.Fatalf("Stat() unexpected error: %v", err)
+	}
+	if !blob.Verified || blob.Type != "image/png" || blob.Size != int64(len(srv.image)) {
+		t.Errorf("Stat() = %+v, expected a verified image/png of %d bytes", blob, len(srv.image))
+	}
+
+	u, _ = url.Parse(srv.URL + "/" + hashOf(srv.image))
+	if _, err := c.Stat(context.Background(), u); !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("Stat() of a mismatching blob error = %v, expected %v", err, ErrHashMismatch)
+	}
+
+	u, _ = url.Parse(srv.URL + "/" + hashOf(srv.other) + ".html")
+	if _, err := c.Preview(context.Background(), u); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Preview() of an HTML page error = %v, expected %v", err, errors.ErrUnsupported)
+	}
+
+	downloads := srv.downloads.Load()
+	u, _ = url.Parse(srv.URL + "/" + hashOf(srv.video))
+	if _, err := c.Preview(context.Background(), u); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Preview() of an HTML page at a hash path error = %v, expected %v", err, errors.ErrUnsupported)
+	}
+	if n := srv.downloads.Load() - downloads; n != 0 {
+		t.Errorf("Preview() of an HTML page downloaded it %d times, expected 0", n)
+	}
+
+	u, _ = url.Parse(srv.URL + "/" + hashOf([]byte("missing")) + ".png")
+	if _, err := c.Stat(context.Background(), u); err == nil {
+		t.Errorf("Stat() of a missing blob expected an error")
+	}
+}
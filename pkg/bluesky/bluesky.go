@@ -0,0 +1,397 @@
+// Package bluesky builds link previews of Bluesky posts and profiles from the public AppView XRPC API,
+// since bsky.app only serves a JavaScript application shell.
+package bluesky
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+	"github.com/danvergara/jumble-proxy-server/pkg/outbound"
+)
+
+const (
+	// DefaultAppViewURL is the base URL of the public AppView API.
+	DefaultAppViewURL = "https://public.api.bsky.app"
+
+	// maxResponseBytes caps the size of an XRPC response.
+	maxResponseBytes = 2 << 20
+)
+
+// ErrNotFound is returned when a post or an account does not exist, or cannot be viewed.
+var ErrNotFound = errors.New("not found")
+
+var (
+	handle = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?\.)+[A-Za-z]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+	did    = regexp.MustCompile(`^did:(plc|web):[A-Za-z0-9._:%-]+$`)
+	rkey   = regexp.MustCompile(`^[A-Za-z0-9._:~-]{1,512}$`)
+)
+
+// Resource is the post or profile a bsky.app URL points to.
+type Resource struct {
+	// Actor is the handle or the DID of the account.
+	Actor string
+	// RKey is the record key of the post, empty for profiles.
+	RKey string
+}
+
+// Parse returns the resource of a bsky.app/profile/{actor} or bsky.app/profile/{actor}/post/{rkey} URL.
+func Parse(rawURL string) (Resource, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Resource{}, err
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if (u.Scheme != "http" && u.Scheme != "https") || (host != "bsky.app" && host != "www.bsky.app") {
+		return Resource{}, errors.New("not a Bluesky URL")
+	}
+
+	segments := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+	if len(segments) < 2 || segments[0] != "profile" {
+		return Resource{}, errors.New("not a Bluesky post or profile URL")
+	}
+
+	actor, err := url.PathUnescape(segments[1])
+	if err != nil || (!handle.MatchString(actor) && !did.MatchString(actor)) {
+		return Resource{}, fmt.Errorf("invalid handle or DID %q", segments[1])
+	}
+	res := Resource{Actor: actor}
+
+	switch {
+	case len(segments) == 2:
+		return res, nil
+	case len(segments) == 4 && segments[2] == "post":
+		if !rkey.MatchString(segments[3]) {
+			return Resource{}, fmt.Errorf("invalid record key %q", segments[3])
+		}
+		res.RKey = segments[3]
+		return res, nil
+	default:
+		return Resource{}, errors.New("not a Bluesky post or profile URL")
+	}
+}
+
+// Options configures the client.
+type Options struct {
+	// HTTPClient queries the AppView API. outbound.NewClient provides one when it is nil.
+	HTTPClient *http.Client
+	// AppViewURL defaults to DefaultAppViewURL.
+	AppViewURL string
+}
+
+// Client builds previews of Bluesky URLs.
+type Client struct {
+	client     *http.Client
+	appViewURL string
+}
+
+func New(opts Options) *Client {
+	c := &Client{
+		client:     opts.HTTPClient,
+		appViewURL: strings.TrimSuffix(opts.AppViewURL, "/"),
+	}
+
+	if c.client == nil {
+		c.client = outbound.NewClient(outbound.Options{})
+	}
+	if c.appViewURL == "" {
+		c.appViewURL = DefaultAppViewURL
+	}
+
+	return c
+}
+
+// Match reports whether u is the URL of a Bluesky post or profile.
+func (c *Client) Match(u *url.URL) bool {
+	_, err := Parse(u.String())
+	return err == nil
+}
+
+// Preview returns the head of the preview document of a Bluesky post or profile.
+// Deleted posts and posts hidden by their author get a placeholder preview rather than an error.
+func (c *Client) Preview(ctx context.Context, u *url.URL) (opengraph.Head, error) {
+	res, err := Parse(u.String())
+	if err != nil {
+		return opengraph.Head{}, err
+	}
+
+	actor := res.Actor
+	if !strings.HasPrefix(actor, "did:") {
+		actor, err = c.resolveHandle(ctx, res.Actor)
+		if err != nil {
+			return opengraph.Head{}, fmt.Errorf("resolving the handle %s: %w", res.Actor, err)
+		}
+	}
+
+	if res.RKey == "" {
+		return c.profileHead(ctx, res, actor)
+	}
+
+	head, err := c.postHead(ctx, res, actor)
+	if errors.Is(err, ErrNotFound) {
+		return placeholderHead(res), nil
+	}
+
+	return head, err
+}
+
+// resolveHandle returns the DID of a handle.
+func (c *Client) resolveHandle(ctx context.Context, h string) (string, error) {
+	var resp struct {
+		DID string `json:"did"`
+	}
+	if err := c.query(ctx, "com.atproto.identity.resolveHandle", url.Values{"handle": {h}}, &resp); err != nil {
+		return "", err
+	}
+
+	if !did.MatchString(resp.DID) {
+		return "", fmt.Errorf("invalid DID %q", resp.DID)
+	}
+
+	return resp.DID, nil
+}
+
+type profileView struct {
+	DID            string `json:"did"`
+	Handle         string `json:"handle"`
+	DisplayName    string `json:"displayName"`
+	Description    string `json:"description"`
+	Avatar         string `json:"avatar"`
+	FollowersCount int64  `json:"followersCount"`
+	PostsCount     int64  `json:"postsCount"`
+}
+
+// name returns the display name of the account, or its handle.
+func (p profileView) name() string {
+	if strings.TrimSpace(p.DisplayName) != "" {
+		return strings.TrimSpace(p.DisplayName)
+	}
+	return p.Handle
+}
+
+type aspectRatio struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// embedView is the union of the embed views of a post: images, external link, video, quoted record,
+// and quoted record with media.
+type embedView struct {
+	Images []struct {
+		Fullsize    string      `json:"fullsize"`
+		AspectRatio aspectRatio `json:"aspectRatio"`
+	} `json:"images"`
+	External *struct {
+		Title string `json:"title"`
+		Thumb string `json:"thumb"`
+	} `json:"external"`
+	Thumbnail   string          `json:"thumbnail"`
+	AspectRatio aspectRatio     `json:"aspectRatio"`
+	Record      json.RawMessage `json:"record"`
+	Media       *embedView      `json:"media"`
+}
+
+// recordView is a quoted post, as found in the record of record embeds.
+type recordView struct {
+	Type   string      `json:"$type"`
+	Author profileView `json:"author"`
+	Value  struct {
+		Text string `json:"text"`
+	} `json:"value"`
+	Embeds []embedView `json:"embeds"`
+	// Record is set on the record embed views of record with media embeds.
+	Record json.RawMessage `json:"record"`
+}
+
+// image returns the first image of the embed, with its dimensions if known.
+func (e *embedView) image() (string, aspectRatio) {
+	if e == nil {
+		return "", aspectRatio{}
+	}
+
+	switch {
+	case len(e.Images) > 0:
+		return e.Images[0].Fullsize, e.Images[0].AspectRatio
+	case e.Thumbnail != "":
+		return e.Thumbnail, e.AspectRatio
+	case e.External != nil && e.External.Thumb != "":
+		return e.External.Thumb, aspectRatio{}
+	case e.Media != nil:
+		return e.Media.image()
+	default:
+		return "", aspectRatio{}
+	}
+}
+
+// quote returns the quoted post of a record or record with media embed, if any.
+func (e *embedView) quote() (recordView, bool) {
+	if e == nil || len(e.Record) == 0 {
+		return recordView{}, false
+	}
+
+	var rec recordView
+	if err := json.Unmarshal(e.Record, &rec); err != nil {
+		return recordView{}, false
+	}
+
+	// Record with media embeds wrap a record embed view, holding the record view in a nested record property.
+	if rec.Type == "app.bsky.embed.record#view" && len(rec.Record) > 0 {
+		var nested recordView
+		if err := json.Unmarshal(rec.Record, &nested); err != nil {
+			return recordView{}, false
+		}
+		rec = nested
+	}
+
+	return rec, rec.Type == "app.bsky.embed.record#viewRecord"
+}
+
+// postHead builds the preview of a post from its thread.
+func (c *Client) postHead(ctx context.Context, res Resource, actor string) (opengraph.Head, error) {
+	params := url.Values{
+		"uri":          {"at://" + actor + "/app.bsky.feed.post/" + res.RKey},
+		"depth":        {"0"},
+		"parentHeight": {"0"},
+	}
+
+	var resp struct {
+		Thread struct {
+			Type string `json:"$type"`
+			Post struct {
+				Author profileView `json:"author"`
+				Record struct {
+					Text      string `json:"text"`
+					CreatedAt string `json:"createdAt"`
+				} `json:"record"`
+				Embed *embedView `json:"embed"`
+			} `json:"post"`
+		} `json:"thread"`
+	}
+	if err := c.query(ctx, "app.bsky.feed.getPostThread", params, &resp); err != nil {
+		return opengraph.Head{}, err
+	}
+
+	// Deleted and blocked posts come back as #notFoundPost and #blockedPost.
+	if resp.Thread.Type != "app.bsky.feed.defs#threadViewPost" {
+		return opengraph.Head{}, ErrNotFound
+	}
+	post := resp.Thread.Post
+	author := post.Author
+
+	head := newHead(postURL(author.Handle, res.RKey), author.name()+" (@"+author.Handle+") on Bluesky")
+	head.SetMeta("og:type", "article")
+	head.SetMeta("author", author.name())
+	head.SetMeta("article:published_time", post.Record.CreatedAt)
+
+	description := strings.TrimSpace(post.Record.Text)
+	quote, quoted := post.Embed.quote()
+	if quoted {
+		description += "\n\nQuoting " + quote.Author.name() + " (@" + quote.Author.Handle + "): " +
+			strings.TrimSpace(quote.Value.Text)
+	}
+	head.SetMeta("og:description", opengraph.Truncate(strings.TrimSpace(description), opengraph.MaxDescriptionLength))
+
+	image, ratio := post.Embed.image()
+	if image == "" && quoted && len(quote.Embeds) > 0 {
+		image, ratio = quote.Embeds[0].image()
+	}
+
+	if image != "" {
+		head.SetMeta("og:image", image)
+		head.SetMeta("og:image:width", opengraph.FormatPositive(ratio.Width))
+		head.SetMeta("og:image:height", opengraph.FormatPositive(ratio.Height))
+		head.SetMeta("twitter:card", "summary_large_image")
+	} else {
+		head.SetMeta("og:image", author.Avatar)
+	}
+
+	return head, nil
+}
+
+// profileHead builds the preview of a profile.
+func (c *Client) profileHead(ctx context.Context, res Resource, actor string) (opengraph.Head, error) {
+	var profile profileView
+	if err := c.query(ctx, "app.bsky.actor.getProfile", url.Values{"actor": {actor}}, &profile); err != nil {
+		return opengraph.Head{}, err
+	}
+
+	head := newHead("https://bsky.app/profile/"+profile.Handle, profile.name()+" (@"+profile.Handle+")")
+	head.SetMeta("og:type", "profile")
+	head.SetMeta("og:description", opengraph.Truncate(strings.TrimSpace(profile.Description), opengraph.MaxDescriptionLength))
+	head.SetMeta("og:image", profile.Avatar)
+	head.SetMeta("twitter:label1", "Followers")
+	head.SetMeta("twitter:data1", strconv.FormatInt(profile.FollowersCount, 10))
+	head.SetMeta("twitter:label2", "Posts")
+	head.SetMeta("twitter:data2", strconv.FormatInt(profile.PostsCount, 10))
+
+	return head, nil
+}
+
+// query calls an XRPC method of the AppView and decodes its response into v.
+// Unknown accounts and records are reported as ErrNotFound.
+func (c *Client) query(ctx context.Context, method string, params url.Values, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.appViewURL+"/xrpc/"+method+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body := io.LimitReader(resp.Body, maxResponseBytes)
+
+	if resp.StatusCode != http.StatusOK {
+		var xrpcErr struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(body).Decode(&xrpcErr)
+
+		switch xrpcErr.Error {
+		case "NotFound", "ActorNotFound", "InvalidRequest":
+			if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusNotFound {
+				return fmt.Errorf("%w: %s", ErrNotFound, xrpcErr.Message)
+			}
+		}
+
+		return fmt.Errorf("%s returned status %d: %s %s", method, resp.StatusCode, xrpcErr.Error, xrpcErr.Message)
+	}
+
+	return json.NewDecoder(body).Decode(v)
+}
+
+// newHead returns a head with the title and the properties every Bluesky preview shares.
+func newHead(canonical, title string) opengraph.Head {
+	head := opengraph.Head{Title: title, Charset: "utf-8"}
+	head.SetMeta("og:title", title)
+	head.SetMeta("og:site_name", "Bluesky")
+	head.SetMeta("og:url", canonical)
+	head.SetMeta("twitter:card", "summary")
+	return head
+}
+
+// placeholderHead is the preview of a post that cannot be shown.
+func placeholderHead(res Resource) opengraph.Head {
+	head := newHead(postURL(res.Actor, res.RKey), "Post unavailable")
+	head.SetMeta("og:type", "article")
+	head.SetMeta("og:description", "This post was deleted, or its author limits who can view it.")
+	return head
+}
+
+// postURL returns the bsky.app URL of a post.
+func postURL(actor, rkey string) string {
+	return "https://bsky.app/profile/" + actor + "/post/" + rkey
+}
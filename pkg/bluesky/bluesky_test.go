@@ -0,0 +1,224 @@
+package bluesky
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected Resource
+		wantErr  bool
+	}{
+		{url: "https://bsky.app/profile/alice.bsky.social/post/3kabc2xyz", expected: Resource{Actor: "alice.bsky.social", RKey: "3kabc2xyz"}},
+		{url: "https://bsky.app/profile/alice.bsky.social", expected: Resource{Actor: "alice.bsky.social"}},
+		{url: "https://bsky.app/profile/did:plc:abc123/post/3kabc2xyz", expected: Resource{Actor: "did:plc:abc123", RKey: "3kabc2xyz"}},
+		{url: "https://bsky.app/profile/alice.bsky.social/post/3kabc2xyz/liked-by", wantErr: true},
+		{url: "https://bsky.app/profile/not_a_handle", wantErr: true},
+		{url: "https://bsky.app/search?q=nostr", wantErr: true},
+		{url: "https://example.com/profile/alice.bsky.social", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			res, err := Parse(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if res != tt.expected {
+				t.Errorf("Parse() = %+v, expected %+v", res, tt.expected)
+			}
+		})
+	}
+}
+
+// newFakeAppView serves the XRPC methods the client calls, for the alice.test and bob.test accounts.
+func newFakeAppView(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		q := r.URL.Query()
+
+		switch r.URL.Path {
+		case "/xrpc/com.atproto.identity.resolveHandle":
+			switch q.Get("handle") {
+			case "alice.test":
+				fmt.Fprint(w, `{"did": "did:plc:alice"}`)
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error": "InvalidRequest", "message": "Unable to resolve handle"}`)
+			}
+		case "/xrpc/app.bsky.actor.getProfile":
+			fmt.Fprint(w, `{"did": "did:plc:alice", "handle": "alice.test", "displayName": "Alice",
+				"description": "Posting about Nostr", "avatar": "https://cdn.test/alice.jpg", "followersCount": 42, "postsCount": 7}`)
+		case "/xrpc/app.bsky.feed.getPostThread":
+			author := `{"did": "did:plc:alice", "handle": "alice.test", "displayName": "Alice", "avatar": "https://cdn.test/alice.jpg"}`
+
+			switch q.Get("uri") {
+			case "at://did:plc:alice/app.bsky.feed.post/images":
+				fmt.Fprintf(w, `{"thread": {"$type": "app.bsky.feed.defs#threadViewPost", "post": {
+					"author": %s,
+					"record": {"text": "Two cats", "createdAt": "2024-05-01T10:00:00Z"},
+					"embed": {"$type": "app.bsky.embed.images#view", "images": [
+						{"fullsize": "https://cdn.test/cat1.jpg", "aspectRatio": {"width": 800, "height": 600}},
+						{"fullsize": "https://cdn.test/cat2.jpg"}
+					]}
+				}}}`, author)
+			case "at://did:plc:alice/app.bsky.feed.post/quote":
+				fmt.Fprintf(w, `{"thread": {"$type": "app.bsky.feed.defs#threadViewPost", "post": {
+					"author": %s,
+					"record": {"text": "Agreed", "createdAt": "2024-05-02T10:00:00Z"},
+					"embed": {"$type": "app.bsky.embed.recordWithMedia#view",
+						"media": {"$type": "app.bsky.embed.external#view", "external": {"title": "Link", "thumb": "https://cdn.test/link.jpg"}},
+						"record": {"$type": "app.bsky.embed.record#view", "record": {
+							"$type": "app.bsky.embed.record#viewRecord",
+							"author": {"did": "did:plc:bob", "handle": "bob.test", "displayName": ""},
+							"value": {"text": "Nostr is neat"}
+						}}
+					}
+				}}}`, author)
+			case "at://did:plc:alice/app.bsky.feed.post/text":
+				fmt.Fprintf(w, `{"thread": {"$type": "app.bsky.feed.defs#threadViewPost", "post": {
+					"author": %s,
+					"record": {"text": "Quoting with a picture", "createdAt": "2024-05-03T10:00:00Z"},
+					"embed": {"$type": "app.bsky.embed.record#view", "record": {
+						"$type": "app.bsky.embed.record#viewRecord",
+						"author": {"did": "did:plc:bob", "handle": "bob.test", "displayName": "Bob"},
+						"value": {"text": "Look"},
+						"embeds": [{"$type": "app.bsky.embed.images#view", "images": [{"fullsize": "https://cdn.test/bob.jpg"}]}]
+					}}
+				}}}`, author)
+			case "at://did:plc:alice/app.bsky.feed.post/deleted":
+				fmt.Fprint(w, `{"thread": {"$type": "app.bsky.feed.defs#notFoundPost", "notFound": true}}`)
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error": "NotFound", "message": "Post not found"}`)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestClientPreview(t *testing.T) {
+	srv := newFakeAppView(t)
+	c := New(Options{HTTPClient: srv.Client(), AppViewURL: srv.URL})
+
+	unavailable := opengraph.Metadata{
+		Title:       "Post unavailable",
+		Description: "This post was deleted, or its author limits who can view it.",
+		SiteName:    "Bluesky",
+		Type:        "article",
+	}
+
+	tests := []struct {
+		name     string
+		url      string
+		expected opengraph.Metadata
+	}{
+		{
+			name: "post with images",
+			url:  "https://bsky.app/profile/alice.test/post/images",
+			expected: opengraph.Metadata{
+				URL:         "https://bsky.app/profile/alice.test/post/images",
+				Title:       "Alice (@alice.test) on Bluesky",
+				Description: "Two cats",
+				Image:       "https://cdn.test/cat1.jpg",
+				ImageWidth:  800,
+				ImageHeight: 600,
+				SiteName:    "Bluesky",
+				Type:        "article",
+				Author:      "Alice",
+			},
+		},
+		{
+			name: "quote post with media",
+			url:  "https://bsky.app/profile/did:plc:alice/post/quote",
+			expected: opengraph.Metadata{
+				URL:         "https://bsky.app/profile/alice.test/post/quote",
+				Title:       "Alice (@alice.test) on Bluesky",
+				Description: "Agreed\n\nQuoting bob.test (@bob.test): Nostr is neat",
+				Image:       "https://cdn.test/link.jpg",
+				SiteName:    "Bluesky",
+				Type:        "article",
+				Author:      "Alice",
+			},
+		},
+		{
+			name: "image of the quoted post",
+			url:  "https://bsky.app/profile/alice.test/post/text",
+			expected: opengraph.Metadata{
+				URL:         "https://bsky.app/profile/alice.test/post/text",
+				Title:       "Alice (@alice.test) on Bluesky",
+				Description: "Quoting with a picture\n\nQuoting Bob (@bob.test): Look",
+				Image:       "https://cdn.test/bob.jpg",
+				SiteName:    "Bluesky",
+				Type:        "article",
+				Author:      "Alice",
+			},
+		},
+		{
+			name: "profile",
+			url:  "https://bsky.app/profile/alice.test",
+			expected: opengraph.Metadata{
+				URL:         "https://bsky.app/profile/alice.test",
+				Title:       "Alice (@alice.test)",
+				Description: "Posting about Nostr",
+				Image:       "https://cdn.test/alice.jpg",
+				SiteName:    "Bluesky",
+				Type:        "profile",
+			},
+		},
+		{
+			name:     "deleted post",
+			url:      "https://bsky.app/profile/alice.test/post/deleted",
+			expected: withURL(unavailable, "https://bsky.app/profile/alice.test/post/deleted"),
+		},
+		{
+			name:     "unknown post",
+			url:      "https://bsky.app/profile/alice.test/post/missing",
+			expected: withURL(unavailable, "https://bsky.app/profile/alice.test/post/missing"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+
+			head, err := c.Preview(context.Background(), u)
+			if err != nil {
+				t.Fatalf("Preview() unexpected error: %v", err)
+			}
+
+			if md := head.Metadata(); md != tt.expected {
+				t.Errorf("Preview() metadata = %+v, expected %+v", md, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClientPreviewUnknownHandle(t *testing.T) {
+	srv := newFakeAppView(t)
+	c := New(Options{HTTPClient: srv.Client(), AppViewURL: srv.URL})
+
+	u, _ := url.Parse("https://bsky.app/profile/nobody.test/post/images")
+	if _, err := c.Preview(context.Background(), u); err == nil {
+		t.Error("Preview() expected an error for an unknown handle")
+	}
+}
+
+func withURL(md opengraph.Metadata, u string) opengraph.Metadata {
+	md.URL = u
+	return md
+}
@@ -1,14 +1,255 @@
 package config
 
 import (
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/coocood/freecache"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/bech32"
+)
+
+// NIP-98 HTTP auth modes, see Config.NIP98Auth.
+const (
+	NIP98AuthOff       = "off"
+	NIP98AuthRequired  = "required"
+	NIP98AuthThreshold = "threshold"
 )
 
+// OEmbedProvider is an oEmbed endpoint and the URL schemes it serves, see oembed.Provider.
+type OEmbedProvider struct {
+	Name     string
+	Endpoint string
+	// Schemes are URL patterns where * matches any sequence of characters.
+	Schemes []string
+}
+
 type Config struct {
-	Host   string
-	Port   string
+	// Listen is where the public server accepts connections, see ParseListener.
+	Listen Listener
 	Logger *slog.Logger
 	Cache  *freecache.Cache
+	// PublicURL is the URL clients reach the server at, like https://proxy.example, when it is behind a reverse proxy.
+	// It is used to build absolute links to the server itself, and the URLs NIP-98 auth events are signed for.
+	PublicURL string
+	// AdminListen is where the admin server hosting pprof, metrics and the cache API accepts connections.
+	// The admin server is disabled when it is the zero value.
+	AdminListen Listener
+	// AdminToken, when set, is the bearer token required by every admin endpoint.
+	// It, or AdminClientCAFile, is required when AdminListen is a TCP address other than a loopback one.
+	AdminToken string
+	// TLSCertFile and TLSKeyFile enable TLS on every listener. The files are reloaded when they change.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSMinVersion is the minimum TLS version accepted: "1.0", "1.1", "1.2" (default) or "1.3".
+	TLSMinVersion string
+	// TLSCipherSuites restricts the TLS 1.2 cipher suites, by IANA name. Go's defaults are used when empty.
+	// HTTP/2 requires the list to include TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 or its ECDSA counterpart.
+	TLSCipherSuites []string
+	// AdminClientCAFile, when set, requires admin clients to present a certificate signed by this CA.
+	AdminClientCAFile string
+	// GitHubToken authenticates the requests made to the GitHub API.
+	GitHubToken string
+	// AccessLogSampleRate is the fraction of successful requests written to the access log.
+	// Values outside (0, 1) log every request; failed requests are always logged.
+	AccessLogSampleRate float64
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host
+	// headers are honoured. These headers are ignored on requests from any other address.
+	TrustedProxies []netip.Prefix
+	// AllowPrivateNetworks lets outbound requests reach loopback and private addresses.
+	// It must stay disabled in production, otherwise the proxy can be used to reach internal services.
+	AllowPrivateNetworks bool
+	// RawPassthrough makes /sites/{site} stream the upstream page as is,
+	// instead of a sanitized document holding only the preview elements of its head.
+	RawPassthrough bool
+	// HeadMaxBytes caps how much of an upstream page is read looking for the end of its head.
+	HeadMaxBytes int64
+	// FeedMaxBytes caps how much of an RSS or Atom feed is read to build its preview.
+	FeedMaxBytes int64
+	// OEmbedProviders are the known oEmbed endpoints, looked up when a page does not advertise its own.
+	// The built-in oembed.DefaultProviders are used when it is nil.
+	OEmbedProviders []OEmbedProvider
+	// YouTubeAPIKey enables the YouTube Data API, used for durations, view counts and channel previews.
+	YouTubeAPIKey string
+	// YouTubeAPIBaseURL and YouTubeOEmbedURL override the YouTube endpoints, mostly for tests.
+	YouTubeAPIBaseURL string
+	YouTubeOEmbedURL  string
+	// TwitterSyndicationURL and TwitterOEmbedURL override the endpoints used for X posts, mostly for tests.
+	TwitterSyndicationURL string
+	TwitterOEmbedURL      string
+	// BlueskyAppViewURL overrides the base URL of the Bluesky AppView API, mostly for tests.
+	BlueskyAppViewURL string
+	// NPMRegistryURL, NPMDownloadsURL, PyPIURL, PyPIStatsURL, CratesIOURL, GoProxyURL, DepsDevURL and DockerHubURL
+	// override the package registry APIs, mostly for tests.
+	NPMRegistryURL  string
+	NPMDownloadsURL string
+	PyPIURL         string
+	PyPIStatsURL    string
+	CratesIOURL     string
+	GoProxyURL      string
+	DepsDevURL      string
+	DockerHubURL    string
+	// MediaWikiHosts are the hosts of the MediaWiki sites previewed from the REST summary endpoint,
+	// besides the Wikipedia language editions, like en.wiktionary.org.
+	MediaWikiHosts []string
+	// MediaWikiAPIURL overrides the origin of the wikis for summary requests, mostly for tests.
+	MediaWikiAPIURL string
+	// IPFSGatewayURL is the path gateway IPFS and IPNS links are fetched from, like http://127.0.0.1:8080.
+	// ipfs.DefaultGatewayURL is used when it is empty. A configured gateway may listen on a private address:
+	// its host and port, and nothing else, are trusted for the IPFS fetches.
+	IPFSGatewayURL string
+	// NostrRelays are the ws or wss relays queried for Nostr previews, after the relay hints of the entity.
+	// nostr.DefaultRelays is used when it is empty.
+	NostrRelays []string
+	// NIP05CacheTTL and NIP05NegativeCacheTTL are how long verified and unverified NIP-05 identifiers are cached.
+	NIP05CacheTTL         time.Duration
+	NIP05NegativeCacheTTL time.Duration
+	// RelayInfoCacheTTL is how long NIP-11 relay information documents are cached.
+	RelayInfoCacheTTL time.Duration
+	// LNURLCacheTTL is how long LNURL pay requests are cached.
+	LNURLCacheTTL time.Duration
+	// BlossomVerifyMaxBytes caps the size of the blobs downloaded to verify their hash.
+	BlossomVerifyMaxBytes int64
+	// NIP98Auth selects when the endpoints fetching upstream content, all but /img/{url}, require NIP-98 HTTP auth:
+	// NIP98AuthOff (the default), NIP98AuthRequired, or NIP98AuthThreshold, which only requires it from clients
+	// making more than NIP98AnonymousRateLimit requests per minute.
+	NIP98Auth string
+	// NIP98AllowedPubKeys, when set, are the only public keys accepted. NIP98DeniedPubKeys are always rejected.
+	// Keys are given in hex or as npubs, and Validate rejects any other value.
+	NIP98AllowedPubKeys []string
+	NIP98DeniedPubKeys  []string
+	// NIP98RateLimit caps the requests per minute of each authenticated public key. Zero disables the limit.
+	NIP98RateLimit int
+	// NIP98AnonymousRateLimit is how many requests per minute a client can make without auth in threshold mode.
+	NIP98AnonymousRateLimit int
+	// NIP98TimeWindow is how far the creation time of an auth event may be from the current time.
+	NIP98TimeWindow time.Duration
+	// ImageMaxBytes caps the size of the images downloaded by the image proxy.
+	ImageMaxBytes int64
+	// ImageMaxPixels caps the width times height of the images decoded by the image proxy.
+	ImageMaxPixels int64
+	// BatchMaxURLs caps the number of URLs accepted by POST /batch.
+	BatchMaxURLs int
+	// BatchConcurrency caps the number of URLs of a batch fetched at the same time.
+	BatchConcurrency int
+	// BatchItemTimeout bounds the time spent fetching each URL of a batch.
+	BatchItemTimeout time.Duration
+	// ShutdownDelay is how long the server keeps serving after readiness starts failing,
+	// giving load balancers time to stop routing traffic before the listener is closed.
+	ShutdownDelay time.Duration
+	// ShutdownTimeout bounds how long in-flight requests are given to finish once the shutdown starts.
+	ShutdownTimeout time.Duration
+}
+
+// Validate reports whether the configuration is complete enough to serve requests.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Logger == nil {
+		errs = append(errs, errors.New("logger is not configured"))
+	}
+
+	if c.Listen.IsZero() {
+		errs = append(errs, errors.New("listener is not configured"))
+	}
+
+	for _, l := range []Listener{c.Listen, c.AdminListen} {
+		if l.Network != NetworkTCP {
+			continue
+		}
+		_, port, err := net.SplitHostPort(l.Address)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if p, err := strconv.Atoi(port); err != nil || p < 0 || p > 65535 {
+			errs = append(errs, fmt.Errorf("port of %s must be a number between 0 and 65535", l))
+		}
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, errors.New("TLS certificate and key files must be set together"))
+	}
+
+	if c.AdminClientCAFile != "" && c.TLSCertFile == "" {
+		errs = append(errs, errors.New("admin client CA requires TLS to be enabled"))
+	}
+
+	if c.AdminListen.Network == NetworkTCP && c.AdminToken == "" && c.AdminClientCAFile == "" &&
+		!isLoopback(c.AdminListen.Address) {
+		errs = append(errs, fmt.Errorf("admin listener %s is not on a loopback address, so it requires a token or a client CA", c.AdminListen))
+	}
+
+	if c.PublicURL != "" {
+		if u, err := url.Parse(c.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+			u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			errs = append(errs, fmt.Errorf("public URL %q must be an http or https URL without a query", c.PublicURL))
+		}
+	}
+
+	if c.IPFSGatewayURL != "" {
+		if u, err := url.Parse(c.IPFSGatewayURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+			u.Host == "" || u.RawQuery != "" {
+			errs = append(errs, fmt.Errorf("IPFS gateway %q must be an http or https URL", c.IPFSGatewayURL))
+		}
+	}
+
+	for _, relay := range c.NostrRelays {
+		if u, err := url.Parse(relay); err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("nostr relay %q must be a ws or wss URL", relay))
+		}
+	}
+
+	switch c.NIP98Auth {
+	case "", NIP98AuthOff, NIP98AuthRequired:
+	case NIP98AuthThreshold:
+		if c.NIP98AnonymousRateLimit <= 0 {
+			errs = append(errs, errors.New("NIP-98 threshold mode requires an anonymous rate limit"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("NIP-98 auth mode %q must be off, required or threshold", c.NIP98Auth))
+	}
+
+	for _, pubkey := range slices.Concat(c.NIP98AllowedPubKeys, c.NIP98DeniedPubKeys) {
+		if !validPubKey(pubkey) {
+			errs = append(errs, fmt.Errorf("NIP-98 public key %q must be in hex or an npub", pubkey))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// isLoopback reports whether the TCP address only accepts connections from the local host.
+// An empty host listens on every interface.
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.IsLoopback()
+}
+
+// validPubKey reports whether pubkey is a Nostr public key in hex or an npub.
+func validPubKey(pubkey string) bool {
+	pubkey = strings.ToLower(strings.TrimSpace(pubkey))
+	if len(pubkey) == 64 {
+		_, err := hex.DecodeString(pubkey)
+		return err == nil
+	}
+
+	prefix, data, err := bech32.Decode(pubkey)
+	return err == nil && prefix == "npub" && len(data) == 32
 }
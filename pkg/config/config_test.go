@@ -0,0 +1,86 @@
+package config
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	valid := func() Config {
+		return Config{Logger: slog.Default(), Listen: Listener{Network: NetworkTCP, Address: ":8080"}}
+	}
+
+	tests := []struct {
+		name        string
+		modify      func(c *Config)
+		expectError bool
+	}{
+		{name: "defaults", modify: func(c *Config) {}},
+		{
+			name:   "admin listener on the loopback interface",
+			modify: func(c *Config) { c.AdminListen = Listener{Network: NetworkTCP, Address: "127.0.0.1:9090"} },
+		},
+		{
+			name:   "admin listener on localhost",
+			modify: func(c *Config) { c.AdminListen = Listener{Network: NetworkTCP, Address: "localhost:9090"} },
+		},
+		{
+			name:   "admin listener on a Unix socket",
+			modify: func(c *Config) { c.AdminListen = Listener{Network: NetworkUnix, Address: "/run/jumble-admin.sock"} },
+		},
+		{
+			name:        "admin listener on every interface without a token",
+			modify:      func(c *Config) { c.AdminListen = Listener{Network: NetworkTCP, Address: ":9090"} },
+			expectError: true,
+		},
+		{
+			name:        "admin listener on a private address without a token",
+			modify:      func(c *Config) { c.AdminListen = Listener{Network: NetworkTCP, Address: "10.0.0.2:9090"} },
+			expectError: true,
+		},
+		{
+			name: "admin listener on every interface with a token",
+			modify: func(c *Config) {
+				c.AdminListen = Listener{Network: NetworkTCP, Address: ":9090"}
+				c.AdminToken = "secret"
+			},
+		},
+		{
+			name: "hex and npub public keys",
+			modify: func(c *Config) {
+				c.NIP98AllowedPubKeys = []string{"7e7e9c42a91bfef19fa929e5fda1b72e0ebc1a4c1141673e2794234d86addf4e"}
+				c.NIP98DeniedPubKeys = []string{"npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg"}
+			},
+		},
+		{
+			name: "mistyped npub in the deny list",
+			modify: func(c *Config) {
+				c.NIP98DeniedPubKeys = []string{"npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjpt"}
+			},
+			expectError: true,
+		},
+		{
+			name:        "short hex public key in the allow list",
+			modify:      func(c *Config) { c.NIP98AllowedPubKeys = []string{"7e7e9c42a91bfef19fa929e5fda1b72e"} },
+			expectError: true,
+		},
+		{
+			name: "note instead of an npub",
+			modify: func(c *Config) {
+				c.NIP98AllowedPubKeys = []string{"note1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqn2l0z3"}
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.modify(&c)
+
+			if err := c.Validate(); (err != nil) != tt.expectError {
+				t.Errorf("Validate() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
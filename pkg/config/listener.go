@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Network types supported by Listener.
+const (
+	NetworkTCP     = "tcp"
+	NetworkUnix    = "unix"
+	NetworkSystemd = "systemd"
+)
+
+// Listener describes where a server accepts connections.
+type Listener struct {
+	// Network is one of NetworkTCP, NetworkUnix or NetworkSystemd.
+	Network string
+	// Address is the host:port for TCP, the socket path for Unix sockets,
+	// or the optional file descriptor name (LISTEN_FDNAMES) for systemd.
+	Address string
+	// SocketMode sets the permissions of a Unix socket file. Zero keeps the umask default.
+	SocketMode os.FileMode
+}
+
+// ParseListener parses a listener spec:
+//
+//	host:port, :port or tcp://host:port  TCP socket
+//	unix:/path/to.sock or unix:///path   Unix domain socket
+//	systemd or systemd:name              socket inherited through systemd socket activation
+func ParseListener(spec string) (Listener, error) {
+	switch {
+	case spec == "":
+		return Listener{}, fmt.Errorf("empty listener spec")
+	case strings.HasPrefix(spec, "unix:"):
+		path := strings.TrimPrefix(strings.TrimPrefix(spec, "unix:"), "//")
+		if path == "" {
+			return Listener{}, fmt.Errorf("missing socket path in %q", spec)
+		}
+		return Listener{Network: NetworkUnix, Address: path}, nil
+	case spec == NetworkSystemd:
+		return Listener{Network: NetworkSystemd}, nil
+	case strings.HasPrefix(spec, "systemd:"):
+		return Listener{Network: NetworkSystemd, Address: strings.TrimPrefix(spec, "systemd:")}, nil
+	default:
+		addr := strings.TrimPrefix(spec, "tcp://")
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return Listener{}, fmt.Errorf("invalid listener address %q: %w", spec, err)
+		}
+		return Listener{Network: NetworkTCP, Address: addr}, nil
+	}
+}
+
+// IsZero reports whether the listener is unset.
+func (l Listener) IsZero() bool {
+	return l.Network == ""
+}
+
+// String returns the spec of the listener.
+func (l Listener) String() string {
+	switch l.Network {
+	case NetworkUnix:
+		return "unix:" + l.Address
+	case NetworkSystemd:
+		if l.Address == "" {
+			return NetworkSystemd
+		}
+		return "systemd:" + l.Address
+	default:
+		return l.Address
+	}
+}
@@ -0,0 +1,47 @@
+package config
+
+import "testing"
+
+func TestParseListener(t *testing.T) {
+	tests := []struct {
+		spec        string
+		expected    Listener
+		expectError bool
+	}{
+		{spec: ":8080", expected: Listener{Network: NetworkTCP, Address: ":8080"}},
+		{spec: "127.0.0.1:8080", expected: Listener{Network: NetworkTCP, Address: "127.0.0.1:8080"}},
+		{spec: "tcp://[::1]:8080", expected: Listener{Network: NetworkTCP, Address: "[::1]:8080"}},
+		{spec: "unix:/run/jumble.sock", expected: Listener{Network: NetworkUnix, Address: "/run/jumble.sock"}},
+		{spec: "unix:///run/jumble.sock", expected: Listener{Network: NetworkUnix, Address: "/run/jumble.sock"}},
+		{spec: "systemd", expected: Listener{Network: NetworkSystemd}},
+		{spec: "systemd:admin", expected: Listener{Network: NetworkSystemd, Address: "admin"}},
+		{spec: "", expectError: true},
+		{spec: "8080", expectError: true},
+		{spec: "unix:", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			result, err := ParseListener(tt.spec)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("ParseListener(%q) expected error, got %v", tt.spec, result)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseListener(%q) unexpected error: %v", tt.spec, err)
+			}
+
+			if result != tt.expected {
+				t.Errorf("ParseListener(%q) = %+v, expected %+v", tt.spec, result, tt.expected)
+			}
+
+			if result.String() == "" {
+				t.Errorf("ParseListener(%q) has an empty String()", tt.spec)
+			}
+		})
+	}
+}
@@ -0,0 +1,588 @@
+// Package fediverse builds link previews of ActivityPub posts and profiles, as published by Mastodon,
+// Pleroma, Misskey and other fediverse servers, whose pages are often rendered by JavaScript.
+package fediverse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+	"github.com/danvergara/jumble-proxy-server/pkg/outbound"
+)
+
+const (
+	// maxResponseBytes caps the size of an ActivityPub, Mastodon API or WebFinger response.
+	maxResponseBytes = 1 << 20
+
+	activityJSON = "application/activity+json"
+	ldJSON       = `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+)
+
+var (
+	// postPaths are the paths of posts on the common fediverse servers.
+	postPaths = []*regexp.Regexp{
+		regexp.MustCompile(`^/@[A-Za-z0-9_.-]+/[0-9]+$`),               // Mastodon
+		regexp.MustCompile(`^/users/[A-Za-z0-9_.-]+/statuses/[0-9]+$`), // Mastodon ActivityPub IDs
+		regexp.MustCompile(`^/notice/[A-Za-z0-9]+$`),                   // Pleroma and Akkoma
+		regexp.MustCompile(`^/objects/[0-9a-fA-F-]{36}$`),              // Pleroma and Akkoma ActivityPub IDs
+		regexp.MustCompile(`^/notes/[a-z0-9]{10,}$`),                   // Misskey and its forks
+		regexp.MustCompile(`^/p/[A-Za-z0-9_.-]+/[0-9]+$`),              // Pixelfed
+	}
+	// profilePaths are the paths of profiles on the common fediverse servers.
+	profilePaths = []*regexp.Regexp{
+		regexp.MustCompile(`^/@[A-Za-z0-9_.-]+(@[A-Za-z0-9.-]+\.[A-Za-z]{2,})?$`),
+		regexp.MustCompile(`^/users/[A-Za-z0-9_.-]+$`),
+	}
+	// mastodonPost and mastodonProfile capture the parts of Mastodon URLs used with its API.
+	mastodonPost    = regexp.MustCompile(`^/(?:@[A-Za-z0-9_.-]+|users/[A-Za-z0-9_.-]+/statuses)/([0-9]+)$`)
+	mastodonProfile = regexp.MustCompile(`^/(?:@|users/)([A-Za-z0-9_.-]+)$`)
+	// remoteProfile is a profile of another server, like /@user@example.social.
+	remoteProfile = regexp.MustCompile(`^/@([A-Za-z0-9_.-]+)@([A-Za-z0-9.-]+\.[A-Za-z]{2,})$`)
+)
+
+var (
+	// ErrNotFediverse is returned, wrapping errors.ErrUnsupported, when the host of a URL answers neither
+	// the ActivityPub request nor the Mastodon API request with JSON. None of its URLs are worth a preview.
+	ErrNotFediverse = fmt.Errorf("%w: not a fediverse server", errors.ErrUnsupported)
+
+	// errNotJSON is returned by getJSON when the response is not a JSON document.
+	errNotJSON = errors.New("not a JSON document")
+)
+
+// excludedHosts use fediverse-like paths without speaking ActivityPub.
+var excludedHosts = map[string]bool{
+	"medium.com":        true,
+	"www.tiktok.com":    true,
+	"tiktok.com":        true,
+	"www.instagram.com": true,
+	"instagram.com":     true,
+}
+
+// Options configures the client.
+type Options struct {
+	// HTTPClient sends the requests. It must refuse non-public addresses, since any host may be queried,
+	// like the outbound client used when it is nil.
+	HTTPClient *http.Client
+}
+
+// Client builds previews of fediverse URLs.
+type Client struct {
+	client *http.Client
+}
+
+func New(opts Options) *Client {
+	c := &Client{client: opts.HTTPClient}
+	if c.client == nil {
+		c.client = outbound.NewClient(outbound.Options{})
+	}
+	return c
+}
+
+// Match reports whether u looks like the URL of a post or profile on a fediverse server.
+// Servers cannot be told apart by their host, so any host matches and Preview fails with
+// errors.ErrUnsupported when the URL turns out not to be an ActivityPub object.
+func (c *Client) Match(u *url.URL) bool {
+	if (u.Scheme != "http" && u.Scheme != "https") || excludedHosts[strings.ToLower(u.Hostname())] {
+		return false
+	}
+
+	for _, paths := range [][]*regexp.Regexp{postPaths, profilePaths} {
+		for _, re := range paths {
+			if re.MatchString(u.Path) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Preview returns the head of the preview document of a fediverse URL.
+// The URL is requested as ActivityPub first, then through the Mastodon API.
+// Profiles of other servers, like /@user@example.social, are resolved with WebFinger.
+func (c *Client) Preview(ctx context.Context, u *url.URL) (opengraph.Head, error) {
+	m := remoteProfile.FindStringSubmatch(u.Path)
+	if m != nil {
+		actorURL, err := c.webfinger(ctx, u.Scheme, m[1], m[2])
+		if err != nil {
+			return opengraph.Head{}, fmt.Errorf(
+				"%w: WebFinger lookup of @%s@%s failed: %v",
+				errors.ErrUnsupported, m[1], m[2], err,
+			)
+		}
+		u = actorURL
+	}
+
+	var obj object
+	apErr := c.getActivityPub(ctx, u.String(), &obj)
+	if apErr == nil {
+		return c.activityPubHead(ctx, u, obj)
+	}
+
+	head, err := c.mastodonHead(ctx, u)
+	if err != nil {
+		// Remote profiles were resolved with WebFinger, so their server is known to be a fediverse server.
+		reason := errors.ErrUnsupported
+		if m == nil && errors.Is(apErr, errNotJSON) && errors.Is(err, errNotJSON) {
+			reason = ErrNotFediverse
+		}
+		return opengraph.Head{}, fmt.Errorf("%w: not an ActivityPub object (%v) nor a Mastodon URL (%v)",
+			reason, apErr, err)
+	}
+
+	return head, nil
+}
+
+// object is the subset of an ActivityStreams object or actor used for previews.
+type object struct {
+	ID                string          `json:"id"`
+	Type              string          `json:"type"`
+	URL               json.RawMessage `json:"url"`
+	Name              string          `json:"name"`
+	PreferredUsername string          `json:"preferredUsername"`
+	Summary           string          `json:"summary"`
+	Content           string          `json:"content"`
+	Sensitive         bool            `json:"sensitive"`
+	Published         string          `json:"published"`
+	AttributedTo      json.RawMessage `json:"attributedTo"`
+	Attachment        json.RawMessage `json:"attachment"`
+	Icon              json.RawMessage `json:"icon"`
+}
+
+// attachment is an image, video or document attached to a post.
+type attachment struct {
+	Type      string          `json:"type"`
+	MediaType string          `json:"mediaType"`
+	URL       json.RawMessage `json:"url"`
+	Width     int             `json:"width"`
+	Height    int             `json:"height"`
+}
+
+// isActor reports whether the object is an account rather than a post.
+func (o object) isActor() bool {
+	switch o.Type {
+	case "Person", "Service", "Group", "Organization", "Application":
+		return true
+	default:
+		return false
+	}
+}
+
+// activityPubHead builds the preview of an ActivityPub post or actor.
+func (c *Client) activityPubHead(ctx context.Context, u *url.URL, obj object) (opengraph.Head, error) {
+	if obj.isActor() {
+		return actorHead(obj), nil
+	}
+
+	var author object
+	if id, embedded := firstObject(obj.AttributedTo); embedded != nil {
+		author = *embedded
+	} else if id != "" {
+		// A missing author still leaves a usable preview.
+		_ = c.getActivityPub(ctx, id, &author)
+	}
+
+	canonical := linkURL(obj.URL)
+	if canonical == "" {
+		canonical = obj.ID
+	}
+
+	p := post{
+		url:       canonical,
+		title:     obj.Name,
+		content:   obj.Content,
+		warning:   obj.Summary,
+		sensitive: obj.Sensitive,
+		published: obj.Published,
+		author:    author.Name,
+		handle:    handle(author),
+		avatar:    linkURL(author.Icon),
+	}
+
+	var attachments []attachment
+	if err := unmarshalOneOrMany(obj.Attachment, &attachments); err == nil {
+		for _, a := range attachments {
+			if strings.HasPrefix(a.MediaType, "image/") || a.Type == "Image" {
+				p.image, p.width, p.height = linkURL(a.URL), a.Width, a.Height
+				break
+			}
+		}
+	}
+
+	if p.author == "" {
+		p.author = author.PreferredUsername
+	}
+	if p.handle == "" {
+		p.handle = u.Host
+	}
+
+	return p.head(), nil
+}
+
+// actorHead builds the preview of an ActivityPub actor.
+func actorHead(actor object) opengraph.Head {
+	name := actor.Name
+	if name == "" {
+		name = actor.PreferredUsername
+	}
+
+	profileURL := linkURL(actor.URL)
+	if profileURL == "" {
+		profileURL = actor.ID
+	}
+
+	return profile{
+		url:    profileURL,
+		name:   name,
+		handle: handle(actor),
+		note:   actor.Summary,
+		avatar: linkURL(actor.Icon),
+	}.head()
+}
+
+// handle returns the @user@host address of an actor.
+func handle(actor object) string {
+	id, err := url.Parse(actor.ID)
+	if err != nil || actor.PreferredUsername == "" || id.Host == "" {
+		return ""
+	}
+	return "@" + actor.PreferredUsername + "@" + id.Host
+}
+
+// mastodonStatus and mastodonAccount are the subsets of the Mastodon API entities used for previews.
+type (
+	mastodonAccount struct {
+		Acct        string `json:"acct"`
+		Username    string `json:"username"`
+		DisplayName string `json:"display_name"`
+		Note        string `json:"note"`
+		URL         string `json:"url"`
+		Avatar      string `json:"avatar"`
+	}
+	mastodonStatus struct {
+		URL             string          `json:"url"`
+		Content         string          `json:"content"`
+		SpoilerText     string          `json:"spoiler_text"`
+		Sensitive       bool            `json:"sensitive"`
+		CreatedAt       string          `json:"created_at"`
+		Account         mastodonAccount `json:"account"`
+		MediaAttachment []struct {
+			Type       string `json:"type"`
+			URL        string `json:"url"`
+			PreviewURL string `json:"preview_url"`
+			Meta       struct {
+				Original struct {
+					Width  int `json:"width"`
+					Height int `json:"height"`
+				} `json:"original"`
+			} `json:"meta"`
+		} `json:"media_attachments"`
+	}
+)
+
+// mastodonHead builds the preview of a Mastodon post or profile from the public API of its server,
+// for servers requiring signed ActivityPub requests.
+func (c *Client) mastodonHead(ctx context.Context, u *url.URL) (opengraph.Head, error) {
+	base := u.Scheme + "://" + u.Host
+
+	if m := mastodonPost.FindStringSubmatch(u.Path); m != nil {
+		var status mastodonStatus
+		if err := c.getJSON(ctx, base+"/api/v1/statuses/"+m[1], "application/json", &status); err != nil {
+			return opengraph.Head{}, err
+		}
+
+		p := post{
+			url:       status.URL,
+			content:   status.Content,
+			warning:   status.SpoilerText,
+			sensitive: status.Sensitive,
+			published: status.CreatedAt,
+			author:    orElse(status.Account.DisplayName, status.Account.Username),
+			handle:    accountHandle(status.Account, u.Host),
+			avatar:    status.Account.Avatar,
+		}
+		for _, a := range status.MediaAttachment {
+			if a.Type == "image" || a.Type == "gifv" || a.Type == "video" {
+				p.image = orElse(a.PreviewURL, a.URL)
+				if a.Type == "image" {
+					p.image, p.width, p.height = a.URL, a.Meta.Original.Width, a.Meta.Original.Height
+				}
+				break
+			}
+		}
+
+		return p.head(), nil
+	}
+
+	if m := mastodonProfile.FindStringSubmatch(u.Path); m != nil {
+		var account mastodonAccount
+		lookup := base + "/api/v1/accounts/lookup?" + url.Values{"acct": {m[1]}}.Encode()
+		if err := c.getJSON(ctx, lookup, "application/json", &account); err != nil {
+			return opengraph.Head{}, err
+		}
+
+		return profile{
+			url:    account.URL,
+			name:   orElse(account.DisplayName, account.Username),
+			handle: accountHandle(account, u.Host),
+			note:   account.Note,
+			avatar: account.Avatar,
+		}.head(), nil
+	}
+
+	return opengraph.Head{}, errors.New("not a Mastodon post or profile URL")
+}
+
+// accountHandle returns the @user@host address of a Mastodon account, whose acct omits the host for local accounts.
+func accountHandle(a mastodonAccount, host string) string {
+	if strings.Contains(a.Acct, "@") {
+		return "@" + a.Acct
+	}
+	return "@" + a.Username + "@" + host
+}
+
+// webfinger resolves the ActivityPub actor of user@domain.
+// The scheme of the link is kept, so only https links resolve over https.
+func (c *Client) webfinger(ctx context.Context, scheme, user, domain string) (*url.URL, error) {
+	endpoint := scheme + "://" + domain + "/.well-known/webfinger?" +
+		url.Values{"resource": {"acct:" + user + "@" + domain}}.Encode()
+
+	var jrd struct {
+		Links []struct {
+			Rel  string `json:"rel"`
+			Type string `json:"type"`
+			Href string `json:"href"`
+		} `json:"links"`
+	}
+	if err := c.getJSON(ctx, endpoint, "application/jrd+json, application/json", &jrd); err != nil {
+		return nil, err
+	}
+
+	for _, link := range jrd.Links {
+		mediaType, _, _ := mime.ParseMediaType(link.Type)
+		if link.Rel == "self" && (mediaType == activityJSON || mediaType == "application/ld+json") {
+			u, err := url.Parse(link.Href)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return nil, fmt.Errorf("invalid actor URL %q", link.Href)
+			}
+			return u, nil
+		}
+	}
+
+	return nil, errors.New("no ActivityPub actor")
+}
+
+// getActivityPub decodes the ActivityPub object at rawURL into v.
+func (c *Client) getActivityPub(ctx context.Context, rawURL string, v *object) error {
+	if err := c.getJSON(ctx, rawURL, activityJSON+", "+ldJSON, v); err != nil {
+		return err
+	}
+	if v.Type == "" || v.ID == "" {
+		return errors.New("not an ActivityPub object")
+	}
+	return nil
+}
+
+// getJSON decodes the JSON document at rawURL into v, refusing any other content type.
+func (c *Client) getJSON(ctx context.Context, rawURL, accept string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", accept)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The content type is checked first, so that the errors of hosts that never answer with JSON
+	// can be told from the errors of a fediverse server, like a 404 for a deleted post.
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return fmt.Errorf("%w: status %d, content type %q", errNotJSON, resp.StatusCode, mediaType)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(v)
+}
+
+// post is a post of any fediverse server.
+type post struct {
+	url       string
+	title     string
+	content   string
+	warning   string
+	sensitive bool
+	published string
+	author    string
+	handle    string
+	avatar    string
+	image     string
+	width     int
+	height    int
+}
+
+// head returns the preview of the post.
+// Posts behind a content warning only show the warning, and their media is not shown if it is sensitive.
+func (p post) head() opengraph.Head {
+	title := p.title
+	if title == "" {
+		title = strings.TrimSpace(p.author + " (" + p.handle + ")")
+	}
+
+	head := opengraph.Head{Title: title, Charset: "utf-8"}
+	head.SetMeta("og:title", title)
+	head.SetMeta("og:type", "article")
+	head.SetMeta("og:url", opengraph.HTTPURL(p.url))
+	head.SetMeta("og:site_name", siteName(p.handle))
+	head.SetMeta("author", p.author)
+	head.SetMeta("article:published_time", p.published)
+
+	description := opengraph.StripTags(p.content)
+	if warning := strings.TrimSpace(opengraph.StripTags(p.warning)); warning != "" {
+		description = "CW: " + warning
+	}
+	head.SetMeta("og:description", opengraph.Truncate(description, opengraph.MaxDescriptionLength))
+
+	image := opengraph.HTTPURL(p.image)
+	if p.sensitive || image == "" {
+		image, p.width, p.height = opengraph.HTTPURL(p.avatar), 0, 0
+	}
+	if image != "" {
+		head.SetMeta("og:image", image)
+		head.SetMeta("og:image:width", opengraph.FormatPositive(p.width))
+		head.SetMeta("og:image:height", opengraph.FormatPositive(p.height))
+	}
+
+	return head
+}
+
+// profile is an account of any fediverse server.
+type profile struct {
+	url    string
+	name   string
+	handle string
+	note   string
+	avatar string
+}
+
+// head returns the preview of the profile.
+func (p profile) head() opengraph.Head {
+	title := strings.TrimSpace(p.name + " (" + p.handle + ")")
+
+	head := opengraph.Head{Title: title, Charset: "utf-8"}
+	head.SetMeta("og:title", title)
+	head.SetMeta("og:type", "profile")
+	head.SetMeta("og:url", opengraph.HTTPURL(p.url))
+	head.SetMeta("og:site_name", siteName(p.handle))
+	head.SetMeta("og:description", opengraph.Truncate(opengraph.StripTags(p.note), opengraph.MaxDescriptionLength))
+	head.SetMeta("og:image", opengraph.HTTPURL(p.avatar))
+
+	return head
+}
+
+// siteName returns the server of a @user@host address.
+func siteName(handle string) string {
+	if i := strings.LastIndex(handle, "@"); i > 0 {
+		return handle[i+1:]
+	}
+	return ""
+}
+
+// firstObject returns the ID of the first object of an ActivityStreams property,
+// and the object itself when it is embedded rather than referenced by its ID.
+func firstObject(raw json.RawMessage) (string, *object) {
+	var id string
+	if json.Unmarshal(raw, &id) == nil {
+		return id, nil
+	}
+
+	var obj object
+	if json.Unmarshal(raw, &obj) == nil && obj.ID != "" {
+		return obj.ID, &obj
+	}
+
+	var items []json.RawMessage
+	if json.Unmarshal(raw, &items) == nil {
+		for _, item := range items {
+			if id, obj := firstObject(item); id != "" {
+				return id, obj
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// linkURL returns the first http(s) URL of an ActivityStreams url, icon or image property,
+// which may be a string, a Link or Image object, or an array of them.
+func linkURL(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return opengraph.HTTPURL(s)
+	}
+
+	var link struct {
+		Href string          `json:"href"`
+		URL  json.RawMessage `json:"url"`
+	}
+	if json.Unmarshal(raw, &link) == nil {
+		if link.Href != "" {
+			return opengraph.HTTPURL(link.Href)
+		}
+		if len(link.URL) > 0 {
+			return linkURL(link.URL)
+		}
+	}
+
+	var items []json.RawMessage
+	if json.Unmarshal(raw, &items) == nil {
+		for _, item := range items {
+			if u := linkURL(item); u != "" {
+				return u
+			}
+		}
+	}
+
+	return ""
+}
+
+// unmarshalOneOrMany decodes a property holding either a single value or an array of them.
+func unmarshalOneOrMany[T any](raw json.RawMessage, v *[]T) error {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(raw, v); err == nil {
+		return nil
+	}
+
+	var one T
+	if err := json.Unmarshal(raw, &one); err != nil {
+		return err
+	}
+	*v = []T{one}
+
+	return nil
+}
+
+// orElse returns s, or fallback when s is empty.
+func orElse(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
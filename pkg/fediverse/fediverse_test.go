@@ -0,0 +1,270 @@
+package fediverse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+)
+
+// newFakeInstance serves social.example, a Mastodon server answering ActivityPub requests,
+// and locked.example, a server requiring signed ActivityPub requests.
+// The returned client sends every request to it, whatever the host.
+func newFakeInstance(t *testing.T) *http.Client {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		activityPub := r.Header.Get("Accept") != "application/json"
+
+		writeJSON := func(contentType, body string) {
+			w.Header().Set("Content-Type", contentType)
+			fmt.Fprint(w, body)
+		}
+
+		switch r.Host + r.URL.Path {
+		case "social.example/@alice/111", "social.example/users/alice/statuses/111":
+			writeJSON("application/activity+json", `{
+				"id": "http://social.example/users/alice/statuses/111",
+				"type": "Note",
+				"url": "http://social.example/@alice/111",
+				"attributedTo": "http://social.example/users/alice",
+				"published": "2024-05-01T10:00:00Z",
+				"content": "<p>Hello <a href=\"http://social.example/tags/nostr\">#nostr</a> &amp; fediverse</p><p>Second paragraph</p>",
+				"attachment": [
+					{"type": "Document", "mediaType": "video/mp4", "url": "http://files.social.example/video.mp4"},
+					{"type": "Document", "mediaType": "image/png", "url": "http://files.social.example/photo.png", "width": 640, "height": 480}
+				]
+			}`)
+		case "social.example/@alice/222":
+			writeJSON("application/activity+json", `{
+				"id": "http://social.example/users/alice/statuses/222",
+				"type": "Note",
+				"attributedTo": {"id": "http://social.example/users/alice", "type": "Person", "name": "Alice", "preferredUsername": "alice"},
+				"summary": "spoilers",
+				"sensitive": true,
+				"content": "<p>The butler did it</p>",
+				"attachment": {"type": "Image", "mediaType": "image/jpeg", "url": "http://files.social.example/spoiler.jpg"}
+			}`)
+		case "social.example/users/alice", "social.example/@alice":
+			writeJSON("application/activity+json", `{
+				"id": "http://social.example/users/alice",
+				"type": "Person",
+				"url": "http://social.example/@alice",
+				"name": "Alice",
+				"preferredUsername": "alice",
+				"summary": "<p>Writing about <b>Nostr</b></p>",
+				"icon": {"type": "Image", "url": "http://files.social.example/alice.png"}
+			}`)
+		case "social.example/.well-known/webfinger":
+			if r.URL.Query().Get("resource") != "acct:alice@social.example" {
+				http.NotFound(w, r)
+				return
+			}
+			writeJSON("application/jrd+json", `{
+				"subject": "acct:alice@social.example",
+				"links": [
+					{"rel": "http://webfinger.net/rel/profile-page", "type": "text/html", "href": "http://social.example/@alice"},
+					{"rel": "self", "type": "application/activity+json", "href": "http://social.example/users/alice"}
+				]
+			}`)
+		case "locked.example/@bob/333":
+			if activityPub {
+				http.Error(w, "Request not signed", http.StatusUnauthorized)
+				return
+			}
+			http.NotFound(w, r)
+		case "locked.example/api/v1/statuses/333":
+			writeJSON("application/json", `{
+				"url": "http://locked.example/@bob/333",
+				"content": "<p>From the API</p>",
+				"created_at": "2024-05-02T10:00:00.000Z",
+				"account": {"username": "bob", "acct": "bob", "display_name": "Bob", "avatar": "http://locked.example/bob.png"},
+				"media_attachments": [{"type": "image", "url": "http://locked.example/cat.jpg", "preview_url": "http://locked.example/cat-small.jpg",
+					"meta": {"original": {"width": 1024, "height": 768}}}]
+			}`)
+		case "locked.example/api/v1/statuses/444":
+			// A deleted post.
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error": "Record not found"}`)
+		case "locked.example/api/v1/accounts/lookup":
+			writeJSON("application/json", `{"username": "bob", "acct": "bob", "display_name": "", "note": "<p>Hi</p>",
+				"url": "http://locked.example/@bob", "avatar": "http://locked.example/bob.png"}`)
+		case "locked.example/@bob":
+			http.Error(w, "Request not signed", http.StatusUnauthorized)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html><head><title>Not the fediverse</title></head></html>")
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	transport := srv.Client().Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+
+	return &http.Client{Transport: transport}
+}
+
+func TestClientMatch(t *testing.T) {
+	c := New(Options{})
+
+	tests := []struct {
+		url      string
+		expected bool
+	}{
+		{"https://mastodon.social/@Gargron/109318834468391637", true},
+		{"https://mastodon.social/@Gargron", true},
+		{"https://mastodon.social/@Gargron@mastodon.social", true},
+		{"https://mastodon.social/users/Gargron/statuses/109318834468391637", true},
+		{"https://pleroma.example/notice/AbCdEf123", true},
+		{"https://misskey.io/notes/9k2x1abcde", true},
+		{"https://medium.com/@author", false},
+		{"https://example.com/blog/post", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+			if got := c.Match(u); got != tt.expected {
+				t.Errorf("Match() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClientPreview(t *testing.T) {
+	c := New(Options{HTTPClient: newFakeInstance(t)})
+
+	tests := []struct {
+		name     string
+		url      string
+		expected opengraph.Metadata
+	}{
+		{
+			name: "ActivityPub note",
+			url:  "http://social.example/@alice/111",
+			expected: opengraph.Metadata{
+				URL:         "http://social.example/@alice/111",
+				Title:       "Alice (@alice@social.example)",
+				Description: "Hello #nostr & fediverse\n\nSecond paragraph",
+				Image:       "http://files.social.example/photo.png",
+				ImageWidth:  640,
+				ImageHeight: 480,
+				SiteName:    "social.example",
+				Type:        "article",
+				Author:      "Alice",
+			},
+		},
+		{
+			name: "content warning and sensitive media",
+			url:  "http://social.example/@alice/222",
+			expected: opengraph.Metadata{
+				URL:         "http://social.example/users/alice/statuses/222",
+				Title:       "Alice (@alice@social.example)",
+				Description: "CW: spoilers",
+				SiteName:    "social.example",
+				Type:        "article",
+				Author:      "Alice",
+			},
+		},
+		{
+			name: "ActivityPub profile",
+			url:  "http://social.example/@alice",
+			expected: opengraph.Metadata{
+				URL:         "http://social.example/@alice",
+				Title:       "Alice (@alice@social.example)",
+				Description: "Writing about Nostr",
+				Image:       "http://files.social.example/alice.png",
+				SiteName:    "social.example",
+				Type:        "profile",
+			},
+		},
+		{
+			name: "WebFinger",
+			url:  "http://mastodon.example/@alice@social.example",
+			expected: opengraph.Metadata{
+				URL:         "http://social.example/@alice",
+				Title:       "Alice (@alice@social.example)",
+				Description: "Writing about Nostr",
+				Image:       "http://files.social.example/alice.png",
+				SiteName:    "social.example",
+				Type:        "profile",
+			},
+		},
+		{
+			name: "Mastodon API status",
+			url:  "http://locked.example/@bob/333",
+			expected: opengraph.Metadata{
+				URL:         "http://locked.example/@bob/333",
+				Title:       "Bob (@bob@locked.example)",
+				Description: "From the API",
+				Image:       "http://locked.example/cat.jpg",
+				ImageWidth:  1024,
+				ImageHeight: 768,
+				SiteName:    "locked.example",
+				Type:        "article",
+				Author:      "Bob",
+			},
+		},
+		{
+			name: "Mastodon API account",
+			url:  "http://locked.example/@bob",
+			expected: opengraph.Metadata{
+				URL:         "http://locked.example/@bob",
+				Title:       "bob (@bob@locked.example)",
+				Description: "Hi",
+				Image:       "http://locked.example/bob.png",
+				SiteName:    "locked.example",
+				Type:        "profile",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+
+			head, err := c.Preview(context.Background(), u)
+			if err != nil {
+				t.Fatalf("Preview() unexpected error: %v", err)
+			}
+
+			if md := head.Metadata(); md != tt.expected {
+				t.Errorf("Preview() metadata = %+v, expected %+v", md, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClientPreviewUnsupported(t *testing.T) {
+	c := New(Options{HTTPClient: newFakeInstance(t)})
+
+	tests := []struct {
+		target       string
+		notFediverse bool
+	}{
+		{target: "http://blog.example/@someone", notFediverse: true},
+		{target: "http://blog.example/@someone/123", notFediverse: true},
+		{target: "http://blog.example/@nobody@unknown.example"},
+		{target: "http://locked.example/@bob/444"},
+	}
+
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.target)
+		_, err := c.Preview(context.Background(), u)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			t.Errorf("Preview(%s) error = %v, expected errors.ErrUnsupported", tt.target, err)
+		}
+		if errors.Is(err, ErrNotFediverse) != tt.notFediverse {
+			t.Errorf("Preview(%s) error = %v, expected ErrNotFediverse %v", tt.target, err, tt.notFediverse)
+		}
+	}
+}
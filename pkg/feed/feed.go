@@ -0,0 +1,625 @@
+// Package feed parses RSS 2.0 and Atom feeds, with the iTunes and Podcasting 2.0 extensions of podcast feeds,
+// and builds link previews of feeds, of their episodes, and of the pages they link to.
+package feed
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+)
+
+// Media types of feeds, also used in <link rel="alternate"> elements to advertise the feed of a page.
+const (
+	TypeRSS  = "application/rss+xml"
+	TypeAtom = "application/atom+xml"
+)
+
+// MaxItems caps the number of items kept from a feed, in document order, which is newest first in practice.
+const MaxItems = 100
+
+// ErrNotFeed is returned by Parse for XML documents that are neither RSS nor Atom feeds.
+var ErrNotFeed = errors.New("not an RSS or Atom feed")
+
+// nsAtom is the namespace of Atom documents.
+const nsAtom = "http://www.w3.org/2005/Atom"
+
+// Feed is a channel and its items.
+type Feed struct {
+	Title string `json:"title,omitempty"`
+	// Description is plain text, like the descriptions of the items.
+	Description string `json:"description,omitempty"`
+	// Link is the website of the feed.
+	Link string `json:"link,omitempty"`
+	// Image is the artwork of the channel.
+	Image    string `json:"image,omitempty"`
+	Author   string `json:"author,omitempty"`
+	Language string `json:"language,omitempty"`
+	Items    []Item `json:"items,omitempty"`
+}
+
+// Item is an article or a podcast episode.
+type Item struct {
+	Title string `json:"title,omitempty"`
+	// Description is plain text, without markup, cut to 300 characters.
+	Description string    `json:"description,omitempty"`
+	Link        string    `json:"link,omitempty"`
+	GUID        string    `json:"guid,omitempty"`
+	Published   time.Time `json:"published,omitzero"`
+	Image       string    `json:"image,omitempty"`
+	Author      string    `json:"author,omitempty"`
+	// Duration is the length of an episode in seconds.
+	Duration  int       `json:"duration,omitempty"`
+	Season    int       `json:"season,omitempty"`
+	Episode   int       `json:"episode,omitempty"`
+	Enclosure Enclosure `json:"enclosure,omitzero"`
+}
+
+// Enclosure is the media file of a podcast episode.
+type Enclosure struct {
+	URL    string `json:"url,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Length int64  `json:"length,omitempty"`
+}
+
+// IsFeedType reports whether contentType is the media type of an RSS or Atom feed.
+// Generic XML types are not, since they need to be sniffed, see Sniff.
+func IsFeedType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == TypeRSS || mediaType == TypeAtom
+}
+
+// IsXMLType reports whether contentType is a generic XML media type, which feeds are often served with.
+func IsXMLType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/xml" || mediaType == "text/xml"
+}
+
+// Sniff reports whether the start of an XML document is the start of a feed, that is whether its root element,
+// found within data, is an RSS <rss> or an Atom <feed> element.
+func Sniff(data []byte) bool {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.CharsetReader = charset.NewReaderLabel
+	d.Strict = false
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return false
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return isRoot(start.Name)
+		}
+	}
+}
+
+func isRoot(name xml.Name) bool {
+	return (name.Local == "rss" && name.Space == "") || (name.Local == "feed" && name.Space == nsAtom)
+}
+
+// Parse reads an RSS 2.0 or Atom feed. The character encoding is taken from the XML declaration.
+// A truncated feed is returned with the items read until the cut.
+// Relative links are resolved against base, which may be nil, and links with a non http(s) scheme are dropped.
+func Parse(r io.Reader, base *url.URL) (Feed, error) {
+	d := xml.NewDecoder(r)
+	d.CharsetReader = charset.NewReaderLabel
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return Feed{}, ErrNotFeed
+			}
+			return Feed{}, err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if !isRoot(start.Name) {
+			return Feed{}, ErrNotFeed
+		}
+
+		// A feed cut by a size limit ends in the middle of an element, so decoding errors keep what was read.
+		// The decoder drops the item it was decoding.
+		if start.Name.Local == "rss" {
+			var doc rssDocument
+			if err := d.DecodeElement(&doc, &start); err != nil {
+				if doc.Channel.Title == "" && len(doc.Channel.Items) == 0 {
+					return Feed{}, err
+				}
+			}
+			return doc.Channel.feed(base), nil
+		}
+
+		var doc atomFeed
+		if err := d.DecodeElement(&doc, &start); err != nil {
+			if doc.Title == "" && len(doc.Entries) == 0 {
+				return Feed{}, err
+			}
+		}
+		return doc.feed(base), nil
+	}
+}
+
+// Item returns the item a URL fragment points to: the item whose GUID, link or enclosure URL is selector.
+// Without a selector, or when no item matches, it returns the latest item, if any, and reports whether it matched.
+func (f Feed) Item(selector string) (Item, bool) {
+	if selector != "" {
+		for _, item := range f.Items {
+			if item.GUID == selector || item.Link == selector || item.Enclosure.URL == selector {
+				return item, true
+			}
+		}
+	}
+
+	return f.Latest(), false
+}
+
+// Latest returns the most recently published item, or the first one when the items are not dated.
+func (f Feed) Latest() Item {
+	var latest Item
+	for i, item := range f.Items {
+		if i == 0 || item.Published.After(latest.Published) {
+			latest = item
+		}
+	}
+	return latest
+}
+
+// ItemByLink returns the item whose link is the page at pageURL, ignoring the scheme, a trailing slash and the fragment.
+func (f Feed) ItemByLink(pageURL string) (Item, bool) {
+	page := comparableURL(pageURL)
+	if page == "" {
+		return Item{}, false
+	}
+
+	for _, item := range f.Items {
+		if comparableURL(item.Link) == page {
+			return item, true
+		}
+	}
+
+	return Item{}, false
+}
+
+// ForPages returns f with only the items that are the link of one of the pages at pageURLs,
+// which is all Apply needs to complete the previews of those pages, and is small enough to be cached.
+func (f Feed) ForPages(pageURLs ...string) Feed {
+	trimmed := f
+	trimmed.Items = nil
+
+	for _, pageURL := range pageURLs {
+		item, ok := f.ItemByLink(pageURL)
+		if ok && !slices.ContainsFunc(trimmed.Items, func(i Item) bool { return i.Link == item.Link }) {
+			trimmed.Items = append(trimmed.Items, item)
+		}
+	}
+
+	return trimmed
+}
+
+// comparableURL returns rawURL without its scheme, fragment and trailing slash, and with a lowercase host.
+func comparableURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	s := strings.ToLower(u.Host) + strings.TrimSuffix(u.EscapedPath(), "/")
+	if u.RawQuery != "" {
+		s += "?" + u.RawQuery
+	}
+	return s
+}
+
+// rssDocument is an RSS 2.0 document. The elements of RSS have no namespace, while extensions reuse
+// their local names, like <itunes:title> or <media:description>, so the plain elements are decoded as rssText.
+type rssDocument struct {
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	ITunesImage   hrefAttr  `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+	ITunesAuthor  string    `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author"`
+	ITunesSummary string    `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd summary"`
+	ITunesTitle   string    `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd title"`
+	AtomLinks     []xmlLink `xml:"http://www.w3.org/2005/Atom link"`
+	Title         rssText   `xml:"title"`
+	Link          rssText   `xml:"link"`
+	Description   rssText   `xml:"description"`
+	Language      rssText   `xml:"language"`
+	Image         rssImage  `xml:"image"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssImage struct {
+	URL rssText `xml:"url"`
+}
+
+type rssItem struct {
+	ITunesImage    hrefAttr       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+	ITunesAuthor   string         `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author"`
+	ITunesSummary  string         `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd summary"`
+	ITunesTitle    string         `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd title"`
+	ITunesDuration string         `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	ITunesSeason   string         `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd season"`
+	ITunesEpisode  string         `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode"`
+	PodcastSeason  string         `xml:"https://podcastindex.org/namespace/1.0 season"`
+	PodcastEpisode string         `xml:"https://podcastindex.org/namespace/1.0 episode"`
+	PodcastImages  podcastImages  `xml:"https://podcastindex.org/namespace/1.0 images"`
+	MediaThumbnail urlAttr        `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	MediaContent   []mediaContent `xml:"http://search.yahoo.com/mrss/ content"`
+	Encoded        string         `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	DCCreator      string         `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Title          rssText        `xml:"title"`
+	Link           rssText        `xml:"link"`
+	Description    rssText        `xml:"description"`
+	Author         rssText        `xml:"author"`
+	GUID           rssText        `xml:"guid"`
+	PubDate        rssText        `xml:"pubDate"`
+	Enclosure      struct {
+		URL    string `xml:"url,attr"`
+		Type   string `xml:"type,attr"`
+		Length string `xml:"length,attr"`
+	} `xml:"enclosure"`
+}
+
+// rssText is the text of an element without a namespace. Elements of the same local name
+// in the namespace of an extension are skipped.
+type rssText string
+
+func (t *rssText) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if start.Name.Space != "" {
+		return d.Skip()
+	}
+
+	var s string
+	if err := d.DecodeElement(&s, &start); err != nil {
+		return err
+	}
+	*t = rssText(s)
+
+	return nil
+}
+
+// atomFeed is an Atom document.
+type atomFeed struct {
+	ITunesImage hrefAttr    `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+	Title       string      `xml:"http://www.w3.org/2005/Atom title"`
+	Subtitle    string      `xml:"http://www.w3.org/2005/Atom subtitle"`
+	Links       []xmlLink   `xml:"http://www.w3.org/2005/Atom link"`
+	Logo        string      `xml:"http://www.w3.org/2005/Atom logo"`
+	Icon        string      `xml:"http://www.w3.org/2005/Atom icon"`
+	Author      atomPerson  `xml:"http://www.w3.org/2005/Atom author"`
+	Lang        string      `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Entries     []atomEntry `xml:"http://www.w3.org/2005/Atom entry"`
+}
+
+type atomEntry struct {
+	MediaThumbnail urlAttr        `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	MediaGroup     mediaGroup     `xml:"http://search.yahoo.com/mrss/ group"`
+	MediaContent   []mediaContent `xml:"http://search.yahoo.com/mrss/ content"`
+	ITunesDuration string         `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	Title          string         `xml:"http://www.w3.org/2005/Atom title"`
+	ID             string         `xml:"http://www.w3.org/2005/Atom id"`
+	Links          []xmlLink      `xml:"http://www.w3.org/2005/Atom link"`
+	Published      string         `xml:"http://www.w3.org/2005/Atom published"`
+	Updated        string         `xml:"http://www.w3.org/2005/Atom updated"`
+	Summary        string         `xml:"http://www.w3.org/2005/Atom summary"`
+	Content        string         `xml:"http://www.w3.org/2005/Atom content"`
+	Author         atomPerson     `xml:"http://www.w3.org/2005/Atom author"`
+}
+
+type atomPerson struct {
+	Name string `xml:"http://www.w3.org/2005/Atom name"`
+}
+
+type xmlLink struct {
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Href   string `xml:"href,attr"`
+	Length string `xml:"length,attr"`
+}
+
+type hrefAttr struct {
+	Href string `xml:"href,attr"`
+}
+
+type urlAttr struct {
+	URL string `xml:"url,attr"`
+}
+
+type mediaContent struct {
+	URL    string `xml:"url,attr"`
+	Medium string `xml:"medium,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// mediaGroup is the <media:group> of YouTube feeds.
+type mediaGroup struct {
+	Thumbnail   urlAttr `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	Description string  `xml:"http://search.yahoo.com/mrss/ description"`
+}
+
+// podcastImages is a <podcast:images srcset="..."> element.
+type podcastImages struct {
+	Srcset string `xml:"srcset,attr"`
+}
+
+func (c rssChannel) feed(base *url.URL) Feed {
+	f := Feed{
+		Title:       firstText(string(c.Title), c.ITunesTitle),
+		Description: text(firstText(string(c.Description), c.ITunesSummary)),
+		Link:        absURL(base, string(c.Link)),
+		Image:       firstURL(base, c.ITunesImage.Href, string(c.Image.URL)),
+		Author:      strings.TrimSpace(c.ITunesAuthor),
+		Language:    strings.TrimSpace(string(c.Language)),
+	}
+	if f.Link == "" {
+		f.Link = absURL(base, atomLink(c.AtomLinks, "alternate"))
+	}
+
+	for _, it := range c.Items {
+		if len(f.Items) == MaxItems {
+			break
+		}
+
+		item := Item{
+			Title:       firstText(string(it.Title), it.ITunesTitle),
+			Description: text(firstText(string(it.Description), it.ITunesSummary, it.Encoded)),
+			Link:        absURL(base, string(it.Link)),
+			GUID:        strings.TrimSpace(string(it.GUID)),
+			Published:   parseTime(string(it.PubDate)),
+			Image:       firstURL(base, it.ITunesImage.Href, largestImage(it.PodcastImages.Srcset), it.MediaThumbnail.URL, mediaImage(it.MediaContent)),
+			Author:      firstText(it.ITunesAuthor, it.DCCreator, string(it.Author)),
+			Duration:    parseDuration(it.ITunesDuration),
+			Season:      firstInt(it.PodcastSeason, it.ITunesSeason),
+			Episode:     firstInt(it.PodcastEpisode, it.ITunesEpisode),
+			Enclosure: Enclosure{
+				URL:  absURL(base, it.Enclosure.URL),
+				Type: strings.TrimSpace(it.Enclosure.Type),
+			},
+		}
+		if item.Enclosure.URL != "" {
+			item.Enclosure.Length, _ = strconv.ParseInt(strings.TrimSpace(it.Enclosure.Length), 10, 64)
+		} else {
+			item.Enclosure = Enclosure{}
+		}
+
+		f.Items = append(f.Items, item)
+	}
+
+	return f
+}
+
+func (a atomFeed) feed(base *url.URL) Feed {
+	f := Feed{
+		Title:       strings.TrimSpace(a.Title),
+		Description: text(a.Subtitle),
+		Link:        absURL(base, atomLink(a.Links, "alternate")),
+		Image:       firstURL(base, a.ITunesImage.Href, a.Logo, a.Icon),
+		Author:      strings.TrimSpace(a.Author.Name),
+		Language:    strings.TrimSpace(a.Lang),
+	}
+
+	for _, e := range a.Entries {
+		if len(f.Items) == MaxItems {
+			break
+		}
+
+		published := parseTime(e.Published)
+		if published.IsZero() {
+			published = parseTime(e.Updated)
+		}
+
+		item := Item{
+			Title:       strings.TrimSpace(e.Title),
+			Description: text(firstText(e.Summary, e.MediaGroup.Description, e.Content)),
+			Link:        absURL(base, atomLink(e.Links, "alternate")),
+			GUID:        strings.TrimSpace(e.ID),
+			Published:   published,
+			Image:       firstURL(base, e.MediaThumbnail.URL, e.MediaGroup.Thumbnail.URL, mediaImage(e.MediaContent)),
+			Author:      strings.TrimSpace(e.Author.Name),
+			Duration:    parseDuration(e.ITunesDuration),
+		}
+
+		for _, l := range e.Links {
+			if strings.EqualFold(l.Rel, "enclosure") {
+				if u := absURL(base, l.Href); u != "" {
+					item.Enclosure.URL = u
+					item.Enclosure.Type = strings.TrimSpace(l.Type)
+					item.Enclosure.Length, _ = strconv.ParseInt(strings.TrimSpace(l.Length), 10, 64)
+					break
+				}
+			}
+		}
+
+		f.Items = append(f.Items, item)
+	}
+
+	return f
+}
+
+// atomLink returns the href of the first link of relation rel. Links without a rel are alternate links.
+func atomLink(links []xmlLink, rel string) string {
+	for _, l := range links {
+		r := strings.ToLower(strings.TrimSpace(l.Rel))
+		if r == rel || (r == "" && rel == "alternate") {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+// mediaImage returns the URL of the first image of a list of <media:content> elements.
+func mediaImage(contents []mediaContent) string {
+	for _, c := range contents {
+		if c.Medium == "image" || strings.HasPrefix(c.Type, "image/") {
+			return c.URL
+		}
+	}
+	return ""
+}
+
+// largestImage returns the widest candidate of a srcset, like "a.jpg 1500w, b.jpg 600w".
+func largestImage(srcset string) string {
+	var (
+		best      string
+		bestWidth = -1
+	)
+
+	for _, candidate := range strings.Split(srcset, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+
+		width := 0
+		if len(fields) > 1 {
+			width, _ = strconv.Atoi(strings.TrimSuffix(fields[1], "w"))
+		}
+		if width > bestWidth {
+			best, bestWidth = fields[0], width
+		}
+	}
+
+	return best
+}
+
+// timeLayouts are the date formats found in feeds: RFC 822 with its many variants in RSS, RFC 3339 in Atom.
+var timeLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"Mon, 2 Jan 2006 15:04 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	time.RFC822Z,
+	time.RFC822,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// parseTime returns the time of a feed date, or the zero time when it has none of the known formats.
+func parseTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+
+	return time.Time{}
+}
+
+// parseDuration returns the seconds of an <itunes:duration>, given as seconds, MM:SS or HH:MM:SS.
+func parseDuration(s string) int {
+	seconds := 0
+	for _, part := range strings.Split(strings.TrimSpace(s), ":") {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return 0
+		}
+		seconds = seconds*60 + int(n)
+	}
+	return seconds
+}
+
+// text returns the plain text of an HTML description, cut to the length of the descriptions of the previews.
+func text(s string) string {
+	return opengraph.Truncate(opengraph.StripTags(strings.TrimSpace(s)), opengraph.MaxDescriptionLength)
+}
+
+func firstText(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func firstInt(values ...string) int {
+	for _, v := range values {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+func firstURL(base *url.URL, refs ...string) string {
+	for _, ref := range refs {
+		if u := absURL(base, ref); u != "" {
+			return u
+		}
+	}
+	return ""
+}
+
+// absURL resolves ref against base and returns it if it is an http(s) URL, and an empty string otherwise.
+func absURL(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+
+	return u.String()
+}
+
+// Fetch gets and parses the feed at feedURL, reading at most maxBytes of it.
+// The request goes through client, which is expected to refuse non-public addresses.
+func Fetch(ctx context.Context, client *http.Client, feedURL string, maxBytes int64) (Feed, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return Feed{}, err
+	}
+	req.Header.Set("Accept", TypeRSS+", "+TypeAtom+", application/xml;q=0.9, text/xml;q=0.8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Feed{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Feed{}, fmt.Errorf("feed returned status %d", resp.StatusCode)
+	}
+
+	return Parse(io.LimitReader(resp.Body, maxBytes), resp.Request.URL)
+}
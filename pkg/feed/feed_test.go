@@ -0,0 +1,345 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+)
+
+const podcastFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd"
+	xmlns:podcast="https://podcastindex.org/namespace/1.0" xmlns:media="http://search.yahoo.com/mrss/"
+	xmlns:atom="http://www.w3.org/2005/Atom">
+<channel>
+	<title>Nostr Talks</title>
+	<itunes:title>Nostr Talks (iTunes)</itunes:title>
+	<link>https://podcast.example/</link>
+	<atom:link href="https://podcast.example/feed.xml" rel="self" type="application/rss+xml"/>
+	<description><![CDATA[<p>Conversations about <b>Nostr</b>.</p>]]></description>
+	<language>en</language>
+	<itunes:author>Alice</itunes:author>
+	<itunes:image href="https://podcast.example/artwork.jpg"/>
+	<image><url>https://podcast.example/small.jpg</url></image>
+	<item>
+		<title>Episode 1: Relays</title>
+		<itunes:title>Relays</itunes:title>
+		<link>https://podcast.example/episodes/1</link>
+		<guid isPermaLink="false">ep-1</guid>
+		<pubDate>Mon, 02 Jun 2025 10:00:00 +0000</pubDate>
+		<description>All about relays.</description>
+		<enclosure url="https://cdn.example/ep1.mp3" type="audio/mpeg" length="1234"/>
+		<itunes:duration>45:30</itunes:duration>
+		<itunes:episode>1</itunes:episode>
+		<itunes:season>2</itunes:season>
+	</item>
+	<item>
+		<title>Episode 2: Zaps</title>
+		<link>/episodes/2</link>
+		<guid>ep-2</guid>
+		<pubDate>Mon, 9 Jun 2025 10:00:00 GMT</pubDate>
+		<description>Lightning &amp; zaps.</description>
+		<media:description>Not this one.</media:description>
+		<enclosure url="https://cdn.example/ep2.mp3" type="audio/mpeg" length="5678"/>
+		<itunes:duration>3723</itunes:duration>
+		<podcast:episode>2</podcast:episode>
+		<podcast:images srcset="https://podcast.example/ep2-600.jpg 600w, https://podcast.example/ep2-1500.jpg 1500w"/>
+	</item>
+</channel>
+</rss>`
+
+const atomFeedDoc = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/" xml:lang="fr">
+	<title>Le blog</title>
+	<subtitle>Notes et articles</subtitle>
+	<link href="https://blog.example/" />
+	<link rel="self" href="https://blog.example/atom.xml" />
+	<logo>https://blog.example/logo.png</logo>
+	<author><name>Bob</name></author>
+	<entry>
+		<title>Premier article</title>
+		<id>tag:blog.example,2025:1</id>
+		<link rel="alternate" href="https://blog.example/posts/1" />
+		<updated>2025-05-01T08:00:00Z</updated>
+		<summary type="html">&lt;p&gt;Bonjour&lt;/p&gt;</summary>
+		<media:thumbnail url="https://blog.example/1.jpg" />
+	</entry>
+</feed>`
+
+func TestParse(t *testing.T) {
+	base, _ := url.Parse("https://podcast.example/feed.xml")
+
+	f, err := Parse(strings.NewReader(podcastFeed), base)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	expected := Feed{
+		Title:       "Nostr Talks",
+		Description: "Conversations about Nostr.",
+		Link:        "https://podcast.example/",
+		Image:       "https://podcast.example/artwork.jpg",
+		Author:      "Alice",
+		Language:    "en",
+		Items: []Item{
+			{
+				Title:       "Episode 1: Relays",
+				Description: "All about relays.",
+				Link:        "https://podcast.example/episodes/1",
+				GUID:        "ep-1",
+				Published:   time.Date(2025, 6, 2, 10, 0, 0, 0, time.UTC),
+				Duration:    45*60 + 30,
+				Season:      2,
+				Episode:     1,
+				Enclosure:   Enclosure{URL: "https://cdn.example/ep1.mp3", Type: "audio/mpeg", Length: 1234},
+			},
+			{
+				Title:       "Episode 2: Zaps",
+				Description: "Lightning & zaps.",
+				Link:        "https://podcast.example/episodes/2",
+				GUID:        "ep-2",
+				Published:   time.Date(2025, 6, 9, 10, 0, 0, 0, time.UTC),
+				Image:       "https://podcast.example/ep2-1500.jpg",
+				Duration:    3723,
+				Episode:     2,
+				Enclosure:   Enclosure{URL: "https://cdn.example/ep2.mp3", Type: "audio/mpeg", Length: 5678},
+			},
+		},
+	}
+	if !reflect.DeepEqual(f, expected) {
+		t.Errorf("Parse() = %+v, expected %+v", f, expected)
+	}
+
+	f, err = Parse(strings.NewReader(atomFeedDoc), nil)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	expected = Feed{
+		Title:       "Le blog",
+		Description: "Notes et articles",
+		Link:        "https://blog.example/",
+		Image:       "https://blog.example/logo.png",
+		Author:      "Bob",
+		Language:    "fr",
+		Items: []Item{
+			{
+				Title:       "Premier article",
+				Description: "Bonjour",
+				Link:        "https://blog.example/posts/1",
+				GUID:        "tag:blog.example,2025:1",
+				Published:   time.Date(2025, 5, 1, 8, 0, 0, 0, time.UTC),
+				Image:       "https://blog.example/1.jpg",
+			},
+		},
+	}
+	if !reflect.DeepEqual(f, expected) {
+		t.Errorf("Parse() = %+v, expected %+v", f, expected)
+	}
+
+	if _, err := Parse(strings.NewReader(`<?xml version="1.0"?><sitemap></sitemap>`), nil); !errors.Is(err, ErrNotFeed) {
+		t.Errorf("Parse() error = %v, expected %v", err, ErrNotFeed)
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	// Cut in the middle of the second item.
+	truncated := podcastFeed[:strings.Index(podcastFeed, "<media:description>")]
+
+	f, err := Parse(strings.NewReader(truncated), nil)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if f.Title != "Nostr Talks" || len(f.Items) != 1 || f.Items[0].GUID != "ep-1" {
+		t.Errorf("Parse() = %+v, expected the channel and its first item", f)
+	}
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected bool
+	}{
+		{data: podcastFeed[:strings.Index(podcastFeed, "<channel>")], expected: true},
+		{data: atomFeedDoc[:strings.Index(atomFeedDoc, "<title>")], expected: true},
+		{data: `<?xml version="1.0"?><!-- a comment --><rss version="2.0">`, expected: true},
+		{data: `<?xml version="1.0"?><feed>`, expected: false},
+		{data: `<?xml version="1.0"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`, expected: false},
+		{data: `not xml`, expected: false},
+	}
+
+	for _, tt := range tests {
+		if got := Sniff([]byte(tt.data)); got != tt.expected {
+			t.Errorf("Sniff(%q) = %v, expected %v", tt.data, got, tt.expected)
+		}
+	}
+}
+
+func TestHead(t *testing.T) {
+	base, _ := url.Parse("https://podcast.example/feed.xml")
+
+	f, err := Parse(strings.NewReader(podcastFeed), base)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		url      string
+		expected opengraph.Metadata
+	}{
+		{
+			name: "channel",
+			url:  "https://podcast.example/feed.xml",
+			expected: opengraph.Metadata{
+				URL:         "https://podcast.example/feed.xml",
+				Title:       "Nostr Talks",
+				Description: "Conversations about Nostr.\n\nLatest: Episode 2: Zaps",
+				Image:       "https://podcast.example/artwork.jpg",
+				SiteName:    "Nostr Talks",
+				Type:        "website",
+				Author:      "Alice",
+			},
+		},
+		{
+			name: "episode by GUID",
+			url:  "https://podcast.example/feed.xml#ep-1",
+			expected: opengraph.Metadata{
+				URL:         "https://podcast.example/episodes/1",
+				Title:       "Episode 1: Relays",
+				Description: "All about relays.",
+				Image:       "https://podcast.example/artwork.jpg",
+				SiteName:    "Nostr Talks",
+				Type:        "music.song",
+				Author:      "Alice",
+				Duration:    2730,
+			},
+		},
+		{
+			name: "episode by enclosure",
+			url:  "https://podcast.example/feed.xml#https://cdn.example/ep2.mp3",
+			expected: opengraph.Metadata{
+				URL:         "https://podcast.example/episodes/2",
+				Title:       "Episode 2: Zaps",
+				Description: "Lightning & zaps.",
+				Image:       "https://podcast.example/ep2-1500.jpg",
+				SiteName:    "Nostr Talks",
+				Type:        "music.song",
+				Author:      "Alice",
+				Duration:    3723,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+			if got := f.Head(u).Metadata(); got != tt.expected {
+				t.Errorf("Head() metadata = %+v, expected %+v", got, tt.expected)
+			}
+		})
+	}
+
+	u, _ := url.Parse("https://podcast.example/feed.xml#ep-1")
+	head := f.Head(u)
+	if audio := head.Meta("og:audio"); audio != "https://cdn.example/ep1.mp3" {
+		t.Errorf("Head() og:audio = %q, expected %q", audio, "https://cdn.example/ep1.mp3")
+	}
+	if label, data := head.Meta("twitter:label1"), head.Meta("twitter:data1"); label != "Duration" || data != "45:30" {
+		t.Errorf("Head() twitter:label1 = %q %q, expected %q %q", label, data, "Duration", "45:30")
+	}
+	if data := head.Meta("twitter:data2"); data != "S2 E1" {
+		t.Errorf("Head() twitter:data2 = %q, expected %q", data, "S2 E1")
+	}
+}
+
+func TestApply(t *testing.T) {
+	f, err := Parse(strings.NewReader(podcastFeed), nil)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	// An episode page with a title only gets the description, the artwork and the audio of the episode.
+	var head opengraph.Head
+	head.SetMeta("og:title", "Relays | Nostr Talks")
+	f.Apply(&head, "http://podcast.example/episodes/1/")
+
+	expected := opengraph.Metadata{
+		Title:       "Relays | Nostr Talks",
+		Description: "All about relays.",
+		Image:       "https://podcast.example/artwork.jpg",
+		SiteName:    "Nostr Talks",
+		Author:      "Alice",
+		Duration:    2730,
+	}
+	if got := head.Metadata(); got != expected {
+		t.Errorf("Apply() metadata = %+v, expected %+v", got, expected)
+	}
+	if audio := head.Meta("og:audio"); audio != "https://cdn.example/ep1.mp3" {
+		t.Errorf("Apply() og:audio = %q, expected %q", audio, "https://cdn.example/ep1.mp3")
+	}
+
+	// Other pages get what they lack from the channel.
+	head = opengraph.Head{}
+	head.SetMeta("og:description", "About us")
+	f.Apply(&head, "https://podcast.example/about")
+
+	expected = opengraph.Metadata{
+		Description: "About us",
+		Image:       "https://podcast.example/artwork.jpg",
+		SiteName:    "Nostr Talks",
+	}
+	if got := head.Metadata(); got != expected {
+		t.Errorf("Apply() metadata = %+v, expected %+v", got, expected)
+	}
+}
+
+func TestForPages(t *testing.T) {
+	f, err := Parse(strings.NewReader(podcastFeed), nil)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	trimmed := f.ForPages("https://podcast.example/episodes/1", "http://podcast.example/episodes/1/")
+	if len(trimmed.Items) != 1 || trimmed.Items[0].GUID != "ep-1" {
+		t.Errorf("ForPages() items = %+v, expected the episode linked by the page", trimmed.Items)
+	}
+	if trimmed.Title != f.Title || trimmed.Image != f.Image || trimmed.Description != f.Description {
+		t.Errorf("ForPages() = %+v, expected the channel of %+v", trimmed, f)
+	}
+
+	if trimmed := f.ForPages("https://podcast.example/about"); len(trimmed.Items) != 0 {
+		t.Errorf("ForPages() items = %+v, expected none", trimmed.Items)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/feed.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(podcastFeed))
+	}))
+	defer ts.Close()
+
+	f, err := Fetch(context.Background(), ts.Client(), ts.URL+"/feed.xml", 1<<20)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if f.Title != "Nostr Talks" || len(f.Items) != 2 {
+		t.Errorf("Fetch() = %+v, expected the podcast feed", f)
+	}
+
+	if _, err := Fetch(context.Background(), ts.Client(), ts.URL+"/missing.xml", 1<<20); err == nil {
+		t.Errorf("Fetch() expected an error for a missing feed")
+	}
+}
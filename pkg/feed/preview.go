@@ -0,0 +1,204 @@
+package feed
+
+import (
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+)
+
+// Head returns the preview of the feed at u. When the fragment of u is the GUID, the link or the enclosure URL
+// of an item, like in https://example.com/podcast.xml#episode-42, the preview is the one of the item.
+// Otherwise, it describes the channel and its latest item.
+func (f Feed) Head(u *url.URL) opengraph.Head {
+	if item, ok := f.Item(u.Fragment); ok {
+		return f.itemHead(u, item)
+	}
+
+	title := f.Title
+	if title == "" {
+		title = u.Hostname()
+	}
+
+	head := opengraph.Head{Title: title, Charset: "utf-8"}
+	head.SetMeta("og:title", title)
+	head.SetMeta("og:site_name", f.siteName(u))
+	head.SetMeta("og:url", u.String())
+	head.SetMeta("og:type", "website")
+	head.SetMeta("og:image", f.Image)
+	head.SetMeta("author", f.Author)
+	head.SetMeta("twitter:card", "summary")
+
+	description := f.Description
+	if len(f.Items) > 0 {
+		latest := f.Latest()
+		if latest.Title != "" {
+			if description != "" {
+				description += "\n\n"
+			}
+			description += "Latest: " + latest.Title
+
+			head.SetMeta("twitter:label1", "Latest")
+			head.SetMeta("twitter:data1", latest.Title)
+		}
+		if !latest.Published.IsZero() {
+			head.SetMeta("twitter:label2", "Published")
+			head.SetMeta("twitter:data2", formatDate(latest.Published))
+		}
+	}
+	head.SetMeta("og:description", description)
+
+	return head
+}
+
+// itemHead returns the preview of an item of the feed at u.
+func (f Feed) itemHead(u *url.URL, item Item) opengraph.Head {
+	title := item.Title
+	if title == "" {
+		title = f.Title
+	}
+
+	link := item.Link
+	if link == "" {
+		link = u.String()
+	}
+
+	head := opengraph.Head{Title: title, Charset: "utf-8"}
+	head.SetMeta("og:title", title)
+	head.SetMeta("og:site_name", f.siteName(u))
+	head.SetMeta("og:url", link)
+	head.SetMeta("og:description", item.Description)
+	head.SetMeta("og:image", firstText(item.Image, f.Image))
+	head.SetMeta("author", firstText(item.Author, f.Author))
+	head.SetMeta("twitter:card", "summary")
+
+	if typ := setEnclosure(&head, item); typ != "" {
+		head.SetMeta("og:type", typ)
+	} else {
+		head.SetMeta("og:type", "article")
+	}
+
+	var labels [][2]string
+	if item.Duration > 0 {
+		labels = append(labels, [2]string{"Duration", opengraph.FormatDuration(time.Duration(item.Duration) * time.Second)})
+	}
+	if number := formatEpisode(item); number != "" {
+		labels = append(labels, [2]string{"Episode", number})
+	}
+	if !item.Published.IsZero() {
+		labels = append(labels, [2]string{"Published", formatDate(item.Published)})
+	}
+	for i, label := range labels[:min(len(labels), 2)] {
+		head.SetMeta("twitter:label"+strconv.Itoa(i+1), label[0])
+		head.SetMeta("twitter:data"+strconv.Itoa(i+1), label[1])
+	}
+
+	return head
+}
+
+// Apply completes the preview of a page advertising the feed with the item the page is the link of,
+// like the page of a podcast episode, or else with the channel. The item is looked up by the canonical URL
+// of the page, then by pageURL. The values of the page are kept.
+func (f Feed) Apply(h *opengraph.Head, pageURL string) {
+	md := h.Metadata()
+
+	if md.SiteName == "" {
+		h.SetMeta("og:site_name", f.Title)
+	}
+
+	item, ok := f.ItemByLink(md.URL)
+	if !ok {
+		item, ok = f.ItemByLink(pageURL)
+	}
+	if !ok {
+		if md.Description == "" {
+			h.SetMeta("og:description", f.Description)
+		}
+		if md.Image == "" {
+			h.SetMeta("og:image", f.Image)
+		}
+		return
+	}
+
+	if md.Title == "" {
+		h.SetMeta("og:title", item.Title)
+	}
+	if md.Description == "" {
+		h.SetMeta("og:description", item.Description)
+	}
+	if md.Image == "" {
+		h.SetMeta("og:image", firstText(item.Image, f.Image))
+	}
+	if md.Author == "" {
+		h.SetMeta("author", firstText(item.Author, f.Author))
+	}
+	if h.Meta("og:audio") == "" && h.Meta("og:video") == "" {
+		setEnclosure(h, item)
+	}
+}
+
+// setEnclosure describes the audio or video file of a podcast episode,
+// and returns the Open Graph type of the episode, if it has one.
+func setEnclosure(h *opengraph.Head, item Item) string {
+	if item.Enclosure.URL == "" {
+		return ""
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(item.Enclosure.Type)
+	if mediaType == "" {
+		if u, err := url.Parse(item.Enclosure.URL); err == nil {
+			mediaType, _, _ = mime.ParseMediaType(mime.TypeByExtension(path.Ext(u.Path)))
+		}
+	}
+
+	switch strings.SplitN(mediaType, "/", 2)[0] {
+	case "audio":
+		h.SetMeta("og:audio", item.Enclosure.URL)
+		h.SetMeta("og:audio:type", mediaType)
+		if item.Duration > 0 {
+			h.SetMeta("music:duration", strconv.Itoa(item.Duration))
+		}
+		return "music.song"
+	case "video":
+		h.SetMeta("og:video", item.Enclosure.URL)
+		h.SetMeta("og:video:type", mediaType)
+		if item.Duration > 0 {
+			h.SetMeta("video:duration", strconv.Itoa(item.Duration))
+		}
+		return "video.other"
+	default:
+		return ""
+	}
+}
+
+// siteName returns the name of the channel, or the host of its website or of the feed.
+func (f Feed) siteName(u *url.URL) string {
+	if f.Title != "" {
+		return f.Title
+	}
+	if link, err := url.Parse(f.Link); err == nil && link.Hostname() != "" {
+		return link.Hostname()
+	}
+	return u.Hostname()
+}
+
+// formatEpisode returns the season and episode numbers of an item, like S2 E15.
+func formatEpisode(item Item) string {
+	switch {
+	case item.Episode > 0 && item.Season > 0:
+		return "S" + strconv.Itoa(item.Season) + " E" + strconv.Itoa(item.Episode)
+	case item.Episode > 0:
+		return strconv.Itoa(item.Episode)
+	default:
+		return ""
+	}
+}
+
+// formatDate returns the day of t, like Jan 2, 2006.
+func formatDate(t time.Time) string {
+	return t.Format("Jan 2, 2006")
+}
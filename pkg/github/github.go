@@ -3,12 +3,16 @@ package github
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/go-github/v74/github"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/logging"
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
 )
 
 type ResourceType int
@@ -67,6 +71,20 @@ func New(apiKey string) *GithubClient {
 	return &GithubClient{client: c}
 }
 
+// CheckRateLimit verifies that the token is accepted by the GitHub API and that the core rate limit is not exhausted.
+func (gc *GithubClient) CheckRateLimit(ctx context.Context) error {
+	limits, _, err := gc.client.RateLimit.Get(ctx)
+	if err != nil {
+		return err
+	}
+
+	if core := limits.GetCore(); core != nil && core.Remaining == 0 {
+		return fmt.Errorf("GitHub API rate limit exhausted until %s", core.Reset.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
 // IsGitHubURL method determines if a given URL belongs to GitHub.
 func (gc *GithubClient) IsGitHubURL(url string) bool {
 	return strings.Contains(strings.ToLower(url), "github.com") ||
@@ -168,14 +186,15 @@ func (gc *GithubClient) queryGitHubResource(
 		return resp, err
 	}
 
-	hash := time.Now().Unix()
-	baseURL := fmt.Sprintf(
-		"https://opengraph.githubassets.com/%d/%s/%s",
-		hash,
-		resourceInfo.Owner,
-		resourceInfo.Repo,
+	logging.FromContext(ctx).Debug(
+		"Querying the GitHub API",
+		slog.String("resource_type", resourceInfo.Type.String()),
+		slog.String("owner", resourceInfo.Owner),
+		slog.String("repo", resourceInfo.Repo),
 	)
 
+	baseURL := SocialImageURL(resourceInfo.Owner, resourceInfo.Repo)
+
 	switch resourceInfo.Type {
 	case User:
 		u, _, err := gc.client.Users.Get(ctx, resourceInfo.Owner)
@@ -314,37 +333,62 @@ func (gc *GithubClient) queryGitHubResource(
 	}
 }
 
+// Preview returns the head of the preview document of a GitHub URL.
+func (gc *GithubClient) Preview(ctx context.Context, rawURL string) (opengraph.Head, error) {
+	resp, err := gc.queryGitHubResource(ctx, rawURL)
+	if err != nil {
+		return opengraph.Head{}, err
+	}
+
+	return PreviewHead(resp.Title, resp.Body, rawURL, resp.imgageSrc), nil
+}
+
+// GenerateGithubOpenGraph returns the HTML document with the Open Graph data of a GitHub URL.
 func (gc *GithubClient) GenerateGithubOpenGraph(
 	ctx context.Context,
 	rawURL string,
 ) (string, error) {
-	resp, err := gc.queryGitHubResource(ctx, rawURL)
+	head, err := gc.Preview(ctx, rawURL)
 	if err != nil {
 		return "", err
 	}
 
-	htmlContent := fmt.Sprintf(`<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="utf-8">
-    <title>%s</title>
-    <meta property="og:title" content="%s">
-    <meta property="og:description" content="%s">
-    <meta property="og:url" content="%s">
-    <meta property="og:image" content="%s">
-    <meta property="og:image:width" content="1200">
-    <meta property="og:image:height" content="630">
-    <meta property="og:type" content="website">
-    <meta property="og:site_name" content="GitHub">
-</head>
-<body>
-    <h1>%s</h1>
-    <p>%s</p>
-    <img src="%s" alt="Preview" style="max-width: 100%%; height: auto;">
-</body>
-</html>`,
-		resp.Title, resp.Title, resp.Body, rawURL, resp.imgageSrc,
-		resp.Title, resp.Body, resp.imgageSrc)
-
-	return htmlContent, nil
+	var b strings.Builder
+	if err := head.Render(&b); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// PreviewHead returns the head of a preview document laid out like the GitHub previews: the title,
+// the description, the URL and the image of a resource, shown as a large card for the social preview images.
+// Previews of other developer resources, like the packages of the registry package, are built on it.
+func PreviewHead(title, description, pageURL, image string) opengraph.Head {
+	head := opengraph.Head{Title: title, Charset: "utf-8"}
+	head.SetMeta("og:title", title)
+	head.SetMeta("og:description", description)
+	head.SetMeta("og:url", pageURL)
+	head.SetMeta("og:type", "website")
+	head.SetMeta("og:site_name", "GitHub")
+	head.SetMeta("og:image", image)
+
+	if strings.HasPrefix(image, socialImageBaseURL) {
+		head.SetMeta("og:image:width", "1200")
+		head.SetMeta("og:image:height", "600")
+		head.SetMeta("twitter:card", "summary_large_image")
+	} else {
+		head.SetMeta("twitter:card", "summary")
+	}
+
+	return head
+}
+
+// socialImageBaseURL is the base URL of the social preview images GitHub generates.
+const socialImageBaseURL = "https://opengraph.githubassets.com/"
+
+// SocialImageURL returns the URL of the social preview image GitHub generates for the repository owner/repo.
+// The first path element of the URL only busts caches, so a constant keeps the URL, and the image, cacheable.
+func SocialImageURL(owner, repo string) string {
+	return socialImageBaseURL + "1/" + owner + "/" + repo
 }
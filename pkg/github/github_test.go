@@ -286,3 +286,44 @@ func TestResourceType_String(t *testing.T) {
 		})
 	}
 }
+
+func TestPreviewHead(t *testing.T) {
+	tests := []struct {
+		name   string
+		image  string
+		card   string
+		width  string
+		height string
+	}{
+		{name: "social image", image: SocialImageURL("o", "r"), card: "summary_large_image", width: "1200", height: "600"},
+		{name: "other image", image: "https://avatars.githubusercontent.com/u/1", card: "summary"},
+		{name: "no image", card: "summary"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			head := PreviewHead("o/r", "A repository", "https://github.com/o/r", tt.image)
+
+			for key, expected := range map[string]string{
+				"og:title":        "o/r",
+				"og:description":  "A repository",
+				"og:url":          "https://github.com/o/r",
+				"og:site_name":    "GitHub",
+				"og:image":        tt.image,
+				"og:image:width":  tt.width,
+				"og:image:height": tt.height,
+				"twitter:card":    tt.card,
+			} {
+				if got := head.Meta(key); got != expected {
+					t.Errorf("PreviewHead() %s = %q, expected %q", key, got, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestSocialImageURL(t *testing.T) {
+	if got, expected := SocialImageURL("psf", "requests"), "https://opengraph.githubassets.com/1/psf/requests"; got != expected {
+		t.Errorf("SocialImageURL() = %q, expected %q", got, expected)
+	}
+}
@@ -0,0 +1,241 @@
+package imageproxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Fit modes supported by Transform.
+const (
+	// FitContain scales the image to fit inside the requested box, keeping its aspect ratio.
+	FitContain = "contain"
+	// FitCover scales and center crops the image to fill the requested box exactly.
+	FitCover = "cover"
+	// FitFill stretches the image to the requested box, ignoring its aspect ratio.
+	FitFill = "fill"
+)
+
+// MaxDimension is the largest width or height that can be requested.
+const MaxDimension = 2048
+
+const defaultQuality = 80
+
+var (
+	// ErrUnsupportedType is returned when the data is not a PNG, JPEG, GIF or WebP image.
+	ErrUnsupportedType = errors.New("unsupported image type")
+	// ErrTooManyPixels is returned when the decoded image would exceed the pixel limit.
+	ErrTooManyPixels = errors.New("image has too many pixels")
+)
+
+// supportedTypes are the sniffed content types that can be decoded.
+var supportedTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Options describes the transformation applied to an image.
+type Options struct {
+	Width   int
+	Height  int
+	Fit     string
+	Format  string
+	Quality int
+}
+
+// ParseOptions reads the w, h, fit, format and q query parameters.
+func ParseOptions(q url.Values) (Options, error) {
+	opts := Options{
+		Fit:     FitContain,
+		Format:  q.Get("format"),
+		Quality: defaultQuality,
+	}
+
+	var err error
+	if opts.Width, err = parseDimension(q.Get("w")); err != nil {
+		return opts, fmt.Errorf("invalid width: %w", err)
+	}
+	if opts.Height, err = parseDimension(q.Get("h")); err != nil {
+		return opts, fmt.Errorf("invalid height: %w", err)
+	}
+
+	if fit := q.Get("fit"); fit != "" {
+		switch fit {
+		case FitContain, FitCover, FitFill:
+			opts.Fit = fit
+		default:
+			return opts, fmt.Errorf("invalid fit mode %q", fit)
+		}
+	}
+
+	switch opts.Format {
+	case "", "jpeg", "png":
+	case "jpg":
+		opts.Format = "jpeg"
+	default:
+		return opts, fmt.Errorf("invalid format %q", opts.Format)
+	}
+
+	if v := q.Get("q"); v != "" {
+		quality, err := strconv.Atoi(v)
+		if err != nil || quality < 1 || quality > 100 {
+			return opts, fmt.Errorf("invalid quality %q", v)
+		}
+		opts.Quality = quality
+	}
+
+	return opts, nil
+}
+
+func parseDimension(v string) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 || n > MaxDimension {
+		return 0, fmt.Errorf("must be between 1 and %d", MaxDimension)
+	}
+
+	return n, nil
+}
+
+// Sniff returns the content type of data, or ErrUnsupportedType if it is not a supported image.
+// The declared Content-Type of the upstream response is never trusted.
+func Sniff(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if !supportedTypes[contentType] {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+
+	return contentType, nil
+}
+
+// Transform decodes data, resizes it according to opts and encodes it again.
+// The image header is checked before decoding, so images over maxPixels are rejected
+// without allocating their pixels.
+// It returns the encoded image and its content type.
+func Transform(data []byte, opts Options, maxPixels int64) ([]byte, string, error) {
+	contentType, err := Sniff(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("decoding image header: %w", err)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, "", fmt.Errorf("%w: %dx%d", ErrTooManyPixels, cfg.Width, cfg.Height)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("decoding image: %w", err)
+	}
+
+	dst := resize(src, opts)
+
+	format := opts.Format
+	if format == "" {
+		format = "png"
+		if contentType == "image/jpeg" {
+			format = "jpeg"
+		}
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		if err := jpeg.Encode(&buf, flatten(dst), &jpeg.Options{Quality: opts.Quality}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/jpeg", nil
+	default:
+		enc := png.Encoder{CompressionLevel: png.BestSpeed}
+		if err := enc.Encode(&buf, dst); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/png", nil
+	}
+}
+
+// resize scales src to the box requested in opts. Images are never upscaled,
+// except in fill mode where the box is honoured exactly.
+func resize(src image.Image, opts Options) image.Image {
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+
+	if (opts.Width == 0 && opts.Height == 0) || sw == 0 || sh == 0 {
+		return src
+	}
+
+	srcRect := sb
+	var dw, dh int
+
+	switch {
+	case opts.Fit == FitFill:
+		dw, dh = opts.Width, opts.Height
+		if dw == 0 {
+			dw = sw
+		}
+		if dh == 0 {
+			dh = sh
+		}
+	case opts.Fit == FitCover && opts.Width > 0 && opts.Height > 0:
+		// Crop the largest centered region with the requested aspect ratio.
+		cw, ch := sw, sw*opts.Height/opts.Width
+		if ch > sh {
+			cw, ch = sh*opts.Width/opts.Height, sh
+		}
+		x0 := sb.Min.X + (sw-cw)/2
+		y0 := sb.Min.Y + (sh-ch)/2
+		srcRect = image.Rect(x0, y0, x0+cw, y0+ch)
+
+		dw, dh = min(opts.Width, cw), min(opts.Height, ch)
+	default:
+		scale := 1.0
+		if opts.Width > 0 {
+			scale = min(scale, float64(opts.Width)/float64(sw))
+		}
+		if opts.Height > 0 {
+			scale = min(scale, float64(opts.Height)/float64(sh))
+		}
+		dw = max(1, int(float64(sw)*scale+0.5))
+		dh = max(1, int(float64(sh)*scale+0.5))
+	}
+
+	if srcRect == sb && dw == sw && dh == sh {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, srcRect, draw.Over, nil)
+
+	return dst
+}
+
+// flatten draws img over a white background, since JPEG has no alpha channel.
+func flatten(img image.Image) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	draw.Draw(dst, b, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, b, img, b.Min, draw.Over)
+	return dst
+}
@@ -0,0 +1,178 @@
+package imageproxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/url"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode the PNG: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestTransform(t *testing.T) {
+	src := encodePNG(t, 1200, 630)
+
+	tests := []struct {
+		name        string
+		opts        Options
+		width       int
+		height      int
+		contentType string
+	}{
+		{
+			name:        "contain by width",
+			opts:        Options{Width: 300, Fit: FitContain, Quality: 80},
+			width:       300,
+			height:      158,
+			contentType: "image/png",
+		},
+		{
+			name:        "contain in a box",
+			opts:        Options{Width: 300, Height: 100, Fit: FitContain, Quality: 80},
+			width:       190,
+			height:      100,
+			contentType: "image/png",
+		},
+		{
+			name:        "cover crops to the box",
+			opts:        Options{Width: 200, Height: 200, Fit: FitCover, Quality: 80},
+			width:       200,
+			height:      200,
+			contentType: "image/png",
+		},
+		{
+			name:        "fill stretches",
+			opts:        Options{Width: 100, Height: 100, Fit: FitFill, Quality: 80},
+			width:       100,
+			height:      100,
+			contentType: "image/png",
+		},
+		{
+			name:        "never upscales",
+			opts:        Options{Width: 2000, Fit: FitContain, Quality: 80},
+			width:       1200,
+			height:      630,
+			contentType: "image/png",
+		},
+		{
+			name:        "converts to jpeg",
+			opts:        Options{Width: 120, Fit: FitContain, Format: "jpeg", Quality: 70},
+			width:       120,
+			height:      63,
+			contentType: "image/jpeg",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, contentType, err := Transform(src, tt.opts, 10_000_000)
+			if err != nil {
+				t.Fatalf("Transform() unexpected error: %v", err)
+			}
+
+			if contentType != tt.contentType {
+				t.Errorf("Transform() content type = %s, expected %s", contentType, tt.contentType)
+			}
+
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(out))
+			if err != nil {
+				t.Fatalf("Failed to decode the output: %v", err)
+			}
+
+			if cfg.Width != tt.width || cfg.Height != tt.height {
+				t.Errorf("Transform() size = %dx%d, expected %dx%d", cfg.Width, cfg.Height, tt.width, tt.height)
+			}
+		})
+	}
+}
+
+func TestTransformFormats(t *testing.T) {
+	img := image.NewPaletted(image.Rect(0, 0, 40, 20), []color.Color{color.Black, color.White})
+
+	var gifBuf bytes.Buffer
+	if err := gif.Encode(&gifBuf, img, nil); err != nil {
+		t.Fatalf("Failed to encode the GIF: %v", err)
+	}
+
+	var jpegBuf bytes.Buffer
+	if err := jpeg.Encode(&jpegBuf, img, nil); err != nil {
+		t.Fatalf("Failed to encode the JPEG: %v", err)
+	}
+
+	if _, contentType, err := Transform(gifBuf.Bytes(), Options{Width: 20}, 1000); err != nil || contentType != "image/png" {
+		t.Errorf("expected a GIF to be converted to PNG, got %s, %v", contentType, err)
+	}
+
+	if _, contentType, err := Transform(jpegBuf.Bytes(), Options{Width: 20, Quality: 80}, 1000); err != nil || contentType != "image/jpeg" {
+		t.Errorf("expected a JPEG to stay a JPEG, got %s, %v", contentType, err)
+	}
+}
+
+func TestTransformRejectsUnsupportedTypes(t *testing.T) {
+	_, _, err := Transform([]byte("<html><body>not an image</body></html>"), Options{}, 1000)
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("expected ErrUnsupportedType, got %v", err)
+	}
+}
+
+func TestTransformRejectsDecompressionBombs(t *testing.T) {
+	data := encodePNG(t, 10, 10)
+
+	// Rewrite the IHDR chunk to claim a 100000x100000 image while the data stays tiny.
+	ihdr := data[8+8 : 8+8+13]
+	binary.BigEndian.PutUint32(ihdr[0:4], 100000)
+	binary.BigEndian.PutUint32(ihdr[4:8], 100000)
+	binary.BigEndian.PutUint32(data[8+8+13:], crc32.ChecksumIEEE(data[8+4:8+8+13]))
+
+	_, _, err := Transform(data, Options{Width: 100}, 50_000_000)
+	if !errors.Is(err, ErrTooManyPixels) {
+		t.Fatalf("expected ErrTooManyPixels, got %v", err)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	opts, err := ParseOptions(url.Values{"w": {"320"}, "h": {"180"}, "fit": {"cover"}, "format": {"jpg"}, "q": {"60"}})
+	if err != nil {
+		t.Fatalf("ParseOptions() unexpected error: %v", err)
+	}
+
+	expected := Options{Width: 320, Height: 180, Fit: FitCover, Format: "jpeg", Quality: 60}
+	if opts != expected {
+		t.Errorf("ParseOptions() = %+v, expected %+v", opts, expected)
+	}
+
+	for _, q := range []url.Values{
+		{"w": {"0"}},
+		{"h": {"5000"}},
+		{"fit": {"zoom"}},
+		{"format": {"bmp"}},
+		{"q": {"101"}},
+	} {
+		if _, err := ParseOptions(q); err == nil {
+			t.Errorf("ParseOptions(%v) expected an error", q)
+		}
+	}
+}
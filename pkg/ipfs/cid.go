@@ -0,0 +1,120 @@
+package ipfs
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	// multihashSHA256 is the multihash code of SHA-256, used by CIDv0.
+	multihashSHA256 = 0x12
+
+	base36Alphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+	base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+)
+
+var base32Lower = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// ValidateCID reports whether s is a CIDv0, in base58btc starting with Qm,
+// or a CIDv1 in one of the base16, base32, base36 or base58btc multibase encodings.
+func ValidateCID(s string) error {
+	if len(s) == 46 && strings.HasPrefix(s, "Qm") {
+		data, err := decodeBase58(s)
+		if err != nil {
+			return err
+		}
+		if len(data) != 34 || data[0] != multihashSHA256 || data[1] != 32 {
+			return fmt.Errorf("invalid CIDv0 %q", s)
+		}
+		return nil
+	}
+
+	if len(s) < 2 {
+		return fmt.Errorf("invalid CID %q", s)
+	}
+
+	data, err := decodeMultibase(s)
+	if err != nil {
+		return fmt.Errorf("invalid CID %q: %w", s, err)
+	}
+
+	version, n := binary.Uvarint(data)
+	if n <= 0 || version != 1 {
+		return fmt.Errorf("invalid CID %q: unsupported version", s)
+	}
+	data = data[n:]
+
+	if _, n = binary.Uvarint(data); n <= 0 {
+		return fmt.Errorf("invalid CID %q: invalid codec", s)
+	}
+
+	if err := validateMultihash(data[n:]); err != nil {
+		return fmt.Errorf("invalid CID %q: %w", s, err)
+	}
+
+	return nil
+}
+
+// validateMultihash reports whether data is exactly one multihash: a code, a length and a digest of that length.
+func validateMultihash(data []byte) error {
+	if _, n := binary.Uvarint(data); n > 0 {
+		data = data[n:]
+	} else {
+		return errors.New("invalid multihash code")
+	}
+
+	length, n := binary.Uvarint(data)
+	if n <= 0 || length != uint64(len(data)-n) {
+		return errors.New("invalid multihash length")
+	}
+
+	return nil
+}
+
+// decodeMultibase decodes s, whose first character is its multibase prefix.
+func decodeMultibase(s string) ([]byte, error) {
+	prefix, rest := s[0], s[1:]
+
+	switch prefix {
+	case 'b', 'B':
+		return base32Lower.DecodeString(strings.ToLower(rest))
+	case 'f', 'F':
+		return hex.DecodeString(rest)
+	case 'k', 'K':
+		return decodeBase(strings.ToLower(rest), base36Alphabet, '0')
+	case 'z':
+		return decodeBase58(rest)
+	default:
+		return nil, fmt.Errorf("unsupported multibase prefix %q", prefix)
+	}
+}
+
+func decodeBase58(s string) ([]byte, error) {
+	return decodeBase(s, base58Alphabet, '1')
+}
+
+// decodeBase decodes s, written in the digits of alphabet, with leading zero digits standing for zero bytes.
+func decodeBase(s, alphabet string, zero byte) ([]byte, error) {
+	if s == "" {
+		return nil, errors.New("empty string")
+	}
+
+	n := new(big.Int)
+	radix := big.NewInt(int64(len(alphabet)))
+	for i := 0; i < len(s); i++ {
+		digit := strings.IndexByte(alphabet, s[i])
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid character %q", s[i])
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+
+	zeros := len(s) - len(strings.TrimLeft(s, string(zero)))
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
@@ -0,0 +1,171 @@
+// Package ipfs normalizes IPFS and IPNS links, given with the ipfs:// and ipns:// schemes
+// or through any path or subdomain gateway, to content paths that can be fetched from a chosen gateway.
+package ipfs
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DefaultGatewayURL is the gateway content is fetched from when none is configured.
+const DefaultGatewayURL = "https://ipfs.io"
+
+// Namespaces of content paths.
+const (
+	NamespaceIPFS = "ipfs"
+	NamespaceIPNS = "ipns"
+)
+
+// ErrNotIPFS is returned by Parse for URLs that are not IPFS or IPNS links.
+var ErrNotIPFS = errors.New("not an IPFS or IPNS URL")
+
+// ErrPathTraversal is returned by Parse for links whose path has . or .. segments, raw or percent-encoded,
+// which gateways would resolve outside the content root.
+var ErrPathTraversal = errors.New("IPFS path with dot segments")
+
+var dnsName = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Path is a content path, /ipfs/{cid}/... or /ipns/{name}/...
+type Path struct {
+	// Namespace is NamespaceIPFS or NamespaceIPNS.
+	Namespace string
+	// Root is the CID of IPFS paths, and the key or the DNSLink domain of IPNS paths.
+	Root string
+	// Rest is the escaped path below the root, and the query, if any.
+	Rest string
+}
+
+// String returns the content path, like /ipfs/{cid}/index.html.
+func (p Path) String() string {
+	return "/" + p.Namespace + "/" + p.Root + p.Rest
+}
+
+// GatewayURL returns the URL of p on the path gateway at gateway, like https://ipfs.io.
+func (p Path) GatewayURL(gateway string) string {
+	return strings.TrimSuffix(gateway, "/") + p.String()
+}
+
+// Parse returns the content path of an ipfs:// or ipns:// URL, of a path gateway URL,
+// like https://ipfs.io/ipfs/{cid}/..., or of a subdomain gateway URL, like https://{cid}.ipfs.dweb.link/...
+// The CID of IPFS paths, and the name of IPNS paths, are validated.
+func Parse(u *url.URL) (Path, error) {
+	var p Path
+
+	rest := u.EscapedPath()
+
+	switch u.Scheme {
+	case NamespaceIPFS, NamespaceIPNS:
+		if u.Host == "" {
+			return Path{}, ErrNotIPFS
+		}
+		p.Namespace, p.Root = u.Scheme, u.Host
+	case "http", "https":
+		labels := strings.Split(u.Hostname(), ".")
+		segments := strings.SplitN(strings.TrimPrefix(rest, "/"), "/", 3)
+
+		switch {
+		case len(segments) >= 2 && (segments[0] == NamespaceIPFS || segments[0] == NamespaceIPNS) && segments[1] != "":
+			p.Namespace, p.Root = segments[0], segments[1]
+			rest = strings.TrimPrefix(rest, "/"+segments[0]+"/"+segments[1])
+		case len(labels) >= 3 && (labels[1] == NamespaceIPFS || labels[1] == NamespaceIPNS):
+			p.Namespace, p.Root = labels[1], labels[0]
+			if p.Namespace == NamespaceIPNS {
+				p.Root = inlinedDNSLink(p.Root)
+			}
+		default:
+			return Path{}, ErrNotIPFS
+		}
+	default:
+		return Path{}, ErrNotIPFS
+	}
+
+	if root, err := url.PathUnescape(p.Root); err == nil {
+		p.Root = root
+	}
+
+	if p.Namespace == NamespaceIPFS {
+		if err := ValidateCID(p.Root); err != nil {
+			return Path{}, err
+		}
+	} else if err := validateIPNSName(p.Root); err != nil {
+		return Path{}, err
+	}
+
+	if rest != "" && !strings.HasPrefix(rest, "/") {
+		rest = "/" + rest
+	}
+	if hasDotSegment(rest) {
+		return Path{}, ErrPathTraversal
+	}
+	if u.RawQuery != "" {
+		rest += "?" + u.RawQuery
+	}
+	p.Rest = rest
+
+	return p, nil
+}
+
+// hasDotSegment reports whether the escaped path has a . or .. segment once unescaped,
+// including segments split by encoded slashes or backslashes, like %2e%2e%2f.
+func hasDotSegment(escaped string) bool {
+	for _, segment := range strings.Split(escaped, "/") {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return true
+		}
+		for _, s := range strings.FieldsFunc(unescaped, func(r rune) bool { return r == '/' || r == '\\' }) {
+			if s == "." || s == ".." {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Within reports whether the escaped path of a gateway URL, once unescaped and cleaned,
+// is still below the content root of p, under the gateway path prefix.
+func (p Path) Within(prefix, escapedPath string) bool {
+	unescaped, err := url.PathUnescape(escapedPath)
+	if err != nil {
+		return false
+	}
+
+	root := strings.TrimSuffix(prefix, "/") + "/" + p.Namespace + "/" + p.Root
+	cleaned := path.Clean(strings.ReplaceAll(unescaped, "\\", "/"))
+	return cleaned == root || strings.HasPrefix(cleaned, root+"/")
+}
+
+// validateIPNSName reports whether name is a key, as a CID or a legacy base58 peer ID, or a DNSLink domain.
+func validateIPNSName(name string) error {
+	if ValidateCID(name) == nil {
+		return nil
+	}
+
+	if data, err := decodeBase58(name); err == nil && validateMultihash(data) == nil {
+		return nil
+	}
+
+	if strings.Contains(name, ".") && dnsName.MatchString(strings.ToLower(name)) {
+		return nil
+	}
+
+	return fmt.Errorf("invalid IPNS name %q", name)
+}
+
+// inlinedDNSLink returns the DNSLink domain a subdomain gateway label stands for,
+// where dots are written as dashes and dashes as double dashes, like en-wikipedia--on--ipfs-org.
+// Labels holding keys are returned as is.
+func inlinedDNSLink(label string) string {
+	if ValidateCID(label) == nil || !strings.Contains(label, "-") {
+		return label
+	}
+
+	const placeholder = "\x00"
+	label = strings.ReplaceAll(label, "--", placeholder)
+	label = strings.ReplaceAll(label, "-", ".")
+	return strings.ReplaceAll(label, placeholder, "-")
+}
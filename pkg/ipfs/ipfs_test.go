@@ -0,0 +1,112 @@
+package ipfs
+
+import (
+	"net/url"
+	"testing"
+)
+
+const (
+	cidV0 = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+	cidV1 = "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"
+	key   = "k51qzi5uqu5dlvj2baxnqndepeb86cbk3ng7n3i46uzyxzyqj2xjonzllnv0v8"
+)
+
+func TestValidateCID(t *testing.T) {
+	tests := []struct {
+		cid     string
+		wantErr bool
+	}{
+		{cid: cidV0},
+		{cid: cidV1},
+		{cid: "bafkreidgvpkjawlxz6sffxzwgooowe5yt7i6wsyg236mfoks77nywkptdq"},
+		{cid: key},
+		{cid: "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbd0", wantErr: true},
+		{cid: cidV1[:len(cidV1)-4], wantErr: true},
+		{cid: "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzd1", wantErr: true},
+		{cid: "about", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cid, func(t *testing.T) {
+			if err := ValidateCID(tt.cid); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+		wantErr  bool
+	}{
+		{url: "ipfs://" + cidV1, expected: "/ipfs/" + cidV1},
+		{url: "ipfs://" + cidV0 + "/wiki/Nostr.html?lang=en", expected: "/ipfs/" + cidV0 + "/wiki/Nostr.html?lang=en"},
+		{url: "ipns://" + key + "/", expected: "/ipns/" + key + "/"},
+		{url: "ipns://en.wikipedia-on-ipfs.org/wiki/", expected: "/ipns/en.wikipedia-on-ipfs.org/wiki/"},
+		{url: "https://ipfs.io/ipfs/" + cidV1 + "/cat.jpg", expected: "/ipfs/" + cidV1 + "/cat.jpg"},
+		{url: "https://gateway.example/ipns/" + key, expected: "/ipns/" + key},
+		{url: "https://" + cidV1 + ".ipfs.dweb.link/cat.jpg", expected: "/ipfs/" + cidV1 + "/cat.jpg"},
+		{url: "https://en-wikipedia--on--ipfs-org.ipns.dweb.link/wiki/", expected: "/ipns/en.wikipedia-on-ipfs.org/wiki/"},
+		{url: "ipfs://not-a-cid", wantErr: true},
+		{url: "ipns://localhost", wantErr: true},
+		{url: "https://example.com/ipfs/about", wantErr: true},
+		{url: "https://example.com/blog/ipfs", wantErr: true},
+		{url: "https://ipfs.example.com/", wantErr: true},
+		{url: "ipfs://" + cidV1 + "/../../debug/pprof", wantErr: true},
+		{url: "ipfs://" + cidV1 + "/./cat.jpg", wantErr: true},
+		{url: "ipfs://" + cidV1 + "/%2e%2e/%2E%2E/api/v0/id", wantErr: true},
+		{url: "ipfs://" + cidV1 + "/..%2F..%2Fapi", wantErr: true},
+		{url: "ipfs://" + cidV1 + "/%2e%2e%5capi", wantErr: true},
+		{url: "https://ipfs.io/ipfs/" + cidV1 + "/../../debug/pprof", wantErr: true},
+		{url: "https://" + cidV1 + ".ipfs.dweb.link/%2e%2e/api", wantErr: true},
+		{url: "ipfs://" + cidV1 + "/..cat/file..", expected: "/ipfs/" + cidV1 + "/..cat/file.."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+			p, err := Parse(u)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := p.String(); !tt.wantErr && got != tt.expected {
+				t.Errorf("Parse() = %s, expected %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPathWithin(t *testing.T) {
+	p := Path{Namespace: NamespaceIPFS, Root: cidV1}
+
+	tests := []struct {
+		prefix string
+		path   string
+		within bool
+	}{
+		{prefix: "", path: "/ipfs/" + cidV1, within: true},
+		{prefix: "/", path: "/ipfs/" + cidV1 + "/cat.jpg", within: true},
+		{prefix: "/gateway/", path: "/gateway/ipfs/" + cidV1 + "/a/b", within: true},
+		{prefix: "", path: "/ipfs/" + cidV1 + "/../../debug/pprof"},
+		{prefix: "", path: "/ipfs/" + cidV1 + "/%2e%2e/%2e%2e/api/v0/id"},
+		{prefix: "", path: "/ipfs/" + cidV1 + "x/cat.jpg"},
+		{prefix: "/gateway", path: "/ipfs/" + cidV1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := p.Within(tt.prefix, tt.path); got != tt.within {
+				t.Errorf("Within(%q, %q) = %t, expected %t", tt.prefix, tt.path, got, tt.within)
+			}
+		})
+	}
+}
+
+func TestPathGatewayURL(t *testing.T) {
+	p := Path{Namespace: NamespaceIPFS, Root: cidV1, Rest: "/cat.jpg"}
+	if got, expected := p.GatewayURL("http://127.0.0.1:8080/"), "http://127.0.0.1:8080/ipfs/"+cidV1+"/cat.jpg"; got != expected {
+		t.Errorf("GatewayURL() = %s, expected %s", got, expected)
+	}
+}
@@ -0,0 +1,185 @@
+// Package lnurl resolves Lightning addresses (LUD-16) and bech32 LNURLs (LUD-01) to the metadata
+// of their pay request (LUD-06), including the NIP-57 fields zaps need.
+package lnurl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/bech32"
+)
+
+// maxResponseBytes caps the size of a pay request response.
+const maxResponseBytes = 256 << 10
+
+var (
+	// ErrNotFound is returned when the service does not know the address.
+	ErrNotFound = errors.New("lightning address not found")
+	// ErrInvalidPayRequest is returned when the service does not answer with a valid pay request.
+	ErrInvalidPayRequest = errors.New("invalid LNURL pay request")
+)
+
+var (
+	username = regexp.MustCompile(`^[a-z0-9._+-]{1,64}$`)
+	domain   = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]([a-z0-9-]{0,61}[a-z0-9])?(:[0-9]{1,5})?$`)
+	hexKey   = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// Resolve returns the pay request URL of a Lightning address, like bob@example.com,
+// or of a bech32 LNURL, with or without the lightning: scheme.
+func Resolve(address string) (*url.URL, error) {
+	address = normalize(address)
+
+	if name, host, ok := strings.Cut(address, "@"); ok {
+		if !username.MatchString(name) || !domain.MatchString(host) {
+			return nil, fmt.Errorf("invalid lightning address %q", address)
+		}
+		return &url.URL{Scheme: "https", Host: host, Path: "/.well-known/lnurlp/" + name}, nil
+	}
+
+	prefix, data, err := bech32.Decode(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LNURL: %w", err)
+	}
+	if prefix != "lnurl" {
+		return nil, fmt.Errorf("invalid LNURL prefix %q", prefix)
+	}
+
+	u, err := url.Parse(string(data))
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil {
+		return nil, fmt.Errorf("invalid LNURL: %q is not an https URL", data)
+	}
+
+	return u, nil
+}
+
+// normalize strips the lightning: scheme from address and lowercases it.
+// Both Lightning addresses and bech32 strings are case insensitive.
+func normalize(address string) string {
+	address = strings.ToLower(strings.TrimSpace(address))
+	return strings.TrimPrefix(address, "lightning:")
+}
+
+// PayRequest is a normalized LUD-06 pay request.
+type PayRequest struct {
+	// Address is the Lightning address or the LNURL that was resolved, in lower case and without the lightning: scheme.
+	Address string `json:"address"`
+	// URL is the URL the pay request was fetched from.
+	URL      string `json:"url"`
+	Callback string `json:"callback"`
+	// MinSendable and MaxSendable are in millisatoshis.
+	MinSendable int64 `json:"minSendable"`
+	MaxSendable int64 `json:"maxSendable"`
+	// Metadata is the raw metadata string, whose hash invoices commit to.
+	Metadata       string `json:"metadata"`
+	Description    string `json:"description,omitempty"`
+	Identifier     string `json:"identifier,omitempty"`
+	CommentAllowed int    `json:"commentAllowed,omitempty"`
+	// AllowsNostr and NostrPubKey are the NIP-57 fields. AllowsNostr is only true with a valid NostrPubKey.
+	AllowsNostr bool   `json:"allowsNostr"`
+	NostrPubKey string `json:"nostrPubkey,omitempty"`
+}
+
+// FetchPayRequest resolves address and fetches its pay request.
+func FetchPayRequest(ctx context.Context, client *http.Client, address string) (PayRequest, error) {
+	u, err := Resolve(address)
+	if err != nil {
+		return PayRequest{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return PayRequest{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return PayRequest{}, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Status         string          `json:"status"`
+		Reason         string          `json:"reason"`
+		Tag            string          `json:"tag"`
+		Callback       string          `json:"callback"`
+		MinSendable    int64           `json:"minSendable"`
+		MaxSendable    int64           `json:"maxSendable"`
+		Metadata       string          `json:"metadata"`
+		CommentAllowed int             `json:"commentAllowed"`
+		AllowsNostr    bool            `json:"allowsNostr"`
+		NostrPubKey    json.RawMessage `json:"nostrPubkey"`
+	}
+	decodeErr := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&body)
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return PayRequest{}, fmt.Errorf("%w: %s", ErrNotFound, address)
+	case decodeErr == nil && strings.EqualFold(body.Status, "ERROR"):
+		return PayRequest{}, fmt.Errorf("%w: %s", ErrInvalidPayRequest, body.Reason)
+	case resp.StatusCode != http.StatusOK:
+		return PayRequest{}, fmt.Errorf("%s returned status %d", u.Host, resp.StatusCode)
+	case decodeErr != nil:
+		return PayRequest{}, fmt.Errorf("%w: %v", ErrInvalidPayRequest, decodeErr)
+	}
+
+	if body.Tag != "payRequest" {
+		return PayRequest{}, fmt.Errorf("%w: unexpected tag %q", ErrInvalidPayRequest, body.Tag)
+	}
+
+	callback, err := url.Parse(body.Callback)
+	if err != nil || callback.Scheme != "https" || callback.Host == "" {
+		return PayRequest{}, fmt.Errorf("%w: invalid callback %q", ErrInvalidPayRequest, body.Callback)
+	}
+
+	if body.MinSendable < 1 || body.MaxSendable < body.MinSendable {
+		return PayRequest{}, fmt.Errorf("%w: invalid sendable range %d to %d",
+			ErrInvalidPayRequest, body.MinSendable, body.MaxSendable)
+	}
+
+	var entries [][]json.RawMessage
+	if err := json.Unmarshal([]byte(body.Metadata), &entries); err != nil {
+		return PayRequest{}, fmt.Errorf("%w: invalid metadata: %v", ErrInvalidPayRequest, err)
+	}
+
+	pr := PayRequest{
+		Address:        normalize(address),
+		URL:            u.String(),
+		Callback:       callback.String(),
+		MinSendable:    body.MinSendable,
+		MaxSendable:    body.MaxSendable,
+		Metadata:       body.Metadata,
+		CommentAllowed: max(body.CommentAllowed, 0),
+	}
+
+	for _, entry := range entries {
+		var typ, value string
+		if len(entry) < 2 || json.Unmarshal(entry[0], &typ) != nil || json.Unmarshal(entry[1], &value) != nil {
+			continue
+		}
+		switch typ {
+		case "text/plain":
+			pr.Description = value
+		case "text/identifier", "text/email":
+			pr.Identifier = value
+		}
+	}
+
+	var pubkey string
+	if json.Unmarshal(body.NostrPubKey, &pubkey) == nil {
+		pubkey = strings.ToLower(pubkey)
+	}
+	if body.AllowsNostr && hexKey.MatchString(pubkey) {
+		pr.AllowsNostr, pr.NostrPubKey = true, pubkey
+	}
+
+	return pr, nil
+}
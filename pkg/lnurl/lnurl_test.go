@@ -0,0 +1,136 @@
+package lnurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/bech32"
+)
+
+const pubkey = "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d"
+
+// newFakeService serves the pay requests of example.com, whose certificate the test server holds.
+// The returned client sends every request to it.
+func newFakeService(t *testing.T) *http.Client {
+	t.Helper()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metadata := `[[\"text/plain\",\"Zap bob\"],[\"text/identifier\",\"bob@example.com\"]]`
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/lnurlp/bob":
+			fmt.Fprintf(w, `{"tag": "payRequest", "callback": "https://example.com/lnurlp/bob/callback",
+				"minSendable": 1000, "maxSendable": 100000000, "metadata": "%s", "commentAllowed": 140,
+				"allowsNostr": true, "nostrPubkey": "%s"}`, metadata, strings.ToUpper(pubkey))
+		case "/.well-known/lnurlp/carol":
+			fmt.Fprintf(w, `{"tag": "payRequest", "callback": "https://example.com/lnurlp/carol/callback",
+				"minSendable": 1000, "maxSendable": 1000, "metadata": "[]", "allowsNostr": true, "nostrPubkey": "npub1"}`)
+		case "/.well-known/lnurlp/disabled":
+			fmt.Fprint(w, `{"status": "ERROR", "reason": "Account disabled"}`)
+		case "/.well-known/lnurlp/withdraw":
+			fmt.Fprint(w, `{"tag": "withdrawRequest", "callback": "https://example.com/withdraw"}`)
+		case "/.well-known/lnurlp/insecure":
+			fmt.Fprintf(w, `{"tag": "payRequest", "callback": "http://example.com/callback",
+				"minSendable": 1000, "maxSendable": 2000, "metadata": "[]"}`)
+		case "/.well-known/lnurlp/range":
+			fmt.Fprintf(w, `{"tag": "payRequest", "callback": "https://example.com/callback",
+				"minSendable": 2000, "maxSendable": 1000, "metadata": "[]"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"status": "ERROR", "reason": "Unknown user"}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	transport := srv.Client().Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+
+	return &http.Client{Transport: transport}
+}
+
+func TestResolve(t *testing.T) {
+	encoded, _ := bech32.Encode("lnurl", []byte("https://example.com/.well-known/lnurlp/bob"))
+	insecure, _ := bech32.Encode("lnurl", []byte("http://example.com/.well-known/lnurlp/bob"))
+
+	tests := []struct {
+		address  string
+		expected string
+		wantErr  bool
+	}{
+		{address: "bob@example.com", expected: "https://example.com/.well-known/lnurlp/bob"},
+		{address: "Bob@Example.com", expected: "https://example.com/.well-known/lnurlp/bob"},
+		{address: "lightning:bob@example.com", expected: "https://example.com/.well-known/lnurlp/bob"},
+		{address: encoded, expected: "https://example.com/.well-known/lnurlp/bob"},
+		{address: "LIGHTNING:" + strings.ToUpper(encoded), expected: "https://example.com/.well-known/lnurlp/bob"},
+		{address: insecure, wantErr: true},
+		{address: "bob@localhost", wantErr: true},
+		{address: "npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			u, err := Resolve(tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && u.String() != tt.expected {
+				t.Errorf("Resolve() = %s, expected %s", u, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFetchPayRequest(t *testing.T) {
+	client := newFakeService(t)
+
+	pr, err := FetchPayRequest(context.Background(), client, "bob@example.com")
+	if err != nil {
+		t.Fatalf("FetchPayRequest() unexpected error: %v", err)
+	}
+
+	expected := PayRequest{
+		Address:        "bob@example.com",
+		URL:            "https://example.com/.well-known/lnurlp/bob",
+		Callback:       "https://example.com/lnurlp/bob/callback",
+		MinSendable:    1000,
+		MaxSendable:    100000000,
+		Metadata:       `[["text/plain","Zap bob"],["text/identifier","bob@example.com"]]`,
+		Description:    "Zap bob",
+		Identifier:     "bob@example.com",
+		CommentAllowed: 140,
+		AllowsNostr:    true,
+		NostrPubKey:    pubkey,
+	}
+	if pr != expected {
+		t.Errorf("FetchPayRequest() = %+v, expected %+v", pr, expected)
+	}
+
+	pr, err = FetchPayRequest(context.Background(), client, "carol@example.com")
+	if err != nil {
+		t.Fatalf("FetchPayRequest() unexpected error: %v", err)
+	}
+	if pr.AllowsNostr || pr.NostrPubKey != "" {
+		t.Errorf("FetchPayRequest() allows Nostr with an invalid public key: %+v", pr)
+	}
+
+	for address, expected := range map[string]error{
+		"nobody@example.com":   ErrNotFound,
+		"disabled@example.com": ErrInvalidPayRequest,
+		"withdraw@example.com": ErrInvalidPayRequest,
+		"insecure@example.com": ErrInvalidPayRequest,
+		"range@example.com":    ErrInvalidPayRequest,
+	} {
+		if _, err := FetchPayRequest(context.Background(), client, address); !errors.Is(err, expected) {
+			t.Errorf("FetchPayRequest(%s) error = %v, expected %v", address, err, expected)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+// Package mediawiki builds link previews of Wikipedia articles, and of the pages of other MediaWiki sites
+// serving the Wikimedia REST API, from the page summary endpoint.
+package mediawiki
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+	"github.com/danvergara/jumble-proxy-server/pkg/outbound"
+)
+
+const (
+	// maxResponseBytes caps the size of a summary response.
+	maxResponseBytes = 1 << 20
+	// summaryPath is the path of the REST summary endpoint, relative to the root of a wiki.
+	summaryPath = "/api/rest_v1/page/summary/"
+)
+
+// Summary types with a special preview.
+const (
+	TypeStandard       = "standard"
+	TypeDisambiguation = "disambiguation"
+)
+
+var wikipediaLanguage = regexp.MustCompile(`^[a-z][a-z0-9]*(-[a-z0-9]+)*$`)
+
+// projects are the names of the Wikimedia projects, by their domain.
+var projects = map[string]string{
+	"wikipedia.org":   "Wikipedia",
+	"wiktionary.org":  "Wiktionary",
+	"wikivoyage.org":  "Wikivoyage",
+	"wikibooks.org":   "Wikibooks",
+	"wikiquote.org":   "Wikiquote",
+	"wikisource.org":  "Wikisource",
+	"wikinews.org":    "Wikinews",
+	"wikiversity.org": "Wikiversity",
+}
+
+// Page is the wiki page a URL points to.
+type Page struct {
+	// Host is the desktop host of the wiki, like en.wikipedia.org for en.m.wikipedia.org.
+	Host string
+	// Title is the title of the page, with underscores instead of spaces, like Albert_Einstein.
+	Title string
+	// Section is the heading of the section the URL anchors to, if any.
+	Section string
+	// Mobile reports whether the URL is on the mobile site.
+	Mobile bool
+}
+
+// Options configures the client.
+type Options struct {
+	// HTTPClient sends the summary requests, through outbound.NewClient when it is nil.
+	HTTPClient *http.Client
+	// Hosts are the hosts of the MediaWiki sites handled besides the Wikipedia language editions,
+	// like en.wiktionary.org or wiki.example.org. Their mobile hosts, like en.m.wiktionary.org, are handled too.
+	Hosts []string
+	// APIURL, when set, replaces the origin of the wikis in the requests, mostly for tests.
+	APIURL string
+}
+
+// Client builds previews of wiki page URLs.
+type Client struct {
+	client *http.Client
+	hosts  map[string]bool
+	apiURL string
+}
+
+func New(opts Options) *Client {
+	c := &Client{
+		client: opts.HTTPClient,
+		hosts:  make(map[string]bool, len(opts.Hosts)),
+		apiURL: strings.TrimSuffix(opts.APIURL, "/"),
+	}
+
+	if c.client == nil {
+		c.client = outbound.NewClient(outbound.Options{})
+	}
+	for _, host := range opts.Hosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			c.hosts[host] = true
+		}
+	}
+
+	return c
+}
+
+// Parse returns the page of a wiki URL, like https://en.m.wikipedia.org/wiki/Alan_Turing#Early_life
+// or https://wiki.example.org/w/index.php?title=Main_Page, on a Wikipedia language edition or on one of the hosts.
+func (c *Client) Parse(u *url.URL) (Page, error) {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Page{}, errors.New("not an http or https URL")
+	}
+
+	host, mobile, ok := c.wikiHost(strings.ToLower(u.Hostname()))
+	if !ok {
+		return Page{}, errors.New("not a known wiki")
+	}
+
+	var title string
+	switch {
+	case strings.HasPrefix(u.Path, "/wiki/"):
+		title = strings.TrimPrefix(u.Path, "/wiki/")
+	case u.Path == "/w/index.php" && u.Query().Get("action") == "" && u.Query().Get("oldid") == "":
+		title = u.Query().Get("title")
+	}
+
+	title = strings.ReplaceAll(strings.TrimSpace(title), " ", "_")
+	if title == "" {
+		return Page{}, errors.New("not a wiki page URL")
+	}
+
+	return Page{
+		Host:    host,
+		Title:   title,
+		Section: strings.TrimSpace(strings.ReplaceAll(u.Fragment, "_", " ")),
+		Mobile:  mobile,
+	}, nil
+}
+
+// wikiHost returns the desktop host of a wiki host, and reports whether host is the mobile site.
+// Mobile hosts insert an m label after the first one, like en.m.wikipedia.org.
+func (c *Client) wikiHost(host string) (string, bool, bool) {
+	mobile := false
+	if first, rest, ok := strings.Cut(host, ".m."); ok && !strings.Contains(first, ".") {
+		host, mobile = first+"."+rest, true
+	}
+
+	if c.hosts[host] {
+		return host, mobile, true
+	}
+
+	lang, ok := strings.CutSuffix(host, ".wikipedia.org")
+	if !ok || lang == "www" || !wikipediaLanguage.MatchString(lang) {
+		return "", false, false
+	}
+
+	return host, mobile, true
+}
+
+// Match reports whether u is the URL of a page on a Wikipedia language edition or on one of the configured wikis.
+func (c *Client) Match(u *url.URL) bool {
+	_, err := c.Parse(u)
+	return err == nil
+}
+
+// summary is the response of the REST summary endpoint.
+type summary struct {
+	Type         string `json:"type"`
+	Title        string `json:"title"`
+	DisplayTitle string `json:"displaytitle"`
+	Description  string `json:"description"`
+	Extract      string `json:"extract"`
+	Lang         string `json:"lang"`
+	Thumbnail    struct {
+		Source string `json:"source"`
+		Width  int    `json:"width"`
+		Height int    `json:"height"`
+	} `json:"thumbnail"`
+	ContentURLs struct {
+		Desktop struct {
+			Page string `json:"page"`
+		} `json:"desktop"`
+		Mobile struct {
+			Page string `json:"page"`
+		} `json:"mobile"`
+	} `json:"content_urls"`
+}
+
+// Preview returns the head of the preview document of a wiki page.
+// Pages without a summary, like special pages, are left to the generic proxy.
+func (c *Client) Preview(ctx context.Context, u *url.URL) (opengraph.Head, error) {
+	page, err := c.Parse(u)
+	if err != nil {
+		return opengraph.Head{}, err
+	}
+
+	s, err := c.summary(ctx, u.Scheme, page)
+	if err != nil {
+		return opengraph.Head{}, err
+	}
+
+	return summaryHead(u, page, s), nil
+}
+
+func (c *Client) summary(ctx context.Context, scheme string, page Page) (summary, error) {
+	origin := c.apiURL
+	if origin == "" {
+		// Wikipedia is only served over https, configured wikis may be on a local network.
+		if strings.HasSuffix(page.Host, ".wikipedia.org") {
+			scheme = "https"
+		}
+		origin = scheme + "://" + page.Host
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+summaryPath+url.PathEscape(page.Title), nil)
+	if err != nil {
+		return summary{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return summary{}, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest:
+		return summary{}, fmt.Errorf("%s has no summary of %s: %w", page.Host, page.Title, errors.ErrUnsupported)
+	case resp.StatusCode != http.StatusOK:
+		return summary{}, fmt.Errorf("%s returned status %d", page.Host, resp.StatusCode)
+	}
+
+	var s summary
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&s); err != nil {
+		// Wikis without the REST API answer with an HTML page.
+		return summary{}, fmt.Errorf("%s has no summary endpoint: %w", page.Host, errors.ErrUnsupported)
+	}
+
+	return s, nil
+}
+
+// summaryHead builds the preview of a page from its summary. Section anchors are kept in the URL
+// and named in the title. Disambiguation pages have no image, and say what they are.
+func summaryHead(u *url.URL, page Page, s summary) opengraph.Head {
+	title := opengraph.StripTags(s.DisplayTitle)
+	if title == "" {
+		title = s.Title
+	}
+	if title == "" {
+		title = strings.ReplaceAll(page.Title, "_", " ")
+	}
+
+	canonical := s.ContentURLs.Desktop.Page
+	if page.Mobile && s.ContentURLs.Mobile.Page != "" {
+		canonical = s.ContentURLs.Mobile.Page
+	}
+	if canonical == "" {
+		canonical = u.String()
+	} else if u.Fragment != "" {
+		canonical += "#" + u.EscapedFragment()
+	}
+
+	description := s.Extract
+	if description == "" {
+		description = s.Description
+	}
+
+	if s.Type == TypeDisambiguation {
+		if !strings.Contains(strings.ToLower(title), "disambiguation") {
+			title += " (disambiguation)"
+		}
+		if description == "" {
+			description = "This disambiguation page lists articles associated with the title " + s.Title + "."
+		}
+	}
+
+	if page.Section != "" {
+		title += " § " + page.Section
+	}
+
+	head := opengraph.Head{Title: title, Charset: "utf-8"}
+	head.SetMeta("og:title", title)
+	head.SetMeta("og:site_name", siteName(page.Host))
+	head.SetMeta("og:url", canonical)
+	head.SetMeta("og:description", opengraph.Truncate(strings.TrimSpace(description), opengraph.MaxDescriptionLength))
+
+	if s.Type == TypeDisambiguation {
+		head.SetMeta("og:type", "website")
+		head.SetMeta("twitter:card", "summary")
+		head.SetMeta("twitter:label1", "Page")
+		head.SetMeta("twitter:data1", "Disambiguation")
+	} else {
+		head.SetMeta("og:type", "article")
+		if s.Thumbnail.Source != "" {
+			head.SetMeta("og:image", s.Thumbnail.Source)
+			if s.Thumbnail.Width > 0 && s.Thumbnail.Height > 0 {
+				head.SetMeta("og:image:width", fmt.Sprint(s.Thumbnail.Width))
+				head.SetMeta("og:image:height", fmt.Sprint(s.Thumbnail.Height))
+			}
+		}
+		head.SetMeta("twitter:card", "summary")
+		if s.Description != "" && s.Description != description {
+			head.SetMeta("twitter:label1", "About")
+			head.SetMeta("twitter:data1", s.Description)
+		}
+	}
+
+	lang := s.Lang
+	if lang == "" {
+		lang, _ = strings.CutSuffix(page.Host, ".wikipedia.org")
+	}
+	if tag, err := language.Parse(lang); err == nil {
+		head.SetMeta("og:locale", strings.ReplaceAll(tag.String(), "-", "_"))
+		if name := display.Self.Name(tag); name != "" {
+			head.SetMeta("twitter:label2", "Language")
+			head.SetMeta("twitter:data2", name)
+		}
+	}
+
+	return head
+}
+
+// siteName returns the name of the Wikimedia project of host, or else host.
+func siteName(host string) string {
+	labels := strings.Split(host, ".")
+	if len(labels) >= 2 {
+		if name, ok := projects[strings.Join(labels[len(labels)-2:], ".")]; ok {
+			return name
+		}
+	}
+	return host
+}
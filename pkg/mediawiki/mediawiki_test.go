@@ -0,0 +1,185 @@
+package mediawiki
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+)
+
+func TestClientParse(t *testing.T) {
+	c := New(Options{Hosts: []string{"en.wiktionary.org", " Wiki.Example.org "}})
+
+	tests := []struct {
+		url      string
+		expected Page
+		wantErr  bool
+	}{
+		{url: "https://en.wikipedia.org/wiki/Alan_Turing", expected: Page{Host: "en.wikipedia.org", Title: "Alan_Turing"}},
+		{
+			url:      "https://en.m.wikipedia.org/wiki/Alan_Turing#Early_life",
+			expected: Page{Host: "en.wikipedia.org", Title: "Alan_Turing", Section: "Early life", Mobile: true},
+		},
+		{url: "https://de.wikipedia.org/wiki/K%C3%B6ln", expected: Page{Host: "de.wikipedia.org", Title: "Köln"}},
+		{url: "https://zh-yue.wikipedia.org/wiki/AC/DC", expected: Page{Host: "zh-yue.wikipedia.org", Title: "AC/DC"}},
+		{
+			url:      "https://fr.wikipedia.org/w/index.php?title=Tour Eiffel",
+			expected: Page{Host: "fr.wikipedia.org", Title: "Tour_Eiffel"},
+		},
+		{url: "https://en.m.wiktionary.org/wiki/nostr", expected: Page{Host: "en.wiktionary.org", Title: "nostr", Mobile: true}},
+		{url: "http://wiki.example.org/wiki/Main_Page", expected: Page{Host: "wiki.example.org", Title: "Main_Page"}},
+		{url: "https://fr.wikipedia.org/w/index.php?title=Tour_Eiffel&action=history", wantErr: true},
+		{url: "https://www.wikipedia.org/wiki/Alan_Turing", wantErr: true},
+		{url: "https://en.wikipedia.org/", wantErr: true},
+		{url: "https://en.wikipedia.org.example.com/wiki/Alan_Turing", wantErr: true},
+		{url: "https://de.wiktionary.org/wiki/nostr", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+
+			page, err := c.Parse(u)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if page != tt.expected {
+				t.Errorf("Parse() = %+v, expected %+v", page, tt.expected)
+			}
+		})
+	}
+}
+
+// newFakeWiki serves the summaries of a few pages.
+func newFakeWiki(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.EscapedPath() {
+		case "/api/rest_v1/page/summary/Alan_Turing":
+			fmt.Fprint(w, `{"type": "standard", "title": "Alan Turing", "displaytitle": "<span class=\"mw-page-title-main\">Alan Turing</span>",
+				"description": "English computer scientist (1912–1954)",
+				"extract": "Alan Mathison Turing was an English mathematician and computer scientist.", "lang": "en",
+				"thumbnail": {"source": "https://upload.wikimedia.org/turing.jpg", "width": 320, "height": 400},
+				"content_urls": {"desktop": {"page": "https://en.wikipedia.org/wiki/Alan_Turing"},
+					"mobile": {"page": "https://en.m.wikipedia.org/wiki/Alan_Turing"}}}`)
+		case "/api/rest_v1/page/summary/K%C3%B6ln":
+			fmt.Fprint(w, `{"type": "standard", "title": "Köln", "extract": "Köln ist die größte Stadt Nordrhein-Westfalens.", "lang": "de",
+				"content_urls": {"desktop": {"page": "https://de.wikipedia.org/wiki/K%C3%B6ln"}}}`)
+		case "/api/rest_v1/page/summary/Mercury":
+			fmt.Fprint(w, `{"type": "disambiguation", "title": "Mercury", "extract": "Mercury commonly refers to:", "lang": "en",
+				"thumbnail": {"source": "https://upload.wikimedia.org/mercury.jpg", "width": 320, "height": 320},
+				"content_urls": {"desktop": {"page": "https://en.wikipedia.org/wiki/Mercury"}}}`)
+		case "/api/rest_v1/page/summary/Special%3ARandom":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"type": "https://mediawiki.org/wiki/HyperSwitch/errors/not_found", "title": "Not found."}`)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<!DOCTYPE html><html><head><title>Wiki</title></head></html>`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestClientPreview(t *testing.T) {
+	srv := newFakeWiki(t)
+	c := New(Options{HTTPClient: srv.Client(), Hosts: []string{"wiki.example.org"}, APIURL: srv.URL})
+
+	tests := []struct {
+		name     string
+		url      string
+		expected opengraph.Metadata
+		labels   map[string]string
+	}{
+		{
+			name: "mobile section",
+			url:  "https://en.m.wikipedia.org/wiki/Alan_Turing#Early_life",
+			expected: opengraph.Metadata{
+				URL:         "https://en.m.wikipedia.org/wiki/Alan_Turing#Early_life",
+				Title:       "Alan Turing § Early life",
+				Description: "Alan Mathison Turing was an English mathematician and computer scientist.",
+				Image:       "https://upload.wikimedia.org/turing.jpg",
+				ImageWidth:  320,
+				ImageHeight: 400,
+				SiteName:    "Wikipedia",
+				Type:        "article",
+			},
+			labels: map[string]string{
+				"og:locale":      "en",
+				"twitter:label1": "About",
+				"twitter:data1":  "English computer scientist (1912–1954)",
+				"twitter:data2":  "English",
+			},
+		},
+		{
+			name: "other language",
+			url:  "https://de.wikipedia.org/wiki/K%C3%B6ln",
+			expected: opengraph.Metadata{
+				URL:         "https://de.wikipedia.org/wiki/K%C3%B6ln",
+				Title:       "Köln",
+				Description: "Köln ist die größte Stadt Nordrhein-Westfalens.",
+				SiteName:    "Wikipedia",
+				Type:        "article",
+			},
+			labels: map[string]string{"og:locale": "de", "twitter:label2": "Language", "twitter:data2": "Deutsch"},
+		},
+		{
+			name: "disambiguation",
+			url:  "https://en.wikipedia.org/wiki/Mercury",
+			expected: opengraph.Metadata{
+				URL:         "https://en.wikipedia.org/wiki/Mercury",
+				Title:       "Mercury (disambiguation)",
+				Description: "Mercury commonly refers to:",
+				SiteName:    "Wikipedia",
+				Type:        "website",
+			},
+			labels: map[string]string{"twitter:label1": "Page", "twitter:data1": "Disambiguation"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+
+			head, err := c.Preview(context.Background(), u)
+			if err != nil {
+				t.Fatalf("Preview() error = %v", err)
+			}
+			if md := head.Metadata(); md != tt.expected {
+				t.Errorf("Preview() = %+v, expected %+v", md, tt.expected)
+			}
+			for key, expected := range tt.labels {
+				if got := head.Meta(key); got != expected {
+					t.Errorf("Preview() %s = %q, expected %q", key, got, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestClientPreviewUnsupported(t *testing.T) {
+	srv := newFakeWiki(t)
+	c := New(Options{HTTPClient: srv.Client(), Hosts: []string{"wiki.example.org"}, APIURL: srv.URL})
+
+	for _, rawURL := range []string{
+		"https://en.wikipedia.org/wiki/Special:Random",
+		"https://wiki.example.org/wiki/Main_Page",
+	} {
+		t.Run(rawURL, func(t *testing.T) {
+			u, _ := url.Parse(rawURL)
+
+			if _, err := c.Preview(context.Background(), u); !errors.Is(err, errors.ErrUnsupported) {
+				t.Errorf("Preview() error = %v, expected %v", err, errors.ErrUnsupported)
+			}
+		})
+	}
+}
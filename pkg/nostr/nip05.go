@@ -0,0 +1,133 @@
+package nostr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// maxNIP05Bytes caps the size of a nostr.json document.
+const maxNIP05Bytes = 1 << 20
+
+// ErrNotVerified is returned when a NIP-05 identifier does not resolve to a public key:
+// the domain has no nostr.json document, the document does not list the name,
+// or it is not a valid document.
+var ErrNotVerified = errors.New("NIP-05 identifier not verified")
+
+var (
+	nip05Name   = regexp.MustCompile(`^[a-z0-9._-]{1,64}$`)
+	nip05Domain = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]([a-z0-9-]{0,61}[a-z0-9])?(:[0-9]{1,5})?$`)
+	hexKey      = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// NIP05 is the result of the lookup of a NIP-05 identifier.
+type NIP05 struct {
+	// Identifier is the normalized name@domain identifier.
+	Identifier string `json:"identifier"`
+	// PubKey is the hex public key the identifier points to.
+	PubKey string `json:"pubkey"`
+	// Relays are the relays the document lists for the public key, if any.
+	Relays []string `json:"relays"`
+}
+
+// ParseNIP05 returns the name and the domain of a name@domain identifier.
+// A bare domain stands for _@domain, the root identifier of the domain.
+func ParseNIP05(identifier string) (string, string, error) {
+	identifier = strings.ToLower(strings.TrimSpace(identifier))
+
+	name, domain, ok := strings.Cut(identifier, "@")
+	if !ok {
+		name, domain = "_", identifier
+	}
+
+	if !nip05Name.MatchString(name) {
+		return "", "", fmt.Errorf("invalid NIP-05 name %q", name)
+	}
+	if !nip05Domain.MatchString(domain) {
+		return "", "", fmt.Errorf("invalid NIP-05 domain %q", domain)
+	}
+
+	return name, domain, nil
+}
+
+// LookupNIP05 fetches https://{domain}/.well-known/nostr.json and returns the public key and the relays
+// of the identifier. Redirects are not followed, as NIP-05 requires.
+func LookupNIP05(ctx context.Context, client *http.Client, identifier string) (NIP05, error) {
+	name, domain, err := ParseNIP05(identifier)
+	if err != nil {
+		return NIP05{}, err
+	}
+
+	noRedirects := *client
+	noRedirects.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		"https://"+domain+"/.well-known/nostr.json?name="+name,
+		nil,
+	)
+	if err != nil {
+		return NIP05{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := noRedirects.Do(req)
+	if err != nil {
+		return NIP05{}, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		return NIP05{}, fmt.Errorf("%w: %s redirects to %s", ErrNotVerified, domain, resp.Header.Get("Location"))
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return NIP05{}, fmt.Errorf("%w: %s has no nostr.json document", ErrNotVerified, domain)
+	case resp.StatusCode != http.StatusOK:
+		return NIP05{}, fmt.Errorf("%s returned status %d", domain, resp.StatusCode)
+	}
+
+	var doc struct {
+		Names  map[string]string   `json:"names"`
+		Relays map[string][]string `json:"relays"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxNIP05Bytes)).Decode(&doc); err != nil {
+		return NIP05{}, fmt.Errorf("%w: invalid nostr.json document: %v", ErrNotVerified, err)
+	}
+
+	pubkey, ok := doc.Names[name]
+	if !ok {
+		// Names are case insensitive, but documents are not always written in lower case.
+		for n, key := range doc.Names {
+			if strings.EqualFold(n, name) {
+				pubkey, ok = key, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return NIP05{}, fmt.Errorf("%w: %s is not listed by %s", ErrNotVerified, name, domain)
+	}
+
+	pubkey = strings.ToLower(pubkey)
+	if !hexKey.MatchString(pubkey) {
+		return NIP05{}, fmt.Errorf("%w: invalid public key %q", ErrNotVerified, pubkey)
+	}
+
+	result := NIP05{Identifier: name + "@" + domain, PubKey: pubkey, Relays: []string{}}
+	for _, relay := range doc.Relays[pubkey] {
+		if relay = normalizeRelay(relay); relay != "" && !slices.Contains(result.Relays, relay) {
+			result.Relays = append(result.Relays, relay)
+		}
+	}
+
+	return result, nil
+}
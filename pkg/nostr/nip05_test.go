@@ -0,0 +1,125 @@
+package nostr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// newFakeNIP05Server serves the nostr.json document of example.com, whose certificate the test server holds.
+// The returned client sends every request to it.
+func newFakeNIP05Server(t *testing.T) *http.Client {
+	t.Helper()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/nostr.json" {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch r.URL.Query().Get("name") {
+		case "moved":
+			http.Redirect(w, r, "https://example.com/.well-known/nostr.json?name=bob", http.StatusFound)
+		case "down":
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{
+				"names": {"Bob": "%s", "_": "%s", "bad": "not a key"},
+				"relays": {"%s": ["wss://relay.example/", "wss://relay.example", "https://not-a-relay.example"]}
+			}`, bob, alice, bob)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	transport := srv.Client().Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+
+	return &http.Client{Transport: transport}
+}
+
+func TestParseNIP05(t *testing.T) {
+	tests := []struct {
+		identifier string
+		name       string
+		domain     string
+		wantErr    bool
+	}{
+		{identifier: "bob@example.com", name: "bob", domain: "example.com"},
+		{identifier: "Bob@Example.COM", name: "bob", domain: "example.com"},
+		{identifier: "example.com", name: "_", domain: "example.com"},
+		{identifier: "bob@localhost", wantErr: true},
+		{identifier: "bob smith@example.com", wantErr: true},
+		{identifier: "bob@example.com/path", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.identifier, func(t *testing.T) {
+			name, domain, err := ParseNIP05(tt.identifier)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseNIP05() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if name != tt.name || domain != tt.domain {
+				t.Errorf("ParseNIP05() = %s, %s, expected %s, %s", name, domain, tt.name, tt.domain)
+			}
+		})
+	}
+}
+
+func TestLookupNIP05(t *testing.T) {
+	client := newFakeNIP05Server(t)
+
+	tests := []struct {
+		identifier  string
+		expected    NIP05
+		notVerified bool
+		wantErr     bool
+	}{
+		{
+			identifier: "bob@example.com",
+			expected: NIP05{
+				Identifier: "bob@example.com",
+				PubKey:     bob,
+				Relays:     []string{"wss://relay.example"},
+			},
+		},
+		{
+			identifier: "example.com",
+			expected:   NIP05{Identifier: "_@example.com", PubKey: alice, Relays: []string{}},
+		},
+		{identifier: "carol@example.com", notVerified: true},
+		{identifier: "bad@example.com", notVerified: true},
+		{identifier: "moved@example.com", notVerified: true},
+		{identifier: "down@example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.identifier, func(t *testing.T) {
+			result, err := LookupNIP05(context.Background(), client, tt.identifier)
+
+			if tt.notVerified {
+				if !errors.Is(err, ErrNotVerified) {
+					t.Fatalf("LookupNIP05() error = %v, expected ErrNotVerified", err)
+				}
+				return
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LookupNIP05() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrNotVerified) {
+				t.Fatalf("LookupNIP05() error = %v, expected an error other than ErrNotVerified", err)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("LookupNIP05() = %+v, expected %+v", result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package nostr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxRelayInfoBytes caps the size of a relay information document.
+	maxRelayInfoBytes = 256 << 10
+	// maxRelayInfoText caps the length of the free text fields of a relay information document.
+	maxRelayInfoText = 2000
+)
+
+var (
+	// ErrRelayInfoNotFound is returned when a relay answers the NIP-11 request with a 404.
+	ErrRelayInfoNotFound = errors.New("relay information document not found")
+	// ErrInvalidRelayInfo is returned when a relay does not serve a valid NIP-11 document.
+	ErrInvalidRelayInfo = errors.New("invalid relay information document")
+)
+
+// RelayInfo is a normalized NIP-11 relay information document.
+type RelayInfo struct {
+	// URL is the normalized ws or wss URL of the relay.
+	URL            string           `json:"url"`
+	Name           string           `json:"name,omitempty"`
+	Description    string           `json:"description,omitempty"`
+	Banner         string           `json:"banner,omitempty"`
+	Icon           string           `json:"icon,omitempty"`
+	PubKey         string           `json:"pubkey,omitempty"`
+	Contact        string           `json:"contact,omitempty"`
+	SupportedNIPs  []int            `json:"supported_nips"`
+	Software       string           `json:"software,omitempty"`
+	Version        string           `json:"version,omitempty"`
+	PrivacyPolicy  string           `json:"privacy_policy,omitempty"`
+	TermsOfService string           `json:"terms_of_service,omitempty"`
+	PostingPolicy  string           `json:"posting_policy,omitempty"`
+	PaymentsURL    string           `json:"payments_url,omitempty"`
+	Limitation     *RelayLimitation `json:"limitation,omitempty"`
+	Fees           *RelayFees       `json:"fees,omitempty"`
+	RelayCountries []string         `json:"relay_countries,omitempty"`
+	LanguageTags   []string         `json:"language_tags,omitempty"`
+	Tags           []string         `json:"tags,omitempty"`
+}
+
+// RelayLimitation are the limits a relay applies to its clients.
+type RelayLimitation struct {
+	MaxMessageLength    int64 `json:"max_message_length,omitempty"`
+	MaxSubscriptions    int64 `json:"max_subscriptions,omitempty"`
+	MaxLimit            int64 `json:"max_limit,omitempty"`
+	MaxSubIDLength      int64 `json:"max_subid_length,omitempty"`
+	MaxEventTags        int64 `json:"max_event_tags,omitempty"`
+	MaxContentLength    int64 `json:"max_content_length,omitempty"`
+	MinPowDifficulty    int64 `json:"min_pow_difficulty,omitempty"`
+	AuthRequired        bool  `json:"auth_required"`
+	PaymentRequired     bool  `json:"payment_required"`
+	RestrictedWrites    bool  `json:"restricted_writes"`
+	CreatedAtLowerLimit int64 `json:"created_at_lower_limit,omitempty"`
+	CreatedAtUpperLimit int64 `json:"created_at_upper_limit,omitempty"`
+	DefaultLimit        int64 `json:"default_limit,omitempty"`
+}
+
+// RelayFees are the fees a relay charges.
+type RelayFees struct {
+	Admission    []RelayFee `json:"admission,omitempty"`
+	Subscription []RelayFee `json:"subscription,omitempty"`
+	Publication  []RelayFee `json:"publication,omitempty"`
+}
+
+// RelayFee is an amount charged for admission, a subscription period or the publication of some kinds.
+type RelayFee struct {
+	Amount int64  `json:"amount"`
+	Unit   string `json:"unit"`
+	Period int64  `json:"period,omitempty"`
+	Kinds  []int  `json:"kinds,omitempty"`
+}
+
+// ParseRelayURL returns the normalized ws or wss URL of a relay given by URL, or by host for wss relays.
+func ParseRelayURL(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "://") {
+		s = "wss://" + s
+	}
+
+	relay := normalizeRelay(s)
+	if relay == "" {
+		return "", fmt.Errorf("invalid relay URL %q: only ws and wss URLs are supported", s)
+	}
+
+	return relay, nil
+}
+
+// FetchRelayInfo requests the NIP-11 document of relay, a ws or wss URL, over http or https.
+func FetchRelayInfo(ctx context.Context, client *http.Client, relay string) (RelayInfo, error) {
+	relay, err := ParseRelayURL(relay)
+	if err != nil {
+		return RelayInfo{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http"+strings.TrimPrefix(relay, "ws"), nil)
+	if err != nil {
+		return RelayInfo{}, err
+	}
+	req.Header.Set("Accept", "application/nostr+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return RelayInfo{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return RelayInfo{}, fmt.Errorf("%w: %s", ErrRelayInfoNotFound, relay)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return RelayInfo{}, fmt.Errorf("relay %s returned status %d", relay, resp.StatusCode)
+	}
+
+	// Relays are lenient about the types of their fields, so each part is decoded on its own
+	// and a malformed part is dropped rather than failing the whole document.
+	var doc struct {
+		Name           json.RawMessage `json:"name"`
+		Description    json.RawMessage `json:"description"`
+		Banner         json.RawMessage `json:"banner"`
+		Icon           json.RawMessage `json:"icon"`
+		PubKey         json.RawMessage `json:"pubkey"`
+		Contact        json.RawMessage `json:"contact"`
+		SupportedNIPs  json.RawMessage `json:"supported_nips"`
+		Software       json.RawMessage `json:"software"`
+		Version        json.RawMessage `json:"version"`
+		PrivacyPolicy  json.RawMessage `json:"privacy_policy"`
+		TermsOfService json.RawMessage `json:"terms_of_service"`
+		PostingPolicy  json.RawMessage `json:"posting_policy"`
+		PaymentsURL    json.RawMessage `json:"payments_url"`
+		Limitation     json.RawMessage `json:"limitation"`
+		Fees           json.RawMessage `json:"fees"`
+		RelayCountries json.RawMessage `json:"relay_countries"`
+		LanguageTags   json.RawMessage `json:"language_tags"`
+		Tags           json.RawMessage `json:"tags"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxRelayInfoBytes)).Decode(&doc); err != nil {
+		return RelayInfo{}, fmt.Errorf("%w: %v", ErrInvalidRelayInfo, err)
+	}
+
+	base := resp.Request.URL
+	info := RelayInfo{
+		URL:            relay,
+		Name:           text(doc.Name),
+		Description:    text(doc.Description),
+		Banner:         link(base, doc.Banner),
+		Icon:           link(base, doc.Icon),
+		Contact:        text(doc.Contact),
+		SupportedNIPs:  numbers(doc.SupportedNIPs),
+		Software:       text(doc.Software),
+		Version:        text(doc.Version),
+		PrivacyPolicy:  link(base, doc.PrivacyPolicy),
+		TermsOfService: link(base, doc.TermsOfService),
+		PostingPolicy:  link(base, doc.PostingPolicy),
+		PaymentsURL:    link(base, doc.PaymentsURL),
+		RelayCountries: texts(doc.RelayCountries),
+		LanguageTags:   texts(doc.LanguageTags),
+		Tags:           texts(doc.Tags),
+	}
+
+	if pubkey := strings.ToLower(text(doc.PubKey)); hexKey.MatchString(pubkey) {
+		info.PubKey = pubkey
+	}
+
+	var limitation RelayLimitation
+	if len(doc.Limitation) > 0 && json.Unmarshal(doc.Limitation, &limitation) == nil && limitation != (RelayLimitation{}) {
+		info.Limitation = &limitation
+	}
+
+	var fees RelayFees
+	if len(doc.Fees) > 0 && json.Unmarshal(doc.Fees, &fees) == nil &&
+		len(fees.Admission)+len(fees.Subscription)+len(fees.Publication) > 0 {
+		info.Fees = &fees
+	}
+
+	return info, nil
+}
+
+// text returns the trimmed string held by raw, cut to maxRelayInfoText characters, or an empty string.
+func text(raw json.RawMessage) string {
+	var s string
+	if len(raw) == 0 || json.Unmarshal(raw, &s) != nil {
+		return ""
+	}
+
+	s = strings.TrimSpace(s)
+	if utf8.RuneCountInString(s) > maxRelayInfoText {
+		s = string([]rune(s)[:maxRelayInfoText])
+	}
+	return s
+}
+
+// texts returns the non-empty strings of the array held by raw.
+func texts(raw json.RawMessage) []string {
+	var values []json.RawMessage
+	if len(raw) == 0 || json.Unmarshal(raw, &values) != nil {
+		return nil
+	}
+
+	var out []string
+	for _, v := range values {
+		if s := text(v); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// link returns the absolute http or https URL held by raw, resolved against base, or an empty string.
+func link(base *url.URL, raw json.RawMessage) string {
+	s := text(raw)
+	if s == "" {
+		return ""
+	}
+
+	u, err := base.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return u.String()
+}
+
+// numbers returns the sorted, distinct NIP numbers of the array held by raw.
+// Some relays list them as strings, like "11", which are accepted too.
+func numbers(raw json.RawMessage) []int {
+	var values []json.RawMessage
+	if len(raw) == 0 || json.Unmarshal(raw, &values) != nil {
+		return []int{}
+	}
+
+	out := []int{}
+	for _, v := range values {
+		var n int
+		if json.Unmarshal(v, &n) != nil {
+			var err error
+			if n, err = strconv.Atoi(text(v)); err != nil {
+				continue
+			}
+		}
+		if n >= 0 && !slices.Contains(out, n) {
+			out = append(out, n)
+		}
+	}
+
+	slices.Sort(out)
+	return out
+}
@@ -0,0 +1,127 @@
+package nostr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRelayURL(t *testing.T) {
+	tests := []struct {
+		relay    string
+		expected string
+		wantErr  bool
+	}{
+		{relay: "wss://Relay.Example/", expected: "wss://relay.example"},
+		{relay: "ws://relay.example:7777", expected: "ws://relay.example:7777"},
+		{relay: "relay.example", expected: "wss://relay.example"},
+		{relay: "https://relay.example", wantErr: true},
+		{relay: "wss://user@relay.example", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.relay, func(t *testing.T) {
+			relay, err := ParseRelayURL(tt.relay)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRelayURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if relay != tt.expected {
+				t.Errorf("ParseRelayURL() = %s, expected %s", relay, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFetchRelayInfo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/nostr+json" {
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html><body>Please use a Nostr client</body></html>")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/nostr+json")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `{
+				"name": "  Example relay ",
+				"description": "A relay for tests",
+				"icon": "/icon.png",
+				"banner": "javascript:alert(1)",
+				"pubkey": "%s",
+				"contact": "mailto:admin@relay.example",
+				"supported_nips": [1, 11, "42", 1, "not a nip"],
+				"software": "git+https://github.com/example/relay.git",
+				"version": "1.2.3",
+				"limitation": {"max_message_length": 16384, "auth_required": false, "payment_required": true},
+				"fees": {"admission": [{"amount": 1000000, "unit": "msats"}]},
+				"relay_countries": ["CA", ""],
+				"tags": ["sfw-only"]
+			}`, strings.ToUpper(bob))
+		case "/lenient":
+			fmt.Fprint(w, `{"name": 42, "pubkey": "npub1...", "supported_nips": "1,11", "limitation": {"max_limit": "500"}}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	relay := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	tests := []struct {
+		relay    string
+		expected RelayInfo
+		wantErr  bool
+	}{
+		{
+			relay: relay,
+			expected: RelayInfo{
+				URL:            relay,
+				Name:           "Example relay",
+				Description:    "A relay for tests",
+				Icon:           srv.URL + "/icon.png",
+				PubKey:         bob,
+				Contact:        "mailto:admin@relay.example",
+				SupportedNIPs:  []int{1, 11, 42},
+				Software:       "git+https://github.com/example/relay.git",
+				Version:        "1.2.3",
+				Limitation:     &RelayLimitation{MaxMessageLength: 16384, PaymentRequired: true},
+				Fees:           &RelayFees{Admission: []RelayFee{{Amount: 1000000, Unit: "msats"}}},
+				RelayCountries: []string{"CA"},
+				Tags:           []string{"sfw-only"},
+			},
+		},
+		{
+			relay:    relay + "/lenient",
+			expected: RelayInfo{URL: relay + "/lenient", SupportedNIPs: []int{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.relay, func(t *testing.T) {
+			info, err := FetchRelayInfo(context.Background(), srv.Client(), tt.relay)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FetchRelayInfo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(info, tt.expected) {
+				t.Errorf("FetchRelayInfo() = %+v, expected %+v", info, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFetchRelayInfoInvalid(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body>Not a relay</body></html>")
+	}))
+	t.Cleanup(srv.Close)
+
+	_, err := FetchRelayInfo(context.Background(), srv.Client(), "ws"+strings.TrimPrefix(srv.URL, "http"))
+	if !errors.Is(err, ErrInvalidRelayInfo) {
+		t.Errorf("FetchRelayInfo() error = %v, expected ErrInvalidRelayInfo", err)
+	}
+}
@@ -0,0 +1,153 @@
+package nostr
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/bech32"
+)
+
+// Prefixes of the NIP-19 entities handled by the provider. nsec keys are never decoded.
+const (
+	PrefixPubKey  = "npub"
+	PrefixProfile = "nprofile"
+	PrefixNote    = "note"
+	PrefixEvent   = "nevent"
+	PrefixAddress = "naddr"
+)
+
+// TLV types of nprofile, nevent and naddr entities.
+const (
+	tlvSpecial = 0
+	tlvRelay   = 1
+	tlvAuthor  = 2
+	tlvKind    = 3
+)
+
+// maxRelayHints caps the relay hints of an entity that are queried.
+const maxRelayHints = 3
+
+// ErrNotNostr is returned by Parse for URLs that do not hold a NIP-19 entity.
+var ErrNotNostr = errors.New("not a Nostr URL")
+
+// Entity is a decoded NIP-19 entity.
+type Entity struct {
+	// Prefix is the human readable part of the entity, like npub or nevent.
+	Prefix string
+	// Raw is the entity as given, bech32 encoded.
+	Raw string
+	// PubKey is the hex public key of a profile, or the author of an event or address when it is known.
+	PubKey string
+	// EventID is the hex ID of a note or event.
+	EventID string
+	// Kind is the kind of an address, or of an event when it is known.
+	Kind int
+	// Identifier is the d tag of an address.
+	Identifier string
+	// Relays are the relay hints of the entity.
+	Relays []string
+}
+
+// Decode decodes the npub, nprofile, note, nevent or naddr entity s.
+func Decode(s string) (Entity, error) {
+	prefix, data, err := bech32.Decode(s)
+	if err != nil {
+		return Entity{}, err
+	}
+
+	e := Entity{Prefix: prefix, Raw: strings.ToLower(s)}
+
+	switch prefix {
+	case PrefixPubKey, PrefixNote:
+		if len(data) != 32 {
+			return Entity{}, fmt.Errorf("invalid %s length %d", prefix, len(data))
+		}
+		if prefix == PrefixPubKey {
+			e.PubKey = hex.EncodeToString(data)
+		} else {
+			e.EventID = hex.EncodeToString(data)
+		}
+		return e, nil
+	case PrefixProfile, PrefixEvent, PrefixAddress:
+		if err := e.decodeTLV(data); err != nil {
+			return Entity{}, err
+		}
+		return e, nil
+	default:
+		return Entity{}, fmt.Errorf("unsupported NIP-19 prefix %q", prefix)
+	}
+}
+
+// decodeTLV fills e from the TLV records of an nprofile, nevent or naddr entity.
+func (e *Entity) decodeTLV(data []byte) error {
+	var special []byte
+	var hasSpecial bool
+
+	for len(data) > 0 {
+		if len(data) < 2 || len(data) < 2+int(data[1]) {
+			return errors.New("truncated TLV record")
+		}
+		typ, value := data[0], data[2:2+int(data[1])]
+		data = data[2+int(data[1]):]
+
+		switch typ {
+		case tlvSpecial:
+			if !hasSpecial {
+				special, hasSpecial = value, true
+			}
+		case tlvRelay:
+			if relay := normalizeRelay(string(value)); relay != "" && len(e.Relays) < maxRelayHints {
+				e.Relays = append(e.Relays, relay)
+			}
+		case tlvAuthor:
+			if len(value) == 32 && e.PubKey == "" {
+				e.PubKey = hex.EncodeToString(value)
+			}
+		case tlvKind:
+			if len(value) == 4 {
+				e.Kind = int(binary.BigEndian.Uint32(value))
+			}
+		}
+	}
+
+	if !hasSpecial {
+		return fmt.Errorf("%s has no %s", e.Prefix, map[string]string{
+			PrefixProfile: "public key", PrefixEvent: "event ID", PrefixAddress: "identifier",
+		}[e.Prefix])
+	}
+
+	switch e.Prefix {
+	case PrefixProfile:
+		if len(special) != 32 {
+			return fmt.Errorf("invalid public key length %d", len(special))
+		}
+		e.PubKey = hex.EncodeToString(special)
+	case PrefixEvent:
+		if len(special) != 32 {
+			return fmt.Errorf("invalid event ID length %d", len(special))
+		}
+		e.EventID = hex.EncodeToString(special)
+	case PrefixAddress:
+		if e.PubKey == "" {
+			return errors.New("naddr has no author")
+		}
+		if e.Kind == 0 {
+			return errors.New("naddr has no kind")
+		}
+		e.Identifier = string(special)
+	}
+
+	return nil
+}
+
+// EncodePubKey returns the npub of the hex public key pubkey.
+func EncodePubKey(pubkey string) (string, error) {
+	data, err := hex.DecodeString(pubkey)
+	if err != nil || len(data) != 32 {
+		return "", fmt.Errorf("invalid public key %q", pubkey)
+	}
+	return bech32.Encode(PrefixPubKey, data)
+}
@@ -0,0 +1,164 @@
+package nostr
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/bech32"
+)
+
+// encodeTLV returns the bech32 entity prefix holding the TLV records, each given as a type and a value.
+func encodeTLV(t *testing.T, prefix string, records ...any) string {
+	t.Helper()
+
+	var data []byte
+	for i := 0; i < len(records); i += 2 {
+		typ := records[i].(int)
+		var value []byte
+		switch v := records[i+1].(type) {
+		case string:
+			if typ == tlvRelay || (prefix == PrefixAddress && typ == tlvSpecial) {
+				value = []byte(v)
+			} else {
+				value, _ = hex.DecodeString(v)
+			}
+		case int:
+			value = binary.BigEndian.AppendUint32(nil, uint32(v))
+		}
+		data = append(data, byte(typ), byte(len(value)))
+		data = append(data, value...)
+	}
+
+	s, err := bech32.Encode(prefix, data)
+	if err != nil {
+		t.Fatalf("Encode() unexpected error: %v", err)
+	}
+	return s
+}
+
+func TestDecode(t *testing.T) {
+	const pubkey = "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d"
+	const eventID = "b9f5441e45ca39179320e0031cfb18e34078673dcc3d3e3a3b3a981760aa5696"
+
+	nevent := encodeTLV(t, PrefixEvent, tlvSpecial, eventID, tlvRelay, "wss://relay.example/", tlvAuthor, pubkey, tlvKind, 1)
+	naddr := encodeTLV(t, PrefixAddress, tlvSpecial, "my-article", tlvRelay, "wss://relay.example", tlvAuthor, pubkey, tlvKind, 30023)
+
+	tests := []struct {
+		name     string
+		entity   string
+		expected Entity
+		wantErr  bool
+	}{
+		{
+			name:   "npub",
+			entity: "npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg",
+			expected: Entity{
+				Prefix: PrefixPubKey,
+				Raw:    "npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg",
+				PubKey: "7e7e9c42a91bfef19fa929e5fda1b72e0ebc1a4c1141673e2794234d86addf4e",
+			},
+		},
+		{
+			name:   "nprofile",
+			entity: "nprofile1qqsrhuxx8l9ex335q7he0f09aej04zpazpl0ne2cgukyawd24mayt8gpp4mhxue69uhhytnc9e3k7mgpz4mhxue69uhkg6nzv9ejuumpv34kytnrdaksjlyr9p",
+			expected: Entity{
+				Prefix: PrefixProfile,
+				Raw:    "nprofile1qqsrhuxx8l9ex335q7he0f09aej04zpazpl0ne2cgukyawd24mayt8gpp4mhxue69uhhytnc9e3k7mgpz4mhxue69uhkg6nzv9ejuumpv34kytnrdaksjlyr9p",
+				PubKey: pubkey,
+				Relays: []string{"wss://r.x.com", "wss://djbas.sadkb.com"},
+			},
+		},
+		{
+			name:   "nevent",
+			entity: nevent,
+			expected: Entity{
+				Prefix:  PrefixEvent,
+				Raw:     nevent,
+				PubKey:  pubkey,
+				EventID: eventID,
+				Kind:    1,
+				Relays:  []string{"wss://relay.example"},
+			},
+		},
+		{
+			name:   "naddr",
+			entity: naddr,
+			expected: Entity{
+				Prefix:     PrefixAddress,
+				Raw:        naddr,
+				PubKey:     pubkey,
+				Kind:       30023,
+				Identifier: "my-article",
+				Relays:     []string{"wss://relay.example"},
+			},
+		},
+		{
+			name:    "naddr without author",
+			entity:  encodeTLV(t, PrefixAddress, tlvSpecial, "my-article", tlvKind, 30023),
+			wantErr: true,
+		},
+		{
+			name:    "nsec",
+			entity:  "nsec1vl029mgpspedva04g90vltkh6fvh240zqtv9k0t9af8935ke9laqsnlfe5",
+			wantErr: true,
+		},
+		{
+			name:    "invalid checksum",
+			entity:  "npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjpta",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := Decode(tt.entity)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(e, tt.expected) {
+				t.Errorf("Decode() = %+v, expected %+v", e, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	const npub = "npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg"
+
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "nostr:" + npub},
+		{url: npub},
+		{url: "https://njump.me/" + npub},
+		{url: "https://example.com/" + npub, wantErr: true},
+		{url: "https://njump.me/about", wantErr: true},
+		{url: "nostr:nsec1vl029mgpspedva04g90vltkh6fvh240zqtv9k0t9af8935ke9laqsnlfe5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			e, err := Parse(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && e.Raw != npub {
+				t.Errorf("Parse() entity = %s, expected %s", e.Raw, npub)
+			}
+		})
+	}
+}
+
+func TestEncodePubKey(t *testing.T) {
+	npub, err := EncodePubKey("7e7e9c42a91bfef19fa929e5fda1b72e0ebc1a4c1141673e2794234d86addf4e")
+	if err != nil {
+		t.Fatalf("EncodePubKey() unexpected error: %v", err)
+	}
+
+	if expected := "npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg"; npub != expected {
+		t.Errorf("EncodePubKey() = %s, expected %s", npub, expected)
+	}
+}
@@ -0,0 +1,144 @@
+package nostr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// KindHTTPAuth is the kind of NIP-98 HTTP auth events.
+const KindHTTPAuth = 27235
+
+const (
+	// maxAuthHeaderBytes caps the size of an Authorization header holding an event.
+	maxAuthHeaderBytes = 16 << 10
+	// maxAuthPayloadBytes caps the size of a request body checked against the payload tag of its event.
+	maxAuthPayloadBytes = 1 << 20
+)
+
+// ErrUnauthorized is returned when a request does not carry a valid NIP-98 Authorization header.
+var ErrUnauthorized = errors.New("invalid NIP-98 authorization")
+
+// VerifyAuth verifies the NIP-98 Authorization header of r and returns the public key that signed it.
+// requestURL is the absolute URL the client sent the request to, which the u tag must match,
+// and the event must have been created within window of now. When the event has a payload tag,
+// the body of r must hash to it; the body is read and replaced so the handler can still read it.
+func VerifyAuth(r *http.Request, requestURL string, now time.Time, window time.Duration) (string, error) {
+	header := r.Header.Get("Authorization")
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Nostr") {
+		return "", fmt.Errorf("%w: missing Nostr authorization", ErrUnauthorized)
+	}
+	if len(token) > maxAuthHeaderBytes {
+		return "", fmt.Errorf("%w: authorization too large", ErrUnauthorized)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(token))
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid base64: %v", ErrUnauthorized, err)
+	}
+
+	var e Event
+	if err := json.Unmarshal(data, &e); err != nil {
+		return "", fmt.Errorf("%w: invalid event: %v", ErrUnauthorized, err)
+	}
+
+	if e.Kind != KindHTTPAuth {
+		return "", fmt.Errorf("%w: unexpected kind %d", ErrUnauthorized, e.Kind)
+	}
+
+	if created := time.Unix(e.CreatedAt, 0); created.Before(now.Add(-window)) || created.After(now.Add(window)) {
+		return "", fmt.Errorf("%w: event created at %s, outside of the accepted window", ErrUnauthorized, created.UTC())
+	}
+
+	if !sameURL(e.Tag("u"), requestURL) {
+		return "", fmt.Errorf("%w: u tag %q does not match %s", ErrUnauthorized, e.Tag("u"), requestURL)
+	}
+
+	if !strings.EqualFold(e.Tag("method"), r.Method) {
+		return "", fmt.Errorf("%w: method tag %q does not match %s", ErrUnauthorized, e.Tag("method"), r.Method)
+	}
+
+	if !hexKey.MatchString(e.PubKey) {
+		return "", fmt.Errorf("%w: invalid public key", ErrUnauthorized)
+	}
+
+	// The signature is checked after the cheap checks above, and before the body is read and hashed.
+	if err := e.Verify(); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnauthorized, err)
+	}
+
+	if payload := e.Tag("payload"); payload != "" {
+		if err := checkPayload(r, payload); err != nil {
+			return "", err
+		}
+	}
+
+	return e.PubKey, nil
+}
+
+// sameURL reports whether the absolute URLs a and b are the same,
+// ignoring the case of the scheme and the host.
+func sameURL(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil || !ua.IsAbs() {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(ua.Scheme, ub.Scheme) &&
+		strings.EqualFold(ua.Host, ub.Host) &&
+		ua.EscapedPath() == ub.EscapedPath() &&
+		ua.RawQuery == ub.RawQuery
+}
+
+// checkPayload reports whether the body of r hashes to the hex SHA-256 payload, and puts the body back in r.
+func checkPayload(r *http.Request, payload string) error {
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxAuthPayloadBytes+1))
+	r.Body.Close()
+	if err != nil {
+		return fmt.Errorf("%w: failed to read the body: %v", ErrUnauthorized, err)
+	}
+	if len(body) > maxAuthPayloadBytes {
+		return fmt.Errorf("%w: body too large to check the payload", ErrUnauthorized)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	sum := sha256.Sum256(body)
+	if !strings.EqualFold(payload, hex.EncodeToString(sum[:])) {
+		return fmt.Errorf("%w: payload tag does not match the body", ErrUnauthorized)
+	}
+
+	return nil
+}
+
+// ParsePubKey returns the hex public key of pubkey, given as hex or as an npub.
+func ParsePubKey(pubkey string) (string, error) {
+	pubkey = strings.ToLower(strings.TrimSpace(pubkey))
+	if hexKey.MatchString(pubkey) {
+		return pubkey, nil
+	}
+
+	e, err := Decode(pubkey)
+	if err != nil || e.Prefix != PrefixPubKey {
+		return "", fmt.Errorf("invalid public key %q", pubkey)
+	}
+
+	return e.PubKey, nil
+}
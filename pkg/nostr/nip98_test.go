@@ -0,0 +1,175 @@
+package nostr
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecretKey = "b7e151628aed2a6abf7158809cf4f3c762e7160f38b4da56a784d9045190cfef"
+
+// authHeader returns the NIP-98 Authorization header of e, signed with testSecretKey.
+func authHeader(t *testing.T, e Event) string {
+	t.Helper()
+
+	if err := e.sign(testSecretKey); err != nil {
+		t.Fatalf("sign() unexpected error: %v", err)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("Marshal() unexpected error: %v", err)
+	}
+
+	return "Nostr " + base64.StdEncoding.EncodeToString(data)
+}
+
+func TestVerifyAuth(t *testing.T) {
+	const pubkey = "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659"
+	const target = "https://proxy.example/sites/https%3A%2F%2Fexample.com"
+
+	now := time.Unix(1700000000, 0)
+	body := `{"urls": ["https://example.com"]}`
+	sum := sha256.Sum256([]byte(body))
+	payload := hex.EncodeToString(sum[:])
+
+	event := func(createdAt int64, kind int, tags ...string) Event {
+		e := Event{CreatedAt: createdAt, Kind: kind, Tags: [][]string{}}
+		for i := 0; i < len(tags); i += 2 {
+			e.Tags = append(e.Tags, []string{tags[i], tags[i+1]})
+		}
+		return e
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		header  string
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			method: "GET",
+			header: authHeader(t, event(now.Unix(), KindHTTPAuth, "u", target, "method", "GET")),
+		},
+		{
+			name:   "host in upper case",
+			method: "GET",
+			header: authHeader(t, event(now.Unix()-30, KindHTTPAuth, "u", strings.Replace(target, "proxy.example", "Proxy.Example", 1), "method", "get")),
+		},
+		{
+			name:   "matching payload",
+			method: "POST",
+			header: authHeader(t, event(now.Unix(), KindHTTPAuth, "u", target, "method", "POST", "payload", payload)),
+		},
+		{
+			name:    "payload mismatch",
+			method:  "POST",
+			header:  authHeader(t, event(now.Unix(), KindHTTPAuth, "u", target, "method", "POST", "payload", strings.Repeat("0", 64))),
+			wantErr: true,
+		},
+		{
+			name:    "wrong kind",
+			method:  "GET",
+			header:  authHeader(t, event(now.Unix(), KindNote, "u", target, "method", "GET")),
+			wantErr: true,
+		},
+		{
+			name:    "expired",
+			method:  "GET",
+			header:  authHeader(t, event(now.Unix()-120, KindHTTPAuth, "u", target, "method", "GET")),
+			wantErr: true,
+		},
+		{
+			name:    "other URL",
+			method:  "GET",
+			header:  authHeader(t, event(now.Unix(), KindHTTPAuth, "u", "https://proxy.example/sites/other", "method", "GET")),
+			wantErr: true,
+		},
+		{
+			name:    "other method",
+			method:  "GET",
+			header:  authHeader(t, event(now.Unix(), KindHTTPAuth, "u", target, "method", "POST")),
+			wantErr: true,
+		},
+		{
+			name:    "bearer token",
+			method:  "GET",
+			header:  "Bearer token",
+			wantErr: true,
+		},
+		{
+			name:    "invalid base64",
+			method:  "GET",
+			header:  "Nostr !!!",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, target, strings.NewReader(body))
+			r.Header.Set("Authorization", tt.header)
+
+			got, err := VerifyAuth(r, target, now, time.Minute)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyAuth() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrUnauthorized) {
+					t.Errorf("VerifyAuth() error = %v, expected %v", err, ErrUnauthorized)
+				}
+				return
+			}
+			if got != pubkey {
+				t.Errorf("VerifyAuth() = %s, expected %s", got, pubkey)
+			}
+
+			if rest, _ := io.ReadAll(r.Body); string(rest) != body {
+				t.Errorf("VerifyAuth() left body %q, expected %q", rest, body)
+			}
+		})
+	}
+}
+
+func TestVerifyAuthForgedSignature(t *testing.T) {
+	const target = "https://proxy.example/sites/x"
+	now := time.Unix(1700000000, 0)
+
+	e := Event{CreatedAt: now.Unix(), Kind: KindHTTPAuth, Tags: [][]string{{"u", target}, {"method", "GET"}}}
+	if err := e.sign(testSecretKey); err != nil {
+		t.Fatalf("sign() unexpected error: %v", err)
+	}
+
+	// Claim the event was signed by someone else.
+	e.PubKey = "f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9"
+	e.ID = e.Hash()
+	data, _ := json.Marshal(e)
+
+	r := httptest.NewRequest("GET", target, nil)
+	r.Header.Set("Authorization", "Nostr "+base64.StdEncoding.EncodeToString(data))
+
+	if _, err := VerifyAuth(r, target, now, time.Minute); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("VerifyAuth() error = %v, expected %v", err, ErrUnauthorized)
+	}
+}
+
+func TestParsePubKey(t *testing.T) {
+	const pubkey = "7e7e9c42a91bfef19fa929e5fda1b72e0ebc1a4c1141673e2794234d86addf4e"
+
+	for _, s := range []string{pubkey, strings.ToUpper(pubkey), "npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg"} {
+		if got, err := ParsePubKey(s); err != nil || got != pubkey {
+			t.Errorf("ParsePubKey(%s) = %s, %v, expected %s", s, got, err, pubkey)
+		}
+	}
+
+	if _, err := ParsePubKey("note1xyz"); err == nil {
+		t.Errorf("ParsePubKey() expected an error for a note")
+	}
+}
@@ -0,0 +1,285 @@
+// Package nostr builds link previews of Nostr notes, long-form articles and profiles,
+// given as NIP-19 entities, nostr: URIs or njump.me links, by querying relays over WebSocket.
+//
+// Events are only used when their ID matches their content and their Schnorr signature is valid,
+// since relay hints are chosen by whoever wrote the link.
+package nostr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+	"github.com/danvergara/jumble-proxy-server/pkg/outbound"
+)
+
+// Event kinds used by the previews.
+const (
+	KindProfile = 0
+	KindNote    = 1
+	KindArticle = 30023
+)
+
+// DefaultTimeout bounds each relay query.
+const DefaultTimeout = 5 * time.Second
+
+// DefaultRelays are queried when no relays are configured, after the relay hints of the entity.
+var DefaultRelays = []string{
+	"wss://relay.damus.io",
+	"wss://nos.lol",
+	"wss://relay.nostr.band",
+	"wss://relay.primal.net",
+}
+
+// ErrNotFound is returned when none of the relays has the event.
+var ErrNotFound = errors.New("event not found on the relays")
+
+// imageURL matches links to images in the content of a note.
+var imageURL = regexp.MustCompile(`https?://[^\s<>"]+\.(?:png|jpe?g|gif|webp|avif)(?:\?[^\s<>"]*)?`)
+
+// Parse returns the NIP-19 entity of a nostr: URI, an njump.me link or a bare entity.
+func Parse(rawURL string) (Entity, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Entity{}, err
+	}
+
+	var entity string
+	switch strings.ToLower(u.Scheme) {
+	case "nostr":
+		entity = u.Opaque
+	case "http", "https":
+		host := strings.ToLower(u.Hostname())
+		if host != "njump.me" && host != "www.njump.me" {
+			return Entity{}, ErrNotNostr
+		}
+		entity = strings.Trim(u.Path, "/")
+	case "":
+		if u.Host != "" {
+			return Entity{}, ErrNotNostr
+		}
+		entity = u.Path
+	default:
+		return Entity{}, ErrNotNostr
+	}
+
+	if entity == "" || strings.Contains(entity, "/") {
+		return Entity{}, ErrNotNostr
+	}
+
+	return Decode(entity)
+}
+
+// Options configures the client.
+type Options struct {
+	// HTTPClient opens the relay connections. Relay hints come from the entities, so the default
+	// outbound client, which refuses private addresses, is used when it is nil.
+	HTTPClient *http.Client
+	// Relays are queried after the relay hints of the entity. DefaultRelays is used when it is empty.
+	Relays []string
+	// Timeout defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Client builds previews of Nostr entities.
+type Client struct {
+	client  *http.Client
+	relays  []string
+	timeout time.Duration
+}
+
+func New(opts Options) *Client {
+	c := &Client{
+		client:  opts.HTTPClient,
+		timeout: opts.Timeout,
+	}
+
+	for _, relay := range opts.Relays {
+		if relay = normalizeRelay(relay); relay != "" {
+			c.relays = append(c.relays, relay)
+		}
+	}
+
+	if c.client == nil {
+		c.client = outbound.NewClient(outbound.Options{})
+	}
+	if len(c.relays) == 0 {
+		c.relays = DefaultRelays
+	}
+	if c.timeout <= 0 {
+		c.timeout = DefaultTimeout
+	}
+
+	return c
+}
+
+// Match reports whether u is a nostr: URI, an njump.me link or a bare NIP-19 entity.
+func (c *Client) Match(u *url.URL) bool {
+	_, err := Parse(u.String())
+	return err == nil
+}
+
+// Preview returns the head of the preview document of a Nostr note, article or profile.
+func (c *Client) Preview(ctx context.Context, u *url.URL) (opengraph.Head, error) {
+	entity, err := Parse(u.String())
+	if err != nil {
+		return opengraph.Head{}, err
+	}
+
+	relays := c.relaysFor(entity)
+
+	if entity.Prefix == PrefixPubKey || entity.Prefix == PrefixProfile {
+		profile, err := c.profile(ctx, relays, entity.PubKey)
+		if err != nil {
+			return opengraph.Head{}, err
+		}
+		return profileHead(entity, profile), nil
+	}
+
+	filter := Filter{IDs: []string{entity.EventID}}
+	if entity.Prefix == PrefixAddress {
+		filter = Filter{Authors: []string{entity.PubKey}, Kinds: []int{entity.Kind}, Limit: 1}
+		if entity.Kind >= 30000 && entity.Kind < 40000 {
+			filter.Tags = map[string][]string{"d": {entity.Identifier}}
+		}
+	}
+
+	event, found, err := c.fetch(ctx, relays, filter)
+	if err != nil {
+		return opengraph.Head{}, err
+	}
+	if !found {
+		return opengraph.Head{}, ErrNotFound
+	}
+
+	// The author is best effort, the event is shown even if their profile cannot be found.
+	profile, _ := c.profile(ctx, relays, event.PubKey)
+
+	return eventHead(entity, event, profile), nil
+}
+
+// relaysFor returns the relay hints of the entity, followed by the configured relays.
+func (c *Client) relaysFor(entity Entity) []string {
+	relays := make([]string, 0, len(entity.Relays)+len(c.relays))
+	for _, relay := range slices.Concat(entity.Relays, c.relays) {
+		if !slices.Contains(relays, relay) {
+			relays = append(relays, relay)
+		}
+	}
+	return relays
+}
+
+// Profile is the metadata of a kind 0 event, see NIP-01 and NIP-24.
+type Profile struct {
+	PubKey      string `json:"-"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	About       string `json:"about"`
+	Picture     string `json:"picture"`
+	NIP05       string `json:"nip05"`
+}
+
+// name returns the display name of the profile, its name, or its shortened npub.
+func (p Profile) name() string {
+	for _, name := range []string{p.DisplayName, p.Name} {
+		if name = strings.TrimSpace(name); name != "" {
+			return name
+		}
+	}
+
+	npub, err := EncodePubKey(p.PubKey)
+	if err != nil {
+		return "Anonymous"
+	}
+	return npub[:12] + "…" + npub[len(npub)-4:]
+}
+
+// profile returns the newest kind 0 profile of pubkey, or an empty profile if none is found.
+func (c *Client) profile(ctx context.Context, relays []string, pubkey string) (Profile, error) {
+	profile := Profile{PubKey: pubkey}
+
+	event, found, err := c.fetch(ctx, relays, Filter{Authors: []string{pubkey}, Kinds: []int{KindProfile}, Limit: 1})
+	if err != nil || !found {
+		return profile, err
+	}
+
+	if err := json.Unmarshal([]byte(event.Content), &profile); err != nil {
+		return Profile{PubKey: pubkey}, fmt.Errorf("invalid profile of %s: %w", pubkey, err)
+	}
+	profile.PubKey = pubkey
+
+	return profile, nil
+}
+
+// eventHead builds the preview of a note or a long-form article.
+func eventHead(entity Entity, event Event, author Profile) opengraph.Head {
+	title := author.name() + " on Nostr"
+	description := strings.TrimSpace(event.Content)
+	image := ""
+
+	if event.Kind == KindArticle {
+		if t := strings.TrimSpace(event.Tag("title")); t != "" {
+			title = t
+		}
+		if summary := strings.TrimSpace(event.Tag("summary")); summary != "" {
+			description = summary
+		}
+		image = event.Tag("image")
+	} else if m := imageURL.FindString(event.Content); m != "" {
+		image = m
+	}
+
+	head := newHead("https://njump.me/"+entity.Raw, title)
+	head.SetMeta("og:type", "article")
+	head.SetMeta("og:description", opengraph.Truncate(description, opengraph.MaxDescriptionLength))
+	head.SetMeta("author", author.name())
+
+	published := event.CreatedAt
+	if event.Kind == KindArticle {
+		if at, err := strconv.ParseInt(event.Tag("published_at"), 10, 64); err == nil && at > 0 {
+			published = at
+		}
+	}
+	head.SetMeta("article:published_time", time.Unix(published, 0).UTC().Format(time.RFC3339))
+
+	if image != "" {
+		head.SetMeta("og:image", image)
+		head.SetMeta("twitter:card", "summary_large_image")
+	} else {
+		head.SetMeta("og:image", author.Picture)
+	}
+
+	return head
+}
+
+// profileHead builds the preview of a profile.
+func profileHead(entity Entity, profile Profile) opengraph.Head {
+	head := newHead("https://njump.me/"+entity.Raw, profile.name())
+	head.SetMeta("og:type", "profile")
+	head.SetMeta("og:description", opengraph.Truncate(strings.TrimSpace(profile.About), opengraph.MaxDescriptionLength))
+	head.SetMeta("og:image", profile.Picture)
+	if profile.NIP05 != "" {
+		head.SetMeta("twitter:label1", "NIP-05")
+		head.SetMeta("twitter:data1", profile.NIP05)
+	}
+	return head
+}
+
+// newHead returns a head with the title and the properties every Nostr preview shares.
+func newHead(canonical, title string) opengraph.Head {
+	head := opengraph.Head{Title: title, Charset: "utf-8"}
+	head.SetMeta("og:title", title)
+	head.SetMeta("og:site_name", "Nostr")
+	head.SetMeta("og:url", canonical)
+	head.SetMeta("twitter:card", "summary")
+	return head
+}
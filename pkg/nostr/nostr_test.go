@@ -0,0 +1,269 @@
+package nostr
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/bech32"
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+	"github.com/danvergara/jumble-proxy-server/pkg/outbound"
+)
+
+// The secret keys and public keys of the test accounts, from the BIP-340 test vectors.
+const (
+	aliceKey = "0000000000000000000000000000000000000000000000000000000000000003"
+	alice    = "f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9"
+	bobKey   = testSecretKey
+	bob      = "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659"
+)
+
+// newEvent returns an event signed with seckey.
+func newEvent(t *testing.T, seckey string, kind int, createdAt int64, content string, tags ...[]string) Event {
+	t.Helper()
+	e := Event{Kind: kind, CreatedAt: createdAt, Content: content, Tags: tags}
+	if e.Tags == nil {
+		e.Tags = [][]string{}
+	}
+	if err := e.sign(seckey); err != nil {
+		t.Fatalf("sign() unexpected error: %v", err)
+	}
+	return e
+}
+
+// newFakeRelay serves events over the NIP-01 protocol, answering every REQ with the matching events and an EOSE.
+// It returns the ws URL of the relay.
+func newFakeRelay(t *testing.T, events ...Event) string {
+	t.Helper()
+
+	srv := httptest.NewServer(websocket.Server{Handler: func(ws *websocket.Conn) {
+		for {
+			var msg []json.RawMessage
+			if err := websocket.JSON.Receive(ws, &msg); err != nil {
+				return
+			}
+
+			var typ, sub string
+			if len(msg) < 2 || json.Unmarshal(msg[0], &typ) != nil || json.Unmarshal(msg[1], &sub) != nil || typ != "REQ" {
+				continue
+			}
+
+			for _, raw := range msg[2:] {
+				var filter Filter
+				var tags map[string]json.RawMessage
+				_ = json.Unmarshal(raw, &filter)
+				_ = json.Unmarshal(raw, &tags)
+				if d, ok := tags["#d"]; ok {
+					filter.Tags = map[string][]string{}
+					var values []string
+					_ = json.Unmarshal(d, &values)
+					filter.Tags["d"] = values
+				}
+
+				for _, e := range events {
+					if filter.Matches(e) {
+						websocket.JSON.Send(ws, []any{"EVENT", sub, e})
+					}
+				}
+			}
+
+			websocket.JSON.Send(ws, []any{"EOSE", sub})
+		}
+	}})
+	t.Cleanup(srv.Close)
+
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestClientPreview(t *testing.T) {
+	profile := newEvent(t, aliceKey, KindProfile, 1700000000,
+		`{"name": "alice", "display_name": "Alice", "about": "Nostr developer", "picture": "https://img.example/alice.png", "nip05": "alice@example.com"}`)
+	oldProfile := newEvent(t, aliceKey, KindProfile, 1600000000, `{"name": "old alice"}`)
+	note := newEvent(t, aliceKey, KindNote, 1714550400, "Hello Nostr https://img.example/cat.jpg")
+	article := newEvent(t, aliceKey, KindArticle, 1714636800, "# Long read\n\nThe body",
+		[]string{"d", "long-read"},
+		[]string{"title", "A long read"},
+		[]string{"summary", "What this article is about"},
+		[]string{"image", "https://img.example/cover.png"},
+		[]string{"published_at", "1714550400"},
+	)
+	bobNote := newEvent(t, bobKey, KindNote, 1714550400, "Only on the hinted relay")
+	tampered := newEvent(t, bobKey, KindNote, 1714550400, "The original")
+	tampered.Content = "Not what was signed"
+	// A far-future profile of alice, with a valid ID but signed by bob, must not win over the real one.
+	forged := newEvent(t, bobKey, KindProfile, 4000000000, `{"name": "mallory", "display_name": "Mallory"}`)
+	forged.PubKey = alice
+	forged.ID = forged.Hash()
+
+	relay := newFakeRelay(t, profile, oldProfile, forged, note, article, tampered)
+	hinted := newFakeRelay(t, bobNote)
+
+	// The fake relays listen on the loopback interface.
+	client := outbound.NewClient(outbound.Options{AllowPrivateNetworks: true})
+	c := New(Options{HTTPClient: client, Relays: []string{relay}})
+
+	noteID, _ := bech32.Encode(PrefixNote, mustHex(t, note.ID))
+	npub := mustNPub(t, alice)
+	nevent := encodeTLV(t, PrefixEvent, tlvSpecial, bobNote.ID, tlvRelay, hinted)
+	naddr := encodeTLV(t, PrefixAddress, tlvSpecial, "long-read", tlvAuthor, alice, tlvKind, KindArticle)
+	tamperedID, _ := bech32.Encode(PrefixNote, mustHex(t, tampered.ID))
+	bobNPub := mustNPub(t, bob)
+	bobName := bobNPub[:12] + "…" + bobNPub[len(bobNPub)-4:]
+
+	tests := []struct {
+		name     string
+		url      string
+		expected opengraph.Metadata
+		err      error
+	}{
+		{
+			name: "note",
+			url:  "nostr:" + noteID,
+			expected: opengraph.Metadata{
+				URL:         "https://njump.me/" + noteID,
+				Title:       "Alice on Nostr",
+				Description: "Hello Nostr https://img.example/cat.jpg",
+				Image:       "https://img.example/cat.jpg",
+				SiteName:    "Nostr",
+				Type:        "article",
+				Author:      "Alice",
+			},
+		},
+		{
+			name: "event on a hinted relay",
+			url:  "https://njump.me/" + nevent,
+			expected: opengraph.Metadata{
+				URL:         "https://njump.me/" + nevent,
+				Title:       bobName + " on Nostr",
+				Description: "Only on the hinted relay",
+				SiteName:    "Nostr",
+				Type:        "article",
+				Author:      bobName,
+			},
+		},
+		{
+			name: "long-form article",
+			url:  naddr,
+			expected: opengraph.Metadata{
+				URL:         "https://njump.me/" + naddr,
+				Title:       "A long read",
+				Description: "What this article is about",
+				Image:       "https://img.example/cover.png",
+				SiteName:    "Nostr",
+				Type:        "article",
+				Author:      "Alice",
+			},
+		},
+		{
+			name: "profile",
+			url:  "nostr:" + npub,
+			expected: opengraph.Metadata{
+				URL:         "https://njump.me/" + npub,
+				Title:       "Alice",
+				Description: "Nostr developer",
+				Image:       "https://img.example/alice.png",
+				SiteName:    "Nostr",
+				Type:        "profile",
+			},
+		},
+		{
+			name: "event not on the relays",
+			url:  "nostr:" + encodeTLV(t, PrefixEvent, tlvSpecial, bobNote.ID),
+			err:  ErrNotFound,
+		},
+		{
+			name: "event not matching its ID",
+			url:  "nostr:" + tamperedID,
+			err:  ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+			if !c.Match(u) {
+				t.Fatalf("Match(%s) = false, expected true", tt.url)
+			}
+
+			head, err := c.Preview(context.Background(), u)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Preview() error = %v, expected %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if md := head.Metadata(); md != tt.expected {
+				t.Errorf("Preview() metadata = %+v, expected %+v", md, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClientPreviewUnreachableRelays(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(srv.Close)
+
+	c := New(Options{HTTPClient: srv.Client(), Relays: []string{"ws" + strings.TrimPrefix(srv.URL, "http")}})
+
+	u, _ := url.Parse("nostr:npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg")
+	if _, err := c.Preview(context.Background(), u); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Preview() error = %v, expected a relay error", err)
+	}
+}
+
+func TestClientPreviewFloodingRelay(t *testing.T) {
+	junk := newEvent(t, aliceKey, KindNote, 1700000000, "not what was asked for")
+
+	// The relay floods the subscription with events that do not match and never sends EOSE.
+	srv := httptest.NewServer(websocket.Server{Handler: func(ws *websocket.Conn) {
+		var msg []json.RawMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil || len(msg) < 2 {
+			return
+		}
+		for range 2 * maxQueryEvents {
+			if websocket.JSON.Send(ws, []any{"EVENT", msg[1], junk}) != nil {
+				return
+			}
+		}
+		_ = websocket.JSON.Receive(ws, &msg)
+	}})
+	t.Cleanup(srv.Close)
+
+	c := New(Options{HTTPClient: srv.Client(), Relays: []string{"ws" + strings.TrimPrefix(srv.URL, "http")}, Timeout: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	u, _ := url.Parse("nostr:npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg")
+	if _, err := c.Preview(ctx, u); !errors.Is(err, errTooManyEvents) {
+		t.Errorf("Preview() error = %v, expected %v", err, errTooManyEvents)
+	}
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex %q: %v", s, err)
+	}
+	return data
+}
+
+func mustNPub(t *testing.T, pubkey string) string {
+	t.Helper()
+	npub, err := EncodePubKey(pubkey)
+	if err != nil {
+		t.Fatalf("EncodePubKey() unexpected error: %v", err)
+	}
+	return npub
+}
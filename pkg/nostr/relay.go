@@ -0,0 +1,286 @@
+package nostr
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxQueryEvents caps the EVENT messages read from a relay for one query, matching or not,
+// so a relay chosen by the author of a link cannot keep the query busy until it times out.
+const maxQueryEvents = 100
+
+// errTooManyEvents is returned by query when a relay sends more than maxQueryEvents events.
+var errTooManyEvents = errors.New("too many events")
+
+// Event is a Nostr event, see NIP-01.
+type Event struct {
+	ID        string     `json:"id"`
+	PubKey    string     `json:"pubkey"`
+	CreatedAt int64      `json:"created_at"`
+	Kind      int        `json:"kind"`
+	Tags      [][]string `json:"tags"`
+	Content   string     `json:"content"`
+	Sig       string     `json:"sig"`
+}
+
+// Tag returns the value of the first tag named name.
+func (e Event) Tag(name string) string {
+	for _, tag := range e.Tags {
+		if len(tag) > 1 && tag[0] == name {
+			return tag[1]
+		}
+	}
+	return ""
+}
+
+// Hash returns the hex ID the event should have, the SHA-256 of its NIP-01 serialization.
+func (e Event) Hash() string {
+	var b strings.Builder
+	b.WriteString("[0,")
+	writeString(&b, e.PubKey)
+	b.WriteString("," + strconv.FormatInt(e.CreatedAt, 10) + "," + strconv.Itoa(e.Kind) + ",[")
+	for i, tag := range e.Tags {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('[')
+		for j, value := range tag {
+			if j > 0 {
+				b.WriteByte(',')
+			}
+			writeString(&b, value)
+		}
+		b.WriteByte(']')
+	}
+	b.WriteString("],")
+	writeString(&b, e.Content)
+	b.WriteByte(']')
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// writeString writes s as a JSON string escaped the way NIP-01 requires,
+// which differs from encoding/json for HTML characters and line separators.
+func writeString(b *strings.Builder, s string) {
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '\n':
+			b.WriteString(`\n`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		default:
+			if r < 0x20 {
+				b.WriteString(`\u00` + hex.EncodeToString([]byte{byte(r)}))
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
+
+// Filter is a subscription filter, see NIP-01.
+type Filter struct {
+	IDs     []string            `json:"ids,omitempty"`
+	Authors []string            `json:"authors,omitempty"`
+	Kinds   []int               `json:"kinds,omitempty"`
+	Tags    map[string][]string `json:"-"`
+	Limit   int                 `json:"limit,omitempty"`
+}
+
+// MarshalJSON adds the tag filters, like #d, next to the other fields.
+func (f Filter) MarshalJSON() ([]byte, error) {
+	type plain Filter
+	fields := map[string]any{}
+
+	data, err := json.Marshal(plain(f))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for name, values := range f.Tags {
+		fields["#"+name] = values
+	}
+
+	return json.Marshal(fields)
+}
+
+// Matches reports whether e matches the filter.
+func (f Filter) Matches(e Event) bool {
+	if len(f.IDs) > 0 && !slices.Contains(f.IDs, e.ID) {
+		return false
+	}
+	if len(f.Authors) > 0 && !slices.Contains(f.Authors, e.PubKey) {
+		return false
+	}
+	if len(f.Kinds) > 0 && !slices.Contains(f.Kinds, e.Kind) {
+		return false
+	}
+	for name, values := range f.Tags {
+		if !slices.Contains(values, e.Tag(name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeRelay returns the relay URL s without its trailing slash, or an empty string if it is not a ws or wss URL.
+func normalizeRelay(s string) string {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" || u.User != nil {
+		return ""
+	}
+
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	return strings.TrimSuffix(u.String(), "/")
+}
+
+// fetch returns the newest event matching filter from any of the relays, or false if none has one.
+// Events whose ID does not match their content are ignored. When filter asks for IDs,
+// the first matching event is returned without waiting for the other relays.
+// An error is only returned when every relay failed.
+func (c *Client) fetch(ctx context.Context, relays []string, filter Filter) (Event, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var (
+		mu     sync.Mutex
+		newest Event
+		found  bool
+		errs   []error
+		wg     sync.WaitGroup
+	)
+
+	for _, relay := range relays {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			events, err := c.query(ctx, relay, filter)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil && len(events) == 0 {
+				errs = append(errs, fmt.Errorf("%s: %w", relay, err))
+				return
+			}
+
+			for _, e := range events {
+				if !found || e.CreatedAt > newest.CreatedAt {
+					newest, found = e, true
+				}
+			}
+			if found && len(filter.IDs) > 0 {
+				cancel()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if !found && len(errs) == len(relays) {
+		return Event{}, false, errors.Join(errs...)
+	}
+
+	return newest, found, nil
+}
+
+// query returns the valid events matching filter stored by relay, reading until its EOSE.
+func (c *Client) query(ctx context.Context, relay string, filter Filter) ([]Event, error) {
+	conn, err := dialWebSocket(ctx, c.client, relay)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	subID := hex.EncodeToString(id)
+
+	req, err := json.Marshal([]any{"REQ", subID, filter})
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.WriteText(req); err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	received := 0
+	for {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil && len(events) > 0 {
+				return events, nil
+			}
+			return events, err
+		}
+
+		var fields []json.RawMessage
+		if err := json.Unmarshal(msg, &fields); err != nil || len(fields) < 2 {
+			continue
+		}
+
+		var typ, sub string
+		if json.Unmarshal(fields[0], &typ) != nil || json.Unmarshal(fields[1], &sub) != nil || sub != subID {
+			continue
+		}
+
+		switch typ {
+		case "EVENT":
+			if received++; received > maxQueryEvents {
+				if len(events) > 0 {
+					return events, nil
+				}
+				return nil, errTooManyEvents
+			}
+
+			var e Event
+			if len(fields) < 3 || json.Unmarshal(fields[2], &e) != nil {
+				continue
+			}
+			// Relay hints are chosen by whoever wrote the link, so events are only trusted once signed.
+			// The filter is checked first, since it is much cheaper than the signature.
+			if !filter.Matches(e) || e.Verify() != nil {
+				continue
+			}
+			events = append(events, e)
+			if len(filter.IDs) > 0 {
+				return events, nil
+			}
+		case "EOSE", "CLOSED":
+			closeReq, _ := json.Marshal([]string{"CLOSE", subID})
+			_ = conn.WriteText(closeReq)
+			return events, nil
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package nostr
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+// ErrInvalidSignature is returned when the signature of an event does not verify.
+var ErrInvalidSignature = errors.New("invalid event signature")
+
+// verifySchnorr reports whether sig is a valid BIP-340 signature of msg by the x-only public key pubkey.
+func verifySchnorr(pubkey, msg, sig []byte) bool {
+	if len(msg) != 32 {
+		return false
+	}
+
+	key, err := schnorr.ParsePubKey(pubkey)
+	if err != nil {
+		return false
+	}
+
+	s, err := schnorr.ParseSignature(sig)
+	if err != nil {
+		return false
+	}
+
+	return s.Verify(msg, key)
+}
+
+// Verify reports whether the ID of e is the hash of its content and its signature is valid.
+func (e Event) Verify() error {
+	if e.ID != e.Hash() {
+		return fmt.Errorf("%w: the ID does not match the content", ErrInvalidSignature)
+	}
+
+	pubkey, err := hex.DecodeString(e.PubKey)
+	if err != nil {
+		return fmt.Errorf("%w: invalid public key", ErrInvalidSignature)
+	}
+	id, _ := hex.DecodeString(e.ID)
+	sig, err := hex.DecodeString(e.Sig)
+	if err != nil {
+		return fmt.Errorf("%w: invalid encoding", ErrInvalidSignature)
+	}
+
+	if !verifySchnorr(pubkey, id, sig) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
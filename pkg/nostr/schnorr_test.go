@@ -0,0 +1,232 @@
+package nostr
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+func decodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex %q: %v", s, err)
+	}
+	return b
+}
+
+// sign sets the public key, the ID and the signature of e, signing it with the hex secret key seckey.
+// The server verifies events and never signs them, so signing is only needed by the tests.
+func (e *Event) sign(seckey string) error {
+	key, err := hex.DecodeString(seckey)
+	if err != nil || len(key) != 32 {
+		return fmt.Errorf("invalid secret key %q", seckey)
+	}
+
+	priv, _ := btcec.PrivKeyFromBytes(key)
+	e.PubKey = hex.EncodeToString(schnorr.SerializePubKey(priv.PubKey()))
+	e.ID = e.Hash()
+
+	id, _ := hex.DecodeString(e.ID)
+	sig, err := schnorr.Sign(priv, id)
+	if err != nil {
+		return err
+	}
+	e.Sig = hex.EncodeToString(sig.Serialize())
+
+	return nil
+}
+
+// Test vectors 0 to 14 from BIP-340. Vectors 15 to 18 sign messages that are not 32 bytes long,
+// while event IDs always are, and such messages are refused.
+func TestSchnorr(t *testing.T) {
+	tests := []struct {
+		name    string
+		seckey  string
+		pubkey  string
+		aux     string
+		msg     string
+		sig     string
+		invalid bool
+	}{
+		{
+			name:   "vector 0",
+			seckey: "0000000000000000000000000000000000000000000000000000000000000003",
+			pubkey: "f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9",
+			aux:    "0000000000000000000000000000000000000000000000000000000000000000",
+			msg:    "0000000000000000000000000000000000000000000000000000000000000000",
+			sig:    "e907831f80848d1069a5371b402410364bdf1c5f8307b0084c55f1ce2dca821525f66a4a85ea8b71e482a74f382d2ce5ebeee8fdb2172f477df4900d310536c0",
+		},
+		{
+			name:   "vector 1",
+			seckey: "b7e151628aed2a6abf7158809cf4f3c762e7160f38b4da56a784d9045190cfef",
+			pubkey: "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+			aux:    "0000000000000000000000000000000000000000000000000000000000000001",
+			msg:    "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+			sig:    "6896bd60eeae296db48a229ff71dfe071bde413e6d43f917dc8dcf8c78de33418906d11ac976abccb20b091292bff4ea897efcb639ea871cfa95f6de339e4b0a",
+		},
+		{
+			name:   "vector 2",
+			seckey: "c90fdaa22168c234c4c6628b80dc1cd129024e088a67cc74020bbea63b14e5c9",
+			pubkey: "dd308afec5777e13121fa72b9cc1b7cc0139715309b086c960e18fd969774eb8",
+			aux:    "c87aa53824b4d7ae2eb035a2b5bbbccc080e76cdc6d1692c4b0b62d798e6d906",
+			msg:    "7e2d58d8b3bcdf1abadec7829054f90dda9805aab56c77333024b9d0a508b75c",
+			sig:    "5831aaeed7b44bb74e5eab94ba9d4294c49bcf2a60728d8b4c200f50dd313c1bab745879a5ad954a72c45a91c3a51d3c7adea98d82f8481e0e1e03674a6f3fb7",
+		},
+		{
+			name:   "vector 3, test fails if msg is reduced modulo p or n",
+			seckey: "0b432b2677937381aef05bb02a66ecd012773062cf3fa2549e44f58ed2401710",
+			pubkey: "25d1dff95105f5253c4022f628a996ad3a0d95fbf21d468a1b33f8c160d8f517",
+			aux:    "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+			msg:    "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+			sig:    "7eb0509757e246f19449885651611cb965ecc1a187dd51b64fda1edc9637d5ec97582b9cb13db3933705b32ba982af5af25fd78881ebb32771fc5922efc66ea3",
+		},
+		{
+			name:   "vector 4",
+			pubkey: "d69c3509bb99e412e68b0fe8544e72837dfa30746d8be2aa65975f29d22dc7b9",
+			msg:    "4df3c3f68fcc83b27e9d42c90431a72499f17875c81a599b566c9889b9696703",
+			sig:    "00000000000000000000003b78ce563f89a0ed9414f5aa28ad0d96d6795f9c6376afb1548af603b3eb45c9f8207dee1060cb71c04e80f593060b07d28308d7f4",
+		},
+		{
+			name:    "vector 5, public key not on the curve",
+			pubkey:  "eefdea4cdb677750a420fee807eacf21eb9898ae79b9768766e4faa04a2d4a34",
+			msg:     "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+			sig:     "6cff5c3ba86c69ea4b7376f31a9bcb4f74c1976089b2d9963da2e5543e17776969e89b4c5564d00349106b8497785dd7d1d713a8ae82b32fa79d5f7fc407d39b",
+			invalid: true,
+		},
+		{
+			name:    "vector 6, has_even_y(R) is false",
+			pubkey:  "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+			msg:     "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+			sig:     "fff97bd5755eeea420453a14355235d382f6472f8568a18b2f057a14602975563cc27944640ac607cd107ae10923d9ef7a73c643e166be5ebeafa34b1ac553e2",
+			invalid: true,
+		},
+		{
+			name:    "vector 7, negated message",
+			pubkey:  "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+			msg:     "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+			sig:     "1fa62e331edbc21c394792d2ab1100a7b432b013df3f6ff4f99fcb33e0e1515f28890b3edb6e7189b630448b515ce4f8622a954cfe545735aaea5134fccdb2bd",
+			invalid: true,
+		},
+		{
+			name:    "vector 8, negated s value",
+			pubkey:  "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+			msg:     "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+			sig:     "6cff5c3ba86c69ea4b7376f31a9bcb4f74c1976089b2d9963da2e5543e177769961764b3aa9b2ffcb6ef947b6887a226e8d7c93e00c5ed0c1834ff0d0c2e6da6",
+			invalid: true,
+		},
+		{
+			name:    "vector 9, sG - eP is infinite with x(inf) defined as 0",
+			pubkey:  "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+			msg:     "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+			sig:     "0000000000000000000000000000000000000000000000000000000000000000123dda8328af9c23a94c1feecfd123ba4fb73476f0d594dcb65c6425bd186051",
+			invalid: true,
+		},
+		{
+			name:    "vector 10, sG - eP is infinite with x(inf) defined as 1",
+			pubkey:  "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+			msg:     "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+			sig:     "00000000000000000000000000000000000000000000000000000000000000017615fbaf5ae28864013c099742deadb4dba87f11ac6754f93780d5a1837cf197",
+			invalid: true,
+		},
+		{
+			name:    "vector 11, sig[0:32] is not an x coordinate on the curve",
+			pubkey:  "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+			msg:     "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+			sig:     "4a298dacae57395a15d0795ddbfd1dcb564da82b0f269bc70a74f8220429ba1d69e89b4c5564d00349106b8497785dd7d1d713a8ae82b32fa79d5f7fc407d39b",
+			invalid: true,
+		},
+		{
+			name:    "vector 12, sig[0:32] is equal to the field size",
+			pubkey:  "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+			msg:     "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+			sig:     "fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f69e89b4c5564d00349106b8497785dd7d1d713a8ae82b32fa79d5f7fc407d39b",
+			invalid: true,
+		},
+		{
+			name:    "vector 13, sig[32:64] is equal to the curve order",
+			pubkey:  "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+			msg:     "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+			sig:     "6cff5c3ba86c69ea4b7376f31a9bcb4f74c1976089b2d9963da2e5543e177769fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141",
+			invalid: true,
+		},
+		{
+			name:    "vector 14, public key is not a valid x coordinate because it exceeds the field size",
+			pubkey:  "fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc30",
+			msg:     "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+			sig:     "6cff5c3ba86c69ea4b7376f31a9bcb4f74c1976089b2d9963da2e5543e17776969e89b4c5564d00349106b8497785dd7d1d713a8ae82b32fa79d5f7fc407d39b",
+			invalid: true,
+		},
+		{
+			name:    "tampered message",
+			pubkey:  "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+			msg:     "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c8a",
+			sig:     "6896bd60eeae296db48a229ff71dfe071bde413e6d43f917dc8dcf8c78de33418906d11ac976abccb20b091292bff4ea897efcb639ea871cfa95f6de339e4b0a",
+			invalid: true,
+		},
+		{
+			name:    "message not 32 bytes long",
+			pubkey:  "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+			msg:     "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c",
+			sig:     "6896bd60eeae296db48a229ff71dfe071bde413e6d43f917dc8dcf8c78de33418906d11ac976abccb20b091292bff4ea897efcb639ea871cfa95f6de339e4b0a",
+			invalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.seckey != "" {
+				priv, _ := btcec.PrivKeyFromBytes(decodeHex(t, tt.seckey))
+				if got := hex.EncodeToString(schnorr.SerializePubKey(priv.PubKey())); got != tt.pubkey {
+					t.Errorf("public key = %s, expected %s", got, tt.pubkey)
+				}
+
+				sig, err := schnorr.Sign(priv, decodeHex(t, tt.msg), schnorr.CustomNonce([32]byte(decodeHex(t, tt.aux))))
+				if err != nil {
+					t.Fatalf("Sign() unexpected error: %v", err)
+				}
+				if got := hex.EncodeToString(sig.Serialize()); got != tt.sig {
+					t.Errorf("Sign() = %s, expected %s", got, tt.sig)
+				}
+			}
+
+			if got := verifySchnorr(decodeHex(t, tt.pubkey), decodeHex(t, tt.msg), decodeHex(t, tt.sig)); got == tt.invalid {
+				t.Errorf("verifySchnorr() = %v, expected %v", got, !tt.invalid)
+			}
+		})
+	}
+}
+
+func TestEventSign(t *testing.T) {
+	e := Event{CreatedAt: 1700000000, Kind: KindNote, Tags: [][]string{{"t", "nostr"}}, Content: "hello"}
+	if err := e.sign("b7e151628aed2a6abf7158809cf4f3c762e7160f38b4da56a784d9045190cfef"); err != nil {
+		t.Fatalf("sign() unexpected error: %v", err)
+	}
+
+	if expected := "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659"; e.PubKey != expected {
+		t.Errorf("sign() public key = %s, expected %s", e.PubKey, expected)
+	}
+	if err := e.Verify(); err != nil {
+		t.Errorf("Verify() unexpected error: %v", err)
+	}
+
+	e.Content = "tampered"
+	if err := e.Verify(); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() of a modified event error = %v, expected %v", err, ErrInvalidSignature)
+	}
+
+	e.ID = e.Hash()
+	if err := e.Verify(); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() of a re-hashed event error = %v, expected %v", err, ErrInvalidSignature)
+	}
+
+	e.Sig = strings.Repeat("z", 128)
+	if err := e.Verify(); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() of a malformed signature error = %v, expected %v", err, ErrInvalidSignature)
+	}
+}
@@ -0,0 +1,222 @@
+package nostr
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// WebSocket opcodes, see RFC 6455 section 5.2.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// maxMessageBytes caps the size of a message read from a relay.
+const maxMessageBytes = 1 << 20
+
+// websocketGUID is appended to the key of the handshake, see RFC 6455 section 1.3.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsConn is a client WebSocket connection, only as capable as talking to relays requires.
+// The handshake goes through an http.Client, so relay connections get the same address checks
+// as every other request to a user supplied URL.
+type wsConn struct {
+	rwc     io.ReadWriteCloser
+	writeMu sync.Mutex
+	stop    func() bool
+}
+
+// dialWebSocket opens a WebSocket connection to the ws or wss URL relay.
+// The connection is closed when ctx is done.
+func dialWebSocket(ctx context.Context, client *http.Client, relay string) (*wsConn, error) {
+	target, ok := strings.CutPrefix(relay, "ws")
+	if !ok {
+		return nil, fmt.Errorf("unsupported relay URL %q", relay)
+	}
+
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	challenge := base64.StdEncoding.EncodeToString(key)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http"+target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", challenge)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		return nil, fmt.Errorf("relay %s returned status %d", relay, resp.StatusCode)
+	}
+
+	sum := sha1.Sum([]byte(challenge + websocketGUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		resp.Body.Close()
+		return nil, fmt.Errorf("relay %s returned an invalid handshake", relay)
+	}
+
+	rwc, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, errors.New("upgraded connection is not writable")
+	}
+
+	c := &wsConn{rwc: rwc}
+	c.stop = context.AfterFunc(ctx, func() { rwc.Close() })
+
+	return c, nil
+}
+
+// WriteText sends msg in a single text frame.
+func (c *wsConn) WriteText(msg []byte) error {
+	return c.writeFrame(opText, msg)
+}
+
+// writeFrame sends a final frame with payload, masked as required from clients.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, 0x80|byte(n))
+	case n <= 0xffff:
+		header = append(header, 0x80|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 0x80|127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return err
+	}
+	header = append(header, mask...)
+
+	frame := append(header, payload...)
+	for i := range payload {
+		frame[len(header)+i] ^= mask[i%4]
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	_, err := c.rwc.Write(frame)
+	return err
+}
+
+// ReadMessage returns the next text or binary message, answering pings on the way.
+// It returns io.EOF once the relay closes the connection.
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	var msg []byte
+
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			return nil, io.EOF
+		case opText, opBinary, opContinuation:
+			if len(msg)+len(payload) > maxMessageBytes {
+				return nil, errors.New("relay message too large")
+			}
+			msg = append(msg, payload...)
+		default:
+			return nil, fmt.Errorf("unsupported WebSocket opcode %d", opcode)
+		}
+
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+// readFrame reads a single frame.
+func (c *wsConn) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.rwc, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin, opcode := header[0]&0x80 != 0, header[0]&0x0f
+	masked, length := header[1]&0x80 != 0, uint64(header[1]&0x7f)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.rwc, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.rwc, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if length > maxMessageBytes {
+		return false, 0, nil, errors.New("relay message too large")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.rwc, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.rwc, payload); err != nil {
+		return false, 0, nil, err
+	}
+
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// Close sends a close frame and closes the connection.
+func (c *wsConn) Close() error {
+	c.stop()
+	_ = c.writeFrame(opClose, nil)
+	return c.rwc.Close()
+}
@@ -0,0 +1,351 @@
+// Package oembed discovers and fetches oEmbed data, see https://oembed.com.
+package oembed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+)
+
+// DiscoveryType is the type of the <link rel="alternate"> element pointing to the JSON oEmbed endpoint of a page.
+const DiscoveryType = "application/json+oembed"
+
+// maxResponseBytes caps the size of an oEmbed response.
+const maxResponseBytes = 1 << 20
+
+// ErrInvalidResponse is returned when an endpoint answers with something that is not an oEmbed response.
+var ErrInvalidResponse = errors.New("invalid oEmbed response")
+
+// Embed types defined by the specification.
+const (
+	TypePhoto = "photo"
+	TypeVideo = "video"
+	TypeLink  = "link"
+	TypeRich  = "rich"
+)
+
+// Provider is an oEmbed endpoint and the URL schemes it serves.
+type Provider struct {
+	Name     string
+	Endpoint string
+	// Schemes are URL patterns where * matches any sequence of characters, as in the oembed.com provider list.
+	Schemes []string
+}
+
+// Providers is a table of oEmbed providers.
+type Providers []Provider
+
+// DefaultProviders are the built-in providers, used for pages whose HTML does not advertise their oEmbed endpoint
+// or cannot be fetched, for example because of a consent wall.
+var DefaultProviders = Providers{
+	{
+		Name:     "YouTube",
+		Endpoint: "https://www.youtube.com/oembed",
+		Schemes: []string{
+			"https://*.youtube.com/watch*",
+			"https://*.youtube.com/shorts/*",
+			"https://*.youtube.com/live/*",
+			"https://*.youtube.com/playlist?*",
+			"https://youtube.com/watch*",
+			"https://youtube.com/shorts/*",
+			"https://youtu.be/*",
+		},
+	},
+	{
+		Name:     "Vimeo",
+		Endpoint: "https://vimeo.com/api/oembed.json",
+		Schemes: []string{
+			"https://vimeo.com/*",
+			"https://player.vimeo.com/video/*",
+		},
+	},
+	{
+		Name:     "SoundCloud",
+		Endpoint: "https://soundcloud.com/oembed",
+		Schemes: []string{
+			"https://soundcloud.com/*",
+			"https://on.soundcloud.com/*",
+		},
+	},
+	{
+		Name:     "Spotify",
+		Endpoint: "https://open.spotify.com/oembed",
+		Schemes: []string{
+			"https://open.spotify.com/*",
+			"https://spotify.link/*",
+		},
+	},
+	{
+		Name:     "Flickr",
+		Endpoint: "https://www.flickr.com/services/oembed/",
+		Schemes: []string{
+			"https://*.flickr.com/photos/*",
+			"https://flic.kr/p/*",
+		},
+	},
+	{
+		Name:     "TikTok",
+		Endpoint: "https://www.tiktok.com/oembed",
+		Schemes:  []string{"https://www.tiktok.com/@*/video/*"},
+	},
+	{
+		Name:     "Dailymotion",
+		Endpoint: "https://www.dailymotion.com/services/oembed",
+		Schemes: []string{
+			"https://www.dailymotion.com/video/*",
+			"https://dai.ly/*",
+		},
+	},
+}
+
+// ReadProviders reads a provider table in the JSON format of https://oembed.com/providers.json.
+// Endpoints without schemes can only be discovered from the pages and are skipped. Schemes are
+// normalized to https, which Match also applies to plain http URLs, and {format} placeholders become json.
+func ReadProviders(r io.Reader) (Providers, error) {
+	var list []struct {
+		Name      string `json:"provider_name"`
+		Endpoints []struct {
+			URL     string   `json:"url"`
+			Schemes []string `json:"schemes"`
+		} `json:"endpoints"`
+	}
+	if err := json.NewDecoder(r).Decode(&list); err != nil {
+		return nil, fmt.Errorf("invalid provider list: %w", err)
+	}
+
+	var ps Providers
+	for _, entry := range list {
+		for _, endpoint := range entry.Endpoints {
+			if len(endpoint.Schemes) == 0 {
+				continue
+			}
+
+			u, err := url.Parse(strings.ReplaceAll(endpoint.URL, "{format}", "json"))
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("invalid endpoint %q of %s", endpoint.URL, entry.Name)
+			}
+
+			p := Provider{Name: entry.Name, Endpoint: u.String()}
+			for _, scheme := range endpoint.Schemes {
+				if rest, ok := strings.CutPrefix(scheme, "http://"); ok {
+					scheme = "https://" + rest
+				}
+				p.Schemes = append(p.Schemes, scheme)
+			}
+			ps = append(ps, p)
+		}
+	}
+
+	return ps, nil
+}
+
+// Match returns the first provider with a scheme matching rawURL.
+// The host and the rest of the URL are matched separately, so a wildcard never spans both,
+// and plain http URLs match the https schemes too.
+func (ps Providers) Match(rawURL string) (Provider, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Provider{}, false
+	}
+
+	host := strings.ToLower(u.Host)
+	rest := u.EscapedPath()
+	if rest == "" {
+		rest = "/"
+	}
+	if u.RawQuery != "" {
+		rest += "?" + u.RawQuery
+	}
+
+	for _, p := range ps {
+		for _, scheme := range p.Schemes {
+			hostPattern, restPattern, ok := strings.Cut(strings.TrimPrefix(scheme, "https://"), "/")
+			if !ok {
+				continue
+			}
+			if matchPattern(hostPattern, host) && matchPattern("/"+restPattern, rest) {
+				return p, true
+			}
+		}
+	}
+
+	return Provider{}, false
+}
+
+// EndpointURL returns the URL of the JSON oEmbed data of target.
+func (p Provider) EndpointURL(target string) string {
+	u, err := url.Parse(p.Endpoint)
+	if err != nil {
+		return ""
+	}
+
+	q := u.Query()
+	q.Set("url", target)
+	q.Set("format", "json")
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// Response is the subset of an oEmbed response used for previews.
+// The html field of video and rich responses is deliberately dropped, since it is markup from a third party.
+type Response struct {
+	Type            string `json:"type"`
+	Title           string `json:"title,omitempty"`
+	AuthorName      string `json:"author_name,omitempty"`
+	AuthorURL       string `json:"author_url,omitempty"`
+	ProviderName    string `json:"provider_name,omitempty"`
+	ProviderURL     string `json:"provider_url,omitempty"`
+	ThumbnailURL    string `json:"thumbnail_url,omitempty"`
+	ThumbnailWidth  int    `json:"thumbnail_width,omitempty"`
+	ThumbnailHeight int    `json:"thumbnail_height,omitempty"`
+	// URL is the image of photo responses.
+	URL    string `json:"url,omitempty"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// wireResponse is an oEmbed response as sent by providers,
+// which do not agree on whether dimensions are numbers or strings.
+type wireResponse struct {
+	Type            string    `json:"type"`
+	Title           string    `json:"title"`
+	AuthorName      string    `json:"author_name"`
+	AuthorURL       string    `json:"author_url"`
+	ProviderName    string    `json:"provider_name"`
+	ProviderURL     string    `json:"provider_url"`
+	ThumbnailURL    string    `json:"thumbnail_url"`
+	ThumbnailWidth  dimension `json:"thumbnail_width"`
+	ThumbnailHeight dimension `json:"thumbnail_height"`
+	URL             string    `json:"url"`
+	Width           dimension `json:"width"`
+	Height          dimension `json:"height"`
+}
+
+// dimension is a size in pixels sent either as a number or a string. Anything else, like "100%", is zero.
+type dimension int
+
+func (d *dimension) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if f, err := strconv.ParseFloat(s, 64); err == nil && f > 0 {
+		*d = dimension(f)
+	}
+	return nil
+}
+
+// Fetch gets and validates the oEmbed response at endpoint.
+// The request goes through client, which is expected to refuse non-public addresses.
+func Fetch(ctx context.Context, client *http.Client, endpoint string) (Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return Response{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Response{}, fmt.Errorf("oEmbed endpoint returned status %d", resp.StatusCode)
+	}
+
+	var wire wireResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&wire); err != nil {
+		return Response{}, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	r := Response{
+		Type:            strings.ToLower(strings.TrimSpace(wire.Type)),
+		Title:           strings.TrimSpace(wire.Title),
+		AuthorName:      strings.TrimSpace(wire.AuthorName),
+		AuthorURL:       opengraph.HTTPURL(wire.AuthorURL),
+		ProviderName:    strings.TrimSpace(wire.ProviderName),
+		ProviderURL:     opengraph.HTTPURL(wire.ProviderURL),
+		ThumbnailURL:    opengraph.HTTPURL(wire.ThumbnailURL),
+		ThumbnailWidth:  int(wire.ThumbnailWidth),
+		ThumbnailHeight: int(wire.ThumbnailHeight),
+		Width:           int(wire.Width),
+		Height:          int(wire.Height),
+	}
+
+	switch r.Type {
+	case TypePhoto:
+		r.URL = opengraph.HTTPURL(wire.URL)
+		if r.URL == "" {
+			return Response{}, fmt.Errorf("%w: photo without url", ErrInvalidResponse)
+		}
+	case TypeVideo, TypeLink, TypeRich:
+	default:
+		return Response{}, fmt.Errorf("%w: unknown type %q", ErrInvalidResponse, wire.Type)
+	}
+
+	if r.ThumbnailURL == "" {
+		r.ThumbnailWidth, r.ThumbnailHeight = 0, 0
+	}
+
+	return r, nil
+}
+
+// Apply merges the response into the head of the page it describes.
+// The oEmbed values take precedence over the ones of the page, which are often generic behind consent walls.
+func (r Response) Apply(h *opengraph.Head) {
+	if r.Title != "" {
+		h.SetMeta("og:title", r.Title)
+	}
+
+	if r.AuthorName != "" {
+		h.SetMeta("author", r.AuthorName)
+	}
+
+	if r.ProviderName != "" {
+		h.SetMeta("og:site_name", r.ProviderName)
+	}
+
+	image, width, height := r.ThumbnailURL, r.ThumbnailWidth, r.ThumbnailHeight
+	if r.Type == TypePhoto {
+		image, width, height = r.URL, r.Width, r.Height
+	}
+
+	if image != "" {
+		h.SetMeta("og:image", image)
+		h.SetMeta("og:image:width", opengraph.FormatPositive(width))
+		h.SetMeta("og:image:height", opengraph.FormatPositive(height))
+	}
+
+	h.SetMeta("oembed:type", r.Type)
+}
+
+// matchPattern reports whether s matches pattern, where * matches any sequence of characters.
+func matchPattern(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return s == pattern
+	}
+
+	first, last := parts[0], parts[len(parts)-1]
+	if len(s) < len(first)+len(last) || !strings.HasPrefix(s, first) || !strings.HasSuffix(s, last) {
+		return false
+	}
+	s = s[len(first) : len(s)-len(last)]
+
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+
+	return true
+}
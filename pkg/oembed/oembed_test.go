@@ -0,0 +1,208 @@
+package oembed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+)
+
+func TestProvidersMatch(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "YouTube"},
+		{"https://m.youtube.com/shorts/abc", "YouTube"},
+		{"http://youtu.be/dQw4w9WgXcQ?t=42", "YouTube"},
+		{"https://vimeo.com/76979871", "Vimeo"},
+		{"https://soundcloud.com/artist/track", "SoundCloud"},
+		{"https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKUQC", "Spotify"},
+		{"https://www.flickr.com/photos/user/123", "Flickr"},
+		{"https://evil.example/?.youtube.com/watch", ""},
+		{"https://youtube.com.evil.example/watch?v=x", ""},
+		{"https://www.youtube.com/feed/trending", ""},
+		{"ftp://youtu.be/x", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			p, ok := DefaultProviders.Match(tt.url)
+			if ok != (tt.expected != "") || p.Name != tt.expected {
+				t.Errorf("Match() = %v, %v, expected %v", p.Name, ok, tt.expected)
+			}
+		})
+	}
+}
+
+func TestProviderEndpointURL(t *testing.T) {
+	p := Provider{Endpoint: "https://example.com/oembed?maxwidth=640"}
+
+	got := p.EndpointURL("https://example.com/a b")
+	expected := "https://example.com/oembed?format=json&maxwidth=640&url=https%3A%2F%2Fexample.com%2Fa+b"
+	if got != expected {
+		t.Errorf("EndpointURL() = %v, expected %v", got, expected)
+	}
+}
+
+func TestReadProviders(t *testing.T) {
+	list := `[
+		{"provider_name": "Example", "provider_url": "https://example.com", "endpoints": [
+			{"schemes": ["http://example.com/photos/*", "https://*.example.com/videos/*"], "url": "https://example.com/oembed.{format}"},
+			{"url": "https://example.com/discovery-only", "discovery": true}
+		]},
+		{"provider_name": "Other", "endpoints": [{"schemes": ["https://other.example/*"], "url": "https://other.example/oembed"}]}
+	]`
+
+	ps, err := ReadProviders(strings.NewReader(list))
+	if err != nil {
+		t.Fatalf("ReadProviders() error = %v", err)
+	}
+
+	expected := Providers{
+		{Name: "Example", Endpoint: "https://example.com/oembed.json", Schemes: []string{"https://example.com/photos/*", "https://*.example.com/videos/*"}},
+		{Name: "Other", Endpoint: "https://other.example/oembed", Schemes: []string{"https://other.example/*"}},
+	}
+	if !reflect.DeepEqual(ps, expected) {
+		t.Errorf("ReadProviders() = %+v, expected %+v", ps, expected)
+	}
+
+	if p, ok := ps.Match("http://example.com/photos/1"); !ok || p.Name != "Example" {
+		t.Errorf("Match() = %+v, %v, expected the Example provider", p, ok)
+	}
+
+	for _, invalid := range []string{
+		`{"provider_name": "Not a list"}`,
+		`[{"provider_name": "Bad", "endpoints": [{"schemes": ["https://bad.example/*"], "url": "/oembed"}]}]`,
+	} {
+		if _, err := ReadProviders(strings.NewReader(invalid)); err == nil {
+			t.Errorf("ReadProviders(%s) expected an error", invalid)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/video":
+			fmt.Fprint(w, `{
+				"version": "1.0",
+				"type": "video",
+				"title": " A video ",
+				"author_name": "Someone",
+				"author_url": "javascript:alert(1)",
+				"provider_name": "Tube",
+				"thumbnail_url": "https://img.example/thumb.jpg",
+				"thumbnail_width": "480",
+				"thumbnail_height": 360,
+				"width": "100%",
+				"height": 315,
+				"html": "<iframe src=\"https://evil.example\"></iframe>"
+			}`)
+		case "/photo":
+			fmt.Fprint(w, `{"version": "1.0", "type": "photo", "url": "https://img.example/photo.jpg", "width": 800, "height": 600}`)
+		case "/photo-without-url":
+			fmt.Fprint(w, `{"version": "1.0", "type": "photo"}`)
+		case "/unknown":
+			fmt.Fprint(w, `{"version": "1.0", "type": "script"}`)
+		case "/html":
+			fmt.Fprint(w, `<html></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		path        string
+		expected    Response
+		expectError bool
+	}{
+		{
+			path: "/video",
+			expected: Response{
+				Type:            TypeVideo,
+				Title:           "A video",
+				AuthorName:      "Someone",
+				ProviderName:    "Tube",
+				ThumbnailURL:    "https://img.example/thumb.jpg",
+				ThumbnailWidth:  480,
+				ThumbnailHeight: 360,
+				Height:          315,
+			},
+		},
+		{
+			path:     "/photo",
+			expected: Response{Type: TypePhoto, URL: "https://img.example/photo.jpg", Width: 800, Height: 600},
+		},
+		{path: "/photo-without-url", expectError: true},
+		{path: "/unknown", expectError: true},
+		{path: "/html", expectError: true},
+		{path: "/missing", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := Fetch(context.Background(), srv.Client(), srv.URL+tt.path)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Fetch() expected error, got %+v", resp)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Fetch() unexpected error: %v", err)
+			}
+
+			if resp != tt.expected {
+				t.Errorf("Fetch() = %+v, expected %+v", resp, tt.expected)
+			}
+		})
+	}
+
+	if _, err := Fetch(context.Background(), srv.Client(), srv.URL+"/unknown"); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("Fetch() error = %v, expected ErrInvalidResponse", err)
+	}
+}
+
+func TestResponseApply(t *testing.T) {
+	head, err := opengraph.ReadHead(strings.NewReader(`<head>
+<title>Before you continue</title>
+<meta property="og:title" content="Before you continue">
+<meta property="og:image" content="https://example.com/consent.png">
+<meta property="og:image:width" content="1200">
+<meta property="og:description" content="Page description">
+</head>`), nil)
+	if err != nil {
+		t.Fatalf("ReadHead() unexpected error: %v", err)
+	}
+
+	Response{
+		Type:         TypeVideo,
+		Title:        "A video",
+		AuthorName:   "Someone",
+		ProviderName: "Tube",
+		ThumbnailURL: "https://img.example/thumb.jpg",
+	}.Apply(&head)
+
+	expected := opengraph.Metadata{
+		Title:       "A video",
+		Description: "Page description",
+		Image:       "https://img.example/thumb.jpg",
+		SiteName:    "Tube",
+		Author:      "Someone",
+		EmbedType:   TypeVideo,
+	}
+	if md := head.Metadata(); md != expected {
+		t.Errorf("Apply() metadata = %+v, expected %+v", md, expected)
+	}
+}
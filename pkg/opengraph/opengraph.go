@@ -0,0 +1,558 @@
+package opengraph
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// Metadata is the link preview data of a page.
+type Metadata struct {
+	URL         string `json:"url,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+	Author      string `json:"author,omitempty"`
+	ImageWidth  int    `json:"image_width,omitempty"`
+	ImageHeight int    `json:"image_height,omitempty"`
+	// Duration is the length of a video or an audio file in seconds.
+	Duration int `json:"duration,omitempty"`
+	// EmbedType is the oEmbed type of the page: photo, video, link or rich.
+	EmbedType string `json:"embed_type,omitempty"`
+}
+
+// Element is a <meta> or <link> element kept from the head of a page.
+type Element struct {
+	Tag   atom.Atom
+	Attrs map[string]string
+}
+
+// Head holds the preview related elements of an HTML head.
+type Head struct {
+	Title string
+	// Charset is the character encoding declared by a <meta charset> or http-equiv Content-Type element.
+	Charset  string
+	Elements []Element
+}
+
+// metaAttrs and linkAttrs are the attributes kept on <meta> and <link> elements.
+var (
+	metaAttrs = []string{"name", "property", "itemprop", "content"}
+	linkAttrs = []string{"rel", "href", "type", "sizes", "title"}
+)
+
+// urlProperties are the <meta> properties whose content is a URL.
+var urlProperties = map[string]bool{
+	"og:url":              true,
+	"og:image":            true,
+	"og:image:url":        true,
+	"og:image:secure_url": true,
+	"og:video":            true,
+	"og:video:url":        true,
+	"og:audio":            true,
+	"twitter:image":       true,
+	"twitter:image:src":   true,
+}
+
+// ReadHead reads the head of an HTML document and keeps the title, the <meta> elements
+// and the <link> elements used for previews: icons, canonical URL, oEmbed and feed discovery.
+// Everything else, including scripts and styles, is dropped.
+// Reading stops at the end of the head or at the start of the body, so the rest of the document is never read.
+// Relative URLs are resolved against base, which may be nil, and links with a non http(s) scheme are dropped.
+func ReadHead(r io.Reader, base *url.URL) (Head, error) {
+	var (
+		head    Head
+		inTitle bool
+		title   strings.Builder
+	)
+
+	z := html.NewTokenizer(r)
+
+loop:
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				head.Title = strings.TrimSpace(title.String())
+				return head, err
+			}
+			break loop
+		case html.TextToken:
+			if inTitle {
+				title.Write(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = false
+			case atom.Head:
+				break loop
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := atom.Lookup(name)
+
+			if tag == atom.Body {
+				break loop
+			}
+
+			if tag == atom.Title && tt == html.StartTagToken {
+				// Only the first title counts, like in browsers.
+				inTitle = title.Len() == 0
+				continue
+			}
+
+			if !hasAttr || (tag != atom.Meta && tag != atom.Link) {
+				continue
+			}
+
+			attrs := map[string]string{}
+			for {
+				key, val, more := z.TagAttr()
+				attrs[strings.ToLower(string(key))] = string(val)
+				if !more {
+					break
+				}
+			}
+
+			switch tag {
+			case atom.Meta:
+				if charset := charsetFromMeta(attrs); charset != "" {
+					if head.Charset == "" {
+						head.Charset = charset
+					}
+					continue
+				}
+
+				el := Element{Tag: atom.Meta, Attrs: keep(attrs, metaAttrs)}
+				if el.Attrs["content"] == "" {
+					continue
+				}
+
+				key := el.Attrs["property"]
+				if key == "" {
+					key = el.Attrs["name"]
+				}
+				if urlProperties[strings.ToLower(key)] {
+					resolved, ok := resolve(base, el.Attrs["content"])
+					if !ok {
+						continue
+					}
+					el.Attrs["content"] = resolved
+				}
+
+				head.Elements = append(head.Elements, el)
+			case atom.Link:
+				if !previewLink(attrs) {
+					continue
+				}
+
+				el := Element{Tag: atom.Link, Attrs: keep(attrs, linkAttrs)}
+				resolved, ok := resolve(base, strings.TrimSpace(el.Attrs["href"]))
+				if !ok {
+					continue
+				}
+				el.Attrs["href"] = resolved
+
+				head.Elements = append(head.Elements, el)
+			}
+		}
+	}
+
+	head.Title = strings.TrimSpace(title.String())
+
+	return head, nil
+}
+
+// DecodeHead detects the character encoding of an HTML document from its byte order mark, the charset
+// parameter of contentType and the <meta charset> or http-equiv elements of its first 1024 bytes,
+// transcodes it to UTF-8 and reads its head like ReadHead.
+// The returned head always declares UTF-8.
+func DecodeHead(r io.Reader, contentType string, base *url.URL) (Head, error) {
+	utf8Reader, err := charset.NewReader(r, contentType)
+	if err != nil {
+		return Head{}, err
+	}
+
+	head, err := ReadHead(utf8Reader, base)
+	head.Charset = "utf-8"
+
+	return head, err
+}
+
+// Parse extracts the preview metadata from the head of an HTML document.
+// Open Graph properties take precedence over Twitter cards, which take precedence over the plain HTML tags.
+// Relative URLs are resolved against base, which may be nil.
+// Parsing stops at the end of the head, so the body is never read.
+func Parse(r io.Reader, base *url.URL) (Metadata, error) {
+	head, err := ReadHead(r, base)
+	return head.Metadata(), err
+}
+
+// Metadata returns the preview metadata described by the head.
+func (h Head) Metadata() Metadata {
+	var md, twitter, plain Metadata
+
+	plain.Title = h.Title
+
+	for _, el := range h.Elements {
+		switch el.Tag {
+		case atom.Meta:
+			key := strings.ToLower(el.Attrs["property"])
+			if key == "" {
+				key = strings.ToLower(el.Attrs["name"])
+			}
+			content := strings.TrimSpace(el.Attrs["content"])
+
+			switch key {
+			case "og:title":
+				setOnce(&md.Title, content)
+			case "og:description":
+				setOnce(&md.Description, content)
+			case "og:image", "og:image:url", "og:image:secure_url":
+				setOnce(&md.Image, content)
+			case "og:url":
+				setOnce(&md.URL, content)
+			case "og:site_name":
+				setOnce(&md.SiteName, content)
+			case "og:type":
+				setOnce(&md.Type, content)
+			case "og:image:width":
+				setOnceInt(&md.ImageWidth, content)
+			case "og:image:height":
+				setOnceInt(&md.ImageHeight, content)
+			case "video:duration", "og:video:duration", "music:duration":
+				setOnceInt(&md.Duration, content)
+			case "author":
+				setOnce(&md.Author, content)
+			case "oembed:type":
+				setOnce(&md.EmbedType, content)
+			case "twitter:title":
+				setOnce(&twitter.Title, content)
+			case "twitter:description":
+				setOnce(&twitter.Description, content)
+			case "twitter:image", "twitter:image:src":
+				setOnce(&twitter.Image, content)
+			case "description":
+				setOnce(&plain.Description, content)
+			}
+		case atom.Link:
+			for _, rel := range strings.Fields(strings.ToLower(el.Attrs["rel"])) {
+				switch rel {
+				case "icon", "apple-touch-icon":
+					setOnce(&md.Icon, el.Attrs["href"])
+				case "canonical":
+					setOnce(&plain.URL, el.Attrs["href"])
+				}
+			}
+		}
+	}
+
+	setOnce(&md.Title, twitter.Title)
+	setOnce(&md.Title, plain.Title)
+	setOnce(&md.Description, twitter.Description)
+	setOnce(&md.Description, plain.Description)
+	setOnce(&md.Image, twitter.Image)
+	setOnce(&md.URL, plain.URL)
+
+	return md
+}
+
+// SetMeta replaces the <meta> elements whose property or name is key with a single element holding content.
+// Keys with a prefix, such as og:title, are set as a property and the others as a name.
+// An empty content only removes the existing elements.
+func (h *Head) SetMeta(key, content string) {
+	h.Elements = slices.DeleteFunc(h.Elements, func(el Element) bool {
+		return el.Tag == atom.Meta &&
+			(strings.EqualFold(el.Attrs["property"], key) || strings.EqualFold(el.Attrs["name"], key))
+	})
+
+	if content == "" {
+		return
+	}
+
+	attr := "name"
+	if strings.Contains(key, ":") {
+		attr = "property"
+	}
+
+	h.Elements = append(h.Elements, Element{
+		Tag:   atom.Meta,
+		Attrs: map[string]string{attr: key, "content": content},
+	})
+}
+
+// imageKeys are the properties and names of the <meta> elements holding the URL of an image.
+var imageKeys = []string{"og:image", "og:image:url", "og:image:secure_url", "twitter:image", "twitter:image:src"}
+
+// RewriteImages replaces the URL of every image of the head with the one returned by rewrite.
+func (h *Head) RewriteImages(rewrite func(string) string) {
+	for i, el := range h.Elements {
+		if el.Tag != atom.Meta || el.Attrs["content"] == "" {
+			continue
+		}
+
+		key := el.Attrs["property"]
+		if key == "" {
+			key = el.Attrs["name"]
+		}
+		if !slices.Contains(imageKeys, strings.ToLower(key)) {
+			continue
+		}
+
+		attrs := maps.Clone(el.Attrs)
+		attrs["content"] = rewrite(el.Attrs["content"])
+		h.Elements[i].Attrs = attrs
+	}
+}
+
+// Meta returns the content of the first <meta> element whose property or name is key,
+// or an empty string when there is none.
+func (h Head) Meta(key string) string {
+	for _, el := range h.Elements {
+		if el.Tag == atom.Meta && (strings.EqualFold(el.Attrs["property"], key) || strings.EqualFold(el.Attrs["name"], key)) {
+			return el.Attrs["content"]
+		}
+	}
+	return ""
+}
+
+// Link returns the href of the first <link> element with the rel and type, if any.
+func (h Head) Link(rel, typ string) (string, bool) {
+	for _, el := range h.Elements {
+		if el.Tag != atom.Link || !strings.EqualFold(el.Attrs["type"], typ) {
+			continue
+		}
+		for _, r := range strings.Fields(el.Attrs["rel"]) {
+			if strings.EqualFold(r, rel) {
+				return el.Attrs["href"], true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// Render writes a minimal HTML document containing only the head elements.
+func (h Head) Render(w io.Writer) error {
+	charset := h.Charset
+	if charset == "" {
+		charset = "utf-8"
+	}
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n")
+	b.WriteString(`<meta charset="` + html.EscapeString(charset) + "\">\n")
+
+	if h.Title != "" {
+		b.WriteString("<title>" + html.EscapeString(h.Title) + "</title>\n")
+	}
+
+	for _, el := range h.Elements {
+		names := metaAttrs
+		if el.Tag == atom.Link {
+			names = linkAttrs
+		}
+
+		b.WriteString("<" + el.Tag.String())
+		for _, name := range names {
+			if v, ok := el.Attrs[name]; ok {
+				b.WriteString(" " + name + `="` + html.EscapeString(v) + `"`)
+			}
+		}
+		b.WriteString(">\n")
+	}
+
+	b.WriteString("</head>\n<body></body>\n</html>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// StripTags returns the text of an HTML fragment, with line breaks for <br> elements and between paragraphs.
+// The content of scripts and styles is dropped.
+func StripTags(fragment string) string {
+	var (
+		b    strings.Builder
+		skip bool
+	)
+
+	z := html.NewTokenizer(strings.NewReader(fragment))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			text := strings.TrimSpace(b.String())
+			for strings.Contains(text, "\n\n\n") {
+				text = strings.ReplaceAll(text, "\n\n\n", "\n\n")
+			}
+			return text
+		case html.TextToken:
+			if !skip {
+				b.Write(z.Text())
+			}
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, _ := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Script, atom.Style:
+				skip = tt == html.StartTagToken
+			case atom.Br:
+				b.WriteString("\n")
+			case atom.P, atom.Div, atom.Blockquote, atom.Li:
+				if tt == html.EndTagToken {
+					b.WriteString("\n\n")
+				}
+			}
+		}
+	}
+}
+
+// MaxDescriptionLength is the number of characters of the descriptions kept in the previews
+// built from APIs and feeds, see Truncate.
+const MaxDescriptionLength = 300
+
+// Truncate shortens s to n characters, ending it with an ellipsis when it is cut.
+func Truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
+
+// FormatCount formats n with thousands separators, like 1,234,567.
+func FormatCount(n int64) string {
+	s := strconv.FormatInt(n, 10)
+
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// FormatDuration formats d like media players do, as h:mm:ss, or m:ss under an hour.
+func FormatDuration(d time.Duration) string {
+	s := int(d.Seconds())
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s%3600/60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// FormatPositive formats n, returning an empty string when it is not set, so SetMeta leaves it out.
+func FormatPositive(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// HTTPURL returns rawURL if it is an absolute http(s) URL, and an empty string otherwise.
+func HTTPURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return u.String()
+}
+
+// previewLink reports whether a <link> is useful for previews.
+func previewLink(attrs map[string]string) bool {
+	for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+		switch rel {
+		case "icon", "apple-touch-icon", "canonical":
+			return true
+		case "alternate":
+			switch strings.ToLower(attrs["type"]) {
+			case "application/json+oembed", "text/xml+oembed", "application/xml+oembed",
+				"application/rss+xml", "application/atom+xml":
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// charsetFromMeta returns the charset declared by a <meta charset> or
+// <meta http-equiv="Content-Type" content="text/html; charset=..."> element.
+func charsetFromMeta(attrs map[string]string) string {
+	if charset, ok := attrs["charset"]; ok {
+		return strings.ToLower(strings.TrimSpace(charset))
+	}
+
+	if strings.EqualFold(attrs["http-equiv"], "content-type") {
+		if _, params, err := mime.ParseMediaType(attrs["content"]); err == nil {
+			return strings.ToLower(params["charset"])
+		}
+	}
+
+	return ""
+}
+
+// keep returns the allowed attributes of attrs.
+func keep(attrs map[string]string, allowed []string) map[string]string {
+	kept := map[string]string{}
+	for _, name := range allowed {
+		if v, ok := attrs[name]; ok {
+			kept[name] = v
+		}
+	}
+	return kept
+}
+
+// setOnce sets dst to value unless dst already has a value.
+func setOnce(dst *string, value string) {
+	if *dst == "" {
+		*dst = value
+	}
+}
+
+// setOnceInt sets dst to the integer value unless dst already has a value or value is not a positive integer.
+func setOnceInt(dst *int, value string) {
+	if n, err := strconv.Atoi(value); err == nil && n > 0 && *dst == 0 {
+		*dst = n
+	}
+}
+
+// resolve makes ref absolute against base, and reports false when the result is not an http(s) URL.
+func resolve(base *url.URL, ref string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", false
+	}
+
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return u.String(), true
+	case "":
+		// A relative URL without a base to resolve it against.
+		return u.String(), base == nil
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,231 @@
+package opengraph
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/html/atom"
+)
+
+func TestParse(t *testing.T) {
+	base, _ := url.Parse("https://example.com/posts/1")
+
+	tests := []struct {
+		name     string
+		doc      string
+		expected Metadata
+	}{
+		{
+			name: "open graph",
+			doc: `<html><head>
+<title>Plain title</title>
+<meta property="og:title" content="OG title">
+<meta property="og:description" content="OG description">
+<meta property="og:image" content="/cover.png">
+<meta property="og:site_name" content="Example">
+<meta property="og:type" content="article">
+<link rel="shortcut icon" href="/favicon.ico">
+</head><body><meta property="og:title" content="ignored"></body></html>`,
+			expected: Metadata{
+				URL:         "",
+				Title:       "OG title",
+				Description: "OG description",
+				Image:       "https://example.com/cover.png",
+				SiteName:    "Example",
+				Type:        "article",
+				Icon:        "https://example.com/favicon.ico",
+			},
+		},
+		{
+			name: "twitter card fallback",
+			doc: `<head><title>Plain</title>
+<meta name="twitter:title" content="Card title">
+<meta name="twitter:image" content="https://cdn.example.com/card.png">
+<meta name="description" content="Plain description">
+<link rel="canonical" href="https://example.com/canonical">`,
+			expected: Metadata{
+				URL:         "https://example.com/canonical",
+				Title:       "Card title",
+				Description: "Plain description",
+				Image:       "https://cdn.example.com/card.png",
+			},
+		},
+		{
+			name:     "plain title with entities",
+			doc:      `<html><head><title> Tom &amp; Jerry </title></head></html>`,
+			expected: Metadata{Title: "Tom & Jerry"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md, err := Parse(strings.NewReader(tt.doc), base)
+			if err != nil {
+				t.Fatalf("Parse() unexpected error: %v", err)
+			}
+
+			if md != tt.expected {
+				t.Errorf("Parse() = %+v, expected %+v", md, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDecodeHead(t *testing.T) {
+	base, _ := url.Parse("https://example.com/")
+
+	tests := []struct {
+		file        string
+		contentType string
+		title       string
+		description string
+	}{
+		{"shift_jis.html", "text/html", "日本語のページ", "こんにちは世界"},
+		{"gbk.html", "text/html", "中文网页", "你好，世界"},
+		{"windows-1251.html", "text/html; charset=windows-1251", "Русская страница", "Привет, мир"},
+		{"euc-kr.html", "", "한국어 페이지", "안녕하세요 세계"},
+		{"utf-16le-bom.html", "text/html; charset=iso-8859-1", "Ünïcödé page", "BOM detected"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatalf("Failed to open the fixture: %v", err)
+			}
+			defer f.Close()
+
+			head, err := DecodeHead(f, tt.contentType, base)
+			if err != nil {
+				t.Fatalf("DecodeHead() unexpected error: %v", err)
+			}
+
+			if head.Charset != "utf-8" {
+				t.Errorf("DecodeHead() Charset = %v, expected utf-8", head.Charset)
+			}
+
+			md := head.Metadata()
+			if md.Title != tt.title {
+				t.Errorf("DecodeHead() Title = %v, expected %v", md.Title, tt.title)
+			}
+			if md.Description != tt.description {
+				t.Errorf("DecodeHead() Description = %v, expected %v", md.Description, tt.description)
+			}
+
+			var out strings.Builder
+			if err := head.Render(&out); err != nil {
+				t.Fatalf("Render() unexpected error: %v", err)
+			}
+			if !strings.Contains(out.String(), `<meta charset="utf-8">`) || !strings.Contains(out.String(), tt.title) {
+				t.Errorf("Render() = %s, expected a UTF-8 document", out.String())
+			}
+		})
+	}
+}
+
+func TestStripTags(t *testing.T) {
+	tests := []struct {
+		fragment string
+		expected string
+	}{
+		{`<p>Hello <a href="https://example.com">world</a> &amp; friends</p><p>Second<br>line</p>`, "Hello world & friends\n\nSecond\nline"},
+		{"<p>One</p>\n\n<p>Two</p>", "One\n\nTwo"},
+		{`plain text`, "plain text"},
+		{`<style>p { color: red }</style>Text<script>alert(1)</script>`, "Text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fragment, func(t *testing.T) {
+			if got := StripTags(tt.fragment); got != tt.expected {
+				t.Errorf("StripTags() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	if got := FormatCount(1234567890); got != "1,234,567,890" {
+		t.Errorf("FormatCount() = %v, expected 1,234,567,890", got)
+	}
+	if got := FormatCount(999); got != "999" {
+		t.Errorf("FormatCount() = %v, expected 999", got)
+	}
+
+	if got := FormatDuration(26*time.Hour + 3*time.Minute + 4*time.Second); got != "26:03:04" {
+		t.Errorf("FormatDuration() = %v, expected 26:03:04", got)
+	}
+	if got := FormatDuration(213 * time.Second); got != "3:33" {
+		t.Errorf("FormatDuration() = %v, expected 3:33", got)
+	}
+
+	if got := FormatPositive(0); got != "" {
+		t.Errorf("FormatPositive(0) = %q, expected an empty string", got)
+	}
+	if got := FormatPositive(630); got != "630" {
+		t.Errorf("FormatPositive(630) = %q, expected 630", got)
+	}
+}
+
+func TestHTTPURL(t *testing.T) {
+	tests := map[string]string{
+		" https://example.com/a b ": "https://example.com/a%20b",
+		"http://example.com":        "http://example.com",
+		"javascript:alert(1)":       "",
+		"/relative/path":            "",
+		"https://":                  "",
+	}
+
+	for rawURL, expected := range tests {
+		if got := HTTPURL(rawURL); got != expected {
+			t.Errorf("HTTPURL(%q) = %q, expected %q", rawURL, got, expected)
+		}
+	}
+}
+
+func TestHeadMeta(t *testing.T) {
+	var h Head
+	h.SetMeta("og:title", "A title")
+	h.SetMeta("description", "A description")
+
+	if got := h.Meta("OG:Title"); got != "A title" {
+		t.Errorf("Meta(OG:Title) = %q, expected %q", got, "A title")
+	}
+	if got := h.Meta("description"); got != "A description" {
+		t.Errorf("Meta(description) = %q, expected %q", got, "A description")
+	}
+	if got := h.Meta("og:image"); got != "" {
+		t.Errorf("Meta(og:image) = %q, expected an empty string", got)
+	}
+}
+
+func TestHeadRewriteImages(t *testing.T) {
+	var h Head
+	h.SetMeta("og:title", "https://example.com/title")
+	h.SetMeta("og:image", "https://example.com/a.png")
+	h.SetMeta("og:image:secure_url", "https://example.com/a.png")
+	h.SetMeta("twitter:image", "https://example.com/b.png")
+	h.Elements = append(h.Elements, Element{Tag: atom.Meta, Attrs: map[string]string{"name": "Twitter:Image:Src", "content": "https://example.com/c.png"}})
+
+	original := h.Elements[1].Attrs
+	h.RewriteImages(func(image string) string { return "/img/" + image })
+
+	for key, expected := range map[string]string{
+		"og:title":            "https://example.com/title",
+		"og:image":            "/img/https://example.com/a.png",
+		"og:image:secure_url": "/img/https://example.com/a.png",
+		"twitter:image":       "/img/https://example.com/b.png",
+		"twitter:image:src":   "/img/https://example.com/c.png",
+	} {
+		if got := h.Meta(key); got != expected {
+			t.Errorf("RewriteImages() %s = %q, expected %q", key, got, expected)
+		}
+	}
+
+	if original["content"] != "https://example.com/a.png" {
+		t.Errorf("RewriteImages() modified the attributes in place: %q", original["content"])
+	}
+}
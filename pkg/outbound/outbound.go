@@ -0,0 +1,157 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// maxRedirects is the number of redirects followed before giving up.
+const maxRedirects = 5
+
+// ErrForbiddenAddress is returned when a request would reach a non-public address.
+var ErrForbiddenAddress = errors.New("destination address is not allowed")
+
+// Options configures the outbound client.
+type Options struct {
+	// AllowPrivateNetworks lets requests reach loopback, private, link-local and other non-public addresses.
+	// It must stay disabled in production, otherwise the proxy can be used to reach internal services.
+	AllowPrivateNetworks bool
+	// TrustedAddresses are the host:port addresses configured by the operator, like a local IPFS gateway,
+	// that may be reached at non-public addresses even when AllowPrivateNetworks is disabled.
+	// Subdomains of the host are trusted on the same port, for subdomain gateways like {cid}.ipfs.localhost:8080.
+	TrustedAddresses []string
+	// Timeout bounds the whole request, including reading the body. Zero means no timeout.
+	Timeout time.Duration
+}
+
+// NewClient returns an http.Client for requests to user supplied URLs.
+// Unless opts.AllowPrivateNetworks is set, the address is checked after DNS resolution on every connection,
+// so redirects and DNS rebinding cannot be used to reach internal services.
+func NewClient(opts Options) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	if !opts.AllowPrivateNetworks {
+		trusted := *dialer
+
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			return checkAddress(address)
+		}
+
+		if len(opts.TrustedAddresses) > 0 {
+			transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+				if isTrusted(address, opts.TrustedAddresses) {
+					return trusted.DialContext(ctx, network, address)
+				}
+				return dialer.DialContext(ctx, network, address)
+			}
+		}
+	}
+	transport.ResponseHeaderTimeout = 15 * time.Second
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   opts.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// isTrusted reports whether the host:port address is one of the trusted addresses,
+// or a subdomain of one of their hosts on the same port.
+func isTrusted(address string, trusted []string) bool {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, t := range trusted {
+		tHost, tPort, err := net.SplitHostPort(t)
+		if err != nil || port != tPort {
+			continue
+		}
+		tHost = strings.ToLower(tHost)
+		if host == tHost || strings.HasSuffix(host, "."+tHost) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAddress rejects the resolved ip:port unless it is a public unicast address.
+func checkAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	if !IsPublic(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, ip)
+	}
+
+	return nil
+}
+
+// IsPublic reports whether ip is a globally routable unicast address.
+func IsPublic(ip netip.Addr) bool {
+	ip = ip.Unmap()
+
+	if !ip.IsValid() || ip.IsUnspecified() || ip.IsLoopback() || ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() {
+		return false
+	}
+
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// reservedPrefixes lists the special purpose ranges not covered by the netip predicates.
+// The NAT64 and 6to4 ranges embed an IPv4 address, private ones included, that a translator
+// or a relay on the path would reach on our behalf, so they are refused as a whole.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("fc00::/7"),
+}
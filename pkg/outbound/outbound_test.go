@@ -0,0 +1,112 @@
+package outbound
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		ip       string
+		expected bool
+	}{
+		{"1.1.1.1", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"64:ff9b::7f00:1", false},
+		{"64:ff9b::a9fe:a9fe", false},
+		{"2002:7f00:1::1", false},
+		{"2002:c0a8:101::1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if result := IsPublic(netip.MustParseAddr(tt.ip)); result != tt.expected {
+				t.Errorf("IsPublic(%s) = %v, expected %v", tt.ip, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(Options{}).Get(srv.URL)
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Fatalf("expected ErrForbiddenAddress for a loopback server, got %v", err)
+	}
+
+	resp, err := NewClient(Options{AllowPrivateNetworks: true}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected the request to succeed when private networks are allowed, got %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestNewClientTrustedAddresses(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	other := httptest.NewServer(handler)
+	defer other.Close()
+
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	client := NewClient(Options{TrustedAddresses: []string{"localhost:" + port}})
+
+	resp, err := client.Get(strings.Replace(srv.URL, "127.0.0.1", "localhost", 1))
+	if err != nil {
+		t.Fatalf("expected the request to a trusted address to succeed, got %v", err)
+	}
+	resp.Body.Close()
+
+	if _, err := client.Get(srv.URL); !errors.Is(err, ErrForbiddenAddress) {
+		t.Fatalf("expected ErrForbiddenAddress for an untrusted loopback host, got %v", err)
+	}
+	if _, err := client.Get(strings.Replace(other.URL, "127.0.0.1", "localhost", 1)); !errors.Is(err, ErrForbiddenAddress) {
+		t.Fatalf("expected ErrForbiddenAddress for another port of a trusted host, got %v", err)
+	}
+}
+
+func TestIsTrusted(t *testing.T) {
+	trusted := []string{"Gateway.Local:443", "localhost:8080"}
+
+	tests := []struct {
+		address  string
+		expected bool
+	}{
+		{"gateway.local:443", true},
+		{"bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi.ipfs.localhost:8080", true},
+		{"localhost.:8080", true},
+		{"localhost:6379", false},
+		{"gateway.local:80", false},
+		{"evilgateway.local:443", false},
+		{"gateway.local.example.com:443", false},
+		{"localhost", false},
+	}
+
+	for _, tt := range tests {
+		if result := isTrusted(tt.address, trusted); result != tt.expected {
+			t.Errorf("isTrusted(%s) = %v, expected %v", tt.address, result, tt.expected)
+		}
+	}
+}
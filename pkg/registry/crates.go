@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"context"
+	"net/url"
+)
+
+// crate is the crates.io API response of a crate, which lists its versions.
+type crate struct {
+	Crate struct {
+		Name             string `json:"name"`
+		Description      string `json:"description"`
+		MaxStableVersion string `json:"max_stable_version"`
+		MaxVersion       string `json:"max_version"`
+		Downloads        int64  `json:"downloads"`
+		Repository       string `json:"repository"`
+	} `json:"crate"`
+	Versions []struct {
+		Num     string `json:"num"`
+		License string `json:"license"`
+		Yanked  bool   `json:"yanked"`
+	} `json:"versions"`
+}
+
+func (c *Client) crate(ctx context.Context, ref Ref) (Package, error) {
+	var cr crate
+	if err := c.getJSON(ctx, c.cratesIOURL+"/api/v1/crates/"+url.PathEscape(ref.Name), &cr); err != nil {
+		return Package{}, err
+	}
+
+	v := ref.Version
+	if v == "" {
+		v = cr.Crate.MaxStableVersion
+		if v == "" {
+			v = cr.Crate.MaxVersion
+		}
+	}
+
+	pkg := Package{
+		Name:           cr.Crate.Name,
+		Version:        v,
+		Description:    cr.Crate.Description,
+		Repository:     repositoryURL(cr.Crate.Repository),
+		Downloads:      cr.Crate.Downloads,
+		DownloadsLabel: "Downloads",
+	}
+
+	found := false
+	for _, version := range cr.Versions {
+		if version.Num == v {
+			pkg.License, found = version.License, true
+			break
+		}
+	}
+	if !found && ref.Version != "" {
+		return Package{}, ErrNotFound
+	}
+
+	return pkg, nil
+}
@@ -0,0 +1,43 @@
+package registry
+
+import (
+	"context"
+	"strings"
+)
+
+// dockerRepository is the Docker Hub API response of a repository.
+type dockerRepository struct {
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	PullCount   int64  `json:"pull_count"`
+}
+
+func (c *Client) dockerImage(ctx context.Context, ref Ref) (Package, error) {
+	endpoint := c.dockerHubURL + "/v2/repositories/" + ref.Name + "/"
+
+	var repo dockerRepository
+	if err := c.getJSON(ctx, endpoint, &repo); err != nil {
+		return Package{}, err
+	}
+
+	if ref.Version != "" {
+		var tag struct {
+			Name string `json:"name"`
+		}
+		if err := c.getJSON(ctx, endpoint+"tags/"+ref.Version, &tag); err != nil {
+			return Package{}, err
+		}
+	}
+
+	// Official images are known by their name alone.
+	name := strings.TrimPrefix(ref.Name, "library/")
+
+	return Package{
+		Name:           name,
+		Version:        ref.Version,
+		Description:    repo.Description,
+		Downloads:      repo.PullCount,
+		DownloadsLabel: "Pulls",
+	}, nil
+}
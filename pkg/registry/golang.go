@@ -0,0 +1,103 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// maxModuleLookups caps the number of module path prefixes of a Go package path looked up on the proxy.
+const maxModuleLookups = 5
+
+// goVersionInfo is the Go module proxy response of a version.
+type goVersionInfo struct {
+	Version string `json:"Version"`
+	Origin  struct {
+		URL string `json:"URL"`
+	} `json:"Origin"`
+}
+
+// depsDevVersion is the deps.dev API response of a package version.
+type depsDevVersion struct {
+	Licenses []string `json:"licenses"`
+	Links    []struct {
+		Label string `json:"label"`
+		URL   string `json:"url"`
+	} `json:"links"`
+}
+
+// goModule describes the package path of ref. The module holding it is the longest prefix of the path
+// the module proxy knows, at the requested version or else at its latest version.
+func (c *Client) goModule(ctx context.Context, ref Ref) (Package, error) {
+	module, info, err := c.resolveModule(ctx, ref)
+	if err != nil {
+		return Package{}, err
+	}
+
+	description := "Go module " + module
+	if ref.Name != module {
+		description = "Go package " + ref.Name + " in module " + module
+	}
+
+	pkg := Package{
+		Name:        ref.Name,
+		Version:     info.Version,
+		Description: description,
+		Repository:  repositoryURL(info.Origin.URL),
+		Downloads:   -1,
+	}
+
+	// The module proxy knows neither the license nor, for modules not served from a VCS, the repository.
+	var dv depsDevVersion
+	endpoint := c.depsDevURL + "/v3/systems/go/packages/" + url.PathEscape(module) + "/versions/" + url.PathEscape(info.Version)
+	if err := c.getJSON(ctx, endpoint, &dv); err == nil {
+		pkg.License = strings.Join(dv.Licenses, " AND ")
+		for _, link := range dv.Links {
+			if link.Label == "SOURCE_REPO" && pkg.Repository == "" {
+				pkg.Repository = repositoryURL(link.URL)
+			}
+		}
+	}
+
+	return pkg, nil
+}
+
+func (c *Client) resolveModule(ctx context.Context, ref Ref) (string, goVersionInfo, error) {
+	elements := strings.Split(ref.Name, "/")
+
+	for n, lookups := len(elements), 0; n > 0 && lookups < maxModuleLookups; n, lookups = n-1, lookups+1 {
+		module := strings.Join(elements[:n], "/")
+
+		endpoint := c.goProxyURL + "/" + escapeModulePath(module) + "/@latest"
+		if ref.Version != "" {
+			endpoint = c.goProxyURL + "/" + escapeModulePath(module) + "/@v/" + escapeModulePath(ref.Version) + ".info"
+		}
+
+		var info goVersionInfo
+		err := c.getJSON(ctx, endpoint, &info)
+		switch {
+		case err == nil && info.Version != "":
+			return module, info, nil
+		case err != nil && !errors.Is(err, ErrNotFound):
+			return "", goVersionInfo{}, err
+		}
+	}
+
+	return "", goVersionInfo{}, ErrNotFound
+}
+
+// escapeModulePath escapes a module path or version for the module proxy protocol,
+// which replaces each uppercase letter with an exclamation mark followed by the letter's lower case.
+func escapeModulePath(p string) string {
+	var b strings.Builder
+	for _, r := range p {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
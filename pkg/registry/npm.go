@@ -0,0 +1,66 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// npmManifest is the manifest of a version of an npm package.
+type npmManifest struct {
+	Name        string          `json:"name"`
+	Version     string          `json:"version"`
+	Description string          `json:"description"`
+	License     json.RawMessage `json:"license"`
+	Repository  json.RawMessage `json:"repository"`
+}
+
+func (c *Client) npm(ctx context.Context, ref Ref) (Package, error) {
+	v := ref.Version
+	if v == "" {
+		v = "latest"
+	}
+
+	var m npmManifest
+	if err := c.getJSON(ctx, c.npmRegistryURL+"/"+url.PathEscape(ref.Name)+"/"+url.PathEscape(v), &m); err != nil {
+		return Package{}, err
+	}
+
+	pkg := Package{
+		Name:           m.Name,
+		Version:        m.Version,
+		Description:    m.Description,
+		License:        stringOrField(m.License, "type"),
+		Repository:     repositoryURL(stringOrField(m.Repository, "url")),
+		Downloads:      -1,
+		DownloadsLabel: "Downloads last week",
+	}
+
+	var downloads struct {
+		Downloads int64 `json:"downloads"`
+	}
+	if err := c.getJSON(ctx, c.npmDownloadsURL+"/downloads/point/last-week/"+ref.Name, &downloads); err == nil {
+		pkg.Downloads = downloads.Downloads
+	}
+
+	return pkg, nil
+}
+
+// stringOrField returns a manifest value given either as a string or as an object, like the license
+// of old packages, {"type": "MIT"}, or the repository, {"type": "git", "url": "..."}.
+func stringOrField(raw json.RawMessage, field string) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return strings.TrimSpace(s)
+	}
+
+	var obj map[string]any
+	if err := json.Unmarshal(raw, &obj); err == nil {
+		if s, ok := obj[field].(string); ok {
+			return strings.TrimSpace(s)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,128 @@
+package registry
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// pypiProject is the JSON API response of a PyPI project or release.
+type pypiProject struct {
+	Info struct {
+		Name              string            `json:"name"`
+		Version           string            `json:"version"`
+		Summary           string            `json:"summary"`
+		License           string            `json:"license"`
+		LicenseExpression string            `json:"license_expression"`
+		Classifiers       []string          `json:"classifiers"`
+		HomePage          string            `json:"home_page"`
+		ProjectURLs       map[string]string `json:"project_urls"`
+	} `json:"info"`
+}
+
+// maxLicenseLength is the length above which the license field of a PyPI project is taken to be
+// the full text of the license rather than its name.
+const maxLicenseLength = 40
+
+func (c *Client) pypi(ctx context.Context, ref Ref) (Package, error) {
+	endpoint := c.pypiURL + "/pypi/" + url.PathEscape(ref.Name)
+	if ref.Version != "" {
+		endpoint += "/" + url.PathEscape(ref.Version)
+	}
+
+	var p pypiProject
+	if err := c.getJSON(ctx, endpoint+"/json", &p); err != nil {
+		return Package{}, err
+	}
+
+	pkg := Package{
+		Name:           p.Info.Name,
+		Version:        p.Info.Version,
+		Description:    p.Info.Summary,
+		License:        pypiLicense(p),
+		Repository:     pypiRepository(p),
+		Downloads:      -1,
+		DownloadsLabel: "Downloads last week",
+	}
+
+	var stats struct {
+		Data struct {
+			LastWeek int64 `json:"last_week"`
+		} `json:"data"`
+	}
+	statsURL := c.pypiStatsURL + "/api/packages/" + url.PathEscape(strings.ToLower(ref.Name)) + "/recent"
+	if err := c.getJSON(ctx, statsURL, &stats); err == nil {
+		pkg.Downloads = stats.Data.LastWeek
+	}
+
+	return pkg, nil
+}
+
+// pypiLicense returns the SPDX expression of the project, or else the name in its license field,
+// or else the license of its trove classifiers, like "License :: OSI Approved :: MIT License".
+func pypiLicense(p pypiProject) string {
+	if p.Info.LicenseExpression != "" {
+		return p.Info.LicenseExpression
+	}
+
+	if license := strings.TrimSpace(p.Info.License); license != "" && len(license) <= maxLicenseLength &&
+		!strings.Contains(license, "\n") {
+		return license
+	}
+
+	for _, classifier := range p.Info.Classifiers {
+		if rest, ok := strings.CutPrefix(classifier, "License :: "); ok {
+			parts := strings.Split(rest, " :: ")
+			return parts[len(parts)-1]
+		}
+	}
+
+	return ""
+}
+
+// pypiRepository returns the source repository among the project URLs, preferring the ones labeled
+// as such, then any URL on a code forge.
+func pypiRepository(p pypiProject) string {
+	labels := make([]string, 0, len(p.Info.ProjectURLs))
+	for label := range p.Info.ProjectURLs {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	for _, label := range labels {
+		switch strings.ToLower(strings.NewReplacer(" ", "", "-", "", "_", "").Replace(label)) {
+		case "source", "sourcecode", "repository", "code", "github", "gitlab":
+			if repo := repositoryURL(p.Info.ProjectURLs[label]); repo != "" {
+				return repo
+			}
+		}
+	}
+
+	candidates := []string{p.Info.HomePage}
+	for _, label := range labels {
+		candidates = append(candidates, p.Info.ProjectURLs[label])
+	}
+	for _, candidate := range candidates {
+		if isForge(candidate) {
+			return repositoryURL(candidate)
+		}
+	}
+
+	return ""
+}
+
+// isForge reports whether rawURL is on a code forge.
+func isForge(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	switch strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") {
+	case "github.com", "gitlab.com", "codeberg.org", "bitbucket.org", "sr.ht", "git.sr.ht":
+		return true
+	default:
+		return false
+	}
+}
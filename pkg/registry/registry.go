@@ -0,0 +1,444 @@
+// Package registry builds link previews of packages on npm, PyPI, crates.io, pkg.go.dev and Docker Hub
+// from the JSON APIs of the registries, since their pages are rendered by JavaScript or carry generic metadata.
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/github"
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+	"github.com/danvergara/jumble-proxy-server/pkg/outbound"
+)
+
+// Default base URLs of the registry APIs.
+const (
+	DefaultNPMRegistryURL  = "https://registry.npmjs.org"
+	DefaultNPMDownloadsURL = "https://api.npmjs.org"
+	DefaultPyPIURL         = "https://pypi.org"
+	DefaultPyPIStatsURL    = "https://pypistats.org"
+	DefaultCratesIOURL     = "https://crates.io"
+	DefaultGoProxyURL      = "https://proxy.golang.org"
+	DefaultDepsDevURL      = "https://api.deps.dev"
+	DefaultDockerHubURL    = "https://hub.docker.com"
+)
+
+const (
+	// maxResponseBytes caps the size of an API response. The crates.io responses list every version.
+	maxResponseBytes = 4 << 20
+	// userAgent identifies the requests, as crates.io requires.
+	userAgent = "jumble-proxy-server (+https://github.com/danvergara/jumble-proxy-server)"
+)
+
+// ErrNotFound is returned when a package or a version does not exist.
+var ErrNotFound = errors.New("package not found")
+
+// Registries.
+const (
+	NPM       = "npm"
+	PyPI      = "pypi"
+	CratesIO  = "crates.io"
+	Go        = "go"
+	DockerHub = "docker"
+)
+
+var (
+	npmName    = regexp.MustCompile(`^(@[A-Za-z0-9][A-Za-z0-9._~-]*/)?[A-Za-z0-9][A-Za-z0-9._~-]*$`)
+	pypiName   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?$`)
+	crateName  = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]{0,63}$`)
+	dockerName = regexp.MustCompile(`^[a-z0-9]+([._-][a-z0-9]+)*$`)
+	version    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.+_-]{0,127}$`)
+)
+
+// Ref is the package, and optionally the version, a registry URL points to.
+type Ref struct {
+	// Registry is one of NPM, PyPI, CratesIO, Go or DockerHub.
+	Registry string
+	// Name is the package name, like @types/node, the Go package path, or the Docker repository, like library/nginx.
+	Name string
+	// Version is empty for the latest version. It is the tag of Docker images.
+	Version string
+}
+
+// Parse returns the package of a registry URL:
+//   - https://www.npmjs.com/package/{name} and .../v/{version}, with scoped names
+//   - https://pypi.org/project/{name}/ and .../{version}/
+//   - https://crates.io/crates/{name} and .../{version}
+//   - https://pkg.go.dev/{path} and {module}@{version}/{subpath}
+//   - https://hub.docker.com/_/{name}, /r/{namespace}/{name} and /layers/{namespace}/{name}/{tag}
+func Parse(u *url.URL) (Ref, error) {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Ref{}, errors.New("not an http or https URL")
+	}
+
+	segments := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+
+	var ref Ref
+	switch host {
+	case "npmjs.com":
+		ref = parseNPM(segments)
+	case "pypi.org":
+		ref = parsePyPI(segments)
+	case "crates.io":
+		ref = parseCrate(segments)
+	case "pkg.go.dev":
+		ref = parseGo(segments)
+	case "hub.docker.com":
+		ref = parseDocker(segments)
+	}
+
+	if ref.Name == "" {
+		return Ref{}, errors.New("not a package URL")
+	}
+	if ref.Version != "" && !version.MatchString(ref.Version) {
+		return Ref{}, fmt.Errorf("invalid version %q", ref.Version)
+	}
+
+	return ref, nil
+}
+
+func parseNPM(segments []string) Ref {
+	if len(segments) < 2 || segments[0] != "package" {
+		return Ref{}
+	}
+	segments = segments[1:]
+
+	name := segments[0]
+	if strings.HasPrefix(name, "@") && len(segments) > 1 {
+		name += "/" + segments[1]
+		segments = segments[1:]
+	}
+	if !npmName.MatchString(name) {
+		return Ref{}
+	}
+
+	ref := Ref{Registry: NPM, Name: name}
+	if len(segments) == 3 && segments[1] == "v" {
+		ref.Version = segments[2]
+	}
+	return ref
+}
+
+func parsePyPI(segments []string) Ref {
+	if len(segments) < 2 || len(segments) > 3 || segments[0] != "project" || !pypiName.MatchString(segments[1]) {
+		return Ref{}
+	}
+
+	ref := Ref{Registry: PyPI, Name: segments[1]}
+	if len(segments) == 3 {
+		ref.Version = segments[2]
+	}
+	return ref
+}
+
+func parseCrate(segments []string) Ref {
+	if len(segments) < 2 || segments[0] != "crates" || !crateName.MatchString(segments[1]) {
+		return Ref{}
+	}
+
+	ref := Ref{Registry: CratesIO, Name: segments[1]}
+	if len(segments) == 3 {
+		ref.Version = segments[2]
+	}
+	return ref
+}
+
+// parseGo returns the package of a pkg.go.dev path. Only module paths, whose first element is a domain, are handled:
+// the standard library and the pages of the site itself, like /search, are left to the generic proxy.
+func parseGo(segments []string) Ref {
+	if len(segments) == 0 || !strings.Contains(segments[0], ".") {
+		return Ref{}
+	}
+
+	ref := Ref{Registry: Go}
+	for i, segment := range segments {
+		if p, v, ok := strings.Cut(segment, "@"); ok {
+			segments[i], ref.Version = p, v
+			break
+		}
+	}
+	ref.Name = strings.Join(segments, "/")
+
+	return ref
+}
+
+func parseDocker(segments []string) Ref {
+	var namespace, name, tag string
+
+	switch {
+	case len(segments) >= 2 && segments[0] == "_":
+		namespace, name = "library", segments[1]
+	case len(segments) >= 3 && segments[0] == "r":
+		namespace, name = segments[1], segments[2]
+	case len(segments) >= 4 && segments[0] == "layers":
+		namespace, name, tag = segments[1], segments[2], segments[3]
+	default:
+		return Ref{}
+	}
+
+	if !dockerName.MatchString(namespace) || !dockerName.MatchString(name) {
+		return Ref{}
+	}
+
+	return Ref{Registry: DockerHub, Name: namespace + "/" + name, Version: tag}
+}
+
+// Package is what the registry says about a package version.
+type Package struct {
+	Name        string
+	Version     string
+	Description string
+	// License is an SPDX expression or the name of a license, if known.
+	License string
+	// Downloads is the number of downloads described by DownloadsLabel, like "Downloads last week".
+	// It is -1 when unknown.
+	Downloads      int64
+	DownloadsLabel string
+	// Repository is the URL of the source repository, if known.
+	Repository string
+}
+
+// Options configures the client. Empty base URLs default to the public registries.
+type Options struct {
+	// HTTPClient sends the requests to the registries. Nil means a client from outbound.NewClient.
+	HTTPClient      *http.Client
+	NPMRegistryURL  string
+	NPMDownloadsURL string
+	PyPIURL         string
+	PyPIStatsURL    string
+	CratesIOURL     string
+	GoProxyURL      string
+	// DepsDevURL is the deps.dev API, which gives the licenses of Go modules.
+	DepsDevURL   string
+	DockerHubURL string
+}
+
+// Client builds previews of registry URLs.
+type Client struct {
+	client          *http.Client
+	npmRegistryURL  string
+	npmDownloadsURL string
+	pypiURL         string
+	pypiStatsURL    string
+	cratesIOURL     string
+	goProxyURL      string
+	depsDevURL      string
+	dockerHubURL    string
+}
+
+func New(opts Options) *Client {
+	c := &Client{
+		client:          opts.HTTPClient,
+		npmRegistryURL:  baseURL(opts.NPMRegistryURL, DefaultNPMRegistryURL),
+		npmDownloadsURL: baseURL(opts.NPMDownloadsURL, DefaultNPMDownloadsURL),
+		pypiURL:         baseURL(opts.PyPIURL, DefaultPyPIURL),
+		pypiStatsURL:    baseURL(opts.PyPIStatsURL, DefaultPyPIStatsURL),
+		cratesIOURL:     baseURL(opts.CratesIOURL, DefaultCratesIOURL),
+		goProxyURL:      baseURL(opts.GoProxyURL, DefaultGoProxyURL),
+		depsDevURL:      baseURL(opts.DepsDevURL, DefaultDepsDevURL),
+		dockerHubURL:    baseURL(opts.DockerHubURL, DefaultDockerHubURL),
+	}
+
+	if c.client == nil {
+		c.client = outbound.NewClient(outbound.Options{})
+	}
+
+	return c
+}
+
+func baseURL(configured, def string) string {
+	if configured == "" {
+		return def
+	}
+	return strings.TrimSuffix(configured, "/")
+}
+
+// Match reports whether u is the URL of a package on one of the registries.
+func (c *Client) Match(u *url.URL) bool {
+	_, err := Parse(u)
+	return err == nil
+}
+
+// Preview returns the head of the preview document of a package.
+func (c *Client) Preview(ctx context.Context, u *url.URL) (opengraph.Head, error) {
+	ref, err := Parse(u)
+	if err != nil {
+		return opengraph.Head{}, err
+	}
+
+	pkg, err := c.Lookup(ctx, ref)
+	if err != nil {
+		return opengraph.Head{}, err
+	}
+
+	return packageHead(u, ref, pkg), nil
+}
+
+// Lookup queries the registry of ref for the package.
+// Download counts are best effort: a failure of the statistics API leaves them unknown.
+func (c *Client) Lookup(ctx context.Context, ref Ref) (Package, error) {
+	switch ref.Registry {
+	case NPM:
+		return c.npm(ctx, ref)
+	case PyPI:
+		return c.pypi(ctx, ref)
+	case CratesIO:
+		return c.crate(ctx, ref)
+	case Go:
+		return c.goModule(ctx, ref)
+	case DockerHub:
+		return c.dockerImage(ctx, ref)
+	default:
+		return Package{}, fmt.Errorf("unknown registry %q", ref.Registry)
+	}
+}
+
+// getJSON decodes the JSON response at rawURL into v. Missing resources are reported as ErrNotFound.
+func (c *Client) getJSON(ctx context.Context, rawURL string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("%s returned status %d", req.URL.Host, resp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(v)
+}
+
+// siteNames are the names of the registries shown in the previews.
+var siteNames = map[string]string{
+	NPM:       "npm",
+	PyPI:      "PyPI",
+	CratesIO:  "crates.io",
+	Go:        "pkg.go.dev",
+	DockerHub: "Docker Hub",
+}
+
+// packageHead builds the preview of a package with the GitHub preview layout,
+// using the social preview image of its repository when it is on GitHub.
+func packageHead(u *url.URL, ref Ref, pkg Package) opengraph.Head {
+	title := pkg.Name
+	if pkg.Version != "" {
+		switch ref.Registry {
+		case Go:
+			title += "@" + pkg.Version
+		case DockerHub:
+			title += ":" + pkg.Version
+		default:
+			title += " " + pkg.Version
+		}
+	}
+
+	var facts []string
+	if pkg.License != "" {
+		facts = append(facts, pkg.License)
+	}
+	if pkg.Downloads >= 0 && pkg.DownloadsLabel != "" {
+		facts = append(facts, opengraph.FormatCount(pkg.Downloads)+" "+strings.ToLower(pkg.DownloadsLabel))
+	}
+	if pkg.Repository != "" {
+		facts = append(facts, strings.TrimPrefix(strings.TrimPrefix(pkg.Repository, "https://"), "http://"))
+	}
+
+	description := opengraph.Truncate(strings.TrimSpace(pkg.Description), opengraph.MaxDescriptionLength)
+	if len(facts) > 0 {
+		if description != "" {
+			description += "\n\n"
+		}
+		description += strings.Join(facts, " · ")
+	}
+
+	var image string
+	if owner, repo, ok := githubRepository(pkg.Repository); ok {
+		image = github.SocialImageURL(owner, repo)
+	}
+
+	head := github.PreviewHead(title, description, u.String(), image)
+	head.SetMeta("og:site_name", siteNames[ref.Registry])
+
+	var labels [][2]string
+	if pkg.License != "" {
+		labels = append(labels, [2]string{"License", pkg.License})
+	}
+	if pkg.Downloads >= 0 && pkg.DownloadsLabel != "" {
+		labels = append(labels, [2]string{pkg.DownloadsLabel, opengraph.FormatCount(pkg.Downloads)})
+	}
+	for i, label := range labels {
+		head.SetMeta("twitter:label"+strconv.Itoa(i+1), label[0])
+		head.SetMeta("twitter:data"+strconv.Itoa(i+1), label[1])
+	}
+
+	return head
+}
+
+// repositoryURL returns the https URL of a source repository, given as in package manifests:
+// git+https://github.com/o/r.git, git://github.com/o/r, git@github.com:o/r.git, github:o/r or o/r.
+func repositoryURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+
+	if rest, ok := strings.CutPrefix(raw, "github:"); ok {
+		raw = "https://github.com/" + rest
+	} else if rest, ok := strings.CutPrefix(raw, "git@"); ok {
+		if host, path, ok := strings.Cut(rest, ":"); ok {
+			raw = "https://" + host + "/" + path
+		}
+	} else if !strings.Contains(raw, ":") && strings.Count(raw, "/") == 1 {
+		raw = "https://github.com/" + raw
+	}
+
+	u, err := url.Parse(strings.TrimPrefix(raw, "git+"))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	switch u.Scheme {
+	case "http", "https", "git", "ssh":
+	default:
+		return ""
+	}
+
+	u.Scheme, u.User, u.RawQuery, u.Fragment = "https", nil, "", ""
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git")
+
+	return u.String()
+}
+
+// githubRepository returns the owner and the name of a repository, and reports whether repoURL is on GitHub.
+func githubRepository(repoURL string) (string, string, bool) {
+	u, err := url.Parse(repoURL)
+	if err != nil || !strings.EqualFold(strings.TrimPrefix(u.Hostname(), "www."), "github.com") {
+		return "", "", false
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+
+	return parts[0], strings.TrimSuffix(parts[1], ".git"), true
+}
@@ -0,0 +1,308 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/github"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected Ref
+		wantErr  bool
+	}{
+		{url: "https://www.npmjs.com/package/react", expected: Ref{Registry: NPM, Name: "react"}},
+		{url: "https://www.npmjs.com/package/@types/node", expected: Ref{Registry: NPM, Name: "@types/node"}},
+		{url: "https://www.npmjs.com/package/@types/node/v/22.0.0", expected: Ref{Registry: NPM, Name: "@types/node", Version: "22.0.0"}},
+		{url: "https://npmjs.com/package/react/v/18.3.1", expected: Ref{Registry: NPM, Name: "react", Version: "18.3.1"}},
+		{url: "https://www.npmjs.com/search?q=react", wantErr: true},
+		{url: "https://pypi.org/project/requests/", expected: Ref{Registry: PyPI, Name: "requests"}},
+		{url: "https://pypi.org/project/requests/2.32.3/", expected: Ref{Registry: PyPI, Name: "requests", Version: "2.32.3"}},
+		{url: "https://pypi.org/project/requests/2.32.3/files/", wantErr: true},
+		{url: "https://crates.io/crates/serde", expected: Ref{Registry: CratesIO, Name: "serde"}},
+		{url: "https://crates.io/crates/serde/1.0.200", expected: Ref{Registry: CratesIO, Name: "serde", Version: "1.0.200"}},
+		{url: "https://crates.io/crates/9lives", wantErr: true},
+		{url: "https://pkg.go.dev/golang.org/x/net/html", expected: Ref{Registry: Go, Name: "golang.org/x/net/html"}},
+		{
+			url:      "https://pkg.go.dev/golang.org/x/net@v0.30.0/html",
+			expected: Ref{Registry: Go, Name: "golang.org/x/net/html", Version: "v0.30.0"},
+		},
+		{url: "https://pkg.go.dev/net/http", wantErr: true},
+		{url: "https://pkg.go.dev/search?q=yaml", wantErr: true},
+		{url: "https://hub.docker.com/_/nginx", expected: Ref{Registry: DockerHub, Name: "library/nginx"}},
+		{url: "https://hub.docker.com/r/grafana/grafana/tags", expected: Ref{Registry: DockerHub, Name: "grafana/grafana"}},
+		{
+			url:      "https://hub.docker.com/layers/library/nginx/1.27-alpine/images/sha256-abc",
+			expected: Ref{Registry: DockerHub, Name: "library/nginx", Version: "1.27-alpine"},
+		},
+		{url: "https://hub.docker.com/u/grafana", wantErr: true},
+		{url: "https://github.com/npm/cli", wantErr: true},
+		{url: "ftp://pypi.org/project/requests/", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+
+			ref, err := Parse(u)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ref != tt.expected {
+				t.Errorf("Parse() = %+v, expected %+v", ref, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRepositoryURL(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected string
+	}{
+		{raw: "git+https://github.com/facebook/react.git", expected: "https://github.com/facebook/react"},
+		{raw: "git://github.com/facebook/react", expected: "https://github.com/facebook/react"},
+		{raw: "git@github.com:facebook/react.git", expected: "https://github.com/facebook/react"},
+		{raw: "github:facebook/react", expected: "https://github.com/facebook/react"},
+		{raw: "facebook/react", expected: "https://github.com/facebook/react"},
+		{raw: "https://gitlab.com/group/project/", expected: "https://gitlab.com/group/project"},
+		{raw: "javascript:alert(1)", expected: ""},
+		{raw: "", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			if got := repositoryURL(tt.raw); got != tt.expected {
+				t.Errorf("repositoryURL() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+// newFakeRegistries serves the APIs of every registry the client queries.
+func newFakeRegistries(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.EscapedPath() {
+		case "/npm/@types%2Fnode/22.0.0":
+			fmt.Fprint(w, `{"name": "@types/node", "version": "22.0.0", "description": "TypeScript definitions for node",
+				"license": "MIT", "repository": {"type": "git", "url": "git+https://github.com/DefinitelyTyped/DefinitelyTyped.git"}}`)
+		case "/npm/left-pad/latest":
+			fmt.Fprint(w, `{"name": "left-pad", "version": "1.3.0", "description": "String left pad", "license": {"type": "WTFPL"}}`)
+		case "/npm-downloads/downloads/point/last-week/@types/node":
+			fmt.Fprint(w, `{"downloads": 61234567, "package": "@types/node"}`)
+		case "/pypi/pypi/requests/json":
+			fmt.Fprint(w, `{"info": {"name": "requests", "version": "2.32.3", "summary": "Python HTTP for Humans.",
+				"license": "Apache-2.0\n\nLicensed under the Apache License...", "classifiers": ["License :: OSI Approved :: Apache Software License"],
+				"project_urls": {"Documentation": "https://requests.readthedocs.io", "Source": "https://github.com/psf/requests"}}}`)
+		case "/pypistats/api/packages/requests/recent":
+			fmt.Fprint(w, `{"data": {"last_day": 1000, "last_month": 100000, "last_week": 25000}}`)
+		case "/crates/api/v1/crates/serde":
+			fmt.Fprint(w, `{"crate": {"name": "serde", "description": "A serialization framework", "max_stable_version": "1.0.200",
+				"downloads": 500000000, "repository": "https://github.com/serde-rs/serde"},
+				"versions": [{"num": "1.0.200", "license": "MIT OR Apache-2.0"}, {"num": "1.0.0", "license": "MIT/Apache-2.0"}]}`)
+		case "/goproxy/golang.org/x/net/@v/v0.30.0.info":
+			fmt.Fprint(w, `{"Version": "v0.30.0", "Origin": {"VCS": "git", "URL": "https://go.googlesource.com/net"}}`)
+		case "/goproxy/github.com/!burnt!sushi/toml/@latest":
+			fmt.Fprint(w, `{"Version": "v1.4.0", "Origin": {"VCS": "git", "URL": "https://github.com/BurntSushi/toml"}}`)
+		case "/depsdev/v3/systems/go/packages/golang.org%2Fx%2Fnet/versions/v0.30.0":
+			fmt.Fprint(w, `{"licenses": ["BSD-3-Clause"], "links": [{"label": "SOURCE_REPO", "url": "https://github.com/golang/net"}]}`)
+		case "/docker/v2/repositories/library/nginx/":
+			fmt.Fprint(w, `{"namespace": "library", "name": "nginx", "description": "Official build of Nginx.", "pull_count": 1000000000}`)
+		case "/docker/v2/repositories/library/nginx/tags/1.27-alpine":
+			fmt.Fprint(w, `{"name": "1.27-alpine"}`)
+		case "/goproxy/golang.org/x/net/html/@v/v0.30.0.info":
+			w.WriteHeader(http.StatusGone)
+			fmt.Fprint(w, `not found: module golang.org/x/net/html: no matching versions`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func newTestClient(srv *httptest.Server) *Client {
+	return New(Options{
+		HTTPClient:      srv.Client(),
+		NPMRegistryURL:  srv.URL + "/npm",
+		NPMDownloadsURL: srv.URL + "/npm-downloads/",
+		PyPIURL:         srv.URL + "/pypi",
+		PyPIStatsURL:    srv.URL + "/pypistats",
+		CratesIOURL:     srv.URL + "/crates",
+		GoProxyURL:      srv.URL + "/goproxy",
+		DepsDevURL:      srv.URL + "/depsdev",
+		DockerHubURL:    srv.URL + "/docker",
+	})
+}
+
+func TestClientPreview(t *testing.T) {
+	c := newTestClient(newFakeRegistries(t))
+
+	tests := []struct {
+		name        string
+		url         string
+		title       string
+		description string
+		siteName    string
+		image       string
+		labels      []string
+	}{
+		{
+			name:        "npm version",
+			url:         "https://www.npmjs.com/package/@types/node/v/22.0.0",
+			title:       "@types/node 22.0.0",
+			description: "TypeScript definitions for node\n\nMIT · 61,234,567 downloads last week · github.com/DefinitelyTyped/DefinitelyTyped",
+			siteName:    "npm",
+			image:       "https://opengraph.githubassets.com/1/",
+			labels:      []string{"License", "MIT", "Downloads last week", "61,234,567"},
+		},
+		{
+			name:        "npm without downloads",
+			url:         "https://www.npmjs.com/package/left-pad",
+			title:       "left-pad 1.3.0",
+			description: "String left pad\n\nWTFPL",
+			siteName:    "npm",
+			labels:      []string{"License", "WTFPL"},
+		},
+		{
+			name:        "pypi",
+			url:         "https://pypi.org/project/requests/",
+			title:       "requests 2.32.3",
+			description: "Python HTTP for Humans.\n\nApache Software License · 25,000 downloads last week · github.com/psf/requests",
+			siteName:    "PyPI",
+			image:       "https://opengraph.githubassets.com/1/",
+			labels:      []string{"License", "Apache Software License", "Downloads last week", "25,000"},
+		},
+		{
+			name:        "crates.io",
+			url:         "https://crates.io/crates/serde",
+			title:       "serde 1.0.200",
+			description: "A serialization framework\n\nMIT OR Apache-2.0 · 500,000,000 downloads · github.com/serde-rs/serde",
+			siteName:    "crates.io",
+			image:       "https://opengraph.githubassets.com/1/",
+			labels:      []string{"License", "MIT OR Apache-2.0", "Downloads", "500,000,000"},
+		},
+		{
+			name:        "crates.io old version",
+			url:         "https://crates.io/crates/serde/1.0.0",
+			title:       "serde 1.0.0",
+			description: "A serialization framework\n\nMIT/Apache-2.0 · 500,000,000 downloads · github.com/serde-rs/serde",
+			siteName:    "crates.io",
+			image:       "https://opengraph.githubassets.com/1/",
+			labels:      []string{"License", "MIT/Apache-2.0", "Downloads", "500,000,000"},
+		},
+		{
+			name:        "go package in a versioned module",
+			url:         "https://pkg.go.dev/golang.org/x/net@v0.30.0/html",
+			title:       "golang.org/x/net/html@v0.30.0",
+			description: "Go package golang.org/x/net/html in module golang.org/x/net\n\nBSD-3-Clause · go.googlesource.com/net",
+			siteName:    "pkg.go.dev",
+			labels:      []string{"License", "BSD-3-Clause"},
+		},
+		{
+			name:        "go module with uppercase letters",
+			url:         "https://pkg.go.dev/github.com/BurntSushi/toml",
+			title:       "github.com/BurntSushi/toml@v1.4.0",
+			description: "Go module github.com/BurntSushi/toml\n\ngithub.com/BurntSushi/toml",
+			siteName:    "pkg.go.dev",
+			image:       "https://opengraph.githubassets.com/1/",
+		},
+		{
+			name:        "docker official image tag",
+			url:         "https://hub.docker.com/layers/library/nginx/1.27-alpine/images/sha256-abc",
+			title:       "nginx:1.27-alpine",
+			description: "Official build of Nginx.\n\n1,000,000,000 pulls",
+			siteName:    "Docker Hub",
+			labels:      []string{"Pulls", "1,000,000,000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+
+			head, err := c.Preview(context.Background(), u)
+			if err != nil {
+				t.Fatalf("Preview() error = %v", err)
+			}
+
+			md := head.Metadata()
+			if md.Title != tt.title || md.Description != tt.description || md.SiteName != tt.siteName || md.URL != tt.url {
+				t.Errorf("Preview() = %+v, expected title %q, description %q, site name %q and URL %q",
+					md, tt.title, tt.description, tt.siteName, tt.url)
+			}
+			if !strings.HasPrefix(md.Image, tt.image) || (tt.image == "") != (md.Image == "") {
+				t.Errorf("Preview() image = %q, expected %q", md.Image, tt.image)
+			}
+
+			var labels []string
+			for i := 1; i <= 2; i++ {
+				if label := head.Meta(fmt.Sprintf("twitter:label%d", i)); label != "" {
+					labels = append(labels, label, head.Meta(fmt.Sprintf("twitter:data%d", i)))
+				}
+			}
+			if strings.Join(labels, "|") != strings.Join(tt.labels, "|") {
+				t.Errorf("Preview() labels = %q, expected %q", labels, tt.labels)
+			}
+		})
+	}
+}
+
+func TestClientPreviewNotFound(t *testing.T) {
+	c := newTestClient(newFakeRegistries(t))
+
+	for _, rawURL := range []string{
+		"https://www.npmjs.com/package/missing",
+		"https://crates.io/crates/serde/9.9.9",
+		"https://pkg.go.dev/example.com/missing",
+		"https://hub.docker.com/layers/library/nginx/missing/images/sha256-abc",
+	} {
+		t.Run(rawURL, func(t *testing.T) {
+			u, _ := url.Parse(rawURL)
+
+			if _, err := c.Preview(context.Background(), u); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Preview() error = %v, expected %v", err, ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestGithubRepository(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+		ok       bool
+	}{
+		{url: "https://github.com/psf/requests", expected: "https://opengraph.githubassets.com/1/psf/requests", ok: true},
+		{url: "https://www.github.com/serde-rs/serde.git", expected: "https://opengraph.githubassets.com/1/serde-rs/serde", ok: true},
+		{url: "https://github.com/psf", ok: false},
+		{url: "https://gitlab.com/group/project", ok: false},
+		{url: "", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			owner, repo, ok := githubRepository(tt.url)
+			image := ""
+			if ok {
+				image = github.SocialImageURL(owner, repo)
+			}
+			if ok != tt.ok || image != tt.expected {
+				t.Errorf("githubRepository() = %q, %v, expected %q, %v", image, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
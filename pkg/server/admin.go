@@ -0,0 +1,168 @@
+package server
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+)
+
+// newAdminServer returns the handler served on the admin listener, sharing st with the public server.
+// It hosts pprof, the metrics and the cache management API and must never be exposed publicly.
+func newAdminServer(cfg *config.Config, st *state) http.Handler {
+	mux := http.NewServeMux()
+	addAdminRoutes(mux, cfg, st)
+	var handler http.Handler = mux
+	if cfg.AdminToken != "" {
+		handler = bearerAuthMiddleware(handler, cfg.AdminToken)
+	}
+	return handler
+}
+
+// addAdminRoutes function adds the admin handlers to the admin server mux.
+func addAdminRoutes(mux *http.ServeMux, cfg *config.Config, st *state) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	mux.Handle("GET /metrics", metricsHandler(cfg, st.metrics))
+
+	mux.Handle("GET /cache/stats", cacheStatsHandler(cfg))
+	mux.Handle("GET /cache/entries", cacheLookupHandler(cfg))
+	mux.Handle("DELETE /cache/entries", cachePurgeHandler(cfg))
+	mux.Handle("DELETE /cache", cacheFlushHandler(cfg))
+}
+
+// bearerAuthMiddleware rejects requests that do not carry the expected bearer token.
+func bearerAuthMiddleware(next http.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cacheStatsHandler returns the statistics of the cache.
+func cacheStatsHandler(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := cfg.Cache
+		writeJSON(w, http.StatusOK, map[string]any{
+			"entries":             c.EntryCount(),
+			"hits":                c.HitCount(),
+			"misses":              c.MissCount(),
+			"lookups":             c.LookupCount(),
+			"hit_rate":            c.HitRate(),
+			"evictions":           c.EvacuateCount(),
+			"expirations":         c.ExpiredCount(),
+			"overwrites":          c.OverwriteCount(),
+			"touched":             c.TouchedCount(),
+			"average_access_time": c.AverageAccessTime(),
+		})
+	}
+}
+
+// cacheLookupHandler returns the metadata of the entry stored for the url query parameter.
+// With raw=true the stored document is returned instead.
+func cacheLookupHandler(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("url")
+		if key == "" {
+			http.Error(w, "missing url query parameter", http.StatusBadRequest)
+			return
+		}
+
+		// Peek does not update the hit and miss statistics of the cache.
+		value, err := cfg.Cache.Peek([]byte(key))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("no cache entry for %s", key), http.StatusNotFound)
+			return
+		}
+
+		if r.URL.Query().Get("raw") == "true" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			w.Write(value)
+			return
+		}
+
+		entry := map[string]any{
+			"url":  key,
+			"size": len(value),
+		}
+		if ttl, err := cfg.Cache.TTL([]byte(key)); err == nil && ttl > 0 {
+			entry["ttl_seconds"] = ttl
+			entry["expires_at"] = time.Now().Add(time.Duration(ttl) * time.Second).UTC()
+		}
+
+		writeJSON(w, http.StatusOK, entry)
+	}
+}
+
+// cachePurgeHandler deletes the entry stored for the url query parameter,
+// or every entry whose URL belongs to the host query parameter (including its subdomains).
+func cachePurgeHandler(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		switch {
+		case query.Get("url") != "":
+			purged := 0
+			if cfg.Cache.Del([]byte(query.Get("url"))) {
+				purged = 1
+			}
+			writeJSON(w, http.StatusOK, map[string]int{"purged": purged})
+		case query.Get("host") != "":
+			host := strings.ToLower(query.Get("host"))
+
+			var keys [][]byte
+			it := cfg.Cache.NewIterator()
+			for entry := it.Next(); entry != nil; entry = it.Next() {
+				if matchesHost(string(entry.Key), host) {
+					keys = append(keys, entry.Key)
+				}
+			}
+
+			purged := 0
+			for _, key := range keys {
+				if cfg.Cache.Del(key) {
+					purged++
+				}
+			}
+
+			writeJSON(w, http.StatusOK, map[string]int{"purged": purged})
+		default:
+			http.Error(w, "missing url or host query parameter", http.StatusBadRequest)
+		}
+	}
+}
+
+// cacheFlushHandler deletes every entry of the cache.
+func cacheFlushHandler(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		purged := cfg.Cache.EntryCount()
+		cfg.Cache.Clear()
+		writeJSON(w, http.StatusOK, map[string]int64{"purged": purged})
+	}
+}
+
+// matchesHost reports whether the cache key is a URL on host or one of its subdomains.
+func matchesHost(key, host string) bool {
+	u, err := url.Parse(key)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	h := strings.ToLower(u.Hostname())
+	return h == host || strings.HasSuffix(h, "."+host)
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/coocood/freecache"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+)
+
+func TestAdminServer(t *testing.T) {
+	cfg := &config.Config{
+		Logger:     slog.Default(),
+		Cache:      freecache.NewCache(1024 * 1024),
+		AdminToken: "secret",
+	}
+
+	entries := []string{
+		"https://github.com/danvergara/dblab",
+		"https://gist.github.com/danvergara/abc",
+		"https://example.com/",
+	}
+	for _, e := range entries {
+		if err := cfg.Cache.Set([]byte(e), []byte("<html></html>"), 3600); err != nil {
+			t.Fatalf("Failed to seed the cache: %v", err)
+		}
+	}
+
+	srv := httptest.NewServer(newAdminServer(cfg, newState(cfg)))
+	defer srv.Close()
+
+	do := func(method, path, token string) (int, string) {
+		t.Helper()
+
+		req, err := http.NewRequest(method, srv.URL+path, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to request %s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if code, _ := do(http.MethodGet, "/cache/stats", ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", code)
+	}
+	if code, _ := do(http.MethodGet, "/cache/stats", "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with a wrong token, got %d", code)
+	}
+
+	code, body := do(http.MethodGet, "/cache/entries?url="+url.QueryEscape(entries[0]), "secret")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200 looking up a cached entry, got %d: %s", code, body)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(body), &entry); err != nil {
+		t.Fatalf("Failed to decode the entry: %v", err)
+	}
+	if entry["url"] != entries[0] || entry["size"].(float64) != float64(len("<html></html>")) {
+		t.Fatalf("unexpected entry %v", entry)
+	}
+
+	if code, _ := do(http.MethodGet, "/cache/entries?url=https://missing.example", "secret"); code != http.StatusNotFound {
+		t.Fatalf("expected 404 looking up a missing entry, got %d", code)
+	}
+
+	code, body = do(http.MethodDelete, "/cache/entries?host=github.com", "secret")
+	if code != http.StatusOK || !strings.Contains(body, `"purged":2`) {
+		t.Fatalf("expected the github.com entries to be purged, got %d: %s", code, body)
+	}
+	if cfg.Cache.EntryCount() != 1 {
+		t.Fatalf("expected 1 entry left, got %d", cfg.Cache.EntryCount())
+	}
+
+	code, body = do(http.MethodDelete, "/cache/entries?url="+url.QueryEscape(entries[2]), "secret")
+	if code != http.StatusOK || !strings.Contains(body, `"purged":1`) {
+		t.Fatalf("expected the entry to be purged, got %d: %s", code, body)
+	}
+
+	cfg.Cache.Set([]byte(entries[0]), []byte("<html></html>"), 3600)
+	if code, _ := do(http.MethodDelete, "/cache", "secret"); code != http.StatusOK {
+		t.Fatalf("expected 200 flushing the cache, got %d", code)
+	}
+	if cfg.Cache.EntryCount() != 0 {
+		t.Fatalf("expected an empty cache after the flush, got %d entries", cfg.Cache.EntryCount())
+	}
+
+	code, body = do(http.MethodGet, "/metrics", "secret")
+	if code != http.StatusOK || !strings.Contains(body, "jumble_proxy_cache_entries 0") {
+		t.Fatalf("unexpected metrics response %d: %s", code, body)
+	}
+}
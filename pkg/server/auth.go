@@ -0,0 +1,134 @@
+package server
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+	"github.com/danvergara/jumble-proxy-server/pkg/logging"
+	"github.com/danvergara/jumble-proxy-server/pkg/nostr"
+)
+
+const (
+	// defaultNIP98TimeWindow is used when cfg.NIP98TimeWindow is not set.
+	defaultNIP98TimeWindow = time.Minute
+	// rateLimitWindow is the window of the NIP-98 rate limits, which are given per minute.
+	rateLimitWindow = time.Minute
+)
+
+// nip98AuthMiddleware requires the requests to next to carry a NIP-98 Authorization header,
+// signed by a public key allowed by cfg and within its rate limit.
+// In threshold mode, requests without the header are let through until their client
+// exceeds the anonymous rate limit. It returns next as is when auth is off.
+func nip98AuthMiddleware(next http.Handler, cfg *config.Config) http.Handler {
+	if cfg.NIP98Auth == "" || cfg.NIP98Auth == config.NIP98AuthOff {
+		return next
+	}
+
+	window := cfg.NIP98TimeWindow
+	if window <= 0 {
+		window = defaultNIP98TimeWindow
+	}
+
+	allowed := pubKeySet(cfg.NIP98AllowedPubKeys)
+	denied := pubKeySet(cfg.NIP98DeniedPubKeys)
+
+	var anonymous, authenticated *rateLimiter
+	if cfg.NIP98Auth == config.NIP98AuthThreshold {
+		anonymous = newRateLimiter(cfg.NIP98AnonymousRateLimit, rateLimitWindow)
+	}
+	if cfg.NIP98RateLimit > 0 {
+		authenticated = newRateLimiter(cfg.NIP98RateLimit, rateLimitWindow)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.FromContext(r.Context())
+		now := time.Now()
+
+		if r.Header.Get("Authorization") == "" && anonymous != nil {
+			if ok, _ := anonymous.allow(clientIP(r, cfg.TrustedProxies), now); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		pubkey, err := nostr.VerifyAuth(r, requestURL(r, cfg.PublicURL, cfg.TrustedProxies), now, window)
+		if err != nil {
+			logger.Warn("NIP-98 auth failed", slog.Any("error", err))
+			setCORSHeaders(w, r.Method)
+			w.Header().Set("WWW-Authenticate", "Nostr")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		setAuthPubKey(r.Context(), pubkey)
+
+		_, isAllowed := allowed[pubkey]
+		_, isDenied := denied[pubkey]
+		if isDenied || (len(allowed) > 0 && !isAllowed) {
+			setCORSHeaders(w, r.Method)
+			http.Error(w, "Public key not allowed", http.StatusForbidden)
+			return
+		}
+
+		if authenticated != nil {
+			if ok, retryAfter := authenticated.allow(pubkey, now); !ok {
+				setCORSHeaders(w, r.Method)
+				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// pubKeySet returns the set of the hex public keys of pubkeys, which Config.Validate checked.
+// A key that still does not parse is kept as is: it matches no verified event,
+// and an allow list made of such keys still rejects every key.
+func pubKeySet(pubkeys []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(pubkeys))
+	for _, pubkey := range pubkeys {
+		if key, err := nostr.ParsePubKey(pubkey); err == nil {
+			pubkey = key
+		}
+		set[pubkey] = struct{}{}
+	}
+	return set
+}
+
+// requestURL returns the absolute URL the client sent r to, as signed in the u tag of its NIP-98 event.
+// It is publicURL followed by the path of r when publicURL is set. Otherwise, the scheme and the host
+// set in X-Forwarded-Proto and X-Forwarded-Host are used when the request comes from one of the trusted proxies.
+func requestURL(r *http.Request, publicURL string, trusted []netip.Prefix) string {
+	if publicURL != "" {
+		return strings.TrimSuffix(publicURL, "/") + r.URL.RequestURI()
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	host := r.Host
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil || !isTrustedProxy(remote, trusted) {
+		return scheme + "://" + host + r.URL.RequestURI()
+	}
+
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		first, _, _ := strings.Cut(proto, ",")
+		scheme = strings.TrimSpace(first)
+	}
+	if fwd := r.Header.Get("X-Forwarded-Host"); fwd != "" {
+		first, _, _ := strings.Cut(fwd, ",")
+		host = strings.TrimSpace(first)
+	}
+
+	return scheme + "://" + host + r.URL.RequestURI()
+}
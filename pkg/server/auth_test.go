@@ -0,0 +1,248 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/coocood/freecache"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+)
+
+const authPubKey = "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659"
+
+// authSignedAt is when the events of authEvents were signed, with the secret key of the first BIP-340 test vector.
+var authSignedAt = time.Unix(1700000000, 0)
+
+// authEvents are the base64 NIP-98 auth events of authPubKey, by method and URL.
+var authEvents = map[string]string{
+	"GET http://proxy.example/sites/https%3A%2F%2Fexample.com":  "eyJpZCI6IjRlOGVlMDg5MTM0Zjg4NTM4NzcwNzFkMGJiOTVlMDAzNTM5ZTU1YzcxODMwOWFjNDBlYzg5NGMyZTMyZDY5NjgiLCJwdWJrZXkiOiJkZmYxZDc3ZjJhNjcxYzVmMzYxODM3MjZkYjIzNDFiZTU4ZmVhZTFkYTJkZWNlZDg0MzI0MGY3YjUwMmJhNjU5IiwiY3JlYXRlZF9hdCI6MTcwMDAwMDAwMCwia2luZCI6MjcyMzUsInRhZ3MiOltbInUiLCJodHRwOi8vcHJveHkuZXhhbXBsZS9zaXRlcy9odHRwcyUzQSUyRiUyRmV4YW1wbGUuY29tIl0sWyJtZXRob2QiLCJHRVQiXV0sImNvbnRlbnQiOiIiLCJzaWciOiI5ODVmODAzZDk4NGQ0ODY0NTk3YWRlYTFlNDNlYzlhOTM0Y2ExMzJmMTAyMjBkYzg1ODA2M2M2Zjc5NmUzM2RmYjA5ZTAzODFmNTc5NmJjNDY0ODg4YTQxNmFiMTY5NDVlZWI1MzdlYjEyOTM5YTQ0ZDQ5NDdmMWM0MDE3ODAxNiJ9",
+	"POST http://proxy.example/sites/https%3A%2F%2Fexample.com": "eyJpZCI6IjMzMjk5ZWM2NTA1ZWNlMzM5ZjM1OGNmYmJiMzhlMTdlODc2YjNkNTg0ZTE0YzhjY2JjMmM4YjBhMjA1MGIxMjkiLCJwdWJrZXkiOiJkZmYxZDc3ZjJhNjcxYzVmMzYxODM3MjZkYjIzNDFiZTU4ZmVhZTFkYTJkZWNlZDg0MzI0MGY3YjUwMmJhNjU5IiwiY3JlYXRlZF9hdCI6MTcwMDAwMDAwMCwia2luZCI6MjcyMzUsInRhZ3MiOltbInUiLCJodHRwOi8vcHJveHkuZXhhbXBsZS9zaXRlcy9odHRwcyUzQSUyRiUyRmV4YW1wbGUuY29tIl0sWyJtZXRob2QiLCJQT1NUIl1dLCJjb250ZW50IjoiIiwic2lnIjoiMzY4OTY3NGRkYjk4MWE5NmNlNWE2MWI4N2YyOWUzZmEwMzY4ZTFlZWJlNDgwMzUxZGQzMGZjNTU2ZTQ1ZDIwZmM1MTE0MWFhYjU5YjcyMTQ0YWEwYTNmMDY1ZTg5OTFlOGJmYzBiZGU0ZjM3MDczZmIyMDNlMDIyYzMyZDcwNGQifQ==",
+	"GET http://proxy.example/sites/other":                      "eyJpZCI6ImVlYjJhZjFkOWU5MGMzMzZlZDIyMzA3MDQ4Y2RjMzVkMWEwN2M3YWY3N2U1MjAyMjE0NDU3MGY0OGExNWViNTEiLCJwdWJrZXkiOiJkZmYxZDc3ZjJhNjcxYzVmMzYxODM3MjZkYjIzNDFiZTU4ZmVhZTFkYTJkZWNlZDg0MzI0MGY3YjUwMmJhNjU5IiwiY3JlYXRlZF9hdCI6MTcwMDAwMDAwMCwia2luZCI6MjcyMzUsInRhZ3MiOltbInUiLCJodHRwOi8vcHJveHkuZXhhbXBsZS9zaXRlcy9vdGhlciJdLFsibWV0aG9kIiwiR0VUIl1dLCJjb250ZW50IjoiIiwic2lnIjoiZDJjM2ZiMjU2MzUwOTRkMDE1MjQzZjhlZDk1Y2YzYjJmMTNjMzgzODZhYWMzMDQ5ZTkyYTFlNmMxNDI1OWExNjVjYzAwYmIyZWI5ZDYxZTY0OGQ4MTQ5N2Y2MzNiMDYwYjliMmRiNDc4YmQzNmRkMGQ1MzJlN2E3YTJkMjNiM2MifQ==",
+}
+
+// nip98Header returns the NIP-98 Authorization header for a request to u with method.
+// The server does not sign events, so the tests use the events of authEvents.
+func nip98Header(t *testing.T, method, u string) string {
+	t.Helper()
+
+	event, ok := authEvents[method+" "+u]
+	if !ok {
+		t.Fatalf("no auth event for %s %s", method, u)
+	}
+
+	return "Nostr " + event
+}
+
+func TestNIP98AuthMiddleware(t *testing.T) {
+	const target = "http://proxy.example/sites/https%3A%2F%2Fexample.com"
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	type request struct {
+		auth         string
+		forwardedFor string
+		code         int
+	}
+
+	tests := []struct {
+		name     string
+		cfg      config.Config
+		requests []request
+	}{
+		{
+			name:     "off",
+			cfg:      config.Config{NIP98Auth: config.NIP98AuthOff},
+			requests: []request{{code: http.StatusOK}},
+		},
+		{
+			name: "required",
+			cfg:  config.Config{NIP98Auth: config.NIP98AuthRequired},
+			requests: []request{
+				{code: http.StatusUnauthorized},
+				{auth: "Nostr bm90IGFuIGV2ZW50", code: http.StatusUnauthorized},
+				{auth: nip98Header(t, http.MethodPost, target), code: http.StatusUnauthorized},
+				{auth: nip98Header(t, http.MethodGet, "http://proxy.example/sites/other"), code: http.StatusUnauthorized},
+				{auth: nip98Header(t, http.MethodGet, target), code: http.StatusOK},
+			},
+		},
+		{
+			name: "denied public key",
+			cfg:  config.Config{NIP98Auth: config.NIP98AuthRequired, NIP98DeniedPubKeys: []string{authPubKey}},
+			requests: []request{
+				{auth: nip98Header(t, http.MethodGet, target), code: http.StatusForbidden},
+			},
+		},
+		{
+			name: "public key not in the allow list",
+			cfg: config.Config{
+				NIP98Auth:           config.NIP98AuthRequired,
+				NIP98AllowedPubKeys: []string{"npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg"},
+			},
+			requests: []request{
+				{auth: nip98Header(t, http.MethodGet, target), code: http.StatusForbidden},
+			},
+		},
+		{
+			name: "public key rate limit",
+			cfg: config.Config{
+				NIP98Auth:           config.NIP98AuthRequired,
+				NIP98AllowedPubKeys: []string{authPubKey},
+				NIP98RateLimit:      2,
+			},
+			requests: []request{
+				{auth: nip98Header(t, http.MethodGet, target), code: http.StatusOK},
+				{auth: nip98Header(t, http.MethodGet, target), code: http.StatusOK},
+				{auth: nip98Header(t, http.MethodGet, target), code: http.StatusTooManyRequests},
+			},
+		},
+		{
+			name: "threshold",
+			cfg:  config.Config{NIP98Auth: config.NIP98AuthThreshold, NIP98AnonymousRateLimit: 2},
+			requests: []request{
+				{code: http.StatusOK},
+				{code: http.StatusOK},
+				{code: http.StatusUnauthorized},
+				{auth: nip98Header(t, http.MethodGet, target), code: http.StatusOK},
+				{auth: "Nostr bm90IGFuIGV2ZW50", code: http.StatusUnauthorized},
+			},
+		},
+		{
+			name: "threshold with spoofed forwarded addresses",
+			cfg:  config.Config{NIP98Auth: config.NIP98AuthThreshold, NIP98AnonymousRateLimit: 2},
+			requests: []request{
+				{forwardedFor: "198.51.100.1", code: http.StatusOK},
+				{forwardedFor: "198.51.100.2", code: http.StatusOK},
+				{forwardedFor: "198.51.100.3", code: http.StatusUnauthorized},
+			},
+		},
+		{
+			name: "threshold behind a trusted proxy",
+			cfg: config.Config{
+				NIP98Auth:               config.NIP98AuthThreshold,
+				NIP98AnonymousRateLimit: 1,
+				TrustedProxies:          []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+			},
+			requests: []request{
+				{forwardedFor: "198.51.100.1", code: http.StatusOK},
+				{forwardedFor: "198.51.100.2", code: http.StatusOK},
+				{forwardedFor: "198.51.100.1", code: http.StatusUnauthorized},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Logger = slog.Default()
+			// The auth events were signed at authSignedAt, accept them until now.
+			tt.cfg.NIP98TimeWindow = time.Since(authSignedAt) + time.Minute
+			handler := nip98AuthMiddleware(next, &tt.cfg)
+
+			for i, req := range tt.requests {
+				r := httptest.NewRequest(http.MethodGet, target, nil)
+				if req.auth != "" {
+					r.Header.Set("Authorization", req.auth)
+				}
+				if req.forwardedFor != "" {
+					r.Header.Set("X-Forwarded-For", req.forwardedFor)
+				}
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, r)
+
+				if rec.Code != req.code {
+					t.Fatalf("request %d status = %d, expected %d: %s", i, rec.Code, req.code, rec.Body)
+				}
+				if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") != "Nostr" {
+					t.Errorf("request %d WWW-Authenticate = %q, expected Nostr", i, rec.Header().Get("WWW-Authenticate"))
+				}
+				if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+					t.Errorf("request %d has no Retry-After header", i)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestURL(t *testing.T) {
+	// httptest requests come from 192.0.2.1.
+	trusted := []netip.Prefix{netip.MustParsePrefix("192.0.2.1/32")}
+
+	r := httptest.NewRequest(http.MethodGet, "http://internal:8080/sites/x?y=1", nil)
+	if got, expected := requestURL(r, "", trusted), "http://internal:8080/sites/x?y=1"; got != expected {
+		t.Errorf("requestURL() = %s, expected %s", got, expected)
+	}
+
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("X-Forwarded-Host", "proxy.example, internal")
+	if got, expected := requestURL(r, "", trusted), "https://proxy.example/sites/x?y=1"; got != expected {
+		t.Errorf("requestURL() behind a proxy = %s, expected %s", got, expected)
+	}
+	if got, expected := requestURL(r, "", nil), "http://internal:8080/sites/x?y=1"; got != expected {
+		t.Errorf("requestURL() from an untrusted address = %s, expected %s", got, expected)
+	}
+
+	if got, expected := requestURL(r, "https://jumble.example/proxy/", nil), "https://jumble.example/proxy/sites/x?y=1"; got != expected {
+		t.Errorf("requestURL() with a public URL = %s, expected %s", got, expected)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(2, time.Minute)
+	now := time.Now()
+
+	for i, expected := range []bool{true, true, false} {
+		if ok, _ := l.allow("a", now); ok != expected {
+			t.Errorf("allow() request %d = %v, expected %v", i, ok, expected)
+		}
+	}
+
+	if ok, _ := l.allow("b", now); !ok {
+		t.Errorf("allow() of another key = false, expected true")
+	}
+
+	if _, retryAfter := l.allow("a", now.Add(20*time.Second)); retryAfter != 40*time.Second {
+		t.Errorf("allow() retry after = %s, expected 40s", retryAfter)
+	}
+
+	if ok, _ := l.allow("a", now.Add(time.Minute)); !ok {
+		t.Errorf("allow() in the next window = false, expected true")
+	}
+}
+
+func TestNIP98AuthRoutes(t *testing.T) {
+	cfg := &config.Config{
+		Logger:    slog.Default(),
+		Cache:     freecache.NewCache(1024 * 1024),
+		NIP98Auth: config.NIP98AuthRequired,
+	}
+	handler := NewServer(cfg)
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{path: "/sites/https%3A%2F%2Fexample.com", code: http.StatusUnauthorized},
+		{path: "/nip05/bob@example.com", code: http.StatusUnauthorized},
+		{path: "/relay-info/wss%3A%2F%2Frelay.example", code: http.StatusUnauthorized},
+		{path: "/lnurl/bob@example.com", code: http.StatusUnauthorized},
+		// The image proxy is exempt, the private upstream is refused by the outbound client instead.
+		{path: "/img/http%3A%2F%2F127.0.0.1%2Fcat.png", code: http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.code {
+				t.Errorf("GET %s status = %d, expected %d: %s", tt.path, rec.Code, tt.code, rec.Body)
+			}
+		})
+	}
+}
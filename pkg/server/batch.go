@@ -0,0 +1,260 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+)
+
+// Defaults used when the batch settings are not configured.
+const (
+	defaultBatchMaxURLs     = 50
+	defaultBatchConcurrency = 8
+	defaultBatchItemTimeout = 10 * time.Second
+
+	// maxBatchBodyBytes caps the size of the POST /batch request body.
+	maxBatchBodyBytes = 1 << 20
+	// maxPreviewBodyBytes caps how much of an upstream page is read to find its metadata.
+	maxPreviewBodyBytes = 2 << 20
+)
+
+// batchRequest is the body of POST /batch.
+type batchRequest struct {
+	URLs []string `json:"urls"`
+}
+
+// batchResult is the outcome of one URL of a batch.
+type batchResult struct {
+	Index    int                 `json:"index"`
+	URL      string              `json:"url"`
+	Metadata *opengraph.Metadata `json:"metadata,omitempty"`
+	Error    string              `json:"error,omitempty"`
+}
+
+// batchHandler returns the preview metadata of several URLs, fetched concurrently.
+// Items fail independently: a failed URL carries an error while the others still return their metadata.
+// With "Accept: application/x-ndjson" results are streamed one per line, in completion order, as they arrive.
+func batchHandler(cfg *config.Config, client, gateway *http.Client, providers []provider) http.HandlerFunc {
+	maxURLs := orDefault(cfg.BatchMaxURLs, defaultBatchMaxURLs)
+	concurrency := orDefault(cfg.BatchConcurrency, defaultBatchConcurrency)
+	itemTimeout := cfg.BatchItemTimeout
+	if itemTimeout <= 0 {
+		itemTimeout = defaultBatchItemTimeout
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCORSHeaders(w, http.MethodPost)
+
+		var req batchRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBodyBytes)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid batch request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if len(req.URLs) == 0 {
+			http.Error(w, "the batch request has no urls", http.StatusBadRequest)
+			return
+		}
+
+		if len(req.URLs) > maxURLs {
+			http.Error(
+				w,
+				fmt.Sprintf("the batch request has %d urls, the limit is %d", len(req.URLs), maxURLs),
+				http.StatusRequestEntityTooLarge,
+			)
+			return
+		}
+
+		results := make(chan batchResult)
+		sem := make(chan struct{}, concurrency)
+
+		var wg sync.WaitGroup
+		for i, site := range req.URLs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				select {
+				case sem <- struct{}{}:
+				case <-r.Context().Done():
+					results <- batchResult{Index: i, URL: site, Error: r.Context().Err().Error()}
+					return
+				}
+				defer func() { <-sem }()
+
+				ctx, cancel := context.WithTimeout(r.Context(), itemTimeout)
+				defer cancel()
+
+				result := batchResult{Index: i, URL: site}
+				md, err := previewMetadata(ctx, cfg, client, gateway, providers, site)
+				if err != nil {
+					result.Error = err.Error()
+				} else {
+					result.Metadata = &md
+				}
+
+				results <- result
+			}()
+		}
+
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+
+		if wantsNDJSON(r) {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+
+			rc := http.NewResponseController(w)
+			enc := json.NewEncoder(w)
+			for result := range results {
+				enc.Encode(result)
+				rc.Flush()
+			}
+			return
+		}
+
+		all := make([]batchResult, len(req.URLs))
+		for result := range results {
+			all[result.Index] = result
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"results": all})
+	}
+}
+
+// preflightHandler answers the CORS preflight requests sent by browsers before POST /batch,
+// and before the requests to /sites/{site} carrying a NIP-98 Authorization header.
+func preflightHandler(method string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCORSHeaders(w, method)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// previewMetadata returns the preview metadata of site, using the same sources as /sites/{site}.
+func previewMetadata(
+	ctx context.Context,
+	cfg *config.Config,
+	client *http.Client,
+	gateway *http.Client,
+	providers []provider,
+	site string,
+) (opengraph.Metadata, error) {
+	site, onGateway, err := gatewaySite(cfg, site)
+	if err != nil {
+		return opengraph.Metadata{}, err
+	}
+
+	if p, u, ok := matchProvider(providers, site); ok && u.Scheme != "http" && u.Scheme != "https" {
+		// nostr: URIs and bare NIP-19 entities have no page to fall back to.
+		doc, _, err := providerPreview(ctx, cfg, p, u)
+		if err != nil {
+			return opengraph.Metadata{}, err
+		}
+		return opengraph.Parse(bytes.NewReader(doc), u)
+	}
+
+	u, err := url.Parse(site)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return opengraph.Metadata{}, errors.New("invalid url: only absolute http and https urls are supported")
+	}
+
+	if isGitHubURL(site) {
+		doc, _, err := githubPreview(ctx, cfg, site)
+		if err != nil {
+			return opengraph.Metadata{}, err
+		}
+		return opengraph.Parse(bytes.NewReader(doc), u)
+	}
+
+	if p, u, ok := matchProvider(providers, site); ok {
+		doc, _, err := providerPreview(ctx, cfg, p, u)
+		if err == nil {
+			return opengraph.Parse(bytes.NewReader(doc), u)
+		}
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return opengraph.Metadata{}, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, site, nil)
+	if err != nil {
+		return opengraph.Metadata{}, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	upstream := client
+	if onGateway {
+		upstream = gateway
+	}
+	resp, err := upstream.Do(req)
+	if err != nil {
+		return opengraph.Metadata{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return opengraph.Metadata{}, fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	}
+
+	if body, ok := feedBody(resp); ok {
+		head, err := feedHead(cfg, body, resp, site)
+		if err != nil {
+			return opengraph.Metadata{}, err
+		}
+		return head.Metadata(), nil
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "" &&
+		mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return opengraph.Metadata{}, fmt.Errorf("unsupported content type %s", mediaType)
+	}
+
+	head, err := opengraph.DecodeHead(
+		io.LimitReader(resp.Body, maxPreviewBodyBytes),
+		resp.Header.Get("Content-Type"),
+		resp.Request.URL,
+	)
+	if err != nil {
+		return opengraph.Metadata{}, err
+	}
+
+	applyOEmbed(ctx, cfg, client, site, &head)
+	applyFeed(ctx, cfg, client, site, &head)
+	proxyImages(cfg, &head)
+
+	md := head.Metadata()
+
+	if md.URL == "" {
+		md.URL = resp.Request.URL.String()
+	}
+
+	return md, nil
+}
+
+// wantsNDJSON reports whether the client asked for a streamed response.
+func wantsNDJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+}
+
+// orDefault returns v if it is positive, def otherwise.
+func orDefault(v, def int) int {
+	if v > 0 {
+		return v
+	}
+	return def
+}
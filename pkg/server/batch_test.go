@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+)
+
+func TestBatchHandler(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int64
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+
+		switch {
+		case r.URL.Path == "/missing":
+			http.NotFound(w, r)
+		case r.URL.Path == "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+		default:
+			time.Sleep(20 * time.Millisecond)
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprintf(w, `<html><head><title>Page %s</title>
+<meta property="og:image" content="/img%s.png"></head><body></body></html>`, r.URL.Path, r.URL.Path)
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		Logger:           slog.Default(),
+		BatchMaxURLs:     10,
+		BatchConcurrency: 2,
+		BatchItemTimeout: 200 * time.Millisecond,
+		// The upstream test server listens on the loopback interface.
+		AllowPrivateNetworks: true,
+	}
+
+	srv := httptest.NewServer(NewServer(cfg))
+	defer srv.Close()
+
+	urls := []string{
+		upstream.URL + "/a",
+		upstream.URL + "/missing",
+		upstream.URL + "/slow",
+		"ftp://example.com/file",
+		upstream.URL + "/b",
+		upstream.URL + "/c",
+	}
+
+	body, _ := json.Marshal(batchRequest{URLs: urls})
+
+	t.Run("json", func(t *testing.T) {
+		resp, err := http.Post(srv.URL+"/batch", "application/json", strings.NewReader(string(body)))
+		if err != nil {
+			t.Fatalf("Failed to post the batch: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		if resp.Header.Get("Access-Control-Allow-Origin") != "*" {
+			t.Fatalf("missing Access-Control-Allow-Origin header")
+		}
+
+		var out struct {
+			Results []batchResult `json:"results"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatalf("Failed to decode the batch response: %v", err)
+		}
+
+		if len(out.Results) != len(urls) {
+			t.Fatalf("expected %d results, got %d", len(urls), len(out.Results))
+		}
+
+		for i, result := range out.Results {
+			if result.Index != i || result.URL != urls[i] {
+				t.Errorf("result %d is out of order: %+v", i, result)
+			}
+		}
+
+		if md := out.Results[0].Metadata; md == nil || md.Title != "Page /a" || md.Image != upstream.URL+"/img/a.png" {
+			t.Errorf("unexpected metadata for /a: %+v", out.Results[0])
+		}
+		if !strings.Contains(out.Results[1].Error, "404") {
+			t.Errorf("expected a 404 error for /missing, got %+v", out.Results[1])
+		}
+		if out.Results[2].Error == "" {
+			t.Errorf("expected a timeout error for /slow, got %+v", out.Results[2])
+		}
+		if !strings.Contains(out.Results[3].Error, "invalid url") {
+			t.Errorf("expected an invalid url error, got %+v", out.Results[3])
+		}
+		if out.Results[4].Metadata == nil || out.Results[5].Metadata == nil {
+			t.Errorf("expected metadata after the failed items, got %+v", out.Results[4:])
+		}
+
+		if max := maxInFlight.Load(); max > int64(cfg.BatchConcurrency) {
+			t.Errorf("expected at most %d concurrent fetches, got %d", cfg.BatchConcurrency, max)
+		}
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/batch", strings.NewReader(string(body)))
+		req.Header.Set("Accept", "application/x-ndjson")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to post the batch: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Fatalf("expected an ndjson response, got %s", ct)
+		}
+
+		seen := map[int]bool{}
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var result batchResult
+			if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to decode the line %q: %v", scanner.Text(), err)
+			}
+			seen[result.Index] = true
+		}
+
+		if len(seen) != len(urls) {
+			t.Fatalf("expected %d streamed results, got %d", len(urls), len(seen))
+		}
+	})
+
+	t.Run("too many urls", func(t *testing.T) {
+		tooMany, _ := json.Marshal(batchRequest{URLs: make([]string, cfg.BatchMaxURLs+1)})
+		resp, err := http.Post(srv.URL+"/batch", "application/json", strings.NewReader(string(tooMany)))
+		if err != nil {
+			t.Fatalf("Failed to post the batch: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Fatalf("expected 413, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("private networks", func(t *testing.T) {
+		// Batched URLs go through the same guarded client as /sites/{site}.
+		strict := httptest.NewServer(NewServer(&config.Config{Logger: slog.Default()}))
+		defer strict.Close()
+
+		internal, _ := json.Marshal(batchRequest{URLs: []string{upstream.URL + "/a"}})
+		resp, err := http.Post(strict.URL+"/batch", "application/json", strings.NewReader(string(internal)))
+		if err != nil {
+			t.Fatalf("Failed to post the batch: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var out struct {
+			Results []batchResult `json:"results"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatalf("Failed to decode the batch response: %v", err)
+		}
+
+		if len(out.Results) != 1 || !strings.Contains(out.Results[0].Error, "not allowed") {
+			t.Errorf("expected the loopback upstream to be refused, got %+v", out.Results)
+		}
+	})
+}
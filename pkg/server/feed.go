@@ -0,0 +1,167 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+	"github.com/danvergara/jumble-proxy-server/pkg/feed"
+	"github.com/danvergara/jumble-proxy-server/pkg/logging"
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+)
+
+const (
+	// defaultFeedMaxBytes is used when cfg.FeedMaxBytes is not set.
+	defaultFeedMaxBytes = 5 << 20
+	// feedCacheTTL is how long, in seconds, the feeds discovered from pages are cached.
+	feedCacheTTL = 3600
+	// feedSniffBytes is how much of a generic XML response is read to find its root element.
+	feedSniffBytes = 4096
+)
+
+// feedBody reports whether the upstream response is a feed, either from its media type or,
+// for generic XML types, from its root element. It returns the reader the body must be read from,
+// which holds the sniffed bytes.
+func feedBody(resp *http.Response) (io.Reader, bool) {
+	contentType := resp.Header.Get("Content-Type")
+
+	switch {
+	case feed.IsFeedType(contentType):
+		return resp.Body, true
+	case feed.IsXMLType(contentType):
+		br := bufio.NewReaderSize(resp.Body, feedSniffBytes)
+		start, _ := br.Peek(feedSniffBytes)
+		return br, feed.Sniff(start)
+	default:
+		return resp.Body, false
+	}
+}
+
+// feedHead parses the feed read from body, the response to the request for site, and returns its preview.
+// The fragment of site may select an item of the feed.
+func feedHead(cfg *config.Config, body io.Reader, resp *http.Response, site string) (opengraph.Head, error) {
+	f, err := feed.Parse(io.LimitReader(body, feedMaxBytes(cfg)), resp.Request.URL)
+	if err != nil {
+		return opengraph.Head{}, err
+	}
+
+	u := *resp.Request.URL
+	if s, err := url.Parse(site); err == nil {
+		u.Fragment = s.Fragment
+	}
+
+	head := f.Head(&u)
+	proxyImages(cfg, &head)
+
+	return head, nil
+}
+
+// writeFeedPreview answers with the preview document of the feed read from body, instead of the raw XML.
+func writeFeedPreview(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	body io.Reader,
+	resp *http.Response,
+	site string,
+) {
+	logger := logging.FromContext(r.Context())
+
+	head, err := feedHead(cfg, body, resp, site)
+	if err != nil {
+		logger.Error("Error reading the upstream feed", slog.String("site", site), slog.Any("error", err))
+		http.Error(w, fmt.Sprintf("reading the upstream feed failed: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(resp.StatusCode)
+	if err := head.Render(w); err != nil {
+		logger.Error("Error writing the feed preview document", slog.Any("error", err))
+	}
+}
+
+// applyFeed completes the head of site with the RSS or Atom feed the page advertises, if any,
+// like the artwork and the audio file of a podcast episode. The feed is only fetched when the page
+// lacks an image, a description or a site name. Failures are logged and leave the head unchanged.
+func applyFeed(ctx context.Context, cfg *config.Config, client *http.Client, site string, head *opengraph.Head) {
+	logger := logging.FromContext(ctx)
+
+	md := head.Metadata()
+	if md.Image != "" && md.Description != "" && md.SiteName != "" {
+		return
+	}
+
+	feedURL, ok := head.Link("alternate", feed.TypeRSS)
+	if !ok {
+		if feedURL, ok = head.Link("alternate", feed.TypeAtom); !ok {
+			return
+		}
+	}
+
+	f, err := fetchFeed(ctx, cfg, client, feedURL, md.URL, site)
+	if err != nil {
+		logger.Warn(
+			"Failed to fetch the feed",
+			slog.String("site", site),
+			slog.String("feed", feedURL),
+			slog.Any("error", err),
+		)
+		return
+	}
+
+	f.Apply(head, site)
+}
+
+// fetchFeed returns the feed at feedURL with only the items that are the link of one of the pages at pageURLs,
+// from the cache if possible. Whole feeds, of up to feed.MaxItems items, would often not fit in a cache entry.
+func fetchFeed(
+	ctx context.Context,
+	cfg *config.Config,
+	client *http.Client,
+	feedURL string,
+	pageURLs ...string,
+) (feed.Feed, error) {
+	logger := logging.FromContext(ctx)
+	key := []byte("feed:" + feedURL + "\n" + strings.Join(pageURLs, "\n"))
+
+	if cfg.Cache != nil {
+		if cached, err := cfg.Cache.Get(key); err == nil {
+			var f feed.Feed
+			if err := json.Unmarshal(cached, &f); err == nil {
+				return f, nil
+			}
+		}
+	}
+
+	f, err := feed.Fetch(ctx, client, feedURL, feedMaxBytes(cfg))
+	if err != nil {
+		return f, err
+	}
+	f = f.ForPages(pageURLs...)
+
+	if cfg.Cache != nil {
+		if data, err := json.Marshal(f); err == nil {
+			if err := cfg.Cache.Set(key, data, feedCacheTTL); err != nil {
+				logger.Debug("Feed not stored in the cache", slog.String("feed", feedURL), slog.Any("error", err))
+			}
+		}
+	}
+
+	return f, nil
+}
+
+func feedMaxBytes(cfg *config.Config) int64 {
+	if cfg.FeedMaxBytes > 0 {
+		return cfg.FeedMaxBytes
+	}
+	return defaultFeedMaxBytes
+}
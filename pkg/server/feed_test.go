@@ -0,0 +1,206 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/coocood/freecache"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+)
+
+const testPodcastFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+<channel>
+	<title>Nostr Talks</title>
+	<link>https://podcast.example/</link>
+	<description>Conversations about Nostr.</description>
+	<itunes:image href="https://podcast.example/artwork.jpg"/>
+	<item>
+		<title>Relays</title>
+		<link>%[1]s/episodes/1</link>
+		<guid>ep-1</guid>
+		<pubDate>Mon, 02 Jun 2025 10:00:00 +0000</pubDate>
+		<description>All about relays.</description>
+		<enclosure url="https://cdn.example/ep1.mp3" type="audio/mpeg" length="1234"/>
+	</item>
+</channel>
+</rss>`
+
+func TestProxyHandlerFeed(t *testing.T) {
+	var feedRequests, bigFeedRequests atomic.Int32
+
+	var upstream *httptest.Server
+	upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.rss":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			fmt.Fprintf(w, testPodcastFeed, upstream.URL)
+		case "/feed.xml":
+			feedRequests.Add(1)
+			w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+			fmt.Fprintf(w, testPodcastFeed, upstream.URL)
+		case "/big.xml":
+			bigFeedRequests.Add(1)
+			w.Header().Set("Content-Type", "application/rss+xml")
+			fmt.Fprintf(w, `<rss version="2.0"><channel><title>Long Talks</title>
+<item><title>The big one</title><link>%s/episodes/big</link>
+<enclosure url="https://cdn.example/big.mp3" type="audio/mpeg"/></item>`, upstream.URL)
+			for i := range 99 {
+				fmt.Fprintf(w, `<item><title>Episode %d</title><link>%s/episodes/%d</link><description>%s</description></item>`,
+					i, upstream.URL, i, strings.Repeat("A long description. ", 20))
+			}
+			fmt.Fprint(w, `</channel></rss>`)
+		case "/episodes/big":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<html><head><title>The big one</title>
+<link rel="alternate" type="application/rss+xml" href="/big.xml">
+</head></html>`)
+		case "/sitemap.xml":
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<?xml version="1.0"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"></urlset>`)
+		case "/episodes/1":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<html><head><title>Relays | Nostr Talks</title>
+<link rel="alternate" type="application/rss+xml" href="/feed.xml">
+</head></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		Logger: slog.Default(),
+		Cache:  freecache.NewCache(1024 * 1024),
+		// The upstream test server listens on the loopback interface.
+		AllowPrivateNetworks: true,
+	}
+
+	srv := httptest.NewServer(NewServer(cfg))
+	defer srv.Close()
+
+	get := func(target string) (*http.Response, string) {
+		t.Helper()
+		resp, err := http.Get(fmt.Sprintf("%s/sites/%s", srv.URL, url.QueryEscape(target)))
+		if err != nil {
+			t.Fatalf("Failed to request the proxy: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	tests := []struct {
+		name     string
+		site     string
+		contains []string
+	}{
+		{
+			name: "rss",
+			site: upstream.URL + "/feed.rss",
+			contains: []string{
+				`<title>Nostr Talks</title>`,
+				`<meta property="og:image" content="https://podcast.example/artwork.jpg">`,
+				`Latest: Relays`,
+			},
+		},
+		{
+			name:     "sniffed xml",
+			site:     upstream.URL + "/feed.xml",
+			contains: []string{`<title>Nostr Talks</title>`},
+		},
+		{
+			name: "episode",
+			site: upstream.URL + "/feed.rss#ep-1",
+			contains: []string{
+				`<title>Relays</title>`,
+				`<meta property="og:audio" content="https://cdn.example/ep1.mp3">`,
+				`<meta property="og:type" content="music.song">`,
+			},
+		},
+		{
+			name: "enriched page",
+			site: upstream.URL + "/episodes/1",
+			contains: []string{
+				`<title>Relays | Nostr Talks</title>`,
+				`<meta property="og:description" content="All about relays.">`,
+				`<meta property="og:image" content="https://podcast.example/artwork.jpg">`,
+				`<meta property="og:audio" content="https://cdn.example/ep1.mp3">`,
+			},
+		},
+		{
+			name:     "cached feed",
+			site:     upstream.URL + "/episodes/1",
+			contains: []string{`<meta property="og:site_name" content="Nostr Talks">`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := get(tt.site)
+			if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/html; charset=utf-8" {
+				t.Fatalf("GET /sites/%s = %d %s, expected 200 text/html:\n%s",
+					tt.site, resp.StatusCode, resp.Header.Get("Content-Type"), body)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(body, want) {
+					t.Errorf("expected the document to contain %s, got:\n%s", want, body)
+				}
+			}
+		})
+	}
+
+	// The feed is fetched once by the sniffed request, and once for the enrichment, which is cached.
+	if n := feedRequests.Load(); n != 2 {
+		t.Errorf("expected 2 requests for the discovered feed, got %d", n)
+	}
+
+	// Feeds with many long items are cached for the page, with the episode it is the link of only.
+	for range 2 {
+		_, body := get(upstream.URL + "/episodes/big")
+		if !strings.Contains(body, `<meta property="og:audio" content="https://cdn.example/big.mp3">`) {
+			t.Errorf("expected the big feed to complete the page, got:\n%s", body)
+		}
+	}
+	if n := bigFeedRequests.Load(); n != 1 {
+		t.Errorf("expected 1 request for the big feed, got %d", n)
+	}
+
+	resp, body := get(upstream.URL + "/sitemap.xml")
+	if resp.Header.Get("Content-Type") != "application/xml" || !strings.Contains(body, "<urlset") {
+		t.Errorf("expected XML documents other than feeds to pass through, got %s: %s", resp.Header.Get("Content-Type"), body)
+	}
+
+	batchResp, err := http.Post(srv.URL+"/batch", "application/json",
+		strings.NewReader(`{"urls": ["`+upstream.URL+`/feed.rss"]}`))
+	if err != nil {
+		t.Fatalf("Failed to request the batch: %v", err)
+	}
+	defer batchResp.Body.Close()
+
+	var batch struct {
+		Results []struct {
+			Metadata struct {
+				Title string `json:"title"`
+				Image string `json:"image"`
+			} `json:"metadata"`
+			Error string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(batchResp.Body).Decode(&batch); err != nil {
+		t.Fatalf("Failed to decode the batch: %v", err)
+	}
+	if len(batch.Results) != 1 || batch.Results[0].Metadata.Title != "Nostr Talks" ||
+		batch.Results[0].Metadata.Image != "https://podcast.example/artwork.jpg" {
+		t.Errorf("batch results = %+v, expected the preview of the feed", batch.Results)
+	}
+}
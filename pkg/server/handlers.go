@@ -1,29 +1,50 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"mime"
 	"net/http"
-	"os"
+	"net/url"
 	"slices"
 	"strings"
 
 	"github.com/danvergara/jumble-proxy-server/pkg/config"
 	"github.com/danvergara/jumble-proxy-server/pkg/github"
+	"github.com/danvergara/jumble-proxy-server/pkg/logging"
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
 )
 
+// defaultHeadMaxBytes is used when cfg.HeadMaxBytes is not set.
+const defaultHeadMaxBytes = 1 << 20
+
 // proxyHandler adds headers to overcome the CORS errors for the Jumble Nostr client.
-func proxyHandler(cfg *config.Config) func(w http.ResponseWriter, r *http.Request) {
-	// Get token from environment variable
-	githubToken := os.Getenv("JUMBLE_PROXY_GITHUB_TOKEN")
+// Upstream requests go through client, which refuses to reach non-public addresses,
+// except for IPFS content, fetched from the configured gateway with gateway.
+// URLs handled by one of the providers are answered with the document it builds instead.
+func proxyHandler(
+	cfg *config.Config,
+	client *http.Client,
+	gateway *http.Client,
+	providers []provider,
+) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.FromContext(r.Context())
+
 		// add the paraters to fix CORS issues.
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		setCORSHeaders(w, http.MethodGet)
 
 		// get the site of interest from the path parameters.
-		site := r.PathValue("site")
+		// IPFS and IPNS links are fetched from the configured gateway.
+		site, onGateway, err := gatewaySite(cfg, r.PathValue("site"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		// Send request to the target site.
 		req, err := http.NewRequest(r.Method, site, r.Body)
@@ -34,75 +55,79 @@ func proxyHandler(cfg *config.Config) func(w http.ResponseWriter, r *http.Reques
 
 		// Check if the target URL is GitHub.
 		if isGitHubURL(site) {
-			gc := github.New(githubToken)
-
-			value, err := cfg.Cache.Get([]byte(site))
-			// The Get method returns not found error when the key does not exist in the cache.
+			doc, cached, err := githubPreview(r.Context(), cfg, site)
 			if err != nil {
-				resp, err := gc.GenerateGithubOpenGraph(r.Context(), site)
-				if err != nil {
-					http.Error(
-						w,
-						"Failed to generate the GitHub Open Graph HTML response",
-						http.StatusInternalServerError,
-					)
-					return
-				}
-
-				cfg.Logger.Info(
-					fmt.Sprintf("Fetch Open Graph data from the GitHub API for the site: %s", site),
-				)
-
-				// Stores the HTML file with the Open Graph data.
-				// Expire in 1 hour.
-				if err := cfg.Cache.Set([]byte(site), []byte(resp), 3600); err != nil {
-					cfg.Logger.Error(
-						fmt.Sprintf(
-							"Failed to store the html file in the cache from the site: %s",
-							site,
-						),
-					)
-				}
-
-				cfg.Logger.Info(
-					fmt.Sprintf(
-						"HTML document with Open Graph data from GitHub successfully stored in the cache for the %s site",
-						site,
-					),
+				http.Error(
+					w,
+					"Failed to generate the GitHub Open Graph HTML response",
+					http.StatusInternalServerError,
 				)
-
-				w.WriteHeader(http.StatusOK)
-				w.Write([]byte(resp))
 				return
 			}
 
-			cfg.Logger.Info(
-				fmt.Sprintf(
-					"HTML document with Open Graph data from Github found in cache for the %s site",
-					site,
-				),
-			)
+			if cached {
+				setCacheStatus(r.Context(), "hit")
+			} else {
+				setCacheStatus(r.Context(), "miss")
+			}
 
-			// Return the stored HTML document.
+			// Return the HTML document with the Open Graph data.
 			w.WriteHeader(http.StatusOK)
-			w.Write(value)
+			w.Write(doc)
 			return
 		}
 
-		// Copy headers from original request.
-		for header, values := range r.Header {
-			for _, value := range values {
+		if p, u, ok := matchProvider(providers, site); ok {
+			doc, cached, err := providerPreview(r.Context(), cfg, p, u)
+			switch {
+			case errors.Is(err, errors.ErrUnsupported):
+				// Fall through to the generic proxy.
+			case err != nil:
+				http.Error(w, fmt.Sprintf("building the preview failed: %v", err), http.StatusBadGateway)
+				return
+			default:
+				if cached {
+					setCacheStatus(r.Context(), "hit")
+				} else {
+					setCacheStatus(r.Context(), "miss")
+				}
+
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.Header().Set("X-Content-Type-Options", "nosniff")
+				w.WriteHeader(http.StatusOK)
+				w.Write(doc)
+				return
+			}
+		}
+
+		// Copy the content negotiation headers of the original request. Credentials, like cookies
+		// and the NIP-98 Authorization header, are meant for the proxy and never reach the upstream site.
+		for _, header := range forwardedHeaders {
+			for _, value := range r.Header.Values(header) {
 				req.Header.Add(header, value)
 			}
 		}
 
+		if !cfg.RawPassthrough {
+			// The head is parsed here, so let the transport negotiate and decode the compression,
+			// and always start from the beginning of the document.
+			req.Header.Del("Accept-Encoding")
+			req.Header.Del("Range")
+		}
+
 		// Perform the proxy request.
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		upstream := client
+		if onGateway {
+			upstream = gateway
+		}
+		resp, err := upstream.Do(req)
 		if err != nil {
 			// More detailed logging for debugging the 502 issue
-			cfg.Logger.Error(
-				fmt.Sprintf("Proxy error - URL: %s, Error: %v, Error Type: %T", site, err, err),
+			logger.Error(
+				"Proxy error",
+				slog.String("site", site),
+				slog.Any("error", err),
+				slog.String("error_type", fmt.Sprintf("%T", err)),
 			)
 			http.Error(w, fmt.Sprintf("proxy request failed: %v", err), http.StatusBadGateway)
 			return
@@ -113,12 +138,10 @@ func proxyHandler(cfg *config.Config) func(w http.ResponseWriter, r *http.Reques
 		if resp.StatusCode >= http.StatusBadRequest {
 			switch resp.StatusCode {
 			case http.StatusTooManyRequests:
-				cfg.Logger.Error(
-					fmt.Sprintf(
-						"Rate limit exceeded - URL: %s, Status: %d",
-						site,
-						resp.StatusCode,
-					),
+				logger.Error(
+					"Rate limit exceeded",
+					slog.String("site", site),
+					slog.Int("upstream_status", resp.StatusCode),
 				)
 				http.Error(
 					w,
@@ -127,12 +150,10 @@ func proxyHandler(cfg *config.Config) func(w http.ResponseWriter, r *http.Reques
 				)
 				return
 			case http.StatusForbidden:
-				cfg.Logger.Error(
-					fmt.Sprintf(
-						"Access denied - URL: %s, Status: %d",
-						site,
-						resp.StatusCode,
-					),
+				logger.Error(
+					"Access denied",
+					slog.String("site", site),
+					slog.Int("upstream_status", resp.StatusCode),
 				)
 				http.Error(
 					w,
@@ -141,12 +162,10 @@ func proxyHandler(cfg *config.Config) func(w http.ResponseWriter, r *http.Reques
 				)
 				return
 			case http.StatusServiceUnavailable:
-				cfg.Logger.Error(
-					fmt.Sprintf(
-						"Service unavailable - URL: %s, Status: %d",
-						site,
-						resp.StatusCode,
-					),
+				logger.Error(
+					"Service unavailable",
+					slog.String("site", site),
+					slog.Int("upstream_status", resp.StatusCode),
 				)
 				http.Error(
 					w,
@@ -155,19 +174,36 @@ func proxyHandler(cfg *config.Config) func(w http.ResponseWriter, r *http.Reques
 				)
 				return
 			default:
-				cfg.Logger.Error(
-					fmt.Sprintf(
-						"Proxy error - URL: %s, Status: %d",
-						site,
-						resp.StatusCode,
-					),
+				logger.Error(
+					"Proxy error",
+					slog.String("site", site),
+					slog.Int("upstream_status", resp.StatusCode),
 				)
 				http.Error(w, fmt.Sprintf("Request failed for site %s", site), resp.StatusCode)
 				return
 			}
 		}
 		// Log successful requests too, to see what's working
-		cfg.Logger.Info(fmt.Sprintf("Proxy success - URL: %s, Status: %d", site, resp.StatusCode))
+		logger.Debug(
+			"Proxy success",
+			slog.String("site", site),
+			slog.Int("upstream_status", resp.StatusCode),
+		)
+
+		if !cfg.RawPassthrough && isHTMLResponse(resp) {
+			writeHeadOnly(w, r, cfg, client, resp)
+			return
+		}
+
+		body := io.Reader(resp.Body)
+		if !cfg.RawPassthrough {
+			var isFeed bool
+			if body, isFeed = feedBody(resp); isFeed {
+				writeFeedPreview(w, r, cfg, body, resp, site)
+				return
+			}
+		}
+
 		// Copy the response headers.
 		for header, values := range resp.Header {
 			for _, value := range values {
@@ -181,15 +217,148 @@ func proxyHandler(cfg *config.Config) func(w http.ResponseWriter, r *http.Reques
 
 		// Set the status code and write the response body.
 		w.WriteHeader(resp.StatusCode)
-		_, err = io.Copy(w, resp.Body)
+		_, err = io.Copy(w, body)
 		if err != nil {
-			cfg.Logger.Error(fmt.Sprintf("Error copying response body: %v", err))
+			logger.Error("Error copying response body", slog.Any("error", err))
 		}
 	}
 }
 
-func isGitHubURL(url string) bool {
-	return strings.Contains(strings.ToLower(url), "github.com") ||
-		strings.Contains(strings.ToLower(url), "api.github.com") ||
-		strings.Contains(strings.ToLower(url), "gist.github.com")
+// writeHeadOnly answers with a sanitized document holding only the preview elements of the upstream head.
+// The upstream page is read until the end of its head or cfg.HeadMaxBytes, whichever comes first,
+// and transcoded to UTF-8 from the charset it declares. The oEmbed data of the page, if any, is merged into the head,
+// and the feed it advertises fills in what the head lacks.
+func writeHeadOnly(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	client *http.Client,
+	resp *http.Response,
+) {
+	logger := logging.FromContext(r.Context())
+
+	maxBytes := cfg.HeadMaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultHeadMaxBytes
+	}
+
+	head, err := opengraph.DecodeHead(
+		io.LimitReader(resp.Body, maxBytes),
+		resp.Header.Get("Content-Type"),
+		resp.Request.URL,
+	)
+	if err != nil {
+		logger.Error("Error reading the head of the upstream page", slog.Any("error", err))
+		http.Error(w, fmt.Sprintf("reading the upstream page failed: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	applyOEmbed(r.Context(), cfg, client, r.PathValue("site"), &head)
+	applyFeed(r.Context(), cfg, client, r.PathValue("site"), &head)
+	proxyImages(cfg, &head)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(resp.StatusCode)
+	if err := head.Render(w); err != nil {
+		logger.Error("Error writing the head-only document", slog.Any("error", err))
+	}
+}
+
+// isHTMLResponse reports whether the upstream response is an HTML page.
+// Responses without a Content-Type are assumed to be HTML.
+func isHTMLResponse(resp *http.Response) bool {
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// githubPreview returns the HTML document with the Open Graph data of a GitHub URL,
+// from the cache if possible, and reports whether it came from the cache.
+func githubPreview(ctx context.Context, cfg *config.Config, site string) ([]byte, bool, error) {
+	logger := logging.FromContext(ctx)
+
+	// The Get method returns not found error when the key does not exist in the cache.
+	if value, err := cfg.Cache.Get([]byte(site)); err == nil {
+		logger.Debug(
+			"HTML document with Open Graph data from Github found in cache",
+			slog.String("site", site),
+		)
+		return value, true, nil
+	}
+
+	gc := github.New(cfg.GitHubToken)
+
+	head, err := gc.Preview(ctx, site)
+	if err != nil {
+		logger.Error(
+			"Failed to generate the GitHub Open Graph HTML response",
+			slog.String("site", site),
+			slog.Any("error", err),
+		)
+		return nil, false, err
+	}
+
+	logger.Info("Fetch Open Graph data from the GitHub API", slog.String("site", site))
+
+	proxyImages(cfg, &head)
+
+	var doc bytes.Buffer
+	if err := head.Render(&doc); err != nil {
+		return nil, false, err
+	}
+
+	// Stores the HTML file with the Open Graph data.
+	// Expire in 1 hour.
+	if err := cfg.Cache.Set([]byte(site), doc.Bytes(), 3600); err != nil {
+		logger.Error(
+			"Failed to store the html file in the cache",
+			slog.String("site", site),
+			slog.Any("error", err),
+		)
+	} else {
+		logger.Debug(
+			"HTML document with Open Graph data from GitHub successfully stored in the cache",
+			slog.String("site", site),
+		)
+	}
+
+	return doc.Bytes(), false, nil
+}
+
+// setCORSHeaders adds the headers to overcome the CORS errors for the Jumble Nostr client.
+func setCORSHeaders(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+}
+
+// forwardedHeaders are the request headers copied onto the upstream request.
+var forwardedHeaders = []string{
+	"Accept",
+	"Accept-Language",
+	"Accept-Encoding",
+	"Range",
+	"User-Agent",
+	"If-None-Match",
+	"If-Modified-Since",
+}
+
+// isGitHubURL reports whether rawURL is on github.com or one of its subdomains, like gist.github.com.
+// URLs of other sites merely containing github.com, like pkg.go.dev/github.com/..., are not.
+func isGitHubURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	return host == "github.com" || strings.HasSuffix(host, ".github.com")
 }
@@ -0,0 +1,477 @@
+package server
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/coocood/freecache"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+)
+
+const trackedPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="0; url=https://evil.example">
+<title>Tracked &amp; heavy page</title>
+<script>window.tracker = new Tracker();</script>
+<link rel="stylesheet" href="/app.css">
+<link rel="icon" href="/favicon.ico">
+<link rel="canonical" href="https://example.com/article">
+<link rel="alternate" type="application/json+oembed" href="/oembed?url=article">
+<link rel="icon" href="javascript:alert(1)">
+<meta property="og:title" content="The &quot;article&quot;">
+<meta property="og:image" content="/cover.png" onload="alert(1)">
+<style>body { color: red }</style>
+</head>
+<body>
+<h1>Megabytes of body</h1>
+<script src="/bundle.js"></script>
+</body>
+</html>`
+
+func TestProxyHandlerHeadOnly(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/endless":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html><head><title>Endless</title><script>")
+			fmt.Fprint(w, strings.Repeat("x", 64*1024))
+		case "/legacy":
+			w.Header().Set("Content-Type", "text/html")
+			http.ServeFile(w, r, "../opengraph/testdata/shift_jis.html")
+		case "/data.json":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"ok":true}`)
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Set-Cookie", "tracking=1")
+			fmt.Fprint(w, trackedPage)
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		Logger:       slog.Default(),
+		HeadMaxBytes: 16 * 1024,
+		// The upstream test server listens on the loopback interface.
+		AllowPrivateNetworks: true,
+	}
+
+	srv := httptest.NewServer(NewServer(cfg))
+	defer srv.Close()
+
+	get := func(target string) (*http.Response, string) {
+		t.Helper()
+		resp, err := http.Get(fmt.Sprintf("%s/sites/%s", srv.URL, url.QueryEscape(target)))
+		if err != nil {
+			t.Fatalf("Failed to request the proxy: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, body := get(upstream.URL + "/article")
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("missing Access-Control-Allow-Origin header")
+	}
+	if resp.Header.Get("Set-Cookie") != "" {
+		t.Errorf("upstream cookies must not be forwarded")
+	}
+
+	for _, want := range []string{
+		`<title>Tracked &amp; heavy page</title>`,
+		`<meta property="og:title" content="The &#34;article&#34;">`,
+		`<meta property="og:image" content="` + upstream.URL + `/cover.png">`,
+		`<link rel="icon" href="` + upstream.URL + `/favicon.ico">`,
+		`<link rel="canonical" href="https://example.com/article">`,
+		`<link rel="alternate" href="` + upstream.URL + `/oembed?url=article" type="application/json+oembed">`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected the document to contain %s, got:\n%s", want, body)
+		}
+	}
+
+	for _, unwanted := range []string{"script", "tracker", "stylesheet", "refresh", "javascript:", "onload", "Megabytes", "color: red"} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("expected %q to be stripped, got:\n%s", unwanted, body)
+		}
+	}
+
+	// Looks like a fediverse profile, but the upstream does not speak ActivityPub.
+	resp, body = get(upstream.URL + "/@someone")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "<title>Tracked &amp; heavy page</title>") {
+		t.Errorf("expected pages declined by the providers to be proxied, got %d:\n%s", resp.StatusCode, body)
+	}
+
+	resp, body = get(upstream.URL + "/endless")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "<title>Endless") || strings.Contains(body, "xxx") {
+		t.Errorf("expected the head to be cut at the byte budget, got %d:\n%s", resp.StatusCode, body)
+	}
+
+	resp, body = get(upstream.URL + "/legacy")
+	if resp.Header.Get("Content-Type") != "text/html; charset=utf-8" ||
+		!strings.Contains(body, `<meta charset="utf-8">`) || !strings.Contains(body, "<title>日本語のページ</title>") {
+		t.Errorf("expected the Shift_JIS page to be transcoded to UTF-8, got %s:\n%s", resp.Header.Get("Content-Type"), body)
+	}
+
+	resp, body = get(upstream.URL + "/data.json")
+	if resp.Header.Get("Content-Type") != "application/json" || body != `{"ok":true}` {
+		t.Errorf("expected non HTML responses to pass through, got %s: %s", resp.Header.Get("Content-Type"), body)
+	}
+}
+
+func TestProxyHandlerOEmbed(t *testing.T) {
+	var oembedRequests atomic.Int32
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		oembedRequests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{
+			"version": "1.0",
+			"type": "video",
+			"title": "Video for %s",
+			"author_name": "Channel",
+			"provider_name": "FakeTube",
+			"thumbnail_url": "https://img.example/thumb.jpg",
+			"thumbnail_width": 480,
+			"thumbnail_height": 360,
+			"html": "<iframe src=\"https://evil.example\"></iframe>"
+		}`, r.URL.Query().Get("url"))
+	}))
+	defer provider.Close()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		switch r.URL.Path {
+		case "/discovered":
+			fmt.Fprintf(w, `<html><head><title>Blog post</title>
+<link rel="alternate" type="application/json+oembed" href="%s/oembed?url=discovered">
+</head></html>`, provider.URL)
+		default:
+			fmt.Fprint(w, `<html><head><title>Before you continue</title>
+<meta property="og:title" content="Before you continue"></head></html>`)
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		Logger: slog.Default(),
+		Cache:  freecache.NewCache(1024 * 1024),
+		OEmbedProviders: []config.OEmbedProvider{{
+			Name:     "FakeTube",
+			Endpoint: provider.URL + "/oembed",
+			Schemes:  []string{strings.Replace(upstream.URL, "http://", "https://", 1) + "/watch*"},
+		}},
+		// The test servers listen on the loopback interface.
+		AllowPrivateNetworks: true,
+	}
+
+	srv := httptest.NewServer(NewServer(cfg))
+	defer srv.Close()
+
+	get := func(target string) string {
+		t.Helper()
+		resp, err := http.Get(fmt.Sprintf("%s/sites/%s", srv.URL, url.QueryEscape(target)))
+		if err != nil {
+			t.Fatalf("Failed to request the proxy: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		title string
+	}{
+		{"discovered", "/discovered", "Video for discovered"},
+		{"provider table", "/watch?v=abc", "Video for " + upstream.URL + "/watch?v=abc"},
+		{"cached", "/watch?v=abc", "Video for " + upstream.URL + "/watch?v=abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := get(upstream.URL + tt.path)
+
+			for _, want := range []string{
+				`<meta property="og:title" content="` + html.EscapeString(tt.title) + `">`,
+				`<meta name="author" content="Channel">`,
+				`<meta property="og:image" content="https://img.example/thumb.jpg">`,
+				`<meta property="og:image:width" content="480">`,
+				`<meta property="oembed:type" content="video">`,
+			} {
+				if !strings.Contains(body, want) {
+					t.Errorf("expected the document to contain %s, got:\n%s", want, body)
+				}
+			}
+
+			if strings.Contains(body, "Before you continue\">") || strings.Contains(body, "iframe") {
+				t.Errorf("expected the oEmbed data to replace the page title and drop the html, got:\n%s", body)
+			}
+		})
+	}
+
+	if n := oembedRequests.Load(); n != 2 {
+		t.Errorf("expected 2 oEmbed requests, got %d", n)
+	}
+
+	if body := get(upstream.URL + "/other"); !strings.Contains(body, "Before you continue") || strings.Contains(body, "oembed:type") {
+		t.Errorf("expected pages without oEmbed to be left alone, got:\n%s", body)
+	}
+}
+
+func TestProxyHandlerProvider(t *testing.T) {
+	var requests atomic.Int32
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"type": "video", "version": "1.0", "title": "A <b>video</b>", "author_name": "Channel",
+			"thumbnail_url": "https://i.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg"}`)
+	}))
+	defer fake.Close()
+
+	cfg := &config.Config{
+		Logger:           slog.Default(),
+		Cache:            freecache.NewCache(1024 * 1024),
+		YouTubeOEmbedURL: fake.URL + "/oembed",
+		// The fake YouTube listens on the loopback interface.
+		AllowPrivateNetworks: true,
+	}
+
+	srv := httptest.NewServer(NewServer(cfg))
+	defer srv.Close()
+
+	for range 2 {
+		resp, err := http.Get(srv.URL + "/sites/" + url.QueryEscape("https://youtu.be/dQw4w9WgXcQ?t=42"))
+		if err != nil {
+			t.Fatalf("Failed to request the proxy: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/html; charset=utf-8" {
+			t.Fatalf("expected a 200 HTML response, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+
+		for _, want := range []string{
+			`<title>A &lt;b&gt;video&lt;/b&gt;</title>`,
+			`<meta property="og:title" content="A &lt;b&gt;video&lt;/b&gt;">`,
+			`<meta property="og:video:url" content="https://www.youtube.com/embed/dQw4w9WgXcQ?start=42">`,
+			`<meta name="author" content="Channel">`,
+		} {
+			if !strings.Contains(string(body), want) {
+				t.Errorf("expected the document to contain %s, got:\n%s", want, body)
+			}
+		}
+	}
+
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected the second preview to come from the cache, got %d upstream requests", n)
+	}
+}
+
+func TestProxyHandlerProxiedImages(t *testing.T) {
+	var upstream *httptest.Server
+	upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/youtube/oembed":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"type": "video", "version": "1.0", "title": "A video",
+				"thumbnail_url": "https://i.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg"}`)
+		case "/feed.rss":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			fmt.Fprintf(w, testPodcastFeed, upstream.URL)
+		case "/proxied":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<html><head><title>Proxied</title>
+<meta property="og:image" content="https://proxy.example/img/https%3A%2F%2Fcdn.example%2Fa.png">
+</head></html>`)
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, trackedPage)
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		Logger:           slog.Default(),
+		Cache:            freecache.NewCache(1024 * 1024),
+		PublicURL:        "https://proxy.example/",
+		YouTubeOEmbedURL: upstream.URL + "/youtube/oembed",
+		// The upstream test server listens on the loopback interface.
+		AllowPrivateNetworks: true,
+	}
+
+	srv := httptest.NewServer(NewServer(cfg))
+	defer srv.Close()
+
+	proxied := func(image string) string {
+		return html.EscapeString("https://proxy.example/img/" + url.PathEscape(image) + previewImageQuery)
+	}
+
+	tests := []struct {
+		name string
+		site string
+		want []string
+	}{
+		{
+			name: "head only",
+			site: upstream.URL + "/article",
+			want: []string{`<meta property="og:image" content="` + proxied(upstream.URL+"/cover.png") + `">`},
+		},
+		{
+			name: "provider",
+			site: "https://youtu.be/dQw4w9WgXcQ",
+			want: []string{`<meta property="og:image" content="` + proxied("https://i.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg") + `">`},
+		},
+		{
+			name: "feed",
+			site: upstream.URL + "/feed.rss",
+			want: []string{`<meta property="og:image" content="` + proxied("https://podcast.example/artwork.jpg") + `">`},
+		},
+		{
+			name: "already proxied",
+			site: upstream.URL + "/proxied",
+			want: []string{`<meta property="og:image" content="https://proxy.example/img/https%3A%2F%2Fcdn.example%2Fa.png">`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + "/sites/" + url.QueryEscape(tt.site))
+			if err != nil {
+				t.Fatalf("Failed to request the proxy: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected 200, got %d:\n%s", resp.StatusCode, body)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(body), want) {
+					t.Errorf("expected the document to contain %s, got:\n%s", want, body)
+				}
+			}
+		})
+	}
+}
+
+func TestProxyHandlerNotFediverse(t *testing.T) {
+	var requests atomic.Int32
+	blog := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head><title>A blog</title></head></html>")
+	}))
+	defer blog.Close()
+
+	cfg := &config.Config{
+		Logger: slog.Default(),
+		Cache:  freecache.NewCache(1024 * 1024),
+		// The blog test server listens on the loopback interface.
+		AllowPrivateNetworks: true,
+	}
+
+	srv := httptest.NewServer(NewServer(cfg))
+	defer srv.Close()
+
+	// The first profile-like URL costs an ActivityPub and a Mastodon API request before the page itself,
+	// the next ones on the same host only the page.
+	for i, expected := range []int32{3, 1} {
+		before := requests.Load()
+
+		resp, err := http.Get(srv.URL + "/sites/" + url.QueryEscape(fmt.Sprintf("%s/@author%d", blog.URL, i)))
+		if err != nil {
+			t.Fatalf("Failed to request the proxy: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "<title>A blog</title>") {
+			t.Fatalf("expected the page to be proxied, got %d:\n%s", resp.StatusCode, body)
+		}
+		if n := requests.Load() - before; n != expected {
+			t.Errorf("request %d cost %d upstream requests, expected %d", i, n, expected)
+		}
+	}
+}
+
+func TestIsGitHubURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected bool
+	}{
+		{url: "https://github.com/danvergara/jumble-proxy-server", expected: true},
+		{url: "https://gist.github.com/octo/abc123", expected: true},
+		{url: "https://api.github.com/repos/octo/repo", expected: true},
+		{url: "https://pkg.go.dev/github.com/google/go-github/v74/github", expected: false},
+		{url: "https://example.com/?ref=github.com", expected: false},
+		{url: "https://notgithub.com/octo", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := isGitHubURL(tt.url); got != tt.expected {
+				t.Errorf("isGitHubURL() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestProxyHandlerRequestHeaders(t *testing.T) {
+	var received http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><title>Headers</title></head></html>`)
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		Logger: slog.Default(),
+		// The upstream test server listens on the loopback interface.
+		AllowPrivateNetworks: true,
+	}
+
+	srv := httptest.NewServer(NewServer(cfg))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/sites/"+url.QueryEscape(upstream.URL+"/"), nil)
+	req.Header.Set("Accept-Language", "de")
+	req.Header.Set("User-Agent", "jumble-test")
+	req.Header.Set("Authorization", "Nostr eyJraW5kIjoyNzIzNX0=")
+	req.Header.Set("Cookie", "session=secret")
+	req.Header.Set("Proxy-Authorization", "Basic c2VjcmV0")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to request the proxy: %v", err)
+	}
+	resp.Body.Close()
+
+	if received.Get("Accept-Language") != "de" || received.Get("User-Agent") != "jumble-test" {
+		t.Errorf("expected the content negotiation headers to be forwarded, got %v", received)
+	}
+	for _, header := range []string{"Authorization", "Cookie", "Proxy-Authorization", "X-Forwarded-For"} {
+		if v := received.Get(header); v != "" {
+			t.Errorf("expected %s not to be forwarded, got %q", header, v)
+		}
+	}
+}
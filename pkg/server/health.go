@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+	"github.com/danvergara/jumble-proxy-server/pkg/github"
+	"github.com/danvergara/jumble-proxy-server/pkg/version"
+)
+
+// githubCheckInterval is how long the result of the GitHub token check is reused,
+// so frequent readiness probes do not consume the API rate limit.
+const githubCheckInterval = time.Minute
+
+// readiness tracks whether the server should receive traffic.
+type readiness struct {
+	cfg          *config.Config
+	shuttingDown atomic.Bool
+	// githubCheck is nil when no GitHub token is configured, in which case the check is skipped.
+	githubCheck func(ctx context.Context) error
+
+	mu              sync.Mutex
+	githubErr       error
+	githubCheckedAt time.Time
+	githubChecking  bool
+}
+
+func newReadiness(cfg *config.Config) *readiness {
+	rd := &readiness{cfg: cfg}
+	if cfg.GitHubToken != "" {
+		rd.githubCheck = func(ctx context.Context) error {
+			return github.New(cfg.GitHubToken).CheckRateLimit(ctx)
+		}
+	}
+
+	return rd
+}
+
+// checkGitHub runs the GitHub check at most once per githubCheckInterval.
+// The API call is made without holding the lock, and concurrent probes get the last result meanwhile.
+func (rd *readiness) checkGitHub(ctx context.Context) error {
+	rd.mu.Lock()
+	fresh := !rd.githubCheckedAt.IsZero() && time.Since(rd.githubCheckedAt) < githubCheckInterval
+	if fresh || rd.githubChecking {
+		err := rd.githubErr
+		rd.mu.Unlock()
+		return err
+	}
+	rd.githubChecking = true
+	check := rd.githubCheck
+	rd.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	err := check(ctx)
+
+	rd.mu.Lock()
+	rd.githubErr = err
+	rd.githubCheckedAt = time.Now()
+	rd.githubChecking = false
+	rd.mu.Unlock()
+
+	return err
+}
+
+// refresh keeps the GitHub check warm in the background until ctx is cancelled,
+// so readiness probes do not wait on the GitHub API.
+func (rd *readiness) refresh(ctx context.Context) {
+	if rd.githubCheck == nil {
+		return
+	}
+
+	ticker := time.NewTicker(githubCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		rd.mu.Lock()
+		rd.githubCheckedAt = time.Time{}
+		rd.mu.Unlock()
+		rd.checkGitHub(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check runs every readiness check and returns the outcome of each one.
+func (rd *readiness) check(ctx context.Context) (map[string]string, bool) {
+	checks := map[string]string{}
+	ready := true
+
+	record := func(name string, err error) {
+		if err != nil {
+			checks[name] = err.Error()
+			ready = false
+			return
+		}
+		checks[name] = "ok"
+	}
+
+	record("config", rd.cfg.Validate())
+
+	if rd.cfg.Cache == nil {
+		record("cache", errors.New("cache is not initialized"))
+	} else {
+		record("cache", nil)
+	}
+
+	if rd.githubCheck == nil {
+		checks["github"] = "skipped: no token configured"
+	} else {
+		record("github", rd.checkGitHub(ctx))
+	}
+
+	if rd.shuttingDown.Load() {
+		record("shutdown", errors.New("server is shutting down"))
+	} else {
+		record("shutdown", nil)
+	}
+
+	return checks, ready
+}
+
+// healthzHandler reports that the process is alive.
+func healthzHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok\n"))
+	}
+}
+
+// readyzHandler reports whether the server is ready to receive traffic.
+func readyzHandler(rd *readiness) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		checks, ready := rd.check(r.Context())
+
+		status := "ok"
+		code := http.StatusOK
+		if !ready {
+			status = "unavailable"
+			code = http.StatusServiceUnavailable
+		}
+
+		writeJSON(w, code, map[string]any{
+			"status": status,
+			"checks": checks,
+		})
+	}
+}
+
+// versionHandler returns the build information of the running binary.
+func versionHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, version.Get())
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+	"github.com/danvergara/jumble-proxy-server/pkg/imageproxy"
+	"github.com/danvergara/jumble-proxy-server/pkg/logging"
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+)
+
+// Defaults used when the image proxy limits are not configured.
+const (
+	defaultImageMaxBytes  = 10 << 20
+	defaultImageMaxPixels = 50_000_000
+
+	// imageCacheTTL is how long, in seconds, transformed images are kept in the cache.
+	imageCacheTTL = 24 * 3600
+
+	// previewImageQuery bounds the images of previews rewritten through the image proxy to the size of a large card.
+	previewImageQuery = "?w=1200&h=630&fit=contain"
+)
+
+// imageHandler fetches an image through the outbound client, resizes and re-encodes it,
+// so clients never contact the third party hosting the image.
+func imageHandler(cfg *config.Config, client *http.Client) http.HandlerFunc {
+	maxBytes := cfg.ImageMaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultImageMaxBytes
+	}
+
+	maxPixels := cfg.ImageMaxPixels
+	if maxPixels <= 0 {
+		maxPixels = defaultImageMaxPixels
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.FromContext(r.Context())
+
+		setCORSHeaders(w, http.MethodGet)
+
+		raw := r.PathValue("url")
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			http.Error(w, "invalid url: only absolute http and https urls are supported", http.StatusBadRequest)
+			return
+		}
+
+		opts, err := imageproxy.ParseOptions(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		key := []byte(fmt.Sprintf("img:%d:%d:%s:%s:%d:%s",
+			opts.Width, opts.Height, opts.Fit, opts.Format, opts.Quality, raw))
+
+		if value, err := cfg.Cache.Get(key); err == nil {
+			setCacheStatus(r.Context(), "hit")
+			contentType, data, _ := bytes.Cut(value, []byte("\n"))
+			writeImage(w, string(contentType), data)
+			return
+		}
+
+		setCacheStatus(r.Context(), "miss")
+
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, raw, nil)
+		if err != nil {
+			http.Error(w, "Failed to create request", http.StatusInternalServerError)
+			return
+		}
+		req.Header.Set("Accept", "image/png,image/jpeg,image/gif,image/webp")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			logger.Error("Image proxy error", slog.String("url", raw), slog.Any("error", err))
+			http.Error(w, fmt.Sprintf("image request failed: %v", err), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			http.Error(
+				w,
+				fmt.Sprintf("image request failed with status %d", resp.StatusCode),
+				http.StatusBadGateway,
+			)
+			return
+		}
+
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("reading image failed: %v", err), http.StatusBadGateway)
+			return
+		}
+		if int64(len(data)) > maxBytes {
+			http.Error(
+				w,
+				fmt.Sprintf("image is larger than %d bytes", maxBytes),
+				http.StatusRequestEntityTooLarge,
+			)
+			return
+		}
+
+		out, contentType, err := imageproxy.Transform(data, opts, maxPixels)
+		if err != nil {
+			code := http.StatusUnprocessableEntity
+			switch {
+			case errors.Is(err, imageproxy.ErrUnsupportedType):
+				code = http.StatusUnsupportedMediaType
+			case errors.Is(err, imageproxy.ErrTooManyPixels):
+				code = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+
+		value := append([]byte(contentType+"\n"), out...)
+		if err := cfg.Cache.Set(key, value, imageCacheTTL); err != nil {
+			// Large images do not fit in a cache entry, they are served without being cached.
+			logger.Debug("Image not stored in the cache", slog.String("url", raw), slog.Any("error", err))
+		}
+
+		writeImage(w, contentType, out)
+	}
+}
+
+func writeImage(w http.ResponseWriter, contentType string, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// proxyImages rewrites the absolute image URLs of head through the image proxy,
+// so clients loading the preview never contact the third parties hosting the images.
+// The head is left as is when cfg.PublicURL is not set.
+func proxyImages(cfg *config.Config, head *opengraph.Head) {
+	prefix := imageProxyURL(cfg)
+	if prefix == "" {
+		return
+	}
+
+	head.RewriteImages(func(image string) string {
+		if strings.HasPrefix(image, prefix) || opengraph.HTTPURL(image) == "" {
+			return image
+		}
+		return prefix + url.PathEscape(image) + previewImageQuery
+	})
+}
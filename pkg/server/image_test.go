@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/coocood/freecache"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+)
+
+func TestImageHandler(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 1200, 630))
+	for x := range 1200 {
+		img.Set(x, 10, color.White)
+	}
+
+	var pngBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, img); err != nil {
+		t.Fatalf("Failed to encode the PNG: %v", err)
+	}
+
+	var fetches atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		switch r.URL.Path {
+		case "/og.png":
+			// The declared content type is wrong on purpose, the proxy must sniff it.
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(pngBuf.Bytes())
+		default:
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("<html><script>alert(1)</script></html>"))
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{
+		Logger: slog.Default(),
+		Cache:  freecache.NewCache(100 * 1024 * 1024),
+		// The upstream test server listens on the loopback interface.
+		AllowPrivateNetworks: true,
+	}
+
+	srv := httptest.NewServer(NewServer(cfg))
+	defer srv.Close()
+
+	get := func(target, query string) *http.Response {
+		t.Helper()
+		resp, err := http.Get(fmt.Sprintf("%s/img/%s?%s", srv.URL, url.QueryEscape(target), query))
+		if err != nil {
+			t.Fatalf("Failed to request the image proxy: %v", err)
+		}
+		return resp
+	}
+
+	for range 2 {
+		resp := get(upstream.URL+"/og.png", "w=300&format=jpeg")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "image/jpeg" {
+			t.Fatalf("expected image/jpeg, got %s", ct)
+		}
+
+		cfg, _, err := image.DecodeConfig(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Failed to decode the proxied image: %v", err)
+		}
+		if cfg.Width != 300 || cfg.Height != 158 {
+			t.Fatalf("expected a 300x158 image, got %dx%d", cfg.Width, cfg.Height)
+		}
+	}
+
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("expected the second request to be served from the cache, upstream was fetched %d times", n)
+	}
+
+	resp := get(upstream.URL+"/fake.png", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415 for a non image body, got %d", resp.StatusCode)
+	}
+
+	resp = get("file:///etc/passwd", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a non http url, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/url"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+	"github.com/danvergara/jumble-proxy-server/pkg/ipfs"
+)
+
+// gatewaySite returns the URL site is fetched from: its content path on the configured IPFS gateway
+// when it is an IPFS or IPNS link, like ipfs://{cid} or https://{cid}.ipfs.dweb.link, and site itself otherwise.
+// It reports whether the URL is on the gateway, which is fetched with the gateway client.
+// ipfs:// and ipns:// URLs with an invalid CID or name, or with dot segments, are rejected, while http URLs are left as they are.
+func gatewaySite(cfg *config.Config, site string) (string, bool, error) {
+	u, err := url.Parse(site)
+	if err != nil {
+		return site, false, nil
+	}
+
+	p, err := ipfs.Parse(u)
+	switch {
+	case err == nil:
+	case u.Scheme == ipfs.NamespaceIPFS || u.Scheme == ipfs.NamespaceIPNS:
+		return "", false, err
+	default:
+		return site, false, nil
+	}
+
+	gateway := cfg.IPFSGatewayURL
+	if gateway == "" {
+		gateway = ipfs.DefaultGatewayURL
+	}
+
+	// Parse rejects dot segments, but the content root is checked again on the URL actually sent,
+	// since the gateway is trusted to be on a private address.
+	gatewayURL := p.GatewayURL(gateway)
+	g, err := url.Parse(gatewayURL)
+	if err != nil {
+		return "", false, err
+	}
+	if prefix, _ := url.Parse(gateway); prefix == nil || !p.Within(prefix.Path, g.EscapedPath()) {
+		return "", false, ipfs.ErrPathTraversal
+	}
+
+	return gatewayURL, true, nil
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+)
+
+func TestIPFSLinks(t *testing.T) {
+	const cid = "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"
+
+	// The gateway stand-in serves an HTML page for the CID and an image below it.
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ipfs/" + cid + "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<html><head><title>On IPFS</title><meta property="og:title" content="An IPFS page"></head></html>`)
+		case "/ipfs/" + cid + "/cat.png":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "\x89PNG")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer gateway.Close()
+
+	// Another service on the loopback interface, which must stay out of reach.
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "internal")
+	}))
+	defer internal.Close()
+
+	// Private networks are not allowed, the configured gateway is trusted anyway.
+	cfg := &config.Config{Logger: slog.Default(), IPFSGatewayURL: gateway.URL}
+	srv := httptest.NewServer(NewServer(cfg))
+	defer srv.Close()
+
+	tests := []struct {
+		site        string
+		code        int
+		contentType string
+		contains    string
+	}{
+		{site: "ipfs://" + cid + "/", code: http.StatusOK, contentType: "text/html; charset=utf-8", contains: "An IPFS page"},
+		{site: "https://" + cid + ".ipfs.dweb.link/", code: http.StatusOK, contentType: "text/html; charset=utf-8", contains: "An IPFS page"},
+		{site: "https://cloudflare-ipfs.com/ipfs/" + cid + "/cat.png", code: http.StatusOK, contentType: "image/png", contains: "PNG"},
+		{site: "ipfs://not-a-cid", code: http.StatusBadRequest},
+		{site: "ipfs://" + cid + "/../../admin", code: http.StatusBadRequest},
+		{site: "ipfs://" + cid + "/%2e%2e/%2E%2E/admin", code: http.StatusBadRequest},
+		{site: "ipfs://" + cid + "/..%2f..%2fadmin", code: http.StatusBadRequest},
+		{site: internal.URL + "/", code: http.StatusBadGateway},
+		{site: gateway.URL + "/admin", code: http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.site, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + "/sites/" + url.PathEscape(tt.site))
+			if err != nil {
+				t.Fatalf("Failed to request the preview: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.code {
+				t.Fatalf("GET /sites/%s status = %d, expected %d: %s", tt.site, resp.StatusCode, tt.code, body)
+			}
+			if tt.contentType != "" && resp.Header.Get("Content-Type") != tt.contentType {
+				t.Errorf("GET /sites/%s Content-Type = %q, expected %q", tt.site, resp.Header.Get("Content-Type"), tt.contentType)
+			}
+			if !strings.Contains(string(body), tt.contains) {
+				t.Errorf("GET /sites/%s body = %q, expected it to contain %q", tt.site, body, tt.contains)
+			}
+		})
+	}
+
+	resp, err := http.Post(srv.URL+"/batch", "application/json",
+		strings.NewReader(`{"urls": ["ipns://en-wikipedia--on--ipfs-org", "ipfs://`+cid+`/"]}`))
+	if err != nil {
+		t.Fatalf("Failed to request the batch: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var batch struct {
+		Results []struct {
+			Index    int `json:"index"`
+			Metadata struct {
+				Title string `json:"title"`
+			} `json:"metadata"`
+			Error string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		t.Fatalf("Failed to decode the batch: %v", err)
+	}
+
+	for _, result := range batch.Results {
+		switch result.Index {
+		case 0:
+			if result.Error == "" {
+				t.Errorf("expected an error for an invalid IPNS name")
+			}
+		case 1:
+			if result.Metadata.Title != "An IPFS page" {
+				t.Errorf("batch title = %q, expected %q (error %q)", result.Metadata.Title, "An IPFS page", result.Error)
+			}
+		}
+	}
+}
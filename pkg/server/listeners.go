@@ -0,0 +1,147 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation.
+const listenFDsStart = 3
+
+// systemdListener is a socket inherited from systemd along with its LISTEN_FDNAMES entry.
+type systemdListener struct {
+	name string
+	ln   net.Listener
+}
+
+// inheritedListeners are the sockets inherited from systemd, loaded when a listener first asks for one.
+type inheritedListeners struct {
+	loaded    bool
+	listeners []systemdListener
+	err       error
+}
+
+// newListener opens the socket described by l, taking systemd sockets from inherited.
+func newListener(l config.Listener, inherited *inheritedListeners) (net.Listener, error) {
+	switch l.Network {
+	case config.NetworkTCP:
+		return net.Listen("tcp", l.Address)
+	case config.NetworkUnix:
+		return listenUnix(l.Address, l.SocketMode)
+	case config.NetworkSystemd:
+		return inherited.take(l.Address)
+	default:
+		return nil, fmt.Errorf("unsupported listener network %q", l.Network)
+	}
+}
+
+// listenUnix listens on a Unix domain socket, replacing a stale socket file left by a previous run.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+
+	return ln, nil
+}
+
+// take returns the inherited socket named name, or the first one when name is empty.
+// Each inherited socket can only be taken once.
+func (il *inheritedListeners) take(name string) (net.Listener, error) {
+	if !il.loaded {
+		il.listeners, il.err = inheritSystemdListeners()
+		il.loaded = true
+	}
+	if il.err != nil {
+		return nil, il.err
+	}
+
+	for i, sl := range il.listeners {
+		if sl.ln != nil && (name == "" || sl.name == name) {
+			il.listeners[i].ln = nil
+			return sl.ln, nil
+		}
+	}
+
+	if name == "" {
+		return nil, errors.New("no socket inherited from systemd")
+	}
+	return nil, fmt.Errorf("no socket named %q inherited from systemd", name)
+}
+
+// closeUnused closes the inherited sockets no listener took,
+// which would otherwise accept connections that are never served.
+func (il *inheritedListeners) closeUnused() {
+	for i, sl := range il.listeners {
+		if sl.ln != nil {
+			sl.ln.Close()
+			il.listeners[i].ln = nil
+		}
+	}
+}
+
+// inheritSystemdListeners turns the file descriptors passed through LISTEN_FDS into listeners.
+// The environment variables are cleared so child processes do not inherit them.
+func inheritSystemdListeners() ([]systemdListener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, errors.New("no socket inherited from systemd: LISTEN_PID does not match this process")
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, errors.New("no socket inherited from systemd: LISTEN_FDS is not set")
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	listeners := make([]systemdListener, 0, n)
+	for i := range n {
+		fd := listenFDsStart + i
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+
+		// FileListener duplicates the descriptor, so the original can be closed right away.
+		f := os.NewFile(uintptr(fd), name)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("inheriting systemd socket %d: %w", fd, err)
+		}
+
+		listeners = append(listeners, systemdListener{name: name, ln: ln})
+	}
+
+	return listeners, nil
+}
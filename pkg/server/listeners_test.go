@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+)
+
+func TestUnixSocketListener(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jumble.sock")
+
+	// A stale socket file from a previous run must not prevent the server from starting.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to create a stale socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	cfg := &config.Config{
+		Listen: config.Listener{Network: config.NetworkUnix, Address: path, SocketMode: 0o660},
+		Logger: slog.Default(),
+	}
+
+	s, err := Listen(cfg)
+	if err != nil {
+		t.Fatalf("Failed to listen on the unix socket: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go s.Serve(ctx)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat the socket: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o660 {
+		t.Errorf("expected socket permissions 0660, got %o", perm)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+
+	resp, err := client.Get("http://unix/healthz")
+	if err != nil {
+		t.Fatalf("Failed to request the server over the unix socket: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestUnixSocketListenerRefusesRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not-a-socket")
+	if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+		t.Fatalf("Failed to create the file: %v", err)
+	}
+
+	if _, err := listenUnix(path, 0); err == nil {
+		t.Fatalf("expected an error when the socket path is a regular file")
+	}
+}
+
+func TestSystemdListenerWithoutActivation(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+
+	if _, err := inheritSystemdListeners(); err == nil {
+		t.Fatalf("expected an error when LISTEN_PID does not match this process")
+	}
+}
+
+func TestInheritedListenersCloseUnused(t *testing.T) {
+	var listeners []systemdListener
+	for _, name := range []string{"public", "admin"} {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		listeners = append(listeners, systemdListener{name: name, ln: ln})
+	}
+	unused := listeners[1].ln.Addr().String()
+	inherited := &inheritedListeners{loaded: true, listeners: listeners}
+
+	public, err := inherited.take("public")
+	if err != nil {
+		t.Fatalf("take() unexpected error: %v", err)
+	}
+	if _, err := inherited.take("public"); err == nil {
+		t.Errorf("expected an error when taking a socket twice")
+	}
+
+	inherited.closeUnused()
+
+	if conn, err := net.Dial("tcp", public.Addr().String()); err != nil {
+		t.Errorf("expected the taken socket to stay open: %v", err)
+	} else {
+		conn.Close()
+	}
+	if conn, err := net.Dial("tcp", unused); err == nil {
+		conn.Close()
+		t.Errorf("expected the unused socket to be closed")
+	}
+}
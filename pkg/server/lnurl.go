@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+	"github.com/danvergara/jumble-proxy-server/pkg/lnurl"
+)
+
+// defaultLNURLCacheTTL is used when cfg.LNURLCacheTTL is not set.
+const defaultLNURLCacheTTL = 10 * time.Minute
+
+// lnurlHandler resolves a Lightning address or a bech32 LNURL and fetches its pay request.
+// Unknown Lightning addresses are answered with a 404.
+func lnurlHandler(cfg *config.Config, client *http.Client) http.HandlerFunc {
+	lookup := jsonLookup{
+		name:        "LNURL pay request",
+		prefix:      "lnurl:",
+		ttl:         cfg.LNURLCacheTTL,
+		negativeTTL: defaultNegativeCacheTTL,
+		identify: func(r *http.Request) (string, error) {
+			u, err := lnurl.Resolve(r.PathValue("address"))
+			if err != nil {
+				return "", err
+			}
+			return u.String(), nil
+		},
+		fetch: func(ctx context.Context, r *http.Request, _ string) (any, error) {
+			return lnurl.FetchPayRequest(ctx, client, r.PathValue("address"))
+		},
+		notFound: lnurl.ErrNotFound,
+	}
+
+	if lookup.ttl <= 0 {
+		lookup.ttl = defaultLNURLCacheTTL
+	}
+
+	return lookup.handler(cfg)
+}
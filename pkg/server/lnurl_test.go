@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/coocood/freecache"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+)
+
+func TestLNURLHandler(t *testing.T) {
+	const pubkey = "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d"
+
+	var fetches atomic.Int64
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if r.URL.Path != "/.well-known/lnurlp/bob" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"tag": "payRequest", "callback": "https://example.com/lnurlp/bob/callback",
+			"minSendable": 1000, "maxSendable": 1000000, "metadata": "[[\"text/plain\",\"Zap bob\"]]",
+			"allowsNostr": true, "nostrPubkey": "%s"}`, pubkey)
+	}))
+	defer upstream.Close()
+
+	// The certificate of the test server is valid for example.com, which is routed to it.
+	transport := upstream.Client().Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, upstream.Listener.Addr().String())
+	}
+	client := &http.Client{Transport: transport}
+
+	cfg := &config.Config{
+		Logger: slog.Default(),
+		Cache:  freecache.NewCache(1024 * 1024),
+	}
+	handler := lnurlHandler(cfg, client)
+
+	get := func(address string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/lnurl/"+url.PathEscape(address), nil)
+		req.SetPathValue("address", address)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		address      string
+		code         int
+		cacheControl string
+		fetches      int64
+	}{
+		{address: "bob@example.com", code: http.StatusOK, cacheControl: "public, max-age=600", fetches: 1},
+		{address: "lightning:BOB@example.com", code: http.StatusOK, fetches: 0},
+		{address: "alice@example.com", code: http.StatusNotFound, cacheControl: "public, max-age=300", fetches: 1},
+		{address: "alice@example.com", code: http.StatusNotFound, fetches: 0},
+		{address: "not an address", code: http.StatusBadRequest, fetches: 0},
+	}
+
+	for _, tt := range tests {
+		before := fetches.Load()
+		rec := get(tt.address)
+
+		if rec.Code != tt.code {
+			t.Fatalf("GET /lnurl/%s status = %d, expected %d: %s", tt.address, rec.Code, tt.code, rec.Body)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("GET /lnurl/%s Access-Control-Allow-Origin = %q, expected *", tt.address, got)
+		}
+		if tt.cacheControl != "" && rec.Header().Get("Cache-Control") != tt.cacheControl {
+			t.Errorf("GET /lnurl/%s Cache-Control = %q, expected %q",
+				tt.address, rec.Header().Get("Cache-Control"), tt.cacheControl)
+		}
+		if got := fetches.Load() - before; got != tt.fetches {
+			t.Errorf("GET /lnurl/%s fetched the pay request %d times, expected %d", tt.address, got, tt.fetches)
+		}
+	}
+
+	var body struct {
+		Callback    string `json:"callback"`
+		Description string `json:"description"`
+		AllowsNostr bool   `json:"allowsNostr"`
+		NostrPubKey string `json:"nostrPubkey"`
+	}
+	if err := json.NewDecoder(get("bob@example.com").Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode the response: %v", err)
+	}
+
+	if body.Callback != "https://example.com/lnurlp/bob/callback" || body.Description != "Zap bob" ||
+		!body.AllowsNostr || body.NostrPubKey != pubkey {
+		t.Errorf("GET /lnurl/bob@example.com body = %+v", body)
+	}
+}
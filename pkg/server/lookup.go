@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+	"github.com/danvergara/jumble-proxy-server/pkg/logging"
+)
+
+// defaultNegativeCacheTTL is how long lookups of documents that do not exist are cached by default.
+const defaultNegativeCacheTTL = 5 * time.Minute
+
+// jsonLookup is an endpoint serving a JSON document fetched through the outbound client,
+// for clients that cannot fetch it themselves because its host does not send CORS headers.
+// Documents are cached for ttl. Documents that do not exist are answered with a 404 and cached for negativeTTL,
+// while other failures are answered with a 502 and not cached, so they are retried on the next request.
+type jsonLookup struct {
+	// name is the name of the lookup in the logs and the error responses, like "NIP-05 lookup".
+	name string
+	// prefix is prepended to the identifiers to build the cache keys.
+	prefix string
+	// ttl and negativeTTL are how long found and not found documents are cached.
+	ttl, negativeTTL time.Duration
+	// identify returns the normalized identifier of the document requested by r. Errors are answered with a 400.
+	identify func(r *http.Request) (string, error)
+	// fetch returns the document of identifier, to be encoded as JSON.
+	fetch func(ctx context.Context, r *http.Request, identifier string) (any, error)
+	// notFound is the error wrapped by fetch when the document does not exist.
+	notFound error
+}
+
+// lookupError is the body of a lookup whose document does not exist.
+type lookupError struct {
+	Identifier string `json:"identifier"`
+	Error      string `json:"error"`
+}
+
+// handler returns the handler of the lookup, caching its responses in cfg.Cache.
+func (l jsonLookup) handler(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.FromContext(r.Context())
+
+		setCORSHeaders(w, http.MethodGet)
+
+		identifier, err := l.identify(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		key := []byte(l.prefix + identifier)
+
+		if cfg.Cache != nil {
+			if value, expireAt, err := cfg.Cache.GetWithExpiration(key); err == nil {
+				setCacheStatus(r.Context(), "hit")
+				status, body, _ := bytes.Cut(value, []byte("\n"))
+				code, _ := strconv.Atoi(string(status))
+				writeCachedJSON(w, cfg, code, body, time.Until(time.Unix(int64(expireAt), 0)))
+				return
+			}
+		}
+
+		setCacheStatus(r.Context(), "miss")
+
+		v, err := l.fetch(r.Context(), r, identifier)
+
+		code, ttl := http.StatusOK, l.ttl
+		switch {
+		case errors.Is(err, l.notFound):
+			code, ttl, v = http.StatusNotFound, l.negativeTTL, lookupError{Identifier: identifier, Error: err.Error()}
+		case err != nil:
+			logger.Error(l.name+" failed", slog.String("identifier", identifier), slog.Any("error", err))
+			http.Error(w, fmt.Sprintf("%s failed: %v", l.name, err), http.StatusBadGateway)
+			return
+		}
+
+		body, err := json.Marshal(v)
+		if err != nil {
+			http.Error(w, "Failed to encode the response", http.StatusInternalServerError)
+			return
+		}
+
+		if cfg.Cache != nil {
+			value := append([]byte(strconv.Itoa(code)+"\n"), body...)
+			if err := cfg.Cache.Set(key, value, int(ttl.Seconds())); err != nil {
+				logger.Error(
+					"Failed to store the "+l.name+" in the cache",
+					slog.String("identifier", identifier),
+					slog.Any("error", err),
+				)
+			}
+		}
+
+		writeCachedJSON(w, cfg, code, body, ttl)
+	}
+}
+
+// writeCachedJSON writes a JSON body that clients may keep for maxAge. Shared caches may keep it too,
+// unless NIP-98 auth is enabled: they would then serve it to clients that never authenticated.
+func writeCachedJSON(w http.ResponseWriter, cfg *config.Config, code int, body []byte, maxAge time.Duration) {
+	scope := "public"
+	if cfg.NIP98Auth != "" && cfg.NIP98Auth != config.NIP98AuthOff {
+		scope = "private"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", scope+", max-age="+strconv.Itoa(max(int(maxAge.Seconds()), 0)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	w.Write(body)
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+)
+
+// metrics counts the requests served by the public server.
+type metrics struct {
+	inFlight atomic.Int64
+
+	mu       sync.Mutex
+	requests map[int]int64
+	cache    map[string]int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests: map[int]int64{},
+		cache:    map[string]int64{},
+	}
+}
+
+// observe records a finished request.
+func (m *metrics) observe(status int, cache string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[status]++
+	if cache != "" {
+		m.cache[cache]++
+	}
+}
+
+// metricsHandler exposes the counters and the cache statistics in the Prometheus text format.
+func metricsHandler(cfg *config.Config, m *metrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		m.mu.Lock()
+		statuses := make([]int, 0, len(m.requests))
+		for status := range m.requests {
+			statuses = append(statuses, status)
+		}
+		sort.Ints(statuses)
+
+		outcomes := make([]string, 0, len(m.cache))
+		for outcome := range m.cache {
+			outcomes = append(outcomes, outcome)
+		}
+		sort.Strings(outcomes)
+
+		writeMetricHeader(w, "jumble_proxy_requests_total", "counter", "Requests served by the proxy, by status code.")
+		for _, status := range statuses {
+			fmt.Fprintf(w, "jumble_proxy_requests_total{code=\"%d\"} %d\n", status, m.requests[status])
+		}
+
+		writeMetricHeader(w, "jumble_proxy_cache_requests_total", "counter", "Requests answered by the proxy, by cache outcome.")
+		for _, outcome := range outcomes {
+			fmt.Fprintf(w, "jumble_proxy_cache_requests_total{outcome=%q} %d\n", outcome, m.cache[outcome])
+		}
+		m.mu.Unlock()
+
+		writeMetricHeader(w, "jumble_proxy_requests_in_flight", "gauge", "Requests currently being served.")
+		fmt.Fprintf(w, "jumble_proxy_requests_in_flight %d\n", m.inFlight.Load())
+
+		if cfg.Cache == nil {
+			return
+		}
+
+		writeMetricHeader(w, "jumble_proxy_cache_entries", "gauge", "Entries stored in the cache.")
+		fmt.Fprintf(w, "jumble_proxy_cache_entries %d\n", cfg.Cache.EntryCount())
+		writeMetricHeader(w, "jumble_proxy_cache_evictions_total", "counter", "Entries evicted from the cache to make room.")
+		fmt.Fprintf(w, "jumble_proxy_cache_evictions_total %d\n", cfg.Cache.EvacuateCount())
+		writeMetricHeader(w, "jumble_proxy_cache_expirations_total", "counter", "Entries removed from the cache after expiring.")
+		fmt.Fprintf(w, "jumble_proxy_cache_expirations_total %d\n", cfg.Cache.ExpiredCount())
+	}
+}
+
+func writeMetricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
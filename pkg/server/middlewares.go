@@ -1,15 +1,198 @@
 package server
 
 import (
-	"fmt"
+	"context"
+	"crypto/rand"
 	"log/slog"
+	mrand "math/rand/v2"
+	"net"
 	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+	"github.com/danvergara/jumble-proxy-server/pkg/logging"
 )
 
-func loggingMiddlware(next http.Handler, logger *slog.Logger) http.Handler {
+const requestIDHeader = "X-Request-ID"
+
+type requestInfoKey struct{}
+
+// requestInfo holds per-request values that handlers report back to the access log.
+type requestInfo struct {
+	cache  string
+	pubkey string
+}
+
+// setCacheStatus records the cache outcome ("hit", "miss", ...) of the current request.
+func setCacheStatus(ctx context.Context, status string) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.cache = status
+	}
+}
+
+// setAuthPubKey records the public key that authenticated the current request.
+func setAuthPubKey(ctx context.Context, pubkey string) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.pubkey = pubkey
+	}
+}
+
+// statusRecorder wraps an http.ResponseWriter to capture the status code and the number of bytes written.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	if sr.status == 0 {
+		sr.status = code
+	}
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += int64(n)
+	return n, err
+}
+
+// Flush lets streaming handlers flush through the recorder.
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap is used by http.ResponseController to reach the underlying writer.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// accessLogMiddleware assigns a request ID, injects a request-scoped logger into the context
+// and emits one structured record per request once the handler returns.
+// Successful requests are sampled according to cfg.AccessLogSampleRate, failed ones are always logged.
+// Every request is also counted in m, regardless of sampling.
+func accessLogMiddleware(next http.Handler, cfg *config.Config, m *metrics) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		site := r.PathValue("site")
-		logger.Info(fmt.Sprintf("Fetching site: %s", site))
-		next.ServeHTTP(w, r)
+		start := time.Now()
+
+		m.inFlight.Add(1)
+		defer m.inFlight.Add(-1)
+
+		requestID := r.Header.Get(requestIDHeader)
+		if requestID == "" || len(requestID) > 128 {
+			requestID = rand.Text()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+
+		logger := cfg.Logger.With(slog.String("request_id", requestID))
+		info := &requestInfo{}
+
+		ctx := logging.WithLogger(r.Context(), logger)
+		ctx = context.WithValue(ctx, requestInfoKey{}, info)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		m.observe(rec.status, info.cache)
+
+		if rec.status < http.StatusBadRequest && !sampled(cfg.AccessLogSampleRate) {
+			return
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case rec.status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Duration("duration", time.Since(start)),
+			slog.Int64("bytes", rec.bytes),
+			slog.String("client", clientIP(r, cfg.TrustedProxies)),
+			slog.String("user_agent", r.UserAgent()),
+		}
+
+		if site := r.PathValue("site"); site != "" {
+			attrs = append(attrs, slog.String("site", site))
+		}
+
+		if info.cache != "" {
+			attrs = append(attrs, slog.String("cache", info.cache))
+		}
+
+		if info.pubkey != "" {
+			attrs = append(attrs, slog.String("pubkey", info.pubkey))
+		}
+
+		logger.LogAttrs(r.Context(), level, "request", attrs...)
 	})
 }
+
+// sampled reports whether a successful request should be logged given a sample rate.
+// Rates outside (0, 1) disable sampling.
+func sampled(rate float64) bool {
+	if rate <= 0 || rate >= 1 {
+		return true
+	}
+	return mrand.Float64() < rate
+}
+
+// clientIP returns the address of the client of r. When the request comes from one of the trusted proxies,
+// it is the last address of X-Forwarded-For that is not a trusted proxy itself, since the addresses
+// before it were set by the client. Otherwise, it is the remote address host.
+func clientIP(r *http.Request, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !isTrustedProxy(host, trusted) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		host = hop
+		if !isTrustedProxy(hop, trusted) {
+			break
+		}
+	}
+
+	return host
+}
+
+// isTrustedProxy reports whether addr is in one of the trusted prefixes.
+func isTrustedProxy(addr string, trusted []netip.Prefix) bool {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+
+	for _, prefix := range trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+	"github.com/danvergara/jumble-proxy-server/pkg/logging"
+)
+
+func TestAccessLogMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		requestID  string
+		status     int
+		sampleRate float64
+		logged     bool
+	}{
+		{
+			name:   "generates a request id",
+			status: http.StatusOK,
+			logged: true,
+		},
+		{
+			name:      "propagates the incoming request id",
+			requestID: "abc-123",
+			status:    http.StatusOK,
+			logged:    true,
+		},
+		{
+			name:       "successful requests can be sampled out",
+			status:     http.StatusOK,
+			sampleRate: 0.0000001,
+			logged:     false,
+		},
+		{
+			name:       "failed requests are always logged",
+			status:     http.StatusBadGateway,
+			sampleRate: 0.0000001,
+			logged:     true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			cfg := &config.Config{
+				Logger:              slog.New(slog.NewJSONHandler(&buf, nil)),
+				AccessLogSampleRate: tc.sampleRate,
+			}
+
+			var handlerRequestID string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				logging.FromContext(r.Context()).Info("from handler")
+				handlerRequestID = w.Header().Get(requestIDHeader)
+				setCacheStatus(r.Context(), "hit")
+				w.WriteHeader(tc.status)
+				w.Write([]byte("hello"))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/sites/example", nil)
+			if tc.requestID != "" {
+				req.Header.Set(requestIDHeader, tc.requestID)
+			}
+			rec := httptest.NewRecorder()
+
+			accessLogMiddleware(next, cfg, newMetrics()).ServeHTTP(rec, req)
+
+			requestID := rec.Header().Get(requestIDHeader)
+			if requestID == "" {
+				t.Fatalf("missing %s response header", requestIDHeader)
+			}
+			if tc.requestID != "" && requestID != tc.requestID {
+				t.Fatalf("expected request id %q, got %q", tc.requestID, requestID)
+			}
+			if handlerRequestID != requestID {
+				t.Fatalf("handler saw request id %q, response has %q", handlerRequestID, requestID)
+			}
+
+			var records []map[string]any
+			dec := json.NewDecoder(&buf)
+			for dec.More() {
+				var record map[string]any
+				if err := dec.Decode(&record); err != nil {
+					t.Fatalf("failed to decode log record: %v", err)
+				}
+				records = append(records, record)
+			}
+
+			for _, record := range records {
+				if record["request_id"] != requestID {
+					t.Errorf("log record %v is not correlated with request id %q", record, requestID)
+				}
+			}
+
+			var access map[string]any
+			for _, record := range records {
+				if record["msg"] == "request" {
+					access = record
+				}
+			}
+
+			if !tc.logged {
+				if access != nil {
+					t.Fatalf("expected the access record to be sampled out, got %v", access)
+				}
+				return
+			}
+
+			if access == nil {
+				t.Fatalf("missing access log record in %v", records)
+			}
+			if int(access["status"].(float64)) != tc.status {
+				t.Errorf("expected status %d, got %v", tc.status, access["status"])
+			}
+			if int(access["bytes"].(float64)) != len("hello") {
+				t.Errorf("expected %d bytes, got %v", len("hello"), access["bytes"])
+			}
+			if access["cache"] != "hit" {
+				t.Errorf("expected cache outcome hit, got %v", access["cache"])
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		expected     string
+	}{
+		{name: "direct", remoteAddr: "203.0.113.7:4321", expected: "203.0.113.7"},
+		{name: "spoofed", remoteAddr: "203.0.113.7:4321", forwardedFor: "198.51.100.1", expected: "203.0.113.7"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.2:4321", forwardedFor: "198.51.100.1", expected: "198.51.100.1"},
+		{name: "prepended by the client", remoteAddr: "10.0.0.2:4321", forwardedFor: "192.0.2.9, 198.51.100.1", expected: "198.51.100.1"},
+		{name: "chained proxies", remoteAddr: "10.0.0.2:4321", forwardedFor: "198.51.100.1, 10.0.0.3", expected: "198.51.100.1"},
+		{name: "trusted proxy without header", remoteAddr: "10.0.0.2:4321", expected: "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+
+			if got := clientIP(r, trusted); got != tt.expected {
+				t.Errorf("clientIP() = %s, expected %s", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+	"github.com/danvergara/jumble-proxy-server/pkg/nostr"
+)
+
+// defaultNIP05CacheTTL is used when cfg.NIP05CacheTTL is not set.
+const defaultNIP05CacheTTL = time.Hour
+
+// nip05Result is the body of a verified identifier.
+type nip05Result struct {
+	nostr.NIP05
+	NPub string `json:"npub"`
+}
+
+// nip05Handler resolves a NIP-05 identifier. Identifiers that do not verify are answered with a 404.
+func nip05Handler(cfg *config.Config, client *http.Client) http.HandlerFunc {
+	lookup := jsonLookup{
+		name:        "NIP-05 lookup",
+		prefix:      "nip05:",
+		ttl:         cfg.NIP05CacheTTL,
+		negativeTTL: cfg.NIP05NegativeCacheTTL,
+		identify: func(r *http.Request) (string, error) {
+			name, domain, err := nostr.ParseNIP05(r.PathValue("identifier"))
+			if err != nil {
+				return "", err
+			}
+			return name + "@" + domain, nil
+		},
+		fetch: func(ctx context.Context, _ *http.Request, identifier string) (any, error) {
+			result, err := nostr.LookupNIP05(ctx, client, identifier)
+			if err != nil {
+				return nil, err
+			}
+			npub, _ := nostr.EncodePubKey(result.PubKey)
+			return nip05Result{NIP05: result, NPub: npub}, nil
+		},
+		notFound: nostr.ErrNotVerified,
+	}
+
+	if lookup.ttl <= 0 {
+		lookup.ttl = defaultNIP05CacheTTL
+	}
+	if lookup.negativeTTL <= 0 {
+		lookup.negativeTTL = defaultNegativeCacheTTL
+	}
+
+	return lookup.handler(cfg)
+}
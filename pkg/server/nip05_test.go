@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coocood/freecache"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+)
+
+func TestNIP05Handler(t *testing.T) {
+	const pubkey = "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d"
+
+	var fetches atomic.Int64
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if r.URL.Query().Get("name") == "down" {
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"names": {"bob": "%s"}, "relays": {"%s": ["wss://relay.example"]}}`, pubkey, pubkey)
+	}))
+	defer upstream.Close()
+
+	// The certificate of the test server is valid for example.com, which is routed to it.
+	transport := upstream.Client().Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, upstream.Listener.Addr().String())
+	}
+	client := &http.Client{Transport: transport}
+
+	cfg := &config.Config{
+		Logger:                slog.Default(),
+		Cache:                 freecache.NewCache(1024 * 1024),
+		NIP05NegativeCacheTTL: time.Minute,
+	}
+	handler := nip05Handler(cfg, client)
+
+	get := func(identifier string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/nip05/"+url.PathEscape(identifier), nil)
+		req.SetPathValue("identifier", identifier)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		identifier   string
+		code         int
+		cacheControl string
+		fetches      int64
+	}{
+		{identifier: "bob@example.com", code: http.StatusOK, cacheControl: "public, max-age=3600", fetches: 1},
+		{identifier: "Bob@example.com", code: http.StatusOK, fetches: 0},
+		{identifier: "alice@example.com", code: http.StatusNotFound, cacheControl: "public, max-age=60", fetches: 1},
+		{identifier: "alice@example.com", code: http.StatusNotFound, fetches: 0},
+		{identifier: "down@example.com", code: http.StatusBadGateway, fetches: 1},
+		{identifier: "down@example.com", code: http.StatusBadGateway, fetches: 1},
+		{identifier: "not an identifier", code: http.StatusBadRequest, fetches: 0},
+	}
+
+	for _, tt := range tests {
+		before := fetches.Load()
+		rec := get(tt.identifier)
+
+		if rec.Code != tt.code {
+			t.Fatalf("GET /nip05/%s status = %d, expected %d: %s", tt.identifier, rec.Code, tt.code, rec.Body)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("GET /nip05/%s Access-Control-Allow-Origin = %q, expected *", tt.identifier, got)
+		}
+		if tt.cacheControl != "" && rec.Header().Get("Cache-Control") != tt.cacheControl {
+			t.Errorf("GET /nip05/%s Cache-Control = %q, expected %q",
+				tt.identifier, rec.Header().Get("Cache-Control"), tt.cacheControl)
+		}
+		if got := fetches.Load() - before; got != tt.fetches {
+			t.Errorf("GET /nip05/%s fetched the document %d times, expected %d", tt.identifier, got, tt.fetches)
+		}
+	}
+
+	var body struct {
+		Identifier string   `json:"identifier"`
+		PubKey     string   `json:"pubkey"`
+		NPub       string   `json:"npub"`
+		Relays     []string `json:"relays"`
+	}
+	if err := json.NewDecoder(get("bob@example.com").Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode the response: %v", err)
+	}
+
+	if body.Identifier != "bob@example.com" || body.PubKey != pubkey ||
+		body.NPub != "npub180cvv07tjdrrgpa0j7j7tmnyl2yr6yr7l8j4s3evf6u64th6gkwsyjh6w6" ||
+		len(body.Relays) != 1 || body.Relays[0] != "wss://relay.example" {
+		t.Errorf("GET /nip05/bob@example.com body = %+v", body)
+	}
+
+	// Behind NIP-98 auth, shared caches must not serve the response to clients that did not authenticate.
+	cfg.NIP98Auth = config.NIP98AuthRequired
+	if got := get("bob@example.com").Header().Get("Cache-Control"); !strings.HasPrefix(got, "private, max-age=") {
+		t.Errorf("GET /nip05/bob@example.com behind NIP-98 auth Cache-Control = %q, expected private", got)
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+	"github.com/danvergara/jumble-proxy-server/pkg/logging"
+	"github.com/danvergara/jumble-proxy-server/pkg/oembed"
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+)
+
+// oembedCacheTTL is how long, in seconds, oEmbed responses are cached.
+const oembedCacheTTL = 3600
+
+// applyOEmbed merges the oEmbed data of site into its head.
+// The endpoint advertised by the page wins over the built-in provider table.
+// Failures are logged and leave the head unchanged, since the page metadata is still usable.
+func applyOEmbed(ctx context.Context, cfg *config.Config, client *http.Client, site string, head *opengraph.Head) {
+	logger := logging.FromContext(ctx)
+
+	endpoint, ok := head.Link("alternate", oembed.DiscoveryType)
+	if !ok {
+		providers := oembed.DefaultProviders
+		if cfg.OEmbedProviders != nil {
+			providers = make(oembed.Providers, len(cfg.OEmbedProviders))
+			for i, p := range cfg.OEmbedProviders {
+				providers[i] = oembed.Provider(p)
+			}
+		}
+
+		provider, ok := providers.Match(site)
+		if !ok {
+			return
+		}
+		endpoint = provider.EndpointURL(site)
+	}
+
+	resp, err := fetchOEmbed(ctx, cfg, client, endpoint)
+	if err != nil {
+		logger.Warn(
+			"Failed to fetch the oEmbed data",
+			slog.String("site", site),
+			slog.String("endpoint", endpoint),
+			slog.Any("error", err),
+		)
+		return
+	}
+
+	resp.Apply(head)
+}
+
+// fetchOEmbed returns the oEmbed response at endpoint, from the cache if possible.
+func fetchOEmbed(ctx context.Context, cfg *config.Config, client *http.Client, endpoint string) (oembed.Response, error) {
+	logger := logging.FromContext(ctx)
+	key := []byte("oembed:" + endpoint)
+
+	if cfg.Cache == nil {
+		return oembed.Fetch(ctx, client, endpoint)
+	}
+
+	if cached, err := cfg.Cache.Get(key); err == nil {
+		var resp oembed.Response
+		if err := json.Unmarshal(cached, &resp); err == nil {
+			return resp, nil
+		}
+	}
+
+	resp, err := oembed.Fetch(ctx, client, endpoint)
+	if err != nil {
+		return resp, err
+	}
+
+	if data, err := json.Marshal(resp); err == nil {
+		if err := cfg.Cache.Set(key, data, oembedCacheTTL); err != nil {
+			logger.Error(
+				"Failed to store the oEmbed response in the cache",
+				slog.String("endpoint", endpoint),
+				slog.Any("error", err),
+			)
+		}
+	}
+
+	return resp, nil
+}
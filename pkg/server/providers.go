@@ -0,0 +1,187 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/coocood/freecache"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/blossom"
+	"github.com/danvergara/jumble-proxy-server/pkg/bluesky"
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+	"github.com/danvergara/jumble-proxy-server/pkg/fediverse"
+	"github.com/danvergara/jumble-proxy-server/pkg/logging"
+	"github.com/danvergara/jumble-proxy-server/pkg/mediawiki"
+	"github.com/danvergara/jumble-proxy-server/pkg/nostr"
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+	"github.com/danvergara/jumble-proxy-server/pkg/registry"
+	"github.com/danvergara/jumble-proxy-server/pkg/twitter"
+	"github.com/danvergara/jumble-proxy-server/pkg/youtube"
+)
+
+const (
+	// providerCacheTTL is how long, in seconds, the documents built by providers are cached.
+	providerCacheTTL = 3600
+	// notFediverseCacheTTL is how long, in seconds, hosts that are not fediverse servers are remembered.
+	notFediverseCacheTTL = 24 * 3600
+)
+
+// provider builds the preview of the URLs of a site whose pages are not usable as is,
+// for example because they are rendered by JavaScript or hidden behind a consent wall.
+type provider interface {
+	// Match reports whether the provider handles u.
+	Match(u *url.URL) bool
+	// Preview returns the head of the preview document of u.
+	// Errors matching errors.ErrUnsupported mean that u is left to the generic proxy after all.
+	Preview(ctx context.Context, u *url.URL) (opengraph.Head, error)
+}
+
+// newProviders returns the providers, in the order they are tried.
+// Their requests go through client, like every other request to a user supplied URL.
+func newProviders(cfg *config.Config, client *http.Client) []provider {
+	return []provider{
+		youtube.New(youtube.Options{
+			HTTPClient: client,
+			APIKey:     cfg.YouTubeAPIKey,
+			APIBaseURL: cfg.YouTubeAPIBaseURL,
+			OEmbedURL:  cfg.YouTubeOEmbedURL,
+		}),
+		twitter.New(twitter.Options{
+			HTTPClient:     client,
+			SyndicationURL: cfg.TwitterSyndicationURL,
+			OEmbedURL:      cfg.TwitterOEmbedURL,
+		}),
+		bluesky.New(bluesky.Options{HTTPClient: client, AppViewURL: cfg.BlueskyAppViewURL}),
+		nostr.New(nostr.Options{HTTPClient: client, Relays: cfg.NostrRelays}),
+		blossom.New(blossom.Options{
+			HTTPClient:     client,
+			VerifyMaxBytes: cfg.BlossomVerifyMaxBytes,
+			ImageProxyURL:  imageProxyURL(cfg),
+		}),
+		registry.New(registry.Options{
+			HTTPClient:      client,
+			NPMRegistryURL:  cfg.NPMRegistryURL,
+			NPMDownloadsURL: cfg.NPMDownloadsURL,
+			PyPIURL:         cfg.PyPIURL,
+			PyPIStatsURL:    cfg.PyPIStatsURL,
+			CratesIOURL:     cfg.CratesIOURL,
+			GoProxyURL:      cfg.GoProxyURL,
+			DepsDevURL:      cfg.DepsDevURL,
+			DockerHubURL:    cfg.DockerHubURL,
+		}),
+		mediawiki.New(mediawiki.Options{HTTPClient: client, Hosts: cfg.MediaWikiHosts, APIURL: cfg.MediaWikiAPIURL}),
+		// The fediverse provider matches paths on any host, so it goes last.
+		fediverseProvider{Client: fediverse.New(fediverse.Options{HTTPClient: client}), cache: cfg.Cache},
+	}
+}
+
+// fediverseProvider remembers the hosts the fediverse provider found not to be fediverse servers.
+// The provider matches paths on any host, so without it every URL of a blog using /@user paths
+// would cost two requests to the blog before being left to the generic proxy.
+type fediverseProvider struct {
+	*fediverse.Client
+	cache *freecache.Cache
+}
+
+func (p fediverseProvider) Preview(ctx context.Context, u *url.URL) (opengraph.Head, error) {
+	key := []byte("not-fediverse:" + strings.ToLower(u.Host))
+	if p.cache != nil {
+		if _, err := p.cache.Get(key); err == nil {
+			return opengraph.Head{}, fmt.Errorf("%w: %s", fediverse.ErrNotFediverse, u.Host)
+		}
+	}
+
+	head, err := p.Client.Preview(ctx, u)
+	if errors.Is(err, fediverse.ErrNotFediverse) && p.cache != nil {
+		if err := p.cache.Set(key, nil, notFediverseCacheTTL); err != nil {
+			logging.FromContext(ctx).Error(
+				"Failed to store the host in the cache",
+				slog.String("host", u.Host),
+				slog.Any("error", err),
+			)
+		}
+	}
+
+	return head, err
+}
+
+// imageProxyURL returns the absolute URL of the image proxy endpoint, to which providers append image URLs,
+// or an empty string when cfg.PublicURL is not set, since previews are parsed against the URL of the page.
+func imageProxyURL(cfg *config.Config) string {
+	if cfg.PublicURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(cfg.PublicURL, "/") + "/img/"
+}
+
+// matchProvider returns the provider handling site, if any.
+// Besides absolute http and https URLs, providers may handle nostr: URIs and bare NIP-19 entities.
+func matchProvider(providers []provider, site string) (provider, *url.URL, bool) {
+	u, err := url.Parse(site)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	switch {
+	case (u.Scheme == "http" || u.Scheme == "https") && u.Host != "":
+	case (u.Scheme == "nostr" || u.Scheme == "") && u.Host == "":
+	default:
+		return nil, nil, false
+	}
+
+	for _, p := range providers {
+		if p.Match(u) {
+			return p, u, true
+		}
+	}
+
+	return nil, nil, false
+}
+
+// providerPreview returns the HTML document built by p for site,
+// from the cache if possible, and reports whether it came from the cache.
+func providerPreview(ctx context.Context, cfg *config.Config, p provider, u *url.URL) ([]byte, bool, error) {
+	logger := logging.FromContext(ctx)
+	site := u.String()
+
+	if cfg.Cache != nil {
+		if value, err := cfg.Cache.Get([]byte(site)); err == nil {
+			return value, true, nil
+		}
+	}
+
+	head, err := p.Preview(ctx, u)
+	if errors.Is(err, errors.ErrUnsupported) {
+		logger.Debug("Provider declined the site", slog.String("site", site), slog.Any("error", err))
+		return nil, false, err
+	}
+	if err != nil {
+		logger.Error("Failed to build the preview", slog.String("site", site), slog.Any("error", err))
+		return nil, false, err
+	}
+
+	proxyImages(cfg, &head)
+
+	var doc bytes.Buffer
+	if err := head.Render(&doc); err != nil {
+		return nil, false, err
+	}
+
+	if cfg.Cache != nil {
+		if err := cfg.Cache.Set([]byte(site), doc.Bytes(), providerCacheTTL); err != nil {
+			logger.Error(
+				"Failed to store the preview in the cache",
+				slog.String("site", site),
+				slog.Any("error", err),
+			)
+		}
+	}
+
+	return doc.Bytes(), false, nil
+}
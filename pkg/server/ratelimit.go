@@ -0,0 +1,56 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter counts the requests of each key in fixed windows, allowing up to limit requests per window.
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu        sync.Mutex
+	counts    map[string]*rateCount
+	lastSweep time.Time
+}
+
+// rateCount is the number of requests of a key in the window starting at start.
+type rateCount struct {
+	start time.Time
+	n     int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, counts: make(map[string]*rateCount)}
+}
+
+// allow counts a request of key at now and reports whether it is within the limit.
+// When it is not, it also returns how long until the window of key ends.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget the keys whose window ended, so idle clients do not accumulate.
+	if now.Sub(l.lastSweep) >= l.window {
+		for k, c := range l.counts {
+			if now.Sub(c.start) >= l.window {
+				delete(l.counts, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	c, ok := l.counts[key]
+	if !ok || now.Sub(c.start) >= l.window {
+		c = &rateCount{start: now}
+		l.counts[key] = c
+	}
+
+	if c.n >= l.limit {
+		return false, c.start.Add(l.window).Sub(now)
+	}
+	c.n++
+
+	return true, 0
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+	"github.com/danvergara/jumble-proxy-server/pkg/nostr"
+)
+
+// defaultRelayInfoCacheTTL is used when cfg.RelayInfoCacheTTL is not set.
+const defaultRelayInfoCacheTTL = time.Hour
+
+// relayInfoResponse is the body of /relay-info/{relayURL}.
+type relayInfoResponse struct {
+	nostr.RelayInfo
+	// IconProxy is the path of the icon through the image proxy, so clients never contact the relay host for it.
+	IconProxy string `json:"icon_proxy,omitempty"`
+}
+
+// relayInfoHandler fetches the NIP-11 information document of a relay.
+// Relays without one are answered with a 404.
+func relayInfoHandler(cfg *config.Config, client *http.Client) http.HandlerFunc {
+	lookup := jsonLookup{
+		name:        "Relay information request",
+		prefix:      "relay-info:",
+		ttl:         cfg.RelayInfoCacheTTL,
+		negativeTTL: defaultNegativeCacheTTL,
+		identify: func(r *http.Request) (string, error) {
+			return nostr.ParseRelayURL(r.PathValue("relayURL"))
+		},
+		fetch: func(ctx context.Context, _ *http.Request, relay string) (any, error) {
+			info, err := nostr.FetchRelayInfo(ctx, client, relay)
+			if err != nil {
+				return nil, err
+			}
+
+			resp := relayInfoResponse{RelayInfo: info}
+			if info.Icon != "" {
+				resp.IconProxy = "/img/" + url.PathEscape(info.Icon) + "?w=128&h=128&fit=cover"
+			}
+			return resp, nil
+		},
+		notFound: nostr.ErrRelayInfoNotFound,
+	}
+
+	if lookup.ttl <= 0 {
+		lookup.ttl = defaultRelayInfoCacheTTL
+	}
+
+	return lookup.handler(cfg)
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/coocood/freecache"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+)
+
+func TestRelayInfoHandler(t *testing.T) {
+	var fetches atomic.Int64
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Path == "/html" {
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html></html>")
+			return
+		}
+		w.Header().Set("Content-Type", "application/nostr+json")
+		fmt.Fprint(w, `{"name": "Test relay", "icon": "https://relay.example/icon.png", "supported_nips": [1, 11]}`)
+	}))
+	defer relay.Close()
+
+	cfg := &config.Config{
+		Logger: slog.Default(),
+		Cache:  freecache.NewCache(1024 * 1024),
+		// The relay test server listens on the loopback interface.
+		AllowPrivateNetworks: true,
+	}
+
+	srv := httptest.NewServer(NewServer(cfg))
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(relay.URL, "http")
+
+	get := func(target string) *http.Response {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/relay-info/" + url.PathEscape(target))
+		if err != nil {
+			t.Fatalf("Failed to request the relay information: %v", err)
+		}
+		return resp
+	}
+
+	for range 2 {
+		resp := get(wsURL)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("expected Access-Control-Allow-Origin *, got %q", got)
+		}
+
+		var body struct {
+			URL           string `json:"url"`
+			Name          string `json:"name"`
+			IconProxy     string `json:"icon_proxy"`
+			SupportedNIPs []int  `json:"supported_nips"`
+		}
+		err := json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Failed to decode the response: %v", err)
+		}
+
+		if body.URL != wsURL || body.Name != "Test relay" || len(body.SupportedNIPs) != 2 {
+			t.Errorf("unexpected relay information %+v", body)
+		}
+		if expected := "/img/https:%2F%2Frelay.example%2Ficon.png?w=128&h=128&fit=cover"; body.IconProxy != expected {
+			t.Errorf("expected icon_proxy %s, got %s", expected, body.IconProxy)
+		}
+	}
+
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("expected the relay to be requested once, got %d", got)
+	}
+
+	// A relay without an information document is cached like one that has it.
+	for range 2 {
+		resp := get(wsURL + "/missing")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET /relay-info/%s/missing expected 404, got %d", wsURL, resp.StatusCode)
+		}
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("expected the relay to be requested twice, got %d", got)
+	}
+
+	for target, code := range map[string]int{
+		wsURL + "/html":         http.StatusBadGateway,
+		"https://relay.example": http.StatusBadRequest,
+	} {
+		resp := get(target)
+		resp.Body.Close()
+		if resp.StatusCode != code {
+			t.Errorf("GET /relay-info/%s expected %d, got %d", target, code, resp.StatusCode)
+		}
+	}
+}
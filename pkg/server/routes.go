@@ -1,31 +1,72 @@
 package server
 
 import (
+	"net"
 	"net/http"
-	"net/http/pprof"
-	"os"
+	"net/url"
 
 	"github.com/danvergara/jumble-proxy-server/pkg/config"
+	"github.com/danvergara/jumble-proxy-server/pkg/outbound"
 )
 
 // addRoutes function adds the handler to the server mux.
-func addRoutes(mux *http.ServeMux, cfg *config.Config) {
-	proxy := http.HandlerFunc(proxyHandler(cfg))
-	mux.Handle("GET /sites/{site}", loggingMiddlware(proxy, cfg.Logger))
-
-	// Add pprof routes only if enabled
-	if os.Getenv("ENABLE_PPROF") == "true" {
-		mux.HandleFunc("/debug/pprof/", pprof.Index)
-		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
-		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
-		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
-		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
-		mux.Handle("/debug/pprof/goroutine", pprof.Handler("goroutine"))
-		mux.Handle("/debug/pprof/heap", pprof.Handler("heap"))
-		mux.Handle("/debug/pprof/allocs", pprof.Handler("allocs"))
-		mux.Handle("/debug/pprof/block", pprof.Handler("block"))
-		mux.Handle("/debug/pprof/mutex", pprof.Handler("mutex"))
-
-		cfg.Logger.Info("pprof endpoints enabled at /debug/pprof/")
+// pprof, metrics and the cache management API live on the admin server, see addAdminRoutes.
+func addRoutes(mux *http.ServeMux, cfg *config.Config, st *state) {
+	mux.Handle("GET /healthz", healthzHandler())
+	mux.Handle("GET /readyz", readyzHandler(st.readiness))
+	mux.Handle("GET /version", versionHandler())
+
+	client := newOutboundClient(cfg)
+	gateway := newGatewayClient(cfg)
+	providers := newProviders(cfg, client)
+
+	proxy := nip98AuthMiddleware(http.HandlerFunc(proxyHandler(cfg, client, gateway, providers)), cfg)
+	mux.Handle("GET /sites/{site}", accessLogMiddleware(proxy, cfg, st.metrics))
+	mux.Handle("OPTIONS /sites/{site}", preflightHandler(http.MethodGet))
+
+	// The image proxy is exempt from NIP-98 auth: its URLs end up in img elements and the image of previews,
+	// which browsers fetch without an Authorization header. It only serves images, within ImageMaxBytes.
+	mux.Handle("GET /img/{url}", accessLogMiddleware(imageHandler(cfg, client), cfg, st.metrics))
+
+	nip05 := nip98AuthMiddleware(nip05Handler(cfg, client), cfg)
+	mux.Handle("GET /nip05/{identifier}", accessLogMiddleware(nip05, cfg, st.metrics))
+	mux.Handle("OPTIONS /nip05/{identifier}", preflightHandler(http.MethodGet))
+
+	relayInfo := nip98AuthMiddleware(relayInfoHandler(cfg, client), cfg)
+	mux.Handle("GET /relay-info/{relayURL}", accessLogMiddleware(relayInfo, cfg, st.metrics))
+	mux.Handle("OPTIONS /relay-info/{relayURL}", preflightHandler(http.MethodGet))
+
+	lnurl := nip98AuthMiddleware(lnurlHandler(cfg, client), cfg)
+	mux.Handle("GET /lnurl/{address}", accessLogMiddleware(lnurl, cfg, st.metrics))
+	mux.Handle("OPTIONS /lnurl/{address}", preflightHandler(http.MethodGet))
+
+	batch := nip98AuthMiddleware(batchHandler(cfg, client, gateway, providers), cfg)
+	mux.Handle("POST /batch", accessLogMiddleware(batch, cfg, st.metrics))
+	mux.Handle("OPTIONS /batch", preflightHandler(http.MethodPost))
+}
+
+// newOutboundClient returns the client used for every request to a user supplied URL.
+func newOutboundClient(cfg *config.Config) *http.Client {
+	return outbound.NewClient(outbound.Options{AllowPrivateNetworks: cfg.AllowPrivateNetworks})
+}
+
+// newGatewayClient returns the client IPFS and IPNS content is fetched with from the configured gateway.
+// The address of the gateway, and only it, is trusted, so a local gateway can be used.
+func newGatewayClient(cfg *config.Config) *http.Client {
+	var trusted []string
+	if u, err := url.Parse(cfg.IPFSGatewayURL); err == nil && u.Hostname() != "" {
+		port := u.Port()
+		if port == "" {
+			port = "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+		}
+		trusted = append(trusted, net.JoinHostPort(u.Hostname(), port))
 	}
+
+	return outbound.NewClient(outbound.Options{
+		AllowPrivateNetworks: cfg.AllowPrivateNetworks,
+		TrustedAddresses:     trusted,
+	})
 }
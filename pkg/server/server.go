@@ -2,65 +2,246 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/danvergara/jumble-proxy-server/pkg/config"
 )
 
+// defaultShutdownTimeout is used when cfg.ShutdownTimeout is not set.
+const defaultShutdownTimeout = 10 * time.Second
+
+// state holds the runtime state shared by the public and the admin servers.
+type state struct {
+	readiness *readiness
+	metrics   *metrics
+}
+
+func newState(cfg *config.Config) *state {
+	return &state{
+		readiness: newReadiness(cfg),
+		metrics:   newMetrics(),
+	}
+}
+
 // NewServer constructor returns an http.Handler if possible, which can be a dedicated type for more complex situations.
 // It configures its own muxer and calls out to routes.go
 func NewServer(cfg *config.Config) http.Handler {
+	return newServer(cfg, newState(cfg))
+}
+
+func newServer(cfg *config.Config, st *state) http.Handler {
 	mux := http.NewServeMux()
-	addRoutes(mux, cfg)
+	addRoutes(mux, cfg, st)
 	var handler http.Handler = mux
 	return handler
 }
 
-// Run the proxy server and will help the server to gracefully shut down.
-func Run(ctx context.Context, cfg *config.Config) error {
-	// Creates a context and it's cancelled if there's Interrupt signal.
-	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
-	defer cancel()
+// listener pairs an http.Server with the socket it serves on.
+type listener struct {
+	server *http.Server
+	ln     net.Listener
+}
+
+// Server owns the public and admin listeners and the background workers of the proxy.
+type Server struct {
+	cfg       *config.Config
+	st        *state
+	certs     *certReloader
+	inherited inheritedListeners
+	listeners []listener
+}
 
-	// Creates a new http.Server based on the Server struct.
-	srv := NewServer(cfg)
-	httpServer := &http.Server{
-		Addr:    net.JoinHostPort(cfg.Host, cfg.Port),
-		Handler: srv,
+// Listen binds the public listener, and the admin listener when cfg.AdminListen is set.
+// Listeners can be TCP sockets, Unix domain sockets or sockets inherited from systemd.
+// Inherited sockets that no listener is configured for are closed.
+// Binding errors are returned right away, so callers can fail fast on a busy port.
+// Use port "0" to bind an ephemeral port and read it back with Addr.
+// When cfg.TLSCertFile is set both listeners terminate TLS and negotiate HTTP/2.
+func Listen(cfg *config.Config) (*Server, error) {
+	s := &Server{cfg: cfg, st: newState(cfg)}
+	defer s.inherited.closeUnused()
+
+	var publicTLS, adminTLS *tls.Config
+	if cfg.TLSCertFile != "" {
+		certs, err := newCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		s.certs = certs
+
+		publicTLS, err = newTLSConfig(cfg, certs)
+		if err != nil {
+			return nil, err
+		}
+
+		adminTLS, err = newAdminTLSConfig(cfg, publicTLS)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Runs the server in a separate go routine.
-	go func() {
-		cfg.Logger.Info(fmt.Sprintf("Listening on %s", httpServer.Addr))
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			cfg.Logger.Error(fmt.Sprintf("Error listening and serving: %s", err))
+	if err := s.listen(cfg.Listen, newServer(cfg, s.st), publicTLS); err != nil {
+		return nil, err
+	}
+
+	if !cfg.AdminListen.IsZero() {
+		if err := s.listen(cfg.AdminListen, newAdminServer(cfg, s.st), adminTLS); err != nil {
+			s.close()
+			return nil, err
 		}
-	}()
+	}
+
+	return s, nil
+}
+
+func (s *Server) listen(spec config.Listener, handler http.Handler, tlsConfig *tls.Config) error {
+	ln, err := newListener(spec, &s.inherited)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", spec, err)
+	}
+
+	s.listeners = append(s.listeners, listener{
+		server: &http.Server{Addr: spec.String(), Handler: handler, TLSConfig: tlsConfig},
+		ln:     ln,
+	})
+
+	return nil
+}
+
+// serve serves on the listener, terminating TLS when the server has a TLS configuration.
+// ServeTLS also enables HTTP/2 through ALPN.
+func (l listener) serve() error {
+	if l.server.TLSConfig != nil {
+		return l.server.ServeTLS(l.ln, "", "")
+	}
+	return l.server.Serve(l.ln)
+}
+
+func (s *Server) close() {
+	for _, l := range s.listeners {
+		l.ln.Close()
+	}
+}
+
+// Addr returns the address the public server is bound to.
+func (s *Server) Addr() net.Addr {
+	return s.listeners[0].ln.Addr()
+}
+
+// AdminAddr returns the address the admin server is bound to, or nil if it is disabled.
+func (s *Server) AdminAddr() net.Addr {
+	if len(s.listeners) < 2 {
+		return nil
+	}
+	return s.listeners[1].ln.Addr()
+}
+
+// Serve serves on every listener until ctx is cancelled or one of them fails, then shuts everything down.
+// Readiness starts failing first, in-flight requests are drained within cfg.ShutdownTimeout,
+// and background workers are stopped before Serve returns.
+// The returned error is the listener failure, if any, joined with any shutdown error.
+func (s *Server) Serve(ctx context.Context) error {
+	cfg := s.cfg
+
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	s.startWorkers(workersCtx, &workers)
+
+	errCh := make(chan error, len(s.listeners))
+
+	// Runs every server in a separate go routine.
+	for _, l := range s.listeners {
+		go func() {
+			cfg.Logger.Info(fmt.Sprintf("Listening on %s", l.ln.Addr()))
+			if err := l.serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errCh <- fmt.Errorf("serving on %s: %w", l.ln.Addr(), err)
+			}
+		}()
+	}
+
+	var serveErr error
+
+	// Blocks until the context gets cancelled or a listener stops on its own.
+	select {
+	case <-ctx.Done():
+		// Fail the readiness probe first, so load balancers stop routing new traffic before the listener closes.
+		s.st.readiness.shuttingDown.Store(true)
+		if cfg.ShutdownDelay > 0 {
+			cfg.Logger.Info(fmt.Sprintf("Waiting %s for load balancers to drain", cfg.ShutdownDelay))
+			time.Sleep(cfg.ShutdownDelay)
+		}
+	case serveErr = <-errCh:
+		s.st.readiness.shuttingDown.Store(true)
+		cfg.Logger.Error(fmt.Sprintf("Error listening and serving: %s", serveErr))
+	}
+
+	timeout := cfg.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	// Create a WaitGroup to wait on different goroutine that gracefully shuts down the server.
+	// Shuts the servers down concurrently, so they share the same drain budget.
+	shutdownErrs := make([]error, len(s.listeners))
 	var wg sync.WaitGroup
-	wg.Add(1)
+	for i, l := range s.listeners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.server.Shutdown(shutdownCtx); err != nil {
+				shutdownErrs[i] = fmt.Errorf("shutting down %s: %w", l.ln.Addr(), err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stopWorkers()
+	workers.Wait()
+
+	cfg.Logger.Info("Server stopped")
 
+	return errors.Join(append([]error{serveErr}, shutdownErrs...)...)
+}
+
+// startWorkers launches the background workers, which must return once ctx is cancelled.
+func (s *Server) startWorkers(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		// Read from Done channel and it blocks until the context created by the NotifyContext function gets cancelled.
-		<-ctx.Done()
-		shutdownCtx := context.Background()
-		shutdownCtx, cancel := context.WithTimeout(shutdownCtx, 10*time.Second)
-		defer cancel()
-		// This goroutine gracefully shuts down the server, but it only gives the process 10 seconds before for wrapping up and return a context's Error.
-		if err := httpServer.Shutdown(shutdownCtx); err != nil {
-			cfg.Logger.Error(fmt.Sprintf("Error shutting down http server: %s", err))
-		}
+		s.st.readiness.refresh(ctx)
 	}()
 
-	wg.Wait()
+	if s.certs != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.certs.watch(ctx, certReloadInterval, s.cfg.Logger)
+		}()
+	}
+}
 
-	return nil
+// Run the proxy server and will help the server to gracefully shut down on SIGINT or SIGTERM.
+// When cfg.AdminListen is set, the admin server is run alongside it and both are shut down together.
+func Run(ctx context.Context, cfg *config.Config) error {
+	// Creates a context and it's cancelled if there's an Interrupt or a Terminate signal.
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	s, err := Listen(cfg)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ctx)
 }
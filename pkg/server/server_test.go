@@ -2,13 +2,19 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
+
+	"github.com/coocood/freecache"
 
 	"github.com/danvergara/jumble-proxy-server/pkg/config"
 )
@@ -40,16 +46,24 @@ func TestServer(t *testing.T) {
 	logger := slog.Default()
 
 	cfg := config.Config{
-		Port:   "8080",
+		Listen: config.Listener{Network: config.NetworkTCP, Address: "127.0.0.1:0"},
 		Logger: logger,
+		// The test site listens on the loopback interface.
+		AllowPrivateNetworks: true,
+		RawPassthrough:       true,
 	}
 
 	site := httptest.NewServer(http.HandlerFunc(htmlHandler))
 	defer site.Close()
 
-	go Run(ctx, &cfg)
+	s, err := Listen(&cfg)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
 
-	resp, err := http.Get(fmt.Sprintf("http://localhost:8080/sites/%s", url.QueryEscape(site.URL)))
+	go s.Serve(ctx)
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/sites/%s", s.Addr(), url.QueryEscape(site.URL)))
 	if err != nil {
 		t.Fatalf("Failed to make request to the site through the proxy server: %v", err)
 	}
@@ -76,3 +90,190 @@ func TestServer(t *testing.T) {
 			htmlContent, string(body))
 	}
 }
+
+func TestRunReturnsListenError(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to bind a port: %v", err)
+	}
+	defer busy.Close()
+
+	cfg := config.Config{
+		Listen: config.Listener{Network: config.NetworkTCP, Address: busy.Addr().String()},
+		Logger: slog.Default(),
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- Run(context.Background(), &cfg) }()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatalf("expected Run to fail on a busy port")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Run did not return on a busy port")
+	}
+}
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	slowSite := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		htmlHandler(w, r)
+	}))
+	defer slowSite.Close()
+
+	cfg := config.Config{
+		Listen:          config.Listener{Network: config.NetworkTCP, Address: "127.0.0.1:0"},
+		Logger:          slog.Default(),
+		ShutdownTimeout: 5 * time.Second,
+		// The test site listens on the loopback interface.
+		AllowPrivateNetworks: true,
+		RawPassthrough:       true,
+	}
+
+	s, err := Listen(&cfg)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- s.Serve(ctx) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	respCh := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(fmt.Sprintf("http://%s/sites/%s", s.Addr(), url.QueryEscape(slowSite.URL)))
+		if err != nil {
+			respCh <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		respCh <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+
+	// New connections are refused once the shutdown has started.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", s.Addr().String())
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatalf("listener still accepting connections after shutdown started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(release)
+
+	res := <-respCh
+	if res.err != nil {
+		t.Fatalf("in-flight request failed during shutdown: %v", res.err)
+	}
+	if res.body != htmlContent {
+		t.Fatalf("in-flight request got an unexpected body %q", res.body)
+	}
+
+	if err := <-serveErr; err != nil {
+		t.Fatalf("expected a clean shutdown, got %v", err)
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	cfg := &config.Config{
+		Listen: config.Listener{Network: config.NetworkTCP, Address: ":8080"},
+		Logger: slog.Default(),
+		Cache:  freecache.NewCache(1024 * 1024),
+	}
+
+	var githubErr error
+	st := newState(cfg)
+	rd := st.readiness
+
+	srv := httptest.NewServer(newServer(cfg, st))
+	defer srv.Close()
+
+	readyz := func() (int, map[string]any) {
+		t.Helper()
+		// Reset the cached GitHub check so every call observes the current state.
+		rd.githubCheckedAt = time.Time{}
+
+		resp, err := http.Get(srv.URL + "/readyz")
+		if err != nil {
+			t.Fatalf("Failed to request /readyz: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var body map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode /readyz response: %v", err)
+		}
+
+		return resp.StatusCode, body
+	}
+
+	resp, err := http.Get(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("Failed to request /healthz: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected /healthz to return 200, got %d", resp.StatusCode)
+	}
+
+	// Without a GitHub token, the GitHub check is skipped.
+	code, body := readyz()
+	if code != http.StatusOK {
+		t.Fatalf("expected /readyz to return 200 without a GitHub token, got %d: %v", code, body)
+	}
+	if checks := body["checks"].(map[string]any); checks["github"] != "skipped: no token configured" {
+		t.Fatalf("expected the github check to be skipped, got %v", checks)
+	}
+
+	rd.githubCheck = func(ctx context.Context) error { return githubErr }
+	if code, body := readyz(); code != http.StatusOK {
+		t.Fatalf("expected /readyz to return 200, got %d: %v", code, body)
+	}
+
+	githubErr = errors.New("rate limited")
+	code, body = readyz()
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("expected /readyz to fail when GitHub is rate limited, got %d", code)
+	}
+	if checks := body["checks"].(map[string]any); checks["github"] != "rate limited" {
+		t.Fatalf("expected the github check to report the error, got %v", checks)
+	}
+
+	githubErr = nil
+	rd.shuttingDown.Store(true)
+	if code, _ := readyz(); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected /readyz to fail while shutting down, got %d", code)
+	}
+
+	resp, err = http.Get(srv.URL + "/version")
+	if err != nil {
+		t.Fatalf("Failed to request /version: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var info map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatalf("Failed to decode /version response: %v", err)
+	}
+	if info["version"] == "" || info["go_version"] == "" {
+		t.Fatalf("expected version and go_version in /version response, got %v", info)
+	}
+}
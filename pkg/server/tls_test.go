@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coocood/freecache"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/config"
+)
+
+// testCA is a self-signed certificate authority generated in-process.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate the CA key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create the CA certificate: %v", err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns a PEM encoded certificate and key signed by the CA.
+func (ca *testCA) issue(t *testing.T, serial int64, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate the key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Failed to create the certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal the key: %v", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestTLSServer(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	caFile := filepath.Join(dir, "ca.pem")
+
+	certPEM, keyPEM := ca.issue(t, 10, x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+	writeFile(t, caFile, ca.pem)
+
+	cfg := &config.Config{
+		Listen:            config.Listener{Network: config.NetworkTCP, Address: "127.0.0.1:0"},
+		Logger:            slog.Default(),
+		Cache:             freecache.NewCache(1024 * 1024),
+		AdminListen:       config.Listener{Network: config.NetworkTCP, Address: "127.0.0.1:0"},
+		TLSCertFile:       certFile,
+		TLSKeyFile:        keyFile,
+		TLSMinVersion:     "1.2",
+		AdminClientCAFile: caFile,
+	}
+
+	s, err := Listen(cfg)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go s.Serve(ctx)
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.pem)
+
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: certs},
+			ForceAttemptHTTP2: true,
+		}}
+	}
+
+	resp, err := newClient().Get(fmt.Sprintf("https://%s/healthz", s.Addr()))
+	if err != nil {
+		t.Fatalf("Failed to request the TLS server: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.ProtoMajor != 2 {
+		t.Errorf("expected HTTP/2, got %s", resp.Proto)
+	}
+	if serial := resp.TLS.PeerCertificates[0].SerialNumber.Int64(); serial != 10 {
+		t.Errorf("expected certificate serial 10, got %d", serial)
+	}
+
+	t.Run("reloads the certificate on change", func(t *testing.T) {
+		certPEM, keyPEM := ca.issue(t, 20, x509.ExtKeyUsageServerAuth)
+		writeFile(t, certFile, certPEM)
+		writeFile(t, keyFile, keyPEM)
+
+		// Make sure the modification time moves forward even on coarse filesystems.
+		future := time.Now().Add(time.Minute)
+		os.Chtimes(certFile, future, future)
+
+		reloaded, err := s.certs.reload()
+		if err != nil || !reloaded {
+			t.Fatalf("expected the certificate to be reloaded, got %v, %v", reloaded, err)
+		}
+
+		resp, err := newClient().Get(fmt.Sprintf("https://%s/healthz", s.Addr()))
+		if err != nil {
+			t.Fatalf("Failed to request the TLS server: %v", err)
+		}
+		resp.Body.Close()
+
+		if serial := resp.TLS.PeerCertificates[0].SerialNumber.Int64(); serial != 20 {
+			t.Errorf("expected certificate serial 20, got %d", serial)
+		}
+	})
+
+	t.Run("admin requires a client certificate", func(t *testing.T) {
+		adminURL := fmt.Sprintf("https://%s/metrics", s.AdminAddr())
+
+		if resp, err := newClient().Get(adminURL); err == nil {
+			resp.Body.Close()
+			t.Fatalf("expected the admin request without a client certificate to fail")
+		}
+
+		clientCertPEM, clientKeyPEM := ca.issue(t, 30, x509.ExtKeyUsageClientAuth)
+		clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+		if err != nil {
+			t.Fatalf("Failed to load the client certificate: %v", err)
+		}
+
+		resp, err := newClient(clientCert).Get(adminURL)
+		if err != nil {
+			t.Fatalf("Failed to request the admin server with a client certificate: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200 from the admin server, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestParseTLSOptions(t *testing.T) {
+	if _, err := parseTLSVersion("1.4"); err == nil {
+		t.Errorf("expected an error for an unknown TLS version")
+	}
+
+	ids, err := parseCipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"})
+	if err != nil || len(ids) != 1 || ids[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("unexpected cipher suites %v, %v", ids, err)
+	}
+
+	if _, err := parseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"}); err == nil {
+		t.Errorf("expected an error for an insecure cipher suite")
+	}
+
+	if _, err := parseCipherSuites([]string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"}); err == nil {
+		t.Errorf("expected an error for cipher suites without the one HTTP/2 requires")
+	}
+}
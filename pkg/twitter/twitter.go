@@ -0,0 +1,423 @@
+// Package twitter builds link previews of X/Twitter posts from the public syndication and oEmbed endpoints,
+// since x.com only serves a JavaScript shell without usable metadata.
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/logging"
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+	"github.com/danvergara/jumble-proxy-server/pkg/outbound"
+)
+
+const (
+	// DefaultSyndicationURL is the base URL of the syndication API used by embedded posts.
+	DefaultSyndicationURL = "https://cdn.syndication.twimg.com"
+	// DefaultOEmbedURL is the oEmbed endpoint of X.
+	DefaultOEmbedURL = "https://publish.twitter.com/oembed"
+
+	// maxResponseBytes caps the size of a syndication or oEmbed response.
+	maxResponseBytes = 2 << 20
+)
+
+// ErrUnavailable is returned when a post was deleted, or belongs to a protected or suspended account.
+var ErrUnavailable = errors.New("post unavailable")
+
+// hosts are the hosts serving post URLs, including the Nitter front-end.
+var hosts = map[string]bool{
+	"x.com":              true,
+	"www.x.com":          true,
+	"mobile.x.com":       true,
+	"twitter.com":        true,
+	"www.twitter.com":    true,
+	"mobile.twitter.com": true,
+	"nitter.net":         true,
+	"fxtwitter.com":      true,
+	"vxtwitter.com":      true,
+	"fixupx.com":         true,
+}
+
+var (
+	screenName = regexp.MustCompile(`^[A-Za-z0-9_]{1,15}$`)
+	postID     = regexp.MustCompile(`^[0-9]{1,20}$`)
+)
+
+// Post is the post a URL points to.
+type Post struct {
+	// ScreenName is empty for /i/web/status/ URLs.
+	ScreenName string
+	ID         string
+}
+
+// URL returns the canonical URL of the post.
+func (p Post) URL() string {
+	user := p.ScreenName
+	if user == "" {
+		user = "i/web"
+	}
+	return "https://x.com/" + user + "/status/" + p.ID
+}
+
+// Parse returns the post of a status URL, like https://x.com/user/status/123 or https://twitter.com/i/web/status/123.
+func Parse(rawURL string) (Post, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Post{}, err
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || !hosts[strings.ToLower(u.Hostname())] {
+		return Post{}, errors.New("not an X URL")
+	}
+
+	segments := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+
+	switch {
+	case len(segments) >= 4 && segments[0] == "i" && segments[1] == "web" &&
+		(segments[2] == "status" || segments[2] == "statuses"):
+		segments = segments[2:]
+		if !postID.MatchString(segments[1]) {
+			return Post{}, fmt.Errorf("invalid post ID %q", segments[1])
+		}
+		return Post{ID: segments[1]}, nil
+	case len(segments) >= 3 && (segments[1] == "status" || segments[1] == "statuses"):
+		if !screenName.MatchString(segments[0]) {
+			return Post{}, fmt.Errorf("invalid screen name %q", segments[0])
+		}
+		// The ID may be followed by /photo/1, /video/1 or /analytics.
+		if !postID.MatchString(segments[2]) {
+			return Post{}, fmt.Errorf("invalid post ID %q", segments[2])
+		}
+		return Post{ScreenName: segments[0], ID: segments[2]}, nil
+	default:
+		return Post{}, errors.New("not a post URL")
+	}
+}
+
+// Options configures the client.
+type Options struct {
+	// HTTPClient sends the syndication and oEmbed requests. It defaults to an outbound client.
+	HTTPClient *http.Client
+	// SyndicationURL defaults to DefaultSyndicationURL.
+	SyndicationURL string
+	// OEmbedURL defaults to DefaultOEmbedURL.
+	OEmbedURL string
+}
+
+// Client builds previews of X posts.
+type Client struct {
+	client         *http.Client
+	syndicationURL string
+	oembedURL      string
+}
+
+func New(opts Options) *Client {
+	c := &Client{
+		client:         opts.HTTPClient,
+		syndicationURL: strings.TrimSuffix(opts.SyndicationURL, "/"),
+		oembedURL:      opts.OEmbedURL,
+	}
+
+	if c.client == nil {
+		c.client = outbound.NewClient(outbound.Options{})
+	}
+	if c.syndicationURL == "" {
+		c.syndicationURL = DefaultSyndicationURL
+	}
+	if c.oembedURL == "" {
+		c.oembedURL = DefaultOEmbedURL
+	}
+
+	return c
+}
+
+// Match reports whether u is the URL of a post.
+func (c *Client) Match(u *url.URL) bool {
+	_, err := Parse(u.String())
+	return err == nil
+}
+
+// Preview returns the head of the preview document of a post.
+// The syndication API is tried first and the oEmbed endpoint second.
+// Deleted and protected posts get a placeholder preview rather than an error.
+func (c *Client) Preview(ctx context.Context, u *url.URL) (opengraph.Head, error) {
+	post, err := Parse(u.String())
+	if err != nil {
+		return opengraph.Head{}, err
+	}
+
+	head, err := c.syndicationHead(ctx, post)
+	if err != nil && !errors.Is(err, ErrUnavailable) {
+		logging.FromContext(ctx).Warn(
+			"Failed to query the X syndication API, falling back to oEmbed",
+			slog.String("site", u.String()),
+			slog.Any("error", err),
+		)
+		head, err = c.oembedHead(ctx, post)
+	}
+
+	if errors.Is(err, ErrUnavailable) {
+		return placeholderHead(post), nil
+	}
+
+	return head, err
+}
+
+type user struct {
+	Name            string `json:"name"`
+	ScreenName      string `json:"screen_name"`
+	ProfileImageURL string `json:"profile_image_url_https"`
+}
+
+type tweet struct {
+	Typename  string `json:"__typename"`
+	IDStr     string `json:"id_str"`
+	Text      string `json:"text"`
+	CreatedAt string `json:"created_at"`
+	User      user   `json:"user"`
+	Entities  struct {
+		URLs []struct {
+			URL         string `json:"url"`
+			ExpandedURL string `json:"expanded_url"`
+		} `json:"urls"`
+		Media []struct {
+			URL string `json:"url"`
+		} `json:"media"`
+	} `json:"entities"`
+	MediaDetails []struct {
+		MediaURLHTTPS string `json:"media_url_https"`
+		OriginalInfo  struct {
+			Width  int `json:"width"`
+			Height int `json:"height"`
+		} `json:"original_info"`
+	} `json:"mediaDetails"`
+	QuotedTweet *tweet `json:"quoted_tweet"`
+}
+
+// syndicationHead builds the preview of a post from the syndication API.
+func (c *Client) syndicationHead(ctx context.Context, post Post) (opengraph.Head, error) {
+	params := url.Values{"id": {post.ID}, "lang": {"en"}, "token": {token(post.ID)}}
+
+	var t tweet
+	if err := c.get(ctx, c.syndicationURL+"/tweet-result?"+params.Encode(), &t); err != nil {
+		return opengraph.Head{}, err
+	}
+
+	// Protected, suspended and age restricted posts are answered with a tombstone.
+	if t.Typename == "TweetTombstone" || t.IDStr == "" {
+		return opengraph.Head{}, ErrUnavailable
+	}
+
+	if post.ScreenName == "" {
+		post.ScreenName = t.User.ScreenName
+	}
+
+	head := newHead(post, t.User.Name, t.User.ScreenName)
+
+	description := t.text()
+	if q := t.QuotedTweet; q != nil && q.IDStr != "" {
+		description += "\n\nQuoting " + q.User.Name + " (@" + q.User.ScreenName + "): " + q.text()
+	}
+	head.SetMeta("og:description", strings.TrimSpace(description))
+
+	if created, err := time.Parse(time.RFC3339, t.CreatedAt); err == nil {
+		head.SetMeta("article:published_time", created.UTC().Format(time.RFC3339))
+	}
+
+	media := t.MediaDetails
+	if len(media) == 0 && t.QuotedTweet != nil {
+		media = t.QuotedTweet.MediaDetails
+	}
+
+	if len(media) > 0 && media[0].MediaURLHTTPS != "" {
+		head.SetMeta("og:image", media[0].MediaURLHTTPS)
+		head.SetMeta("og:image:width", opengraph.FormatPositive(media[0].OriginalInfo.Width))
+		head.SetMeta("og:image:height", opengraph.FormatPositive(media[0].OriginalInfo.Height))
+		head.SetMeta("twitter:card", "summary_large_image")
+	} else if avatar := t.User.ProfileImageURL; avatar != "" {
+		head.SetMeta("og:image", strings.Replace(avatar, "_normal.", "_400x400.", 1))
+	}
+
+	return head, nil
+}
+
+// text returns the text of the post, with the shortened links expanded and the links to its media removed.
+func (t tweet) text() string {
+	text := t.Text
+	for _, u := range t.Entities.URLs {
+		text = strings.ReplaceAll(text, u.URL, u.ExpandedURL)
+	}
+	for _, m := range t.Entities.Media {
+		text = strings.ReplaceAll(text, m.URL, "")
+	}
+	return strings.TrimSpace(html.UnescapeString(text))
+}
+
+// oembedHead builds the preview of a post from the oEmbed endpoint, whose HTML snippet holds the text of the post.
+func (c *Client) oembedHead(ctx context.Context, post Post) (opengraph.Head, error) {
+	params := url.Values{"url": {post.URL()}, "omit_script": {"true"}, "dnt": {"true"}}
+
+	var resp struct {
+		AuthorName string `json:"author_name"`
+		AuthorURL  string `json:"author_url"`
+		HTML       string `json:"html"`
+	}
+	if err := c.get(ctx, c.oembedURL+"?"+params.Encode(), &resp); err != nil {
+		return opengraph.Head{}, err
+	}
+
+	screen := post.ScreenName
+	if author, err := url.Parse(resp.AuthorURL); err == nil && screenName.MatchString(strings.Trim(author.Path, "/")) {
+		screen = strings.Trim(author.Path, "/")
+	}
+	post.ScreenName = screen
+
+	head := newHead(post, resp.AuthorName, screen)
+	if text := blockquoteText(resp.HTML); text != "" {
+		head.SetMeta("og:description", text)
+	}
+
+	return head, nil
+}
+
+// get decodes the JSON document at rawURL into v.
+// Missing and forbidden documents are reported as ErrUnavailable.
+func (c *Client) get(ctx context.Context, rawURL string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusForbidden:
+		return ErrUnavailable
+	default:
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(v)
+}
+
+// newHead returns a head with the title and the properties every post preview shares.
+func newHead(post Post, name, screen string) opengraph.Head {
+	title := "Post on X"
+	switch {
+	case name != "" && screen != "":
+		title = name + " (@" + screen + ") on X"
+	case name != "":
+		title = name + " on X"
+	}
+
+	head := opengraph.Head{Title: title, Charset: "utf-8"}
+	head.SetMeta("og:title", title)
+	head.SetMeta("og:site_name", "X")
+	head.SetMeta("og:type", "article")
+	head.SetMeta("og:url", post.URL())
+	head.SetMeta("twitter:card", "summary")
+	if name != "" {
+		head.SetMeta("author", name)
+	}
+	if screen != "" {
+		head.SetMeta("twitter:creator", "@"+screen)
+	}
+
+	return head
+}
+
+// placeholderHead is the preview of a post that cannot be shown.
+func placeholderHead(post Post) opengraph.Head {
+	head := newHead(post, "", post.ScreenName)
+	head.Title = "Post unavailable"
+	head.SetMeta("og:title", "Post unavailable")
+	head.SetMeta(
+		"og:description",
+		"This post was deleted, or its author limits who can view it.",
+	)
+	return head
+}
+
+// blockquoteText returns the text of the first paragraph of the blockquote of an embedded post.
+func blockquoteText(snippet string) string {
+	z := html.NewTokenizer(strings.NewReader(snippet))
+
+	var (
+		inParagraph bool
+		text        strings.Builder
+	)
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return strings.TrimSpace(text.String())
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.P:
+				inParagraph = true
+			case atom.Br:
+				if inParagraph {
+					text.WriteByte('\n')
+				}
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			if atom.Lookup(name) == atom.P && inParagraph {
+				return strings.TrimSpace(text.String())
+			}
+		case html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			if atom.Lookup(name) == atom.Br && inParagraph {
+				text.WriteByte('\n')
+			}
+		case html.TextToken:
+			if inParagraph {
+				text.Write(z.Text())
+			}
+		}
+	}
+}
+
+// token returns the token expected by the syndication API, computed like the embed script does:
+// (id / 1e15 * π) in base 36, without zeros and the decimal point.
+func token(id string) string {
+	n, err := strconv.ParseFloat(id, 64)
+	if err != nil {
+		return ""
+	}
+
+	v := n / 1e15 * math.Pi
+	integer := math.Floor(v)
+	fraction := v - integer
+
+	s := strconv.FormatInt(int64(integer), 36)
+	for range 10 {
+		fraction *= 36
+		digit := math.Floor(fraction)
+		s += strconv.FormatInt(int64(digit), 36)
+		fraction -= digit
+	}
+
+	return strings.NewReplacer("0", "", ".", "").Replace(s)
+}
@@ -0,0 +1,185 @@
+package twitter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		url         string
+		expected    Post
+		expectError bool
+	}{
+		{url: "https://x.com/jack/status/20", expected: Post{ScreenName: "jack", ID: "20"}},
+		{url: "https://twitter.com/jack/status/20?s=20", expected: Post{ScreenName: "jack", ID: "20"}},
+		{url: "https://mobile.twitter.com/jack/statuses/20", expected: Post{ScreenName: "jack", ID: "20"}},
+		{url: "https://x.com/jack/status/20/photo/1", expected: Post{ScreenName: "jack", ID: "20"}},
+		{url: "https://nitter.net/jack/status/20#m", expected: Post{ScreenName: "jack", ID: "20"}},
+		{url: "https://twitter.com/i/web/status/20", expected: Post{ID: "20"}},
+		{url: "https://x.com/jack", expectError: true},
+		{url: "https://x.com/jack/status/abc", expectError: true},
+		{url: "https://x.com/not-a-user/status/20", expectError: true},
+		{url: "https://example.com/jack/status/20", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			post, err := Parse(tt.url)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Parse() expected error, got %+v", post)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Parse() unexpected error: %v", err)
+			}
+
+			if post != tt.expected {
+				t.Errorf("Parse() = %+v, expected %+v", post, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClientPreview(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.URL.Path == "/oembed" {
+			fmt.Fprint(w, `{"author_name": "Jack", "author_url": "https://twitter.com/jack",
+				"html": "<blockquote class=\"twitter-tweet\"><p lang=\"en\" dir=\"ltr\">just setting up my twttr<br>again</p>&mdash; jack (@jack) <a href=\"https://twitter.com/jack/status/30\">March 21, 2006</a></blockquote>"}`)
+			return
+		}
+
+		if r.URL.Query().Get("token") == "" {
+			http.Error(w, "missing token", http.StatusBadRequest)
+			return
+		}
+
+		switch r.URL.Query().Get("id") {
+		case "20":
+			fmt.Fprint(w, `{
+				"__typename": "Tweet",
+				"id_str": "20",
+				"text": "look at this &amp; that https://t.co/link https://t.co/media",
+				"created_at": "2006-03-21T20:50:14.000Z",
+				"user": {"name": "jack", "screen_name": "jack", "profile_image_url_https": "https://pbs.twimg.com/profile_images/1/a_normal.jpg"},
+				"entities": {
+					"urls": [{"url": "https://t.co/link", "expanded_url": "https://example.com/article"}],
+					"media": [{"url": "https://t.co/media"}]
+				},
+				"mediaDetails": [{"type": "photo", "media_url_https": "https://pbs.twimg.com/media/photo.jpg", "original_info": {"width": 1200, "height": 800}}],
+				"quoted_tweet": {"id_str": "10", "text": "quoted text", "user": {"name": "Biz", "screen_name": "biz"}}
+			}`)
+		case "21":
+			fmt.Fprint(w, `{
+				"__typename": "Tweet",
+				"id_str": "21",
+				"text": "no media",
+				"user": {"name": "jack", "screen_name": "jack", "profile_image_url_https": "https://pbs.twimg.com/profile_images/1/a_normal.jpg"}
+			}`)
+		case "30":
+			http.Error(w, "upstream hiccup", http.StatusInternalServerError)
+		case "40":
+			fmt.Fprint(w, `{"__typename": "TweetTombstone", "tombstone": {"text": {"text": "You’re unable to view this Post"}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(Options{HTTPClient: srv.Client(), SyndicationURL: srv.URL, OEmbedURL: srv.URL + "/oembed"})
+
+	placeholder := func(user, id string) opengraph.Metadata {
+		return opengraph.Metadata{
+			URL:         "https://x.com/" + user + "/status/" + id,
+			Title:       "Post unavailable",
+			Description: "This post was deleted, or its author limits who can view it.",
+			SiteName:    "X",
+			Type:        "article",
+		}
+	}
+
+	tests := []struct {
+		name     string
+		url      string
+		expected opengraph.Metadata
+	}{
+		{
+			name: "post with media and quote",
+			url:  "https://twitter.com/i/web/status/20",
+			expected: opengraph.Metadata{
+				URL:         "https://x.com/jack/status/20",
+				Title:       "jack (@jack) on X",
+				Description: "look at this & that https://example.com/article\n\nQuoting Biz (@biz): quoted text",
+				Image:       "https://pbs.twimg.com/media/photo.jpg",
+				ImageWidth:  1200,
+				ImageHeight: 800,
+				SiteName:    "X",
+				Type:        "article",
+				Author:      "jack",
+			},
+		},
+		{
+			name: "post without media uses the avatar",
+			url:  "https://x.com/jack/status/21",
+			expected: opengraph.Metadata{
+				URL:         "https://x.com/jack/status/21",
+				Title:       "jack (@jack) on X",
+				Description: "no media",
+				Image:       "https://pbs.twimg.com/profile_images/1/a_400x400.jpg",
+				SiteName:    "X",
+				Type:        "article",
+				Author:      "jack",
+			},
+		},
+		{
+			name: "oEmbed fallback",
+			url:  "https://x.com/jack/status/30",
+			expected: opengraph.Metadata{
+				URL:         "https://x.com/jack/status/30",
+				Title:       "Jack (@jack) on X",
+				Description: "just setting up my twttr\nagain",
+				SiteName:    "X",
+				Type:        "article",
+				Author:      "Jack",
+			},
+		},
+		{name: "protected", url: "https://x.com/locked/status/40", expected: placeholder("locked", "40")},
+		{name: "deleted", url: "https://x.com/gone/status/50", expected: placeholder("gone", "50")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+
+			head, err := c.Preview(context.Background(), u)
+			if err != nil {
+				t.Fatalf("Preview() unexpected error: %v", err)
+			}
+
+			if md := head.Metadata(); md != tt.expected {
+				t.Errorf("Preview() metadata = %+v, expected %+v", md, tt.expected)
+			}
+		})
+	}
+}
+
+func TestToken(t *testing.T) {
+	if got := token("20"); got == "" {
+		t.Errorf("token() = %q, expected a non empty token", got)
+	}
+	if got := token("1628832338187636740"); got == "" || got != token("1628832338187636740") {
+		t.Errorf("token() = %q, expected a stable non empty token", got)
+	}
+}
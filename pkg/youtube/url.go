@@ -0,0 +1,245 @@
+package youtube
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind is the kind of resource a YouTube URL points to.
+type Kind int
+
+const (
+	Unknown Kind = iota
+	Video
+	Short
+	Live
+	Playlist
+	Channel
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Video:
+		return "video"
+	case Short:
+		return "short"
+	case Live:
+		return "live"
+	case Playlist:
+		return "playlist"
+	case Channel:
+		return "channel"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrNotYouTube is returned by Parse for URLs that do not point to a YouTube resource.
+var ErrNotYouTube = errors.New("not a YouTube URL")
+
+// Resource is the YouTube resource a URL points to.
+type Resource struct {
+	Kind Kind
+	// ID is the video, playlist or channel ID. It is empty for channels given by handle or legacy name.
+	ID string
+	// Handle is the @handle of a channel, including the @.
+	Handle string
+	// Username is the legacy /user/ or /c/ name of a channel.
+	Username string
+	// PlaylistID is the playlist a video is watched from, if any.
+	PlaylistID string
+	// Start is the timestamp given by the t or start parameter.
+	Start time.Duration
+}
+
+var (
+	videoID    = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	playlistID = regexp.MustCompile(`^[A-Za-z0-9_-]{2,64}$`)
+	channelID  = regexp.MustCompile(`^UC[A-Za-z0-9_-]{22}$`)
+	handle     = regexp.MustCompile(`^@[A-Za-z0-9_.-]{3,30}$`)
+	name       = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,100}$`)
+	timestamp  = regexp.MustCompile(`^(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s?)?$`)
+)
+
+// hosts are the hosts serving youtube.com URLs.
+var hosts = map[string]bool{
+	"youtube.com":              true,
+	"www.youtube.com":          true,
+	"m.youtube.com":            true,
+	"music.youtube.com":        true,
+	"youtube-nocookie.com":     true,
+	"www.youtube-nocookie.com": true,
+}
+
+// Parse returns the resource of a YouTube watch, shorts, live, embed, youtu.be, playlist or channel URL.
+func Parse(rawURL string) (Resource, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Resource{}, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return Resource{}, ErrNotYouTube
+	}
+
+	host := strings.ToLower(u.Hostname())
+	segments := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+	query := u.Query()
+
+	var res Resource
+
+	switch {
+	case host == "youtu.be":
+		if len(segments) != 1 {
+			return Resource{}, ErrNotYouTube
+		}
+		res = Resource{Kind: Video, ID: segments[0]}
+	case hosts[host]:
+		res, err = parsePath(segments, query)
+		if err != nil {
+			return Resource{}, err
+		}
+	default:
+		return Resource{}, ErrNotYouTube
+	}
+
+	switch res.Kind {
+	case Video, Short, Live:
+		if !videoID.MatchString(res.ID) {
+			return Resource{}, fmt.Errorf("invalid video ID %q", res.ID)
+		}
+		if list := query.Get("list"); playlistID.MatchString(list) {
+			res.PlaylistID = list
+		}
+		res.Start = parseStart(query, u.Fragment)
+	case Playlist:
+		if !playlistID.MatchString(res.ID) {
+			return Resource{}, fmt.Errorf("invalid playlist ID %q", res.ID)
+		}
+	}
+
+	return res, nil
+}
+
+// parsePath returns the resource of the path of a youtube.com URL.
+func parsePath(segments []string, query url.Values) (Resource, error) {
+	if len(segments) == 0 {
+		return Resource{}, ErrNotYouTube
+	}
+
+	switch segments[0] {
+	case "watch":
+		return Resource{Kind: Video, ID: query.Get("v")}, nil
+	case "playlist":
+		return Resource{Kind: Playlist, ID: query.Get("list")}, nil
+	}
+
+	if len(segments) < 2 {
+		if handle.MatchString(segments[0]) {
+			return Resource{Kind: Channel, Handle: segments[0]}, nil
+		}
+		return Resource{}, ErrNotYouTube
+	}
+
+	switch segments[0] {
+	case "shorts":
+		return Resource{Kind: Short, ID: segments[1]}, nil
+	case "live":
+		return Resource{Kind: Live, ID: segments[1]}, nil
+	case "embed", "v", "e":
+		return Resource{Kind: Video, ID: segments[1]}, nil
+	case "channel":
+		if !channelID.MatchString(segments[1]) {
+			return Resource{}, fmt.Errorf("invalid channel ID %q", segments[1])
+		}
+		return Resource{Kind: Channel, ID: segments[1]}, nil
+	case "user", "c":
+		if !name.MatchString(segments[1]) {
+			return Resource{}, fmt.Errorf("invalid channel name %q", segments[1])
+		}
+		return Resource{Kind: Channel, Username: segments[1]}, nil
+	}
+
+	if handle.MatchString(segments[0]) {
+		// Channel tabs, like /@handle/videos.
+		return Resource{Kind: Channel, Handle: segments[0]}, nil
+	}
+
+	return Resource{}, ErrNotYouTube
+}
+
+// parseStart returns the timestamp of the t or start query parameters, or of a #t= fragment.
+// Timestamps are either seconds, like 90 or 90s, or a duration like 1h2m3s.
+func parseStart(query url.Values, fragment string) time.Duration {
+	value := query.Get("t")
+	if value == "" {
+		value = query.Get("start")
+	}
+	if value == "" {
+		value, _ = strings.CutPrefix(fragment, "t=")
+	}
+
+	m := timestamp.FindStringSubmatch(value)
+	if value == "" || m == nil {
+		return 0
+	}
+
+	var d time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		if n, err := strconv.Atoi(m[i+1]); err == nil {
+			d += time.Duration(n) * unit
+		}
+	}
+
+	return d
+}
+
+// URL returns the canonical URL of the resource.
+func (r Resource) URL() string {
+	switch r.Kind {
+	case Video, Short, Live:
+		q := url.Values{"v": {r.ID}}
+		if r.PlaylistID != "" {
+			q.Set("list", r.PlaylistID)
+		}
+		if r.Start > 0 {
+			q.Set("t", strconv.Itoa(int(r.Start.Seconds()))+"s")
+		}
+		if r.Kind == Short {
+			return "https://www.youtube.com/shorts/" + r.ID
+		}
+		return "https://www.youtube.com/watch?" + q.Encode()
+	case Playlist:
+		return "https://www.youtube.com/playlist?" + url.Values{"list": {r.ID}}.Encode()
+	case Channel:
+		switch {
+		case r.ID != "":
+			return "https://www.youtube.com/channel/" + r.ID
+		case r.Handle != "":
+			return "https://www.youtube.com/" + r.Handle
+		default:
+			return "https://www.youtube.com/user/" + r.Username
+		}
+	default:
+		return ""
+	}
+}
+
+// EmbedURL returns the URL of the embedded player of a video, starting at its timestamp.
+func (r Resource) EmbedURL() string {
+	switch r.Kind {
+	case Video, Short, Live:
+		u := "https://www.youtube.com/embed/" + r.ID
+		if r.Start > 0 {
+			u += "?start=" + strconv.Itoa(int(r.Start.Seconds()))
+		}
+		return u
+	default:
+		return ""
+	}
+}
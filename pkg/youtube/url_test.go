@@ -0,0 +1,136 @@
+package youtube
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		expected    Resource
+		expectError bool
+	}{
+		{
+			name:     "watch",
+			url:      "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+			expected: Resource{Kind: Video, ID: "dQw4w9WgXcQ"},
+		},
+		{
+			name:     "watch with timestamp in seconds",
+			url:      "https://youtube.com/watch?v=dQw4w9WgXcQ&t=90",
+			expected: Resource{Kind: Video, ID: "dQw4w9WgXcQ", Start: 90 * time.Second},
+		},
+		{
+			name:     "mobile watch with duration timestamp",
+			url:      "https://m.youtube.com/watch?v=dQw4w9WgXcQ&t=1h2m3s",
+			expected: Resource{Kind: Video, ID: "dQw4w9WgXcQ", Start: time.Hour + 2*time.Minute + 3*time.Second},
+		},
+		{
+			name:     "watch in a playlist with fragment timestamp",
+			url:      "https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI#t=42",
+			expected: Resource{Kind: Video, ID: "dQw4w9WgXcQ", PlaylistID: "PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI", Start: 42 * time.Second},
+		},
+		{
+			name:     "youtu.be with timestamp",
+			url:      "https://youtu.be/dQw4w9WgXcQ?si=share&t=75s",
+			expected: Resource{Kind: Video, ID: "dQw4w9WgXcQ", Start: 75 * time.Second},
+		},
+		{
+			name:     "shorts",
+			url:      "https://www.youtube.com/shorts/aqz-KE-bpKQ",
+			expected: Resource{Kind: Short, ID: "aqz-KE-bpKQ"},
+		},
+		{
+			name:     "live",
+			url:      "https://www.youtube.com/live/jfKfPfyJRdk?feature=share",
+			expected: Resource{Kind: Live, ID: "jfKfPfyJRdk"},
+		},
+		{
+			name:     "embed with start",
+			url:      "https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ?start=30",
+			expected: Resource{Kind: Video, ID: "dQw4w9WgXcQ", Start: 30 * time.Second},
+		},
+		{
+			name:     "playlist",
+			url:      "https://www.youtube.com/playlist?list=PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI",
+			expected: Resource{Kind: Playlist, ID: "PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI"},
+		},
+		{
+			name:     "channel ID",
+			url:      "https://www.youtube.com/channel/UC_x5XG1OV2P6uZZ5FSM9Ttw",
+			expected: Resource{Kind: Channel, ID: "UC_x5XG1OV2P6uZZ5FSM9Ttw"},
+		},
+		{
+			name:     "channel handle tab",
+			url:      "https://www.youtube.com/@GoogleDevelopers/videos",
+			expected: Resource{Kind: Channel, Handle: "@GoogleDevelopers"},
+		},
+		{
+			name:     "legacy channel name",
+			url:      "https://www.youtube.com/c/GoogleDevelopers",
+			expected: Resource{Kind: Channel, Username: "GoogleDevelopers"},
+		},
+		{name: "invalid video ID", url: "https://www.youtube.com/watch?v=short", expectError: true},
+		{name: "missing video ID", url: "https://youtu.be/", expectError: true},
+		{name: "not a resource", url: "https://www.youtube.com/feed/trending", expectError: true},
+		{name: "other host", url: "https://youtube.com.evil.example/watch?v=dQw4w9WgXcQ", expectError: true},
+		{name: "other scheme", url: "javascript://youtu.be/dQw4w9WgXcQ", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Parse(tt.url)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Parse() expected error, got %+v", res)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Parse() unexpected error: %v", err)
+			}
+
+			if res != tt.expected {
+				t.Errorf("Parse() = %+v, expected %+v", res, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResourceURL(t *testing.T) {
+	tests := []struct {
+		resource Resource
+		url      string
+		embed    string
+	}{
+		{
+			resource: Resource{Kind: Video, ID: "dQw4w9WgXcQ", Start: 90 * time.Second},
+			url:      "https://www.youtube.com/watch?t=90s&v=dQw4w9WgXcQ",
+			embed:    "https://www.youtube.com/embed/dQw4w9WgXcQ?start=90",
+		},
+		{
+			resource: Resource{Kind: Short, ID: "aqz-KE-bpKQ"},
+			url:      "https://www.youtube.com/shorts/aqz-KE-bpKQ",
+			embed:    "https://www.youtube.com/embed/aqz-KE-bpKQ",
+		},
+		{
+			resource: Resource{Kind: Channel, Handle: "@GoogleDevelopers"},
+			url:      "https://www.youtube.com/@GoogleDevelopers",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := tt.resource.URL(); got != tt.url {
+				t.Errorf("URL() = %v, expected %v", got, tt.url)
+			}
+			if got := tt.resource.EmbedURL(); got != tt.embed {
+				t.Errorf("EmbedURL() = %v, expected %v", got, tt.embed)
+			}
+		})
+	}
+}
@@ -0,0 +1,373 @@
+// Package youtube builds link previews of YouTube URLs from the oEmbed endpoint and the Data API,
+// since the watch pages served to datacenter IPs are often a cookie consent wall.
+package youtube
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/logging"
+	"github.com/danvergara/jumble-proxy-server/pkg/oembed"
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+	"github.com/danvergara/jumble-proxy-server/pkg/outbound"
+)
+
+const (
+	// DefaultAPIBaseURL is the base URL of the YouTube Data API.
+	DefaultAPIBaseURL = "https://www.googleapis.com/youtube/v3"
+	// DefaultOEmbedURL is the oEmbed endpoint of YouTube.
+	DefaultOEmbedURL = "https://www.youtube.com/oembed"
+
+	// maxResponseBytes caps the size of a Data API response.
+	maxResponseBytes = 1 << 20
+)
+
+// ErrNotFound is returned when the Data API does not know the resource, for example a deleted video.
+var ErrNotFound = errors.New("YouTube resource not found")
+
+// Options configures the client.
+type Options struct {
+	// HTTPClient sends the Data API and oEmbed requests. An outbound client is made when it is nil.
+	HTTPClient *http.Client
+	// APIKey is the Data API key. Without it previews only use the oEmbed endpoint, and channels are not supported.
+	APIKey string
+	// APIBaseURL defaults to DefaultAPIBaseURL.
+	APIBaseURL string
+	// OEmbedURL defaults to DefaultOEmbedURL.
+	OEmbedURL string
+}
+
+// Client builds previews of YouTube URLs.
+type Client struct {
+	client     *http.Client
+	apiKey     string
+	apiBaseURL string
+	oembedURL  string
+}
+
+func New(opts Options) *Client {
+	c := &Client{
+		client:     opts.HTTPClient,
+		apiKey:     opts.APIKey,
+		apiBaseURL: strings.TrimSuffix(opts.APIBaseURL, "/"),
+		oembedURL:  opts.OEmbedURL,
+	}
+
+	if c.client == nil {
+		c.client = outbound.NewClient(outbound.Options{})
+	}
+	if c.apiBaseURL == "" {
+		c.apiBaseURL = DefaultAPIBaseURL
+	}
+	if c.oembedURL == "" {
+		c.oembedURL = DefaultOEmbedURL
+	}
+
+	return c
+}
+
+// Match reports whether u is a YouTube URL the client can preview.
+func (c *Client) Match(u *url.URL) bool {
+	res, err := Parse(u.String())
+	if err != nil {
+		return false
+	}
+	return res.Kind != Channel || c.apiKey != ""
+}
+
+// Preview returns the head of the preview document of a YouTube URL.
+// The Data API is used when an API key is configured, falling back to the oEmbed endpoint for videos and playlists.
+func (c *Client) Preview(ctx context.Context, u *url.URL) (opengraph.Head, error) {
+	res, err := Parse(u.String())
+	if err != nil {
+		return opengraph.Head{}, err
+	}
+
+	if c.apiKey == "" {
+		return c.oembedHead(ctx, res)
+	}
+
+	var head opengraph.Head
+	switch res.Kind {
+	case Channel:
+		return c.channelHead(ctx, res)
+	case Playlist:
+		head, err = c.playlistHead(ctx, res)
+	default:
+		head, err = c.videoHead(ctx, res)
+	}
+
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		logging.FromContext(ctx).Warn(
+			"Failed to query the YouTube Data API, falling back to oEmbed",
+			slog.String("site", u.String()),
+			slog.Any("error", err),
+		)
+		return c.oembedHead(ctx, res)
+	}
+
+	return head, err
+}
+
+// oembedHead builds the preview of a video or playlist from the oEmbed endpoint.
+func (c *Client) oembedHead(ctx context.Context, res Resource) (opengraph.Head, error) {
+	if res.Kind == Channel {
+		return opengraph.Head{}, errors.New("YouTube channels need a Data API key")
+	}
+
+	provider := oembed.Provider{Name: "YouTube", Endpoint: c.oembedURL}
+	resp, err := oembed.Fetch(ctx, c.client, provider.EndpointURL(res.URL()))
+	if err != nil {
+		return opengraph.Head{}, err
+	}
+
+	head := newHead(res, resp.Title)
+	resp.Apply(&head)
+	head.SetMeta("og:site_name", "YouTube")
+
+	return head, nil
+}
+
+type thumbnail struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+type thumbnails struct {
+	Default  *thumbnail `json:"default"`
+	Medium   *thumbnail `json:"medium"`
+	High     *thumbnail `json:"high"`
+	Standard *thumbnail `json:"standard"`
+	Maxres   *thumbnail `json:"maxres"`
+}
+
+// best returns the largest thumbnail.
+func (t thumbnails) best() (thumbnail, bool) {
+	for _, th := range []*thumbnail{t.Maxres, t.Standard, t.High, t.Medium, t.Default} {
+		if th != nil && th.URL != "" {
+			return *th, true
+		}
+	}
+	return thumbnail{}, false
+}
+
+type snippet struct {
+	Title        string     `json:"title"`
+	Description  string     `json:"description"`
+	ChannelTitle string     `json:"channelTitle"`
+	Thumbnails   thumbnails `json:"thumbnails"`
+}
+
+// videoHead builds the preview of a video from the Data API.
+func (c *Client) videoHead(ctx context.Context, res Resource) (opengraph.Head, error) {
+	var resp struct {
+		Items []struct {
+			Snippet        snippet `json:"snippet"`
+			ContentDetails struct {
+				Duration string `json:"duration"`
+			} `json:"contentDetails"`
+			Statistics struct {
+				ViewCount string `json:"viewCount"`
+			} `json:"statistics"`
+		} `json:"items"`
+	}
+
+	params := url.Values{"part": {"snippet,contentDetails,statistics"}, "id": {res.ID}}
+	if err := c.query(ctx, "videos", params, &resp); err != nil {
+		return opengraph.Head{}, err
+	}
+	if len(resp.Items) == 0 {
+		return opengraph.Head{}, ErrNotFound
+	}
+	item := resp.Items[0]
+
+	head := newHead(res, item.Snippet.Title)
+	setSnippet(&head, item.Snippet)
+	head.SetMeta("oembed:type", oembed.TypeVideo)
+
+	if d, ok := parseISODuration(item.ContentDetails.Duration); ok && d > 0 {
+		head.SetMeta("video:duration", strconv.Itoa(int(d.Seconds())))
+		head.SetMeta("twitter:label1", "Duration")
+		head.SetMeta("twitter:data1", opengraph.FormatDuration(d))
+	}
+
+	if views, err := strconv.ParseInt(item.Statistics.ViewCount, 10, 64); err == nil {
+		head.SetMeta("twitter:label2", "Views")
+		head.SetMeta("twitter:data2", opengraph.FormatCount(views))
+	}
+
+	return head, nil
+}
+
+// playlistHead builds the preview of a playlist from the Data API.
+func (c *Client) playlistHead(ctx context.Context, res Resource) (opengraph.Head, error) {
+	var resp struct {
+		Items []struct {
+			Snippet        snippet `json:"snippet"`
+			ContentDetails struct {
+				ItemCount int64 `json:"itemCount"`
+			} `json:"contentDetails"`
+		} `json:"items"`
+	}
+
+	params := url.Values{"part": {"snippet,contentDetails"}, "id": {res.ID}}
+	if err := c.query(ctx, "playlists", params, &resp); err != nil {
+		return opengraph.Head{}, err
+	}
+	if len(resp.Items) == 0 {
+		return opengraph.Head{}, ErrNotFound
+	}
+	item := resp.Items[0]
+
+	head := newHead(res, item.Snippet.Title)
+	setSnippet(&head, item.Snippet)
+	head.SetMeta("twitter:label1", "Videos")
+	head.SetMeta("twitter:data1", opengraph.FormatCount(item.ContentDetails.ItemCount))
+
+	return head, nil
+}
+
+// channelHead builds the preview of a channel from the Data API.
+func (c *Client) channelHead(ctx context.Context, res Resource) (opengraph.Head, error) {
+	var resp struct {
+		Items []struct {
+			Snippet    snippet `json:"snippet"`
+			Statistics struct {
+				SubscriberCount       string `json:"subscriberCount"`
+				HiddenSubscriberCount bool   `json:"hiddenSubscriberCount"`
+				VideoCount            string `json:"videoCount"`
+			} `json:"statistics"`
+		} `json:"items"`
+	}
+
+	params := url.Values{"part": {"snippet,statistics"}}
+	switch {
+	case res.ID != "":
+		params.Set("id", res.ID)
+	case res.Handle != "":
+		params.Set("forHandle", res.Handle)
+	default:
+		params.Set("forUsername", res.Username)
+	}
+
+	if err := c.query(ctx, "channels", params, &resp); err != nil {
+		return opengraph.Head{}, err
+	}
+	if len(resp.Items) == 0 {
+		return opengraph.Head{}, ErrNotFound
+	}
+	item := resp.Items[0]
+
+	head := newHead(res, item.Snippet.Title)
+	// The author of a channel is the channel itself.
+	item.Snippet.ChannelTitle = item.Snippet.Title
+	setSnippet(&head, item.Snippet)
+
+	if subscribers, err := strconv.ParseInt(item.Statistics.SubscriberCount, 10, 64); err == nil &&
+		!item.Statistics.HiddenSubscriberCount {
+		head.SetMeta("twitter:label1", "Subscribers")
+		head.SetMeta("twitter:data1", opengraph.FormatCount(subscribers))
+	}
+
+	if videos, err := strconv.ParseInt(item.Statistics.VideoCount, 10, 64); err == nil {
+		head.SetMeta("twitter:label2", "Videos")
+		head.SetMeta("twitter:data2", opengraph.FormatCount(videos))
+	}
+
+	return head, nil
+}
+
+// query calls a Data API resource and decodes its response into v.
+func (c *Client) query(ctx context.Context, resource string, params url.Values, v any) error {
+	params.Set("key", c.apiKey)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiBaseURL+"/"+resource+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("YouTube Data API returned status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(v)
+}
+
+// newHead returns a head with the title and the properties every YouTube preview shares.
+func newHead(res Resource, title string) opengraph.Head {
+	head := opengraph.Head{Title: title, Charset: "utf-8"}
+
+	head.SetMeta("og:title", title)
+	head.SetMeta("og:site_name", "YouTube")
+	head.SetMeta("og:url", res.URL())
+
+	switch res.Kind {
+	case Channel:
+		head.SetMeta("og:type", "profile")
+	case Playlist:
+		head.SetMeta("og:type", "website")
+	default:
+		head.SetMeta("og:type", "video.other")
+		head.SetMeta("og:video:url", res.EmbedURL())
+		head.SetMeta("og:image", "https://i.ytimg.com/vi/"+res.ID+"/hqdefault.jpg")
+	}
+
+	return head
+}
+
+// setSnippet sets the description, channel and thumbnail of a Data API snippet.
+func setSnippet(head *opengraph.Head, s snippet) {
+	if description := opengraph.Truncate(strings.TrimSpace(s.Description), opengraph.MaxDescriptionLength); description != "" {
+		head.SetMeta("og:description", description)
+	}
+
+	if s.ChannelTitle != "" {
+		head.SetMeta("author", s.ChannelTitle)
+	}
+
+	if th, ok := s.Thumbnails.best(); ok {
+		head.SetMeta("og:image", th.URL)
+		head.SetMeta("og:image:width", opengraph.FormatPositive(th.Width))
+		head.SetMeta("og:image:height", opengraph.FormatPositive(th.Height))
+	}
+}
+
+var isoDuration = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseISODuration parses the ISO 8601 durations of the Data API, like PT1H2M3S.
+func parseISODuration(s string) (time.Duration, bool) {
+	m := isoDuration.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+
+	var d time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if n, err := strconv.Atoi(m[i+1]); err == nil {
+			d += time.Duration(n) * unit
+		}
+	}
+
+	return d, true
+}
@@ -0,0 +1,202 @@
+package youtube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/danvergara/jumble-proxy-server/pkg/opengraph"
+)
+
+func newFakeYouTube(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/oembed":
+			fmt.Fprintf(w, `{"type": "video", "version": "1.0", "title": "Title of %s", "author_name": "Rick",
+				"provider_name": "YouTube", "thumbnail_url": "https://i.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg",
+				"thumbnail_width": 480, "thumbnail_height": 360, "html": "<iframe></iframe>"}`, q.Get("url"))
+			return
+		}
+
+		if q.Get("key") != "secret" {
+			http.Error(w, `{"error": {"code": 403}}`, http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v3/videos":
+			if q.Get("id") != "dQw4w9WgXcQ" {
+				fmt.Fprint(w, `{"items": []}`)
+				return
+			}
+			fmt.Fprint(w, `{"items": [{
+				"snippet": {
+					"title": "Never Gonna Give You Up",
+					"description": "The official video",
+					"channelTitle": "Rick Astley",
+					"thumbnails": {
+						"high": {"url": "https://i.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg", "width": 480, "height": 360},
+						"maxres": {"url": "https://i.ytimg.com/vi/dQw4w9WgXcQ/maxresdefault.jpg", "width": 1280, "height": 720}
+					}
+				},
+				"contentDetails": {"duration": "PT3M33S"},
+				"statistics": {"viewCount": "1234567890"}
+			}]}`)
+		case "/v3/channels":
+			if q.Get("forHandle") != "@RickAstleyYT" {
+				fmt.Fprint(w, `{"items": []}`)
+				return
+			}
+			fmt.Fprint(w, `{"items": [{
+				"snippet": {
+					"title": "Rick Astley",
+					"description": "Official channel",
+					"thumbnails": {"default": {"url": "https://yt3.ggpht.com/avatar.jpg", "width": 88, "height": 88}}
+				},
+				"statistics": {"subscriberCount": "4200000", "videoCount": "321"}
+			}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestClientPreview(t *testing.T) {
+	srv := newFakeYouTube(t)
+
+	tests := []struct {
+		name     string
+		apiKey   string
+		url      string
+		expected opengraph.Metadata
+	}{
+		{
+			name:   "data API",
+			apiKey: "secret",
+			url:    "https://youtu.be/dQw4w9WgXcQ?t=42",
+			expected: opengraph.Metadata{
+				URL:         "https://www.youtube.com/watch?t=42s&v=dQw4w9WgXcQ",
+				Title:       "Never Gonna Give You Up",
+				Description: "The official video",
+				Image:       "https://i.ytimg.com/vi/dQw4w9WgXcQ/maxresdefault.jpg",
+				ImageWidth:  1280,
+				ImageHeight: 720,
+				SiteName:    "YouTube",
+				Type:        "video.other",
+				Author:      "Rick Astley",
+				Duration:    213,
+				EmbedType:   "video",
+			},
+		},
+		{
+			name: "oEmbed without an API key",
+			url:  "https://www.youtube.com/shorts/dQw4w9WgXcQ",
+			expected: opengraph.Metadata{
+				URL:         "https://www.youtube.com/shorts/dQw4w9WgXcQ",
+				Title:       "Title of https://www.youtube.com/shorts/dQw4w9WgXcQ",
+				Image:       "https://i.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg",
+				ImageWidth:  480,
+				ImageHeight: 360,
+				SiteName:    "YouTube",
+				Type:        "video.other",
+				Author:      "Rick",
+				EmbedType:   "video",
+			},
+		},
+		{
+			name:   "oEmbed fallback when the API refuses the key",
+			apiKey: "revoked",
+			url:    "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+			expected: opengraph.Metadata{
+				URL:         "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+				Title:       "Title of https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+				Image:       "https://i.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg",
+				ImageWidth:  480,
+				ImageHeight: 360,
+				SiteName:    "YouTube",
+				Type:        "video.other",
+				Author:      "Rick",
+				EmbedType:   "video",
+			},
+		},
+		{
+			name:   "channel",
+			apiKey: "secret",
+			url:    "https://www.youtube.com/@RickAstleyYT",
+			expected: opengraph.Metadata{
+				URL:         "https://www.youtube.com/@RickAstleyYT",
+				Title:       "Rick Astley",
+				Description: "Official channel",
+				Image:       "https://yt3.ggpht.com/avatar.jpg",
+				ImageWidth:  88,
+				ImageHeight: 88,
+				SiteName:    "YouTube",
+				Type:        "profile",
+				Author:      "Rick Astley",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(Options{
+				HTTPClient: srv.Client(),
+				APIKey:     tt.apiKey,
+				APIBaseURL: srv.URL + "/v3",
+				OEmbedURL:  srv.URL + "/oembed",
+			})
+
+			u, _ := url.Parse(tt.url)
+			if !c.Match(u) {
+				t.Fatalf("Match() = false, expected true")
+			}
+
+			head, err := c.Preview(context.Background(), u)
+			if err != nil {
+				t.Fatalf("Preview() unexpected error: %v", err)
+			}
+
+			if md := head.Metadata(); md != tt.expected {
+				t.Errorf("Preview() metadata = %+v, expected %+v", md, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClientPreviewNotFound(t *testing.T) {
+	srv := newFakeYouTube(t)
+	c := New(Options{HTTPClient: srv.Client(), APIKey: "secret", APIBaseURL: srv.URL + "/v3"})
+
+	u, _ := url.Parse("https://www.youtube.com/watch?v=xxxxxxxxxxx")
+	if _, err := c.Preview(context.Background(), u); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Preview() error = %v, expected ErrNotFound", err)
+	}
+}
+
+func TestClientMatchChannelNeedsAPIKey(t *testing.T) {
+	u, _ := url.Parse("https://www.youtube.com/@RickAstleyYT")
+
+	if New(Options{}).Match(u) {
+		t.Errorf("Match() = true, expected channels to be left to the generic proxy without an API key")
+	}
+}
+
+func TestParseISODuration(t *testing.T) {
+	d, ok := parseISODuration("P1DT2H3M4S")
+	if !ok || d != 26*time.Hour+3*time.Minute+4*time.Second {
+		t.Errorf("parseISODuration() = %v, %v, expected 26h3m4s", d, ok)
+	}
+}